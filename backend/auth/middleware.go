@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"kakeibo-backend/models"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	contextKeyUser    = "auth.user"
+	contextKeySession = "auth.session"
+)
+
+// Middleware は Authorization: Bearer <token> を検証し、
+// 認証済みユーザーを echo.Context に格納する
+func Middleware(s *Service) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" {
+				return c.JSON(http.StatusUnauthorized, "missing bearer token")
+			}
+			user, session, err := s.Authenticate(token)
+			if err != nil {
+				if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrSessionRevoked) {
+					return c.JSON(http.StatusUnauthorized, err.Error())
+				}
+				return c.JSON(http.StatusInternalServerError, err.Error())
+			}
+			SetCurrentUser(c, user, session)
+			return next(c)
+		}
+	}
+}
+
+// SetCurrentUser は認証済みユーザーを格納する (テストからも利用)
+func SetCurrentUser(c echo.Context, user *models.User, session *models.Session) {
+	c.Set(contextKeyUser, user)
+	c.Set(contextKeySession, session)
+}
+
+// CurrentUser は認証済みユーザーを返す。未認証なら nil
+func CurrentUser(c echo.Context) *models.User {
+	user, _ := c.Get(contextKeyUser).(*models.User)
+	return user
+}
+
+// CurrentUserID は認証済みユーザーのIDを返す。未認証なら uuid.Nil
+func CurrentUserID(c echo.Context) uuid.UUID {
+	if user := CurrentUser(c); user != nil {
+		return user.ID
+	}
+	return uuid.Nil
+}
+
+// CurrentSession は現在のリクエストのセッションを返す。未認証なら nil
+func CurrentSession(c echo.Context) *models.Session {
+	session, _ := c.Get(contextKeySession).(*models.Session)
+	return session
+}
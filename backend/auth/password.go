@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptは72バイトを超える入力を黙って切り捨てるため事前に弾く
+const maxPasswordBytes = 72
+
+const minPasswordLength = 8
+
+var (
+	ErrPasswordTooShort = errors.New("password must be at least 8 characters")
+	ErrPasswordTooLong  = errors.New("password must be at most 72 bytes")
+)
+
+// HashPassword はパスワードをbcryptでハッシュ化する
+func HashPassword(plain string) (string, error) {
+	if len([]rune(plain)) < minPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	if len(plain) > maxPasswordBytes {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword はハッシュと平文が一致するか確認する
+func CheckPassword(hash, plain string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain)) == nil
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"errors"
+	"kakeibo-backend/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrSessionRevoked     = errors.New("session revoked or expired")
+)
+
+// ユーザーが存在しない場合もbcryptの比較を行い、応答時間の差でメールアドレスの存在が分からないようにする
+var dummyHash, _ = HashPassword("dummy-password-for-timing")
+
+// TokenPair ログイン・リフレッシュ時のレスポンス
+type TokenPair struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Service はログイン・セッション管理を行う
+type Service struct {
+	DB     *gorm.DB
+	Tokens *TokenIssuer
+}
+
+// NormalizeEmail はメールアドレスの前後の空白を除き、小文字にそろえる
+// 登録・変更時とログイン時で同じ形にするため、メールアドレスを保存・検索する前に必ず通す
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Login はメールアドレスとパスワードを検証し、新しいセッションを発行する
+// 小文字にそろえる前に登録されたユーザーもログインできるよう、大文字・小文字を区別せずに探す
+func (s *Service) Login(email, password, userAgent string) (*TokenPair, error) {
+	var user models.User
+	err := s.DB.First(&user, "LOWER(email) = ?", NormalizeEmail(email)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		CheckPassword(dummyHash, password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !CheckPassword(user.Password, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	refresh, err := NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	session := models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: HashRefreshToken(refresh),
+		ExpiresAt:        s.Tokens.now().Add(s.Tokens.RefreshTTL),
+		UserAgent:        userAgent,
+	}
+	if err := s.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return s.issue(user.ID, session.ID, refresh)
+}
+
+// Refresh はリフレッシュトークンをローテーションし、新しいトークンを返す
+// 使用済みのリフレッシュトークンは以後使えない
+func (s *Service) Refresh(refreshToken string) (*TokenPair, error) {
+	var pair *TokenPair
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		err := tx.First(&session, "refresh_token_hash = ?", HashRefreshToken(refreshToken)).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionRevoked
+		}
+		if err != nil {
+			return err
+		}
+		if !s.active(&session) {
+			return ErrSessionRevoked
+		}
+
+		next, err := NewRefreshToken()
+		if err != nil {
+			return err
+		}
+		// 旧ハッシュを条件に更新し、同じトークンの同時使用は片方だけ成功させる
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND refresh_token_hash = ?", session.ID, session.RefreshTokenHash).
+			Updates(map[string]interface{}{
+				"refresh_token_hash": HashRefreshToken(next),
+				"expires_at":         s.Tokens.now().Add(s.Tokens.RefreshTTL),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSessionRevoked
+		}
+		pair, err = s.issue(session.UserID, session.ID, next)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Logout はセッションを失効させる
+// 失効したセッションに紐づくアクセストークンも Authenticate で拒否される
+func (s *Service) Logout(sessionID uuid.UUID) error {
+	now := s.Tokens.now()
+	return s.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", &now).Error
+}
+
+// RevokeAll はユーザーの全セッションを失効させる (パスワード変更時など)
+func (s *Service) RevokeAll(userID uuid.UUID) error {
+	now := s.Tokens.now()
+	return s.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", &now).Error
+}
+
+// Authenticate はアクセストークンを検証し、ユーザーとセッションを返す
+func (s *Service) Authenticate(accessToken string) (*models.User, *models.Session, error) {
+	userID, sessionID, err := s.Tokens.ParseAccessToken(accessToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	var session models.Session
+	if err := s.DB.First(&session, "id = ? AND user_id = ?", sessionID, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrSessionRevoked
+		}
+		return nil, nil, err
+	}
+	if !s.active(&session) {
+		return nil, nil, ErrSessionRevoked
+	}
+	var user models.User
+	if err := s.DB.First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	return &user, &session, nil
+}
+
+func (s *Service) active(session *models.Session) bool {
+	return session.RevokedAt == nil && s.Tokens.now().Before(session.ExpiresAt)
+}
+
+func (s *Service) issue(userID, sessionID uuid.UUID, refresh string) (*TokenPair, error) {
+	access, expiresAt, err := s.Tokens.IssueAccessToken(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+	}, nil
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"errors"
+	"kakeibo-backend/models"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestService(t *testing.T) (*Service, models.User) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.Session{}); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: hash}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &Service{DB: db, Tokens: NewTokenIssuer([]byte("test-secret"))}, user
+}
+
+// TestHashPassword はハッシュ化と検証のテスト
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "password123" {
+		t.Error("password should not be stored verbatim")
+	}
+	if !CheckPassword(hash, "password123") {
+		t.Error("correct password should match")
+	}
+	if CheckPassword(hash, "password124") {
+		t.Error("wrong password should not match")
+	}
+	if _, err := HashPassword("short"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Errorf("expected ErrPasswordTooShort, got %v", err)
+	}
+}
+
+// TestLoginAndAuthenticate はログインからトークン検証までのテスト
+func TestLoginAndAuthenticate(t *testing.T) {
+	s, user := newTestService(t)
+
+	if _, err := s.Login(user.Email, "wrong password", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := s.Login("nobody@example.com", "correct horse", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+
+	pair, err := s.Login(user.Email, "correct horse", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := s.Authenticate(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("authenticated user = %s, want %s", got.ID, user.ID)
+	}
+
+	// 別の鍵で署名されたトークンは拒否
+	other := &Service{DB: s.DB, Tokens: NewTokenIssuer([]byte("other-secret"))}
+	if _, _, err := other.Authenticate(pair.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+// TestRefreshRotation は使用済みリフレッシュトークンが再利用できないことのテスト
+func TestRefreshRotation(t *testing.T) {
+	s, user := newTestService(t)
+	pair, err := s.Login(user.Email, "correct horse", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := s.Refresh(pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.RefreshToken == pair.RefreshToken {
+		t.Error("refresh token should rotate")
+	}
+	if _, err := s.Refresh(pair.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("reused refresh token: expected ErrSessionRevoked, got %v", err)
+	}
+	if _, err := s.Refresh(next.RefreshToken); err != nil {
+		t.Errorf("rotated refresh token should work: %v", err)
+	}
+}
+
+// TestLogout はログアウト後に両トークンが無効になることのテスト
+func TestLogout(t *testing.T) {
+	s, user := newTestService(t)
+	pair, err := s.Login(user.Email, "correct horse", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, session, err := s.Authenticate(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Logout(session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Authenticate(pair.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("access token after logout: expected ErrSessionRevoked, got %v", err)
+	}
+	if _, err := s.Refresh(pair.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("refresh token after logout: expected ErrSessionRevoked, got %v", err)
+	}
+}
+
+// TestExpiredAccessToken は期限切れトークンが拒否されることのテスト
+func TestExpiredAccessToken(t *testing.T) {
+	s, user := newTestService(t)
+	pair, err := s.Login(user.Email, "correct horse", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Tokens.now = func() time.Time { return time.Now().Add(DefaultAccessTTL + time.Minute) }
+	if _, _, err := s.Authenticate(pair.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// AccessClaims アクセストークンのクレーム
+// Subject にユーザーID、SessionID に発行元セッションを入れる
+type AccessClaims struct {
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// TokenIssuer はHS256で署名したアクセストークンを発行・検証する
+type TokenIssuer struct {
+	secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewTokenIssuer は新しいTokenIssuerを作成
+func NewTokenIssuer(secret []byte) *TokenIssuer {
+	return &TokenIssuer{
+		secret:     secret,
+		AccessTTL:  DefaultAccessTTL,
+		RefreshTTL: DefaultRefreshTTL,
+		now:        time.Now,
+	}
+}
+
+// IssueAccessToken はアクセストークンと有効期限を返す
+func (ti *TokenIssuer) IssueAccessToken(userID, sessionID uuid.UUID) (string, time.Time, error) {
+	now := ti.now()
+	expiresAt := now.Add(ti.AccessTTL)
+	claims := AccessClaims{
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ti.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("sign access token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken は署名と有効期限を検証し、ユーザーIDとセッションIDを返す
+func (ti *TokenIssuer) ParseAccessToken(token string) (userID, sessionID uuid.UUID, err error) {
+	claims := &AccessClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return ti.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(ti.now),
+	)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, ErrInvalidToken
+	}
+	if userID, err = uuid.Parse(claims.Subject); err != nil {
+		return uuid.Nil, uuid.Nil, ErrInvalidToken
+	}
+	if sessionID, err = uuid.Parse(claims.SessionID); err != nil {
+		return uuid.Nil, uuid.Nil, ErrInvalidToken
+	}
+	return userID, sessionID, nil
+}
+
+// NewRefreshToken はランダムなリフレッシュトークンを生成する
+// 平文はクライアントへ返し、DBには HashRefreshToken の結果だけを保存する
+func NewRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashRefreshToken はリフレッシュトークンの保存用ハッシュを返す
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,271 @@
+package billing
+
+import (
+	"kakeibo-backend/models"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var jst = time.FixedZone("Asia/Tokyo", 9*60*60)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, jst)
+}
+
+// TestNextBillingDate は請求サイクルごとの次回請求日のテスト
+func TestNextBillingDate(t *testing.T) {
+	tests := []struct {
+		name  string
+		due   time.Time
+		cycle string
+		days  uint
+		day   int
+		want  time.Time
+	}{
+		{"monthly", date(2026, 4, 10), models.CycleMonthly, 0, 10, date(2026, 5, 10)},
+		{"monthly clamps to month end", date(2026, 1, 31), models.CycleMonthly, 0, 31, date(2026, 2, 28)},
+		{"monthly returns to anchor day", date(2026, 2, 28), models.CycleMonthly, 0, 31, date(2026, 3, 31)},
+		{"monthly leap year", date(2028, 1, 30), models.CycleMonthly, 0, 30, date(2028, 2, 29)},
+		{"monthly over year end", date(2026, 12, 15), models.CycleMonthly, 0, 15, date(2027, 1, 15)},
+		{"yearly", date(2026, 6, 1), models.CycleYearly, 0, 1, date(2027, 6, 1)},
+		{"yearly from leap day", date(2028, 2, 29), models.CycleYearly, 0, 29, date(2029, 2, 28)},
+		{"yearly back to leap day", date(2031, 2, 28), models.CycleYearly, 0, 29, date(2032, 2, 29)},
+		{"days", date(2026, 4, 25), models.CycleDays, 14, 0, date(2026, 5, 9)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextBillingDate(tt.due, tt.cycle, tt.days, tt.day)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+
+	if _, err := NextBillingDate(date(2026, 4, 1), models.CycleDays, 0, 0); err == nil {
+		t.Error("days cycle without cycle days should fail")
+	}
+	if _, err := NextBillingDate(date(2026, 4, 1), "weekly", 0, 0); err == nil {
+		t.Error("unknown cycle should fail")
+	}
+}
+
+func newTestEngine(t *testing.T, now time.Time) (*Engine, models.User, models.Category) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.Category{}, &models.Subscription{}, &models.Expense{}, &models.DuplicateCandidate{}); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	category := models.Category{Name: "サブスク"}
+	for _, v := range []interface{}{&user, &category} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Engine{DB: db, Now: func() time.Time { return now }}, user, category
+}
+
+// TestEngineRun は請求日を過ぎた分だけ計上し、2回目の実行では何もしないことのテスト
+func TestEngineRun(t *testing.T) {
+	now := date(2026, 4, 15)
+	e, user, category := newTestEngine(t, now)
+
+	netflix := models.Subscription{
+		Name: "Netflix", MonthlyFee: 1490, BillingCycle: models.CycleMonthly, BillingDay: 31,
+		NextBillingDate: date(2026, 1, 31), IsActive: true, UserID: user.ID, CategoryID: category.ID,
+	}
+	future := models.Subscription{
+		Name: "Future", MonthlyFee: 500, BillingCycle: models.CycleMonthly,
+		NextBillingDate: date(2026, 5, 1), IsActive: true, UserID: user.ID, CategoryID: category.ID,
+	}
+	inactive := models.Subscription{
+		Name: "Cancelled", MonthlyFee: 980, BillingCycle: models.CycleMonthly,
+		NextBillingDate: date(2026, 1, 1), IsActive: false, UserID: user.ID, CategoryID: category.ID,
+	}
+	for _, s := range []*models.Subscription{&netflix, &future, &inactive} {
+		if err := e.DB.Create(s).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := e.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1/31, 2/28, 3/31 の3回分
+	if res.Charges != 3 || res.Subscriptions != 1 {
+		t.Fatalf("result = %+v, want 3 charges for 1 subscription", res)
+	}
+
+	var expenses []models.Expense
+	if err := e.DB.Order("spent_at").Find(&expenses).Error; err != nil {
+		t.Fatal(err)
+	}
+	wantDates := []time.Time{date(2026, 1, 31), date(2026, 2, 28), date(2026, 3, 31)}
+	if len(expenses) != len(wantDates) {
+		t.Fatalf("got %d expenses, want %d", len(expenses), len(wantDates))
+	}
+	for i, exp := range expenses {
+		if !exp.SpentAt.Equal(wantDates[i]) {
+			t.Errorf("expense %d spent_at = %s, want %s", i, exp.SpentAt, wantDates[i])
+		}
+		if exp.Amount != 1490 || exp.CategoryID != category.ID || exp.UserID != user.ID {
+			t.Errorf("unexpected expense: %+v", exp)
+		}
+		if exp.SubscriptionID == nil || *exp.SubscriptionID != netflix.ID {
+			t.Errorf("expense should link to subscription: %+v", exp.SubscriptionID)
+		}
+	}
+
+	var updated models.Subscription
+	if err := e.DB.First(&updated, "id = ?", netflix.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !updated.NextBillingDate.Equal(date(2026, 4, 30)) {
+		t.Errorf("next_billing_date = %s, want 2026-04-30", updated.NextBillingDate)
+	}
+
+	// 2回目は何も計上しない
+	res, err = e.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Charges != 0 {
+		t.Errorf("second run booked %d charges", res.Charges)
+	}
+}
+
+// TestEngineSkipsAlreadyBooked は同じ請求日の支出が既にあれば計上しないことのテスト
+// (前回の実行が NextBillingDate を更新する前に停止した場合など)
+func TestEngineSkipsAlreadyBooked(t *testing.T) {
+	e, user, category := newTestEngine(t, date(2026, 4, 15))
+	sub := models.Subscription{
+		Name: "Spotify", MonthlyFee: 980, BillingCycle: models.CycleDays, BillingCycleDays: 30,
+		NextBillingDate: date(2026, 4, 1), IsActive: true, UserID: user.ID, CategoryID: category.ID,
+	}
+	if err := e.DB.Create(&sub).Error; err != nil {
+		t.Fatal(err)
+	}
+	existing := models.Expense{
+		Amount: 980, Description: "Spotify", SpentAt: sub.NextBillingDate,
+		UserID: user.ID, CategoryID: category.ID, SubscriptionID: &sub.ID,
+	}
+	if err := e.DB.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := e.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Charges != 0 {
+		t.Errorf("booked %d charges, want 0", res.Charges)
+	}
+	var count int64
+	e.DB.Model(&models.Expense{}).Count(&count)
+	if count != 1 {
+		t.Errorf("expense count = %d, want 1", count)
+	}
+	var updated models.Subscription
+	e.DB.First(&updated, "id = ?", sub.ID)
+	if !updated.NextBillingDate.Equal(date(2026, 5, 1)) {
+		t.Errorf("next_billing_date = %s, want 2026-05-01", updated.NextBillingDate)
+	}
+}
+
+// TestEngineFlagsDuplicate は手入力した支出と同じ請求を計上した場合に重複の候補にすることのテスト
+// 同じサブスクリプションの別の請求日の支出は候補にしない
+func TestEngineFlagsDuplicate(t *testing.T) {
+	e, user, category := newTestEngine(t, date(2026, 4, 15))
+	netflix := models.Subscription{
+		Name: "Netflix", MonthlyFee: 1490, BillingCycle: models.CycleMonthly,
+		NextBillingDate: date(2026, 4, 10), IsActive: true, UserID: user.ID, CategoryID: category.ID,
+	}
+	daily := models.Subscription{
+		Name: "日替わり", MonthlyFee: 100, BillingCycle: models.CycleDays, BillingCycleDays: 1,
+		NextBillingDate: date(2026, 4, 13), IsActive: true, UserID: user.ID, CategoryID: category.ID,
+	}
+	for _, s := range []*models.Subscription{&netflix, &daily} {
+		if err := e.DB.Create(s).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	manual := models.Expense{Amount: 1490, Description: "NETFLIX.COM", SpentAt: date(2026, 4, 11), UserID: user.ID, CategoryID: category.ID}
+	if err := e.DB.Create(&manual).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := e.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Charges != 4 {
+		t.Fatalf("result = %+v, want 4 charges", res)
+	}
+	var candidates []models.DuplicateCandidate
+	if err := e.DB.Find(&candidates).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 {
+		t.Fatalf("got %d candidates, want 1: %+v", len(candidates), candidates)
+	}
+	var billed models.Expense
+	if err := e.DB.First(&billed, "subscription_id = ?", netflix.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	c := candidates[0]
+	if c.ExpenseID != billed.ID || c.DuplicateOfID != manual.ID || c.Status != models.DuplicatePending || c.UserID != user.ID {
+		t.Errorf("unexpected candidate: %+v", c)
+	}
+}
+
+// TestEngineContinuesAfterFailure は1件の計上に失敗しても残りのサブスクリプションを計上することのテスト
+func TestEngineContinuesAfterFailure(t *testing.T) {
+	e, user, category := newTestEngine(t, date(2026, 4, 15))
+	broken := models.Subscription{
+		Name: "Broken", MonthlyFee: 300, BillingCycle: "weekly",
+		NextBillingDate: date(2026, 4, 1), IsActive: true, UserID: user.ID, CategoryID: category.ID,
+	}
+	good := models.Subscription{
+		Name: "Spotify", MonthlyFee: 980, BillingCycle: models.CycleMonthly,
+		NextBillingDate: date(2026, 4, 10), IsActive: true, UserID: user.ID, CategoryID: category.ID,
+	}
+	for _, s := range []*models.Subscription{&broken, &good} {
+		if err := e.DB.Create(s).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := e.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Failed != 1 || res.Subscriptions != 1 || res.Charges != 1 {
+		t.Errorf("result = %+v, want 1 failed and 1 charge", res)
+	}
+	var expenses []models.Expense
+	e.DB.Find(&expenses)
+	if len(expenses) != 1 || expenses[0].SubscriptionID == nil || *expenses[0].SubscriptionID != good.ID {
+		t.Errorf("unexpected expenses: %+v", expenses)
+	}
+	// 失敗した分は計上も次回請求日の更新もしない (トランザクションごと戻す)
+	var updated models.Subscription
+	e.DB.First(&updated, "id = ?", broken.ID)
+	if !updated.NextBillingDate.Equal(broken.NextBillingDate) {
+		t.Errorf("broken next_billing_date = %s, want unchanged", updated.NextBillingDate)
+	}
+}
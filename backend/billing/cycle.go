@@ -0,0 +1,43 @@
+package billing
+
+import (
+	"fmt"
+	"kakeibo-backend/models"
+	"time"
+)
+
+// NextBillingDate は due の次の請求日を返す
+// monthly / yearly は billingDay 日に合わせ、その月に存在しない日は月末に丸める
+// (1/31 → 2/28 → 3/31 のように、丸めた後も元の日付に戻る)
+func NextBillingDate(due time.Time, cycle string, cycleDays uint, billingDay int) (time.Time, error) {
+	switch cycle {
+	case models.CycleMonthly, "":
+		return addMonthsClamped(due, 1, billingDay), nil
+	case models.CycleYearly:
+		return addMonthsClamped(due, 12, billingDay), nil
+	case models.CycleDays:
+		if cycleDays == 0 {
+			return time.Time{}, fmt.Errorf("billing_cycle_days must be positive for %q cycle", models.CycleDays)
+		}
+		return due.AddDate(0, 0, int(cycleDays)), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown billing cycle %q", cycle)
+}
+
+// addMonthsClamped は t の months か月後の day 日を返す (時刻とタイムゾーンは t のまま)
+func addMonthsClamped(t time.Time, months, day int) time.Time {
+	if day <= 0 {
+		day = t.Day()
+	}
+	// 1日を基準に月を進めてから日を決める (time.AddDate は 1/31 + 1か月 を 3/3 にしてしまう)
+	first := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	target := first.AddDate(0, months, 0)
+	if last := daysIn(target.Year(), target.Month()); day > last {
+		day = last
+	}
+	return target.AddDate(0, 0, day-1)
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,152 @@
+// Package billing はサブスクリプションの請求日を進め、支出として計上する
+package billing
+
+import (
+	"context"
+	"errors"
+	"kakeibo-backend/duplicate"
+	"kakeibo-backend/models"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 長期間停止していた場合でも1回の実行で無制限に計上しないための上限
+const maxChargesPerRun = 120
+
+// errConcurrentUpdate は別の実行が先に同じサブスクリプションを処理したことを表す
+var errConcurrentUpdate = errors.New("subscription was updated concurrently")
+
+// Result は1回の実行結果
+type Result struct {
+	Subscriptions int // 処理したサブスクリプション数
+	Charges       int // 新たに計上した支出数
+	Failed        int // 計上に失敗したサブスクリプション数 (次回の実行でやり直す)
+}
+
+// Engine は請求日を過ぎた有効なサブスクリプションを計上する
+//
+// 同じ請求日の支出は (subscription_id, spent_at) の一意制約で1件に限られ、
+// NextBillingDate の更新は読み込み時の値を条件に行うため、
+// 複数回・並行して実行しても二重に計上されない。
+type Engine struct {
+	DB  *gorm.DB
+	Now func() time.Time
+}
+
+// Run は now 時点で請求日を過ぎたサブスクリプションをすべて計上する
+// 1件の計上に失敗しても (請求サイクルが不正など) ログに残して残りのサブスクリプションを計上する
+func (e *Engine) Run() (Result, error) {
+	now := e.now()
+	var due []models.Subscription
+	if err := e.DB.
+		Where("is_active = ? AND next_billing_date <= ?", true, now).
+		Order("next_billing_date ASC").
+		Find(&due).Error; err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	for _, sub := range due {
+		charges, err := e.bill(sub, now)
+		if errors.Is(err, errConcurrentUpdate) {
+			continue
+		}
+		if err != nil {
+			log.Printf("billing: subscription %s: %v", sub.ID, err)
+			result.Failed++
+			continue
+		}
+		result.Subscriptions++
+		result.Charges += charges
+	}
+	return result, nil
+}
+
+// Start は interval ごとに Run を実行する。ctx がキャンセルされるまで戻らない
+func (e *Engine) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if res, err := e.Run(); err != nil {
+			log.Printf("billing: %v", err)
+		} else if res.Charges > 0 || res.Failed > 0 {
+			log.Printf("billing: booked %d charges for %d subscriptions (%d failed)", res.Charges, res.Subscriptions, res.Failed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// bill は1件のサブスクリプションについて now までの請求をまとめて計上する
+func (e *Engine) bill(sub models.Subscription, now time.Time) (int, error) {
+	billingDay := int(sub.BillingDay)
+	if billingDay == 0 {
+		billingDay = sub.NextBillingDate.Day()
+	}
+
+	charges := 0
+	err := e.DB.Transaction(func(tx *gorm.DB) error {
+		due := sub.NextBillingDate
+		for !due.After(now) && charges < maxChargesPerRun {
+			subscriptionID := sub.ID
+			expense := models.Expense{
+				Amount:         int(sub.MonthlyFee),
+				Description:    sub.Name,
+				SpentAt:        due,
+				UserID:         sub.UserID,
+				CategoryID:     sub.CategoryID,
+				SubscriptionID: &subscriptionID,
+			}
+			expense.ID = uuid.New()
+			res := tx.Omit("Category").Clauses(clause.OnConflict{DoNothing: true}).Create(&expense)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 1 {
+				charges++
+				// 手入力や取り込みで同じ請求を既に登録していれば重複の候補にする
+				if _, err := (&duplicate.Detector{}).Flag(tx, expense); err != nil {
+					return err
+				}
+			}
+
+			next, err := NextBillingDate(due, sub.BillingCycle, sub.BillingCycleDays, billingDay)
+			if err != nil {
+				return err
+			}
+			due = next
+		}
+
+		res := tx.Model(&models.Subscription{}).
+			Where("id = ? AND next_billing_date = ?", sub.ID, sub.NextBillingDate).
+			Updates(map[string]interface{}{
+				"next_billing_date": due,
+				"billing_day":       billingDay,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errConcurrentUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return charges, nil
+}
+
+func (e *Engine) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,177 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kakeibo-backend/models"
+	"kakeibo-backend/notify"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RunResult は1回の実行結果
+type RunResult struct {
+	Sent   int
+	Failed int
+}
+
+// Alerter は今月の予算の使用率が AlertThresholds を超えたら通知する
+//
+// 送信前に BudgetAlert を (budget_id, month, threshold) の一意制約付きで作成して送信権を確保するため、
+// 何度実行しても、複数プロセスで実行しても、同じ月の同じしきい値を二度通知しない。
+// 一度に複数のしきい値を超えた場合は、最も高いしきい値の通知を1件だけ送る。
+// 送信に失敗した場合は記録を消し、次回の実行で再送する。
+type Alerter struct {
+	DB       *gorm.DB
+	Notifier notify.Notifier
+	Now      func() time.Time
+}
+
+// Run は予算のある全ユーザーの今月の使用率を確認する
+func (a *Alerter) Run(ctx context.Context) (RunResult, error) {
+	now := a.now()
+	var userIDs []uuid.UUID
+	if err := a.DB.Model(&models.Budget{}).Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		return RunResult{}, err
+	}
+
+	var result RunResult
+	calc := Calculator{DB: a.DB, Now: a.Now}
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		var user models.User
+		if err := a.DB.First(&user, "id = ?", userID).Error; err != nil {
+			log.Printf("budget: load user %s: %v", userID, err)
+			result.Failed++
+			continue
+		}
+		progress, err := calc.Calculate(userID, now)
+		if err != nil {
+			log.Printf("budget: calculate user %s: %v", userID, err)
+			result.Failed++
+			continue
+		}
+		for _, p := range progress {
+			sent, err := a.alert(ctx, user, p, now)
+			if err != nil {
+				log.Printf("budget: alert budget %s: %v", p.Budget.ID, err)
+				result.Failed++
+				continue
+			}
+			if sent {
+				result.Sent++
+			}
+		}
+	}
+	return result, nil
+}
+
+// Start は interval ごとに Run を実行する。ctx がキャンセルされるまで戻らない
+func (a *Alerter) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if res, err := a.Run(ctx); err != nil {
+			log.Printf("budget: %v", err)
+		} else if res.Sent > 0 || res.Failed > 0 {
+			log.Printf("budget: sent %d alerts (%d failed)", res.Sent, res.Failed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// alert は p が新たに超えたしきい値があれば通知する。送る必要がなければ false を返す
+func (a *Alerter) alert(ctx context.Context, user models.User, p Progress, now time.Time) (bool, error) {
+	var claimed []models.BudgetAlert
+	for _, threshold := range Thresholds(p.Budget) {
+		if p.Percent < float64(threshold) {
+			break
+		}
+		entry := models.BudgetAlert{
+			BudgetID:  p.Budget.ID,
+			Month:     p.Month,
+			Threshold: threshold,
+			Percent:   p.Percent,
+			SentAt:    now,
+			UserID:    user.ID,
+		}
+		res := a.DB.Omit("User").Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+		if res.Error != nil {
+			return false, errors.Join(res.Error, a.release(claimed))
+		}
+		if res.RowsAffected == 1 {
+			claimed = append(claimed, entry)
+		}
+	}
+	if len(claimed) == 0 {
+		return false, nil
+	}
+
+	msg := BuildMessage(p, claimed[len(claimed)-1].Threshold)
+	if err := a.Notifier.Notify(ctx, user, msg); err != nil {
+		return false, errors.Join(err, a.release(claimed))
+	}
+	return true, nil
+}
+
+// release は送信できなかった通知の記録を消す
+func (a *Alerter) release(claimed []models.BudgetAlert) error {
+	var errs []error
+	for i := range claimed {
+		if err := a.DB.Unscoped().Delete(&claimed[i]).Error; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// BuildMessage は予算の使用率の通知を作る
+func BuildMessage(p Progress, threshold int) notify.Message {
+	name := p.Budget.Category.Name
+	month := int(p.Month.Month())
+	subject := fmt.Sprintf("【家計簿】%d月の%sの予算の%d%%を使いました", month, name, threshold)
+	if threshold >= 100 && p.Remaining < 0 {
+		subject = fmt.Sprintf("【家計簿】%d月の%sの予算を超えました", month, name)
+	} else if threshold >= 100 {
+		subject = fmt.Sprintf("【家計簿】%d月の%sの予算を使い切りました", month, name)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d月の%sの予算 %s のうち %s (%.1f%%) を使いました。\n",
+		month, name, formatYen(p.Available), formatYen(int64(p.Spent)), p.Percent)
+	if p.Remaining >= 0 {
+		fmt.Fprintf(&b, "残りは %s です。\n", formatYen(p.Remaining))
+	} else {
+		fmt.Fprintf(&b, "%s 超過しています。\n", formatYen(-p.Remaining))
+	}
+	if p.Upcoming > 0 {
+		fmt.Fprintf(&b, "このほかに今月 %s のサブスクリプションの請求が予定されています。\n", formatYen(int64(p.Upcoming)))
+	}
+	return notify.Message{Subject: subject, Body: b.String()}
+}
+
+func formatYen(n int64) string {
+	if n < 0 {
+		return "-" + notify.FormatYen(uint64(-n)) + "円"
+	}
+	return notify.FormatYen(uint64(n)) + "円"
+}
+
+func (a *Alerter) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
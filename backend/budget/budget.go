@@ -0,0 +1,232 @@
+// Package budget はカテゴリごとの予算 (models.Budget) の使用状況を集計し、使いすぎを通知する
+package budget
+
+import (
+	"encoding/json"
+	"fmt"
+	"kakeibo-backend/models"
+	"kakeibo-backend/report"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 繰り越しをさかのぼる月数の上限
+const maxRolloverMonths = 12
+
+// Progress は1件の予算の対象月の使用状況
+//
+// 使った額 (Spent) はレポートと同じく、支出 (サブスクリプションの計上分を含む) の SpentAt と
+// 公共料金の NextBillingDate で月を決め、予算のカテゴリと子孫のカテゴリの分を合計する。
+type Progress struct {
+	Budget models.Budget `json:"budget"`
+	// Month は対象の月の1日
+	Month time.Time `json:"month"`
+	// Amount は予算額、Carryover は前月までの繰り越し (Rollover のときのみ。超過ならマイナス)
+	Amount    uint64 `json:"amount"`
+	Carryover int64  `json:"carryover"`
+	// Available はこの月に使える額 (Amount + Carryover)
+	Available int64  `json:"available"`
+	Spent     uint64 `json:"spent"`
+	// Upcoming は今日以降に請求予定で、まだ計上されていないサブスクリプションの額 (Spent には含まない)
+	Upcoming uint64 `json:"upcoming"`
+	// Remaining は Available - Spent (超過ならマイナス)
+	Remaining int64 `json:"remaining"`
+	// Percent は Available に対する Spent の割合 (%)。Available が0以下なら100
+	Percent float64 `json:"percent"`
+}
+
+// Thresholds は b.AlertThresholds を昇順で返す (読めなければ空)
+func Thresholds(b models.Budget) []int {
+	var thresholds []int
+	if len(b.AlertThresholds) == 0 || json.Unmarshal(b.AlertThresholds, &thresholds) != nil {
+		return nil
+	}
+	sort.Ints(thresholds)
+	return thresholds
+}
+
+// Effective は month に使う userID の予算を返す
+// 同じカテゴリにその月だけの予算があれば、毎月の予算の代わりにそれを使う
+func Effective(db *gorm.DB, userID uuid.UUID, month time.Time) ([]models.Budget, error) {
+	month = report.MonthStart(month)
+	var budgets []models.Budget
+	if err := db.Scopes(models.OwnedBy(userID)).Preload("Category").
+		Where("month = ? OR month IS NULL", month).
+		Order("created_at ASC").
+		Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	monthly := map[uuid.UUID]bool{}
+	for _, b := range budgets {
+		if b.Month != nil {
+			monthly[b.CategoryID] = true
+		}
+	}
+	effective := []models.Budget{}
+	for _, b := range budgets {
+		if b.Month == nil && monthly[b.CategoryID] {
+			continue
+		}
+		effective = append(effective, b)
+	}
+	return effective, nil
+}
+
+// Calculator は予算の使用状況を集計する
+type Calculator struct {
+	DB *gorm.DB
+	// Now は Upcoming の基準の時刻。nil なら time.Now
+	Now func() time.Time
+}
+
+// Calculate は userID の month の全ての予算の使用状況を返す
+func (c *Calculator) Calculate(userID uuid.UUID, month time.Time) ([]Progress, error) {
+	month = report.MonthStart(month)
+	budgets, err := Effective(c.DB, userID, month)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.categoryTree(userID)
+	if err != nil {
+		return nil, err
+	}
+	progress := make([]Progress, 0, len(budgets))
+	for _, b := range budgets {
+		p, err := c.progress(b, tree.descendants(b.CategoryID), month)
+		if err != nil {
+			return nil, err
+		}
+		progress = append(progress, p)
+	}
+	return progress, nil
+}
+
+func (c *Calculator) progress(b models.Budget, categoryIDs []uuid.UUID, month time.Time) (Progress, error) {
+	p := Progress{Budget: b, Month: month, Amount: b.Amount}
+	spent, err := c.spent(b.UserID, categoryIDs, month)
+	if err != nil {
+		return Progress{}, err
+	}
+	p.Spent = spent
+	if b.Rollover && b.Month == nil {
+		if p.Carryover, err = c.carryover(b, categoryIDs, month); err != nil {
+			return Progress{}, err
+		}
+	}
+	if p.Upcoming, err = c.upcoming(b.UserID, categoryIDs, month); err != nil {
+		return Progress{}, err
+	}
+
+	p.Available = int64(p.Amount) + p.Carryover
+	p.Remaining = p.Available - int64(p.Spent)
+	p.Percent = 100
+	if p.Available > 0 {
+		p.Percent = math.Round(float64(p.Spent)/float64(p.Available)*1000) / 10
+	}
+	return p, nil
+}
+
+// carryover は予算を作成した月 (最大 maxRolloverMonths か月前) から前月までの残りの合計を返す
+func (c *Calculator) carryover(b models.Budget, categoryIDs []uuid.UUID, month time.Time) (int64, error) {
+	from := report.MonthStart(b.CreatedAt.In(month.Location()))
+	if limit := month.AddDate(0, -maxRolloverMonths, 0); from.Before(limit) {
+		from = limit
+	}
+	var carry int64
+	for m := from; m.Before(month); m = m.AddDate(0, 1, 0) {
+		spent, err := c.spent(b.UserID, categoryIDs, m)
+		if err != nil {
+			return 0, err
+		}
+		carry += int64(b.Amount) - int64(spent)
+	}
+	return carry, nil
+}
+
+// spent は categoryIDs の month の支出と公共料金の合計を返す
+func (c *Calculator) spent(userID uuid.UUID, categoryIDs []uuid.UUID, month time.Time) (uint64, error) {
+	next := month.AddDate(0, 1, 0)
+	var expenses, fees int64
+	if err := c.DB.Model(&models.Expense{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("user_id = ? AND category_id IN ? AND spent_at >= ? AND spent_at < ?", userID, categoryIDs, month, next).
+		Scan(&expenses).Error; err != nil {
+		return 0, fmt.Errorf("sum expenses: %w", err)
+	}
+	if err := c.DB.Model(&models.PublicFee{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("user_id = ? AND category_id IN ? AND next_billing_date >= ? AND next_billing_date < ?", userID, categoryIDs, month, next).
+		Scan(&fees).Error; err != nil {
+		return 0, fmt.Errorf("sum public fees: %w", err)
+	}
+	return uint64(expenses + fees), nil
+}
+
+// upcoming は month のうち今日以降に請求予定のサブスクリプションの合計を返す
+// 請求日を過ぎると billing.Engine が支出として計上するため、次回の請求日だけを数える
+func (c *Calculator) upcoming(userID uuid.UUID, categoryIDs []uuid.UUID, month time.Time) (uint64, error) {
+	next := month.AddDate(0, 1, 0)
+	now := c.now()
+	if !now.Before(next) {
+		return 0, nil
+	}
+	from := month
+	if today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, month.Location()); today.After(from) {
+		from = today
+	}
+	var total int64
+	if err := c.DB.Model(&models.Subscription{}).
+		Select("COALESCE(SUM(monthly_fee), 0)").
+		Where("user_id = ? AND is_active = ? AND category_id IN ? AND next_billing_date >= ? AND next_billing_date < ?",
+			userID, true, categoryIDs, from, next).
+		Scan(&total).Error; err != nil {
+		return 0, fmt.Errorf("sum subscriptions: %w", err)
+	}
+	return uint64(total), nil
+}
+
+func (c *Calculator) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// categoryTree は親カテゴリ → 子カテゴリ
+type categoryTree map[uuid.UUID][]uuid.UUID
+
+// categoryTree は userID が使えるカテゴリの親子関係を読み込む (削除済みのカテゴリも過去の支出のため含める)
+func (c *Calculator) categoryTree(userID uuid.UUID) (categoryTree, error) {
+	var categories []models.Category
+	if err := c.DB.Unscoped().Scopes(models.VisibleCategories(userID)).
+		Select("id, parent_id").
+		Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	tree := categoryTree{}
+	for _, cat := range categories {
+		if cat.ParentID != nil {
+			tree[*cat.ParentID] = append(tree[*cat.ParentID], cat.ID)
+		}
+	}
+	return tree, nil
+}
+
+// descendants は id と全ての子孫のカテゴリを返す
+func (t categoryTree) descendants(id uuid.UUID) []uuid.UUID {
+	ids := []uuid.UUID{id}
+	seen := map[uuid.UUID]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range t[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
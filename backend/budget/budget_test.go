@@ -0,0 +1,240 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"kakeibo-backend/models"
+	"kakeibo-backend/notify"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(
+		&models.User{}, &models.Category{}, &models.Expense{}, &models.Subscription{}, &models.PublicFee{},
+		&models.Budget{}, &models.BudgetAlert{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type recordingNotifier struct {
+	sent []notify.Message
+	err  error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, user models.User, msg notify.Message) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+// fixture はユーザーと「食費 > 外食」「住居」のカテゴリ
+type fixture struct {
+	db      *gorm.DB
+	user    models.User
+	food    models.Category
+	eatOut  models.Category
+	housing models.Category
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{db: newTestDB(t)}
+	f.user = models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := f.db.Create(&f.user).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.food = models.Category{Name: "食費", UserID: &f.user.ID}
+	f.housing = models.Category{Name: "住居", UserID: &f.user.ID}
+	for _, c := range []*models.Category{&f.food, &f.housing} {
+		if err := f.db.Create(c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.eatOut = models.Category{Name: "外食", ParentID: &f.food.ID, UserID: &f.user.ID}
+	if err := f.db.Create(&f.eatOut).Error; err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f *fixture) create(t *testing.T, rows ...interface{}) {
+	t.Helper()
+	for _, v := range rows {
+		if err := f.db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (f *fixture) expense(category models.Category, amount int, at time.Time) *models.Expense {
+	return &models.Expense{Amount: amount, Description: "x", SpentAt: at, UserID: f.user.ID, CategoryID: category.ID}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 12, 0, 0, 0, time.Local)
+}
+
+func TestCalculate(t *testing.T) {
+	f := newFixture(t)
+	may := time.Date(2026, 5, 1, 0, 0, 0, 0, time.Local)
+	food := models.Budget{Amount: 30000, CategoryID: f.food.ID, UserID: f.user.ID}
+	housing := models.Budget{Amount: 80000, CategoryID: f.housing.ID, UserID: f.user.ID}
+	housingMay := models.Budget{Amount: 100000, Month: &may, CategoryID: f.housing.ID, UserID: f.user.ID}
+	f.create(t, &food, &housing, &housingMay,
+		f.expense(f.food, 10000, date(2026, 5, 3)),
+		f.expense(f.eatOut, 14000, date(2026, 5, 10)),
+		f.expense(f.eatOut, 9999, date(2026, 4, 30)), // 前月
+		f.expense(f.housing, 85000, date(2026, 5, 1)),
+		&models.PublicFee{FeeType: "電気", Amount: 6000, UsageMonth: 4, NextBillingDate: date(2026, 5, 25), UserID: f.user.ID, CategoryID: f.housing.ID},
+		&models.Subscription{Name: "ミールキット", MonthlyFee: 4000, NextBillingDate: date(2026, 5, 28), IsActive: true, UserID: f.user.ID, CategoryID: f.eatOut.ID},
+	)
+
+	calc := Calculator{DB: f.db, Now: func() time.Time { return date(2026, 5, 20) }}
+	progress, err := calc.Calculate(f.user.ID, date(2026, 5, 15))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 2 {
+		t.Fatalf("got %d budgets, want 2 (the May housing budget replaces the monthly one)", len(progress))
+	}
+	byCategory := map[string]Progress{}
+	for _, p := range progress {
+		byCategory[p.Budget.Category.Name] = p
+	}
+
+	// 子カテゴリの支出も予算に含める
+	p := byCategory["食費"]
+	if p.Spent != 24000 || p.Remaining != 6000 || p.Percent != 80 || p.Upcoming != 4000 || !p.Month.Equal(may) {
+		t.Errorf("食費 = %+v", p)
+	}
+	// 公共料金も含める
+	p = byCategory["住居"]
+	if p.Budget.ID != housingMay.ID || p.Amount != 100000 || p.Spent != 91000 || p.Remaining != 9000 || p.Percent != 91 {
+		t.Errorf("住居 = %+v", p)
+	}
+
+	// 過去の月は請求予定を数えない
+	progress, err = calc.Calculate(f.user.ID, date(2026, 4, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range progress {
+		if p.Upcoming != 0 {
+			t.Errorf("%s: upcoming = %d in a past month", p.Budget.Category.Name, p.Upcoming)
+		}
+	}
+}
+
+func TestCalculateRollover(t *testing.T) {
+	f := newFixture(t)
+	food := models.Budget{Amount: 30000, Rollover: true, CategoryID: f.food.ID, UserID: f.user.ID}
+	f.create(t, &food,
+		f.expense(f.food, 25000, date(2026, 3, 10)), // 作成前の月は繰り越さない
+		f.expense(f.food, 20000, date(2026, 4, 10)),
+		f.expense(f.eatOut, 45000, date(2026, 5, 10)),
+		f.expense(f.food, 1000, date(2026, 6, 2)),
+	)
+	if err := f.db.Model(&food).Update("created_at", date(2026, 4, 1)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	calc := Calculator{DB: f.db}
+	cases := []struct {
+		month     time.Time
+		carryover int64
+		remaining int64
+		percent   float64
+	}{
+		{date(2026, 4, 1), 0, 10000, 66.7},
+		{date(2026, 5, 1), 10000, -5000, 112.5},
+		{date(2026, 6, 1), -5000, 24000, 4},
+	}
+	for _, c := range cases {
+		progress, err := calc.Calculate(f.user.ID, c.month)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(progress) != 1 {
+			t.Fatalf("%s: got %d budgets", c.month.Format("2006-01"), len(progress))
+		}
+		p := progress[0]
+		if p.Carryover != c.carryover || p.Remaining != c.remaining || p.Percent != c.percent {
+			t.Errorf("%s: carryover %d, remaining %d, percent %v; want %d, %d, %v",
+				c.month.Format("2006-01"), p.Carryover, p.Remaining, p.Percent, c.carryover, c.remaining, c.percent)
+		}
+	}
+}
+
+func TestAlerter(t *testing.T) {
+	f := newFixture(t)
+	food := models.Budget{Amount: 10000, AlertThresholds: datatypes.JSON(`[80, 100]`), CategoryID: f.food.ID, UserID: f.user.ID}
+	silent := models.Budget{Amount: 1000, AlertThresholds: datatypes.JSON(`[]`), CategoryID: f.housing.ID, UserID: f.user.ID}
+	f.create(t, &food, &silent, f.expense(f.housing, 5000, date(2026, 5, 2)))
+
+	notifier := &recordingNotifier{}
+	now := date(2026, 5, 20)
+	a := &Alerter{DB: f.db, Notifier: notifier, Now: func() time.Time { return now }}
+	run := func() RunResult {
+		t.Helper()
+		res, err := a.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := run(); res.Sent != 0 {
+		t.Errorf("under threshold: sent %d", res.Sent)
+	}
+	f.create(t, f.expense(f.eatOut, 8500, date(2026, 5, 5)))
+	if res := run(); res.Sent != 1 || !strings.Contains(notifier.sent[0].Subject, "80%") {
+		t.Fatalf("80%%: %+v, %+v", res, notifier.sent)
+	}
+	if res := run(); res.Sent != 0 {
+		t.Errorf("the same threshold was alerted again: %+v", res)
+	}
+
+	// 送信に失敗したら次回に再送する
+	f.create(t, f.expense(f.food, 2000, date(2026, 5, 6)))
+	notifier.err = errors.New("smtp down")
+	if res := run(); res.Failed != 1 {
+		t.Errorf("failed notify: %+v", res)
+	}
+	notifier.err = nil
+	if res := run(); res.Sent != 1 || !strings.Contains(notifier.sent[1].Subject, "予算を超えました") ||
+		!strings.Contains(notifier.sent[1].Body, "500円 超過") {
+		t.Errorf("100%%: %+v, %+v", res, notifier.sent)
+	}
+
+	// 月が変われば改めて通知する
+	now = date(2026, 6, 20)
+	f.create(t, f.expense(f.food, 12000, date(2026, 6, 1)))
+	if res := run(); res.Sent != 1 || len(notifier.sent) != 3 {
+		t.Errorf("next month: %+v, %d sent", res, len(notifier.sent))
+	}
+	var alerts int64
+	f.db.Model(&models.BudgetAlert{}).Count(&alerts)
+	if alerts != 4 {
+		t.Errorf("got %d alert records, want 4", alerts)
+	}
+}
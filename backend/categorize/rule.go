@@ -0,0 +1,191 @@
+// Package categorize はユーザーが定義した規則 (models.CategoryRule) で支出のカテゴリを決める
+package categorize
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kakeibo-backend/models"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// ErrNoCondition は条件が1つも無い規則を表す (すべての支出に一致してしまう)
+var ErrNoCondition = errors.New("rule needs at least one condition")
+
+// Rule は条件を解釈済みの CategoryRule
+type Rule struct {
+	models.CategoryRule
+
+	contains string
+	merchant string
+	pattern  *regexp.Regexp
+	weekdays map[time.Weekday]bool
+}
+
+// Compile は r の条件を解釈する。条件が無い・正規表現が不正などの場合はエラーを返す
+func Compile(r models.CategoryRule) (*Rule, error) {
+	rule := &Rule{
+		CategoryRule: r,
+		contains:     normalize(r.DescriptionContains),
+		merchant:     normalize(r.Merchant),
+	}
+	if r.DescriptionPattern != "" {
+		pattern, err := regexp.Compile(r.DescriptionPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid description_pattern: %w", err)
+		}
+		rule.pattern = pattern
+	}
+	if r.MinAmount != nil && r.MaxAmount != nil && *r.MinAmount > *r.MaxAmount {
+		return nil, errors.New("min_amount must not be greater than max_amount")
+	}
+	if len(r.Weekdays) > 0 {
+		var days []int
+		if err := json.Unmarshal(r.Weekdays, &days); err != nil {
+			return nil, fmt.Errorf("invalid weekdays: %w", err)
+		}
+		for _, d := range days {
+			if d < 0 || d > 6 {
+				return nil, errors.New("weekdays must be between 0 (Sunday) and 6 (Saturday)")
+			}
+			if rule.weekdays == nil {
+				rule.weekdays = map[time.Weekday]bool{}
+			}
+			rule.weekdays[time.Weekday(d)] = true
+		}
+	}
+	if rule.contains == "" && rule.merchant == "" && rule.pattern == nil &&
+		r.MinAmount == nil && r.MaxAmount == nil && rule.weekdays == nil {
+		return nil, ErrNoCondition
+	}
+	return rule, nil
+}
+
+// Match は e が規則のすべての条件を満たすか判定する
+// 内容は全角・半角 (NFKC) をそろえて比べる。曜日は loc で判定する
+func (r *Rule) Match(e models.Expense, loc *time.Location) bool {
+	if r.MinAmount != nil && e.Amount < *r.MinAmount {
+		return false
+	}
+	if r.MaxAmount != nil && e.Amount > *r.MaxAmount {
+		return false
+	}
+	if r.weekdays != nil && !r.weekdays[e.SpentAt.In(loc).Weekday()] {
+		return false
+	}
+	description := normalize(e.Description)
+	if r.contains != "" && !strings.Contains(description, r.contains) {
+		return false
+	}
+	if r.merchant != "" && !strings.HasPrefix(description, r.merchant) {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(norm.NFKC.String(e.Description)) {
+		return false
+	}
+	return true
+}
+
+// Engine はユーザーの有効な規則を優先順に評価する
+type Engine struct {
+	Rules []*Rule
+	// Loc は曜日を判定するタイムゾーン。nil なら time.Local
+	Loc *time.Location
+}
+
+// Load は userID の有効な規則を優先順に読み込む
+// 保存済みの規則が解釈できない場合 (保存後に規則の仕様が変わった場合など) はその規則を使わない
+func Load(db *gorm.DB, userID uuid.UUID) (*Engine, error) {
+	var rules []models.CategoryRule
+	if err := db.Scopes(models.OwnedBy(userID)).Where("is_active = ?", true).
+		Order("priority ASC, created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	engine := &Engine{}
+	for _, r := range rules {
+		if rule, err := Compile(r); err == nil {
+			engine.Rules = append(engine.Rules, rule)
+		}
+	}
+	return engine, nil
+}
+
+// Categorize は e に最初に一致した規則を返す。どれにも一致しなければ nil
+func (en *Engine) Categorize(e models.Expense) *Rule {
+	loc := en.Loc
+	if loc == nil {
+		loc = time.Local
+	}
+	for _, r := range en.Rules {
+		if r.Match(e, loc) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Preview は rule を過去の支出に当てはめた場合にカテゴリが変わる支出を新しい順に返す
+// (他の規則の優先順は考えず、rule だけを当てはめる)
+func Preview(db *gorm.DB, rule *Rule, loc *time.Location) ([]models.Expense, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	query := db.Scopes(models.OwnedBy(rule.UserID)).Where("category_id <> ?", rule.CategoryID)
+	if rule.MinAmount != nil {
+		query = query.Where("amount >= ?", *rule.MinAmount)
+	}
+	if rule.MaxAmount != nil {
+		query = query.Where("amount <= ?", *rule.MaxAmount)
+	}
+	var expenses []models.Expense
+	if err := query.Preload("Category").Order("spent_at DESC").Find(&expenses).Error; err != nil {
+		return nil, err
+	}
+	matched := []models.Expense{}
+	for _, e := range expenses {
+		if rule.Match(e, loc) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+// Apply は Preview の支出のカテゴリを rule のカテゴリに変更し、変更した支出の ID を返す
+func Apply(db *gorm.DB, rule *Rule, loc *time.Location) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		expenses, err := Preview(tx, rule, loc)
+		if err != nil {
+			return err
+		}
+		for _, e := range expenses {
+			ids = append(ids, e.ID)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Expense{}).Where("id IN ?", ids).Update("category_id", rule.CategoryID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// normalize は全角・半角 (NFKC)、大文字・小文字と空白の違いをそろえる
+func normalize(s string) string {
+	s = strings.ToLower(norm.NFKC.String(s))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
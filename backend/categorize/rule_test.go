@@ -0,0 +1,90 @@
+package categorize
+
+import (
+	"errors"
+	"kakeibo-backend/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestCompileErrors(t *testing.T) {
+	cases := map[string]models.CategoryRule{
+		"no condition":  {Name: "x"},
+		"bad pattern":   {DescriptionPattern: "("},
+		"min > max":     {MinAmount: intPtr(1000), MaxAmount: intPtr(100)},
+		"bad weekday":   {Weekdays: datatypes.JSON(`[7]`)},
+		"blank strings": {DescriptionContains: "  ", Merchant: " "},
+	}
+	for name, r := range cases {
+		if _, err := Compile(r); err == nil {
+			t.Errorf("%s: Compile should fail", name)
+		}
+	}
+	if _, err := Compile(models.CategoryRule{Weekdays: datatypes.JSON(`[]`)}); !errors.Is(err, ErrNoCondition) {
+		t.Errorf("empty weekdays: err = %v, want ErrNoCondition", err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	// 2026-05-09 は土曜日
+	saturday := time.Date(2026, 5, 9, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name    string
+		rule    models.CategoryRule
+		expense models.Expense
+		want    bool
+	}{
+		{"contains ignores width and case", models.CategoryRule{DescriptionContains: "スタバ"}, models.Expense{Description: "ｽﾀﾊﾞ 渋谷"}, true},
+		{"contains", models.CategoryRule{DescriptionContains: "amazon"}, models.Expense{Description: "Ａｍａｚｏｎ マーケットプレイス"}, true},
+		{"contains mismatch", models.CategoryRule{DescriptionContains: "amazon"}, models.Expense{Description: "楽天"}, false},
+		{"merchant prefix", models.CategoryRule{Merchant: "セブンイレブン"}, models.Expense{Description: "ｾﾌﾞﾝｲﾚﾌﾞﾝ 新宿店"}, true},
+		{"merchant not prefix", models.CategoryRule{Merchant: "セブンイレブン"}, models.Expense{Description: "返品 セブンイレブン"}, false},
+		{"pattern", models.CategoryRule{DescriptionPattern: `^JR(東|西)日本`}, models.Expense{Description: "ＪＲ東日本 モバイルSuica"}, true},
+		{"amount range", models.CategoryRule{MinAmount: intPtr(100), MaxAmount: intPtr(500)}, models.Expense{Amount: 500}, true},
+		{"amount over", models.CategoryRule{MinAmount: intPtr(100), MaxAmount: intPtr(500)}, models.Expense{Amount: 501}, false},
+		{"weekday", models.CategoryRule{Weekdays: datatypes.JSON(`[0,6]`)}, models.Expense{SpentAt: saturday}, true},
+		{"weekday mismatch", models.CategoryRule{Weekdays: datatypes.JSON(`[1,2,3,4,5]`)}, models.Expense{SpentAt: saturday}, false},
+		{"all conditions", models.CategoryRule{DescriptionContains: "カフェ", MaxAmount: intPtr(1000), Weekdays: datatypes.JSON(`[6]`)},
+			models.Expense{Description: "カフェ", Amount: 1200, SpentAt: saturday}, false},
+	}
+	for _, tc := range cases {
+		rule, err := Compile(tc.rule)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := rule.Match(tc.expense, time.UTC); got != tc.want {
+			t.Errorf("%s: Match = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEngineCategorize(t *testing.T) {
+	food, eatOut := uuid.New(), uuid.New()
+	compile := func(r models.CategoryRule) *Rule {
+		rule, err := Compile(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rule
+	}
+	// Load と同じく優先順に並べる
+	engine := &Engine{Rules: []*Rule{
+		compile(models.CategoryRule{Name: "高いカフェは外食", DescriptionContains: "カフェ", MinAmount: intPtr(1000), CategoryID: eatOut}),
+		compile(models.CategoryRule{Name: "カフェ", DescriptionContains: "カフェ", CategoryID: food}),
+	}, Loc: time.UTC}
+
+	if r := engine.Categorize(models.Expense{Description: "カフェ", Amount: 1500}); r == nil || r.CategoryID != eatOut {
+		t.Errorf("expensive cafe: got %+v, want eatOut", r)
+	}
+	if r := engine.Categorize(models.Expense{Description: "カフェ", Amount: 480}); r == nil || r.CategoryID != food {
+		t.Errorf("cafe: got %+v, want food", r)
+	}
+	if r := engine.Categorize(models.Expense{Description: "書店", Amount: 480}); r != nil {
+		t.Errorf("book store: got %+v, want nil", r)
+	}
+}
@@ -1,70 +1,94 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
-	// "gorm.io/gorm/logger" // This line was removed as per instruction
-
+	"kakeibo-backend/auth"
+	"kakeibo-backend/billing"
+	"kakeibo-backend/budget"
+	"kakeibo-backend/database"
 	"kakeibo-backend/handlers"
-	"kakeibo-backend/models"
+	"kakeibo-backend/migrations"
+	"kakeibo-backend/notify"
+	"kakeibo-backend/pricewatch"
+	"kakeibo-backend/scraper"
+	"kakeibo-backend/suggest"
 )
 
 func main() {
 	// データベース接続設定 (環境変数から取得)
-	// Docker環境などでの接続待ちを考慮してリトライロジックを入れることが多いですが、
-	// ここではシンプルに実装します。Docker Composeのdepends_onやwait-for-itを利用するのも手です。
-
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Tokyo",
-		getEnv("DB_HOST", "localhost"),
-		getEnv("DB_USER", "postgres"),
-		getEnv("DB_PASSWORD", "postgres"),
-		getEnv("DB_NAME", "kakeibo"),
-		getEnv("DB_PORT", "5432"),
-	)
-
-	var db *gorm.DB
-	var err error
-
-	// 簡易的なリトライロジック
-	for i := 0; i < 10; i++ {
-
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Info),
-		})
-		if err == nil {
-			break
-		}
-		log.Printf("Failed to connect to database: %v. Retrying in 2 seconds... (%d/10)", err, i+1)
-		time.Sleep(2 * time.Second)
-	}
-
+	db, err := database.Connect(logger.Info)
 	if err != nil {
 		log.Fatalf("Could not connect to database: %v", err)
 	}
 
-	// マイグレーション実行
-	// 実際の運用ではマイグレーションツール(golang-migrateなど)の使用を検討してください。
-	if err := db.AutoMigrate(
-		&models.User{},
-		&models.Subscription{},
-		&models.Category{},
-		&models.Expense{},
-		&models.ScrapedItem{},
-	); err != nil {
+	// マイグレーション実行 (未適用分のみ)
+	// 状態確認や取り消しは go run ./cmd/migrate status|down を使う
+	runner, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	applied, err := runner.Up()
+	for _, m := range applied {
+		log.Printf("Applied migration %s", m.FileName())
+	}
+	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// サブスクリプションの自動計上 (起動時と1時間ごと)
+	billingEngine := &billing.Engine{DB: db}
+	go billingEngine.Start(context.Background(), time.Hour)
+
+	// 請求予定のリマインド (リマインド日に月1回。1時間ごとに確認する)
+	// 送信先はユーザーの通知設定で選ぶ。SMTP_ADDR が未設定ならメール希望者にも受信箱へ送る
+	router := notify.Router{DB: db}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		router.Email = notify.SMTPNotifier{
+			Addr:     addr,
+			From:     os.Getenv("SMTP_FROM"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	} else {
+		log.Println("SMTP_ADDR is not set; email notifications go to the in-app inbox")
+	}
+	reminder := &notify.Scheduler{DB: db, Notifier: router}
+	go reminder.Start(context.Background(), time.Hour)
+
+	// 予算の使用率の通知 (しきい値ごとに月1回。1時間ごとに確認する)
+	alerter := &budget.Alerter{DB: db, Notifier: router}
+	go alerter.Start(context.Background(), time.Hour)
+
+	// スクレイピングの設定 (robots.txt のキャッシュと同じホストへの間隔は価格監視と API で共有する)
+	scraperConfig := scraper.DefaultConfig()
+	if ua := os.Getenv("SCRAPER_USER_AGENT"); ua != "" {
+		scraperConfig.UserAgent = ua
+	}
+	scraperConfig.Politeness = scraper.NewPoliteness()
+	for _, d := range strings.Split(os.Getenv("SCRAPER_DENY_DOMAINS"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			scraperConfig.DenyDomains = append(scraperConfig.DenyDomains, d)
+		}
+	}
+	scraperConfig.DomainRules, err = scraper.ParseDomainRules(os.Getenv("SCRAPER_DOMAIN_RULES"))
+	if err != nil {
+		log.Fatalf("Invalid SCRAPER_DOMAIN_RULES: %v", err)
+	}
+
+	// 価格監視 (商品ごとの取得間隔を5分ごとに確認する)
+	watcher := &pricewatch.Watcher{DB: db, Fetcher: pricewatch.ScraperFetcher{Config: scraperConfig}, Notifier: router}
+	go watcher.Start(context.Background(), 5*time.Minute)
+
 	// Echoインスタンス作成
 	e := echo.New()
 
@@ -73,12 +97,40 @@ func main() {
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 
+	// 認証設定
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		// 開発用: 起動ごとにランダムな鍵を使うため、再起動で全トークンが無効になる
+		log.Println("JWT_SECRET is not set. Using a random secret; tokens will not survive restarts.")
+		secret, err := auth.NewRefreshToken()
+		if err != nil {
+			log.Fatalf("Failed to generate JWT secret: %v", err)
+		}
+		jwtSecret = secret
+	}
+	authService := &auth.Service{DB: db, Tokens: auth.NewTokenIssuer([]byte(jwtSecret))}
+
 	// ハンドラー初期化
-	userHandler := handlers.UserHandlers{DB: db}
+	authHandler := handlers.AuthHandlers{Auth: authService}
+	userHandler := handlers.UserHandlers{DB: db, Auth: authService}
 	subscriptionHandler := handlers.SubscriptionHandlers{DB: db}
 	categoryHandler := handlers.CategoryHandlers{DB: db}
-	expenseHandler := handlers.ExpenseHandlers{DB: db}
-	scraperHandler := handlers.ScraperHandlers{DB: db}
+	expenseHandler := handlers.ExpenseHandlers{DB: db, Suggester: &suggest.Suggester{DB: db}}
+	// スクレイピングのサイトのプロファイル (同梱分と SCRAPER_PROFILE_DIR のファイル)
+	profiles, err := scraper.LoadRegistry(os.Getenv("SCRAPER_PROFILE_DIR"))
+	if err != nil {
+		log.Fatalf("Failed to load scraper profiles: %v", err)
+	}
+	scraperHandler := handlers.ScraperHandlers{DB: db, Profiles: profiles, Config: scraperConfig}
+	reportHandler := handlers.ReportHandlers{DB: db}
+	publicFeeHandler := handlers.PublicFeeHandlers{DB: db}
+	watchHandler := handlers.WatchHandlers{DB: db}
+	wishlistHandler := handlers.WishlistHandlers{DB: db}
+	budgetHandler := handlers.BudgetHandlers{DB: db}
+	importHandler := handlers.ImportHandlers{DB: db}
+	duplicateHandler := handlers.DuplicateHandlers{DB: db}
+	categoryRuleHandler := handlers.CategoryRuleHandlers{DB: db}
+	notificationHandler := handlers.NotificationHandlers{DB: db}
 
 	// ルーティング
 	e.GET("/", func(c echo.Context) error {
@@ -86,8 +138,17 @@ func main() {
 	})
 	api := e.Group("/api")
 
-	// User routes
+	// Auth routes (認証不要)
+	api.POST("/auth/login", authHandler.Login)
+	api.POST("/auth/refresh", authHandler.Refresh)
 	api.POST("/users", userHandler.CreateUser)
+
+	// ここから下は認証必須
+	api = api.Group("", auth.Middleware(authService))
+	api.POST("/auth/logout", authHandler.Logout)
+	api.GET("/auth/me", authHandler.Me)
+
+	// User routes
 	api.GET("/users", userHandler.GetUserWithPagination)
 	api.GET("/users/search", userHandler.SearchUser)
 	api.GET("/users/:id", userHandler.GetUserById)
@@ -105,16 +166,87 @@ func main() {
 	api.GET("/category", categoryHandler.GetCategory)
 	api.PUT("/category/:id", categoryHandler.UpdateCategory)
 	api.DELETE("/category/:id", categoryHandler.DeleteCategory)
+	api.POST("/category/:id/archive", categoryHandler.ArchiveCategory)
+	api.POST("/category/:id/unarchive", categoryHandler.UnarchiveCategory)
+	api.POST("/category/:id/merge", categoryHandler.MergeCategory)
 
 	api.POST("/expenses", expenseHandler.CreateExpense)
 	api.GET("/expenses", expenseHandler.GetExpense)
+	api.GET("/expenses/suggest-category", expenseHandler.SuggestCategory)
 	api.GET("/expenses/:date", expenseHandler.GetExpenseByDate)
 	api.PUT("/expenses/:id", expenseHandler.UpdateExpense)
 	api.DELETE("/expenses/:id", expenseHandler.DeleteExpense)
 
+	// PublicFee routes
+	api.POST("/public-fees", publicFeeHandler.CreatePublicFee)
+	api.GET("/public-fees", publicFeeHandler.GetPublicFee)
+	api.GET("/public-fees/trends", publicFeeHandler.GetPublicFeeTrends)
+	api.PUT("/public-fees/:id", publicFeeHandler.UpdatePublicFee)
+	api.DELETE("/public-fees/:id", publicFeeHandler.DeletePublicFee)
+
+	// Report routes
+	api.GET("/reports", reportHandler.GetReport)
+
+	// Notification routes
+	api.GET("/notification-settings", notificationHandler.GetNotificationSetting)
+	api.PUT("/notification-settings", notificationHandler.UpdateNotificationSetting)
+	api.GET("/notification-logs", notificationHandler.GetNotificationLogs)
+	api.GET("/notifications", notificationHandler.GetNotifications)
+	api.PUT("/notifications/read", notificationHandler.MarkAllNotificationsRead)
+	api.PUT("/notifications/:id/read", notificationHandler.MarkNotificationRead)
+
 	// Scraper routes
 	api.POST("/scrape", scraperHandler.ScrapeProducts)
 	api.GET("/scrape/guide", scraperHandler.GetScrapingGuide)
+	api.GET("/scrape/profiles", scraperHandler.GetScrapeProfiles)
+	api.GET("/scraped-items", scraperHandler.GetScrapedItems)
+	api.GET("/scraped-items/:id", scraperHandler.GetScrapedItemByID)
+	api.DELETE("/scraped-items/:id", scraperHandler.DeleteScrapedItem)
+
+	// Price watch routes
+	api.POST("/watch-items", watchHandler.CreateWatchItem)
+	api.GET("/watch-items", watchHandler.GetWatchItem)
+	api.PUT("/watch-items/:id", watchHandler.UpdateWatchItem)
+	api.DELETE("/watch-items/:id", watchHandler.DeleteWatchItem)
+	api.GET("/watch-items/:id/history", watchHandler.GetPriceHistory)
+
+	// Wishlist routes
+	api.POST("/wishlist", wishlistHandler.CreateWishlistItem)
+	api.GET("/wishlist", wishlistHandler.GetWishlist)
+	api.PUT("/wishlist/:id", wishlistHandler.UpdateWishlistItem)
+	api.DELETE("/wishlist/:id", wishlistHandler.DeleteWishlistItem)
+	api.POST("/wishlist/:id/bought", wishlistHandler.MarkWishlistItemBought)
+	api.GET("/wishlist/:id/history", wishlistHandler.GetWishlistPriceHistory)
+
+	// Budget routes
+	api.POST("/budgets", budgetHandler.CreateBudget)
+	api.GET("/budgets", budgetHandler.GetBudget)
+	api.GET("/budgets/progress", budgetHandler.GetBudgetProgress)
+	api.PUT("/budgets/:id", budgetHandler.UpdateBudget)
+	api.DELETE("/budgets/:id", budgetHandler.DeleteBudget)
+
+	// Import routes (明細CSVの取り込み)
+	api.POST("/imports", importHandler.UploadImport)
+	api.GET("/imports", importHandler.GetImports)
+	api.GET("/imports/formats", importHandler.GetImportFormats)
+	api.GET("/imports/:id", importHandler.GetImportByID)
+	api.POST("/imports/:id/commit", importHandler.CommitImport)
+	api.POST("/imports/:id/rollback", importHandler.RollbackImport)
+
+	// Duplicate routes (二重に登録された可能性のある支出の確認)
+	api.GET("/duplicates", duplicateHandler.GetDuplicates)
+	api.POST("/duplicates/:id/merge", duplicateHandler.MergeDuplicate)
+	api.POST("/duplicates/:id/ignore", duplicateHandler.IgnoreDuplicate)
+
+	// Category rule routes (支出のカテゴリの自動分類)
+	api.POST("/category-rules", categoryRuleHandler.CreateCategoryRule)
+	api.GET("/category-rules", categoryRuleHandler.GetCategoryRules)
+	api.POST("/category-rules/dry-run", categoryRuleHandler.DryRunCategoryRule)
+	api.PUT("/category-rules/:id", categoryRuleHandler.UpdateCategoryRule)
+	api.DELETE("/category-rules/:id", categoryRuleHandler.DeleteCategoryRule)
+	api.GET("/category-rules/:id/dry-run", categoryRuleHandler.DryRunCategoryRuleByID)
+	api.POST("/category-rules/:id/apply", categoryRuleHandler.ApplyCategoryRule)
+
 	// サーバー起動
 	port := getEnv("PORT", "8080")
 	e.Logger.Fatal(e.Start(":" + port))
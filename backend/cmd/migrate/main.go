@@ -0,0 +1,89 @@
+// migrate はスキーママイグレーションを操作するコマンド
+//
+//	go run ./cmd/migrate status     適用状況を表示
+//	go run ./cmd/migrate up         未適用のマイグレーションをすべて適用
+//	go run ./cmd/migrate down [N]   直近N件 (既定1件) を取り消し
+//
+// 接続先は cmd/api と同じ環境変数 (DB_HOST など) で指定する
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"gorm.io/gorm/logger"
+
+	"kakeibo-backend/database"
+	"kakeibo-backend/migrations"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	db, err := database.Connect(logger.Warn)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+	runner, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "status":
+		statuses, err := runner.Status()
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.AppliedAt != nil {
+				state = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if st.Modified {
+				state += " (MODIFIED since applied)"
+			}
+			fmt.Printf("%04d_%-40s %s\n", st.Version, st.Name, state)
+		}
+
+	case "up":
+		applied, err := runner.Up()
+		for _, m := range applied {
+			fmt.Printf("applied  %s\n", m.FileName())
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("already up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				usage()
+			}
+		}
+		reverted, err := runner.Down(steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %s\n", m.FileName())
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate status | up | down [N]")
+	os.Exit(2)
+}
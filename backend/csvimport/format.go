@@ -0,0 +1,118 @@
+package csvimport
+
+import (
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// Format は明細CSVの形式 (見出しの列名と、支出の項目への対応)
+//
+// 各項目には候補の列名を優先順に並べる。見出しの行に Date・Description・Amount の
+// いずれかの候補が全て揃っていれば、その形式とみなす。
+type Format struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	// Date は利用日・取引日の列
+	Date []string `json:"-"`
+	// Description は内容の列。複数見つかれば最初の空でない値を使う
+	Description []string `json:"-"`
+	// Amount は支払った金額 (出金) の列。空の行 (銀行口座の入金など) は取り込まない
+	Amount []string `json:"-"`
+}
+
+// GenericFormat は見出しの一般的な列名で判定する形式の名前
+const GenericFormat = "generic"
+
+// Formats は判定に使う形式 (発行元ごとの形式を先に、汎用の形式を最後に照合する)
+var Formats = []Format{
+	{
+		Name:        "rakuten_card",
+		Label:       "楽天カード",
+		Date:        []string{"利用日"},
+		Description: []string{"利用店名・商品名"},
+		Amount:      []string{"利用金額"},
+	},
+	{
+		Name:        "smbc",
+		Label:       "三井住友銀行",
+		Date:        []string{"年月日"},
+		Description: []string{"お取り扱い内容"},
+		Amount:      []string{"お引出し"},
+	},
+	{
+		Name:        "mufg",
+		Label:       "三菱UFJ銀行",
+		Date:        []string{"日付"},
+		Description: []string{"摘要内容", "摘要"},
+		Amount:      []string{"支払い金額"},
+	},
+	{
+		Name:        "paypay",
+		Label:       "PayPay",
+		Date:        []string{"取引日"},
+		Description: []string{"取引先", "取引内容"},
+		Amount:      []string{"出金金額（円）"},
+	},
+	{
+		Name:        GenericFormat,
+		Label:       "汎用 (日付・内容・金額の列があるCSV)",
+		Date:        []string{"日付", "利用日", "ご利用日", "利用年月日", "取引日", "年月日", "date"},
+		Description: []string{"利用店名・商品名", "ご利用店名", "利用店名", "店名", "内容", "摘要", "取引内容", "品名", "説明", "description"},
+		Amount:      []string{"利用金額", "ご利用金額", "金額", "支払金額", "支払い金額", "出金金額", "出金", "お引出し", "amount"},
+	},
+}
+
+// FindFormat は名前の形式を返す
+func FindFormat(name string) (Format, bool) {
+	for _, f := range Formats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// columns は見出しの行での各項目の列番号 (見つからない項目は空)
+type columns struct {
+	date        int
+	description []int
+	amount      int
+}
+
+// match は header が f の見出しの行なら列番号を返す
+func (f Format) match(header []string) (columns, bool) {
+	index := map[string]int{}
+	for i, name := range header {
+		name = normalizeHeader(name)
+		if _, ok := index[name]; !ok {
+			index[name] = i
+		}
+	}
+	find := func(candidates []string) int {
+		for _, c := range candidates {
+			if i, ok := index[normalizeHeader(c)]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+
+	cols := columns{date: find(f.Date), amount: find(f.Amount)}
+	for _, c := range f.Description {
+		if i, ok := index[normalizeHeader(c)]; ok {
+			cols.description = append(cols.description, i)
+		}
+	}
+	if cols.date < 0 || cols.amount < 0 || len(cols.description) == 0 {
+		return columns{}, false
+	}
+	return cols, true
+}
+
+// normalizeHeader は列名の全角・半角、大文字・小文字、前後の空白と BOM の違いを無視するために正規化する
+func normalizeHeader(s string) string {
+	s = strings.TrimPrefix(s, "\ufeff")
+	s = width.Fold.String(s)
+	return strings.ToLower(strings.TrimSpace(s))
+}
@@ -0,0 +1,231 @@
+// Package csvimport は銀行・クレジットカードの明細CSVを読み、支出 (models.Expense) にする行を取り出す
+package csvimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/width"
+)
+
+// 文字コード (Result.Encoding)
+const (
+	EncodingUTF8     = "utf-8"
+	EncodingShiftJIS = "shift_jis"
+)
+
+// 見出しの行を探す行数 (明細の前に口座名などの行がある形式がある)
+const maxHeaderSearch = 20
+
+// 取り込まない理由 (Row.Skip)
+const (
+	SkipInvalidDate   = "invalid_date"
+	SkipInvalidAmount = "invalid_amount"
+	SkipNoAmount      = "no_amount" // 入金だけの行・金額が空の行
+	SkipRefund        = "refund"    // マイナスの金額 (返金・取消)
+	SkipNoDescription = "no_description"
+)
+
+// ErrUnknownFormat は見出しの行が見つからず、形式を判定できなかったことを表す
+var ErrUnknownFormat = errors.New("unknown csv format: no header row with date, description and amount columns")
+
+// Row は明細の1行
+type Row struct {
+	// Line はCSVの行番号 (1から)
+	Line        int       `json:"line"`
+	SpentAt     time.Time `json:"spent_at"`
+	Description string    `json:"description"`
+	Amount      int       `json:"amount"`
+	// Skip は取り込まない理由。取り込む行は空
+	Skip string `json:"skip,omitempty"`
+}
+
+// Result は明細CSVを読んだ結果
+type Result struct {
+	Format   string `json:"format"`
+	Encoding string `json:"encoding"`
+	Rows     []Row  `json:"rows"`
+}
+
+// Parse は明細CSVを読む
+//
+// 文字コードは UTF-8 (BOM 付きも可) か Shift_JIS を自動で判定する。
+// format が空なら見出しの行から Formats の順に形式を判定し、指定すればその形式の見出しの行を探す。
+// 日付は loc の日付として読む。
+func Parse(data []byte, format string, loc *time.Location) (*Result, error) {
+	formats := Formats
+	if format != "" {
+		f, ok := FindFormat(format)
+		if !ok {
+			return nil, fmt.Errorf("unknown format %q", format)
+		}
+		formats = []Format{f}
+	}
+
+	text, encoding, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(strings.NewReader(text))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var (
+		result *Result
+		cols   columns
+	)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		if result == nil {
+			if line > maxHeaderSearch {
+				break
+			}
+			for _, f := range formats {
+				if c, ok := f.match(record); ok {
+					result = &Result{Format: f.Name, Encoding: encoding, Rows: []Row{}}
+					cols = c
+					break
+				}
+			}
+			continue
+		}
+		if blank(record) {
+			continue
+		}
+		result.Rows = append(result.Rows, parseRow(record, cols, line, loc))
+	}
+	if result == nil {
+		return nil, ErrUnknownFormat
+	}
+	return result, nil
+}
+
+// decode は data を UTF-8 の文字列にする。UTF-8 として読めなければ Shift_JIS とみなす
+func decode(data []byte) (string, string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return string(data), EncodingUTF8, nil
+	}
+	decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", "", fmt.Errorf("decode shift_jis: %w", err)
+	}
+	return string(decoded), EncodingShiftJIS, nil
+}
+
+func parseRow(record []string, cols columns, line int, loc *time.Location) Row {
+	row := Row{Line: line}
+	for _, i := range cols.description {
+		if v := strings.TrimSpace(field(record, i)); v != "" {
+			row.Description = v
+			break
+		}
+	}
+
+	date, err := ParseDate(field(record, cols.date), loc)
+	if err != nil {
+		row.Skip = SkipInvalidDate
+		return row
+	}
+	row.SpentAt = date
+
+	// 出金の無い行は空か "-" (PayPay)
+	raw := strings.TrimSpace(field(record, cols.amount))
+	if raw == "" || raw == "-" {
+		row.Skip = SkipNoAmount
+		return row
+	}
+	amount, err := ParseAmount(raw)
+	switch {
+	case err != nil:
+		row.Skip = SkipInvalidAmount
+	case amount < 0:
+		row.Skip = SkipRefund
+	case amount == 0:
+		row.Skip = SkipNoAmount
+	case row.Description == "":
+		row.Skip = SkipNoDescription
+	}
+	row.Amount = amount
+	return row
+}
+
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+func blank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// 日付の表記 (時刻付きの表記は日付だけの表記より先に照合する)
+var dateLayouts = []string{
+	"2006/1/2 15:04:05",
+	"2006/1/2 15:04",
+	"2006-01-02 15:04:05",
+	"2006/1/2",
+	"2006-1-2",
+	"2006.1.2",
+	"2006年1月2日",
+	"20060102",
+}
+
+// ParseDate は明細の日付 ("2026/05/03"、"2026年5月3日"、"20260503" など) を loc の日時として読む
+func ParseDate(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(width.Fold.String(s))
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// ParseAmount は明細の金額 ("1,280"、"￥1,280"、"-500"、"△500" など) を円で読む
+// 小数点以下は切り捨てる
+func ParseAmount(s string) (int, error) {
+	s = width.Fold.String(strings.TrimSpace(s))
+	negative := false
+	for _, sign := range []string{"-", "△", "▲"} {
+		if strings.HasPrefix(s, sign) {
+			negative = true
+			s = strings.TrimPrefix(s, sign)
+			break
+		}
+	}
+	s = strings.NewReplacer(",", "", "¥", "", "\\", "", "円", "", " ", "").Replace(s)
+	if whole, _, ok := strings.Cut(s, "."); ok {
+		s = whole
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
@@ -0,0 +1,150 @@
+package csvimport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+var jst = time.FixedZone("JST", 9*60*60)
+
+func TestParseFormats(t *testing.T) {
+	cases := []struct {
+		name   string
+		csv    string
+		format string
+		want   []Row
+	}{
+		{
+			name: "rakuten card",
+			csv: "\ufeff\"利用日\",\"利用店名・商品名\",\"利用者\",\"支払方法\",\"利用金額\",\"支払手数料\",\"支払総額\"\n" +
+				"\"2026/05/03\",\"セブン－イレブン\",\"本人\",\"1回払い\",\"1,280\",\"0\",\"1,280\"\n" +
+				"\"2026/05/04\",\"返品 ABCマート\",\"本人\",\"1回払い\",\"-5,500\",\"0\",\"-5,500\"\n",
+			format: "rakuten_card",
+			want: []Row{
+				{Line: 2, SpentAt: time.Date(2026, 5, 3, 0, 0, 0, 0, jst), Description: "セブン－イレブン", Amount: 1280},
+				{Line: 3, SpentAt: time.Date(2026, 5, 4, 0, 0, 0, 0, jst), Description: "返品 ABCマート", Amount: -5500, Skip: SkipRefund},
+			},
+		},
+		{
+			name: "smbc with preamble",
+			csv: "口座番号,123-4567890\n\n" +
+				"年月日,お引出し,お預入れ,お取り扱い内容,残高\n" +
+				"2026/5/1,\"80,000\",,カ－ド ヤチン,\"200,000\"\n" +
+				"2026/5/25,,\"250,000\",キユウヨ,\"450,000\"\n",
+			format: "smbc",
+			want: []Row{
+				{Line: 4, SpentAt: time.Date(2026, 5, 1, 0, 0, 0, 0, jst), Description: "カ－ド ヤチン", Amount: 80000},
+				{Line: 5, SpentAt: time.Date(2026, 5, 25, 0, 0, 0, 0, jst), Description: "キユウヨ", Skip: SkipNoAmount},
+			},
+		},
+		{
+			name: "mufg falls back to 摘要",
+			csv: "日付,摘要,摘要内容,支払い金額,預かり金額,差引残高,メモ,未資金化区分,入払区分\n" +
+				"2026/5/10,カード,ｾﾌﾞﾝｲﾚﾌﾞﾝ,540,,\"99,460\",,,支払い\n" +
+				"2026/5/11,振込手数料,,220,,\"99,240\",,,支払い\n",
+			format: "mufg",
+			want: []Row{
+				{Line: 2, SpentAt: time.Date(2026, 5, 10, 0, 0, 0, 0, jst), Description: "ｾﾌﾞﾝｲﾚﾌﾞﾝ", Amount: 540},
+				{Line: 3, SpentAt: time.Date(2026, 5, 11, 0, 0, 0, 0, jst), Description: "振込手数料", Amount: 220},
+			},
+		},
+		{
+			name: "paypay",
+			csv: "取引日,出金金額（円）,入金金額（円）,海外出金金額,通貨,変換レート（円）,利用国,取引内容,取引先,取引方法,支払い区分,利用者,取引番号\n" +
+				"2026/05/12 18:30:05,\"2,300\",-,-,-,-,-,支払い,ファミリーマート,PayPay残高,-,-,0001\n" +
+				"2026/05/13 09:00:00,-,\"5,000\",-,-,-,-,チャージ,,銀行口座,-,-,0002\n",
+			format: "paypay",
+			want: []Row{
+				{Line: 2, SpentAt: time.Date(2026, 5, 12, 18, 30, 5, 0, jst), Description: "ファミリーマート", Amount: 2300},
+				{Line: 3, SpentAt: time.Date(2026, 5, 13, 9, 0, 0, 0, jst), Description: "チャージ", Skip: SkipNoAmount},
+			},
+		},
+		{
+			name: "generic",
+			csv: "ご利用日,ご利用店名,ご利用金額,備考\n" +
+				"２０２６年５月１４日,書店,￥１，９８０,\n" +
+				"合計,,\"1,980\",\n",
+			format: GenericFormat,
+			want: []Row{
+				{Line: 2, SpentAt: time.Date(2026, 5, 14, 0, 0, 0, 0, jst), Description: "書店", Amount: 1980},
+				{Line: 3, Description: "", Skip: SkipInvalidDate},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Parse([]byte(tc.csv), "", jst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Format != tc.format || result.Encoding != EncodingUTF8 {
+				t.Errorf("format %s / %s, want %s / utf-8", result.Format, result.Encoding, tc.format)
+			}
+			if len(result.Rows) != len(tc.want) {
+				t.Fatalf("got %d rows, want %d: %+v", len(result.Rows), len(tc.want), result.Rows)
+			}
+			for i, want := range tc.want {
+				got := result.Rows[i]
+				if got.Line != want.Line || !got.SpentAt.Equal(want.SpentAt) || got.Description != want.Description ||
+					got.Skip != want.Skip || (want.Skip == "" && got.Amount != want.Amount) {
+					t.Errorf("row %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseShiftJIS(t *testing.T) {
+	data, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte("日付,内容,金額\n2026/05/20,ドラッグストア,\"3,210\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Parse(data, "", jst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Encoding != EncodingShiftJIS || result.Format != GenericFormat {
+		t.Errorf("encoding %s, format %s", result.Encoding, result.Format)
+	}
+	if len(result.Rows) != 1 || result.Rows[0].Description != "ドラッグストア" || result.Rows[0].Amount != 3210 {
+		t.Errorf("rows = %+v", result.Rows)
+	}
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	if _, err := Parse([]byte("name,price\napple,100\n"), "", jst); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("err = %v, want ErrUnknownFormat", err)
+	}
+	// 指定した形式の見出しが無ければ判定しない
+	if _, err := Parse([]byte("日付,内容,金額\n2026/05/20,x,100\n"), "rakuten_card", jst); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("err = %v, want ErrUnknownFormat", err)
+	}
+	if _, err := Parse([]byte("日付,内容,金額\n"), "visa", jst); err == nil {
+		t.Error("unknown format name should fail")
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	cases := map[string]int{
+		"1,280":   1280,
+		"￥1,280":  1280,
+		"1280円":   1280,
+		"-500":    -500,
+		"△500":    -500,
+		"１２３":     123,
+		"1,000.5": 1000,
+	}
+	for s, want := range cases {
+		if got, err := ParseAmount(s); err != nil || got != want {
+			t.Errorf("ParseAmount(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "-", "abc", "1-2"} {
+		if _, err := ParseAmount(s); err == nil {
+			t.Errorf("ParseAmount(%q) should fail", s)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Connect は環境変数の設定でPostgreSQLに接続する
+// Docker環境などでDBの起動を待つため、失敗時は2秒おきに10回までリトライする
+func Connect(logLevel logger.LogLevel) (*gorm.DB, error) {
+	dsn := fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Tokyo",
+		getEnv("DB_HOST", "localhost"),
+		getEnv("DB_USER", "postgres"),
+		getEnv("DB_PASSWORD", "postgres"),
+		getEnv("DB_NAME", "kakeibo"),
+		getEnv("DB_PORT", "5432"),
+	)
+
+	var db *gorm.DB
+	var err error
+	for i := 0; i < 10; i++ {
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+			Logger: logger.Default.LogMode(logLevel),
+		})
+		if err == nil {
+			return db, nil
+		}
+		log.Printf("Failed to connect to database: %v. Retrying in 2 seconds... (%d/10)", err, i+1)
+		time.Sleep(2 * time.Second)
+	}
+	return nil, err
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
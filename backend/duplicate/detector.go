@@ -0,0 +1,209 @@
+// Package duplicate は同じ買い物が二重に登録された可能性のある支出 (models.Expense) を見つける
+package duplicate
+
+import (
+	"errors"
+	"kakeibo-backend/models"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 既定の判定条件
+const (
+	DefaultWindow        = 3 * 24 * time.Hour
+	DefaultMinSimilarity = 0.5
+)
+
+// Detector は金額が同じで、SpentAt が Window 以内、内容が似ている支出を重複の候補にする
+//
+// 手入力・サブスクリプションの計上・明細の取り込みでは同じ買い物の日付が数日ずれることがあるため、
+// 日付は完全には一致させない。同じ明細の取り込みどうし (同じ店で同じ金額を2回払った場合など) は候補にしない。
+type Detector struct {
+	// Window は SpentAt の差の上限。0 なら DefaultWindow
+	Window time.Duration
+	// MinSimilarity は Similarity の下限。0 なら DefaultMinSimilarity
+	MinSimilarity float64
+}
+
+// Candidates は e の重複の候補になる支出を返す (候補の組として記録済みのものも含む)
+func (d *Detector) Candidates(db *gorm.DB, e models.Expense) ([]models.Expense, []float64, error) {
+	window := d.Window
+	if window == 0 {
+		window = DefaultWindow
+	}
+	min := d.MinSimilarity
+	if min == 0 {
+		min = DefaultMinSimilarity
+	}
+
+	query := db.Where("user_id = ? AND id <> ? AND amount = ? AND spent_at >= ? AND spent_at <= ?",
+		e.UserID, e.ID, e.Amount, e.SpentAt.Add(-window), e.SpentAt.Add(window))
+	if e.ImportBatchID != nil {
+		query = query.Where("(import_batch_id IS NULL OR import_batch_id <> ?)", *e.ImportBatchID)
+	}
+	// 同じサブスクリプションの別の請求日の支出は重複ではない (短い請求サイクル)
+	if e.SubscriptionID != nil {
+		query = query.Where("(subscription_id IS NULL OR subscription_id <> ?)", *e.SubscriptionID)
+	}
+	var nearby []models.Expense
+	if err := query.Order("created_at ASC").Find(&nearby).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		matches []models.Expense
+		scores  []float64
+	)
+	for _, other := range nearby {
+		if score := Similarity(e.Description, other.Description); score >= min {
+			matches = append(matches, other)
+			scores = append(scores, score)
+		}
+	}
+	return matches, scores, nil
+}
+
+// Flag は e の重複の候補を pending の DuplicateCandidate として記録し、新たに記録した組の相手の支出を返す
+// e は登録したばかりの支出 (候補の ExpenseID 側) とする。判断済みの組は記録し直さない
+func (d *Detector) Flag(db *gorm.DB, e models.Expense) ([]models.Expense, error) {
+	matches, scores, err := d.Candidates(db, e)
+	if err != nil {
+		return nil, err
+	}
+	var flagged []models.Expense
+	for i, other := range matches {
+		// 既に逆向きの組がある場合も記録しない
+		var exists int64
+		if err := db.Model(&models.DuplicateCandidate{}).Unscoped().
+			Where("expense_id = ? AND duplicate_of_id = ?", other.ID, e.ID).
+			Count(&exists).Error; err != nil {
+			return nil, err
+		}
+		if exists > 0 {
+			continue
+		}
+		candidate := models.DuplicateCandidate{
+			ExpenseID:     e.ID,
+			DuplicateOfID: other.ID,
+			Score:         math.Round(scores[i]*100) / 100,
+			Status:        models.DuplicatePending,
+			UserID:        e.UserID,
+		}
+		res := db.Omit("Expense", "DuplicateOf", "User").Clauses(clause.OnConflict{DoNothing: true}).Create(&candidate)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			flagged = append(flagged, other)
+		}
+	}
+	return flagged, nil
+}
+
+// ErrNotPending は判断済みの候補をもう一度判断しようとしたことを表す
+var ErrNotPending = errors.New("duplicate candidate is already resolved")
+
+// Merge は候補の組のうち keep を残し、もう片方の支出を削除する
+// 削除する支出が欲しいものリストの購入の記録なら、その紐付けを残す支出に移す
+func Merge(db *gorm.DB, candidate models.DuplicateCandidate, keep models.Expense, remove models.Expense) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.DuplicateCandidate{}).
+			Where("id = ? AND status = ?", candidate.ID, models.DuplicatePending).
+			Updates(map[string]interface{}{"status": models.DuplicateMerged, "kept_expense_id": keep.ID, "resolved_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotPending
+		}
+		if remove.WishlistItemID != nil && keep.WishlistItemID == nil {
+			if err := tx.Model(&models.Expense{}).Where("id = ?", keep.ID).Updates(map[string]interface{}{
+				"wishlist_item_id": *remove.WishlistItemID,
+				"product_url":      remove.ProductURL,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.WishlistItem{}).Where("id = ?", *remove.WishlistItemID).Update("expense_id", keep.ID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.Expense{}, "id = ?", remove.ID).Error
+	})
+}
+
+// Ignore は候補の組を別の支出と判断したことを記録する
+func Ignore(db *gorm.DB, candidate models.DuplicateCandidate) error {
+	res := db.Model(&models.DuplicateCandidate{}).
+		Where("id = ? AND status = ?", candidate.ID, models.DuplicatePending).
+		Updates(map[string]interface{}{"status": models.DuplicateIgnored, "resolved_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotPending
+	}
+	return nil
+}
+
+// Similarity は2つの支出の内容の類似度 (0〜1) を返す
+//
+// 全角・半角 (「ｾﾌﾞﾝ」と「セブン」)、大文字・小文字、空白と記号の違いは無視する。
+// 一方がもう一方を含む場合 ("Amazon" と "AMAZON.CO.JP") は 0.8、それ以外は文字の2-gram の Dice 係数。
+func Similarity(a, b string) float64 {
+	a, b = normalize(a), normalize(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	if strings.Contains(a, b) || strings.Contains(b, a) {
+		return 0.8
+	}
+	ba, bb := bigrams(a), bigrams(b)
+	if len(ba) == 0 || len(bb) == 0 {
+		return 0
+	}
+	counts := map[string]int{}
+	for _, g := range ba {
+		counts[g]++
+	}
+	common := 0
+	for _, g := range bb {
+		if counts[g] > 0 {
+			counts[g]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(ba)+len(bb))
+}
+
+func normalize(s string) string {
+	// NFKC で半角カナ (濁点を含む) を全角に、全角英数字を半角にそろえる
+	s = strings.ToLower(norm.NFKC.String(s))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func bigrams(s string) []string {
+	runes := []rune(s)
+	if len(runes) < 2 {
+		return nil
+	}
+	grams := make([]string, 0, len(runes)-1)
+	for i := 0; i+1 < len(runes); i++ {
+		grams = append(grams, string(runes[i:i+2]))
+	}
+	return grams
+}
@@ -0,0 +1,171 @@
+package duplicate
+
+import (
+	"errors"
+	"kakeibo-backend/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(
+		&models.User{}, &models.Category{}, &models.Expense{}, &models.WishlistItem{}, &models.DuplicateCandidate{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"セブンイレブン", "ｾﾌﾞﾝｲﾚﾌﾞﾝ", 1, 1},
+		{"Amazon", "AMAZON.CO.JP", 0.8, 0.8},
+		{"スターバックス 渋谷店", "スターバックス新宿店", 0.6, 0.8},
+		{"スーパー", "ドラッグストア", 0, 0.2},
+		{"", "スーパー", 0, 0},
+	}
+	for _, tc := range cases {
+		if got := Similarity(tc.a, tc.b); got < tc.min || got > tc.max {
+			t.Errorf("Similarity(%q, %q) = %.2f, want %.2f..%.2f", tc.a, tc.b, got, tc.min, tc.max)
+		}
+	}
+}
+
+func TestFlag(t *testing.T) {
+	db := newTestDB(t)
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	category := models.Category{Name: "食費"}
+	for _, v := range []interface{}{&user, &other, &category} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	batch := uuid.New()
+	expense := func(userID uuid.UUID, amount int, description string, spentAt time.Time, batchID *uuid.UUID) models.Expense {
+		e := models.Expense{Amount: amount, Description: description, SpentAt: spentAt, UserID: userID, CategoryID: category.ID, ImportBatchID: batchID}
+		if err := db.Omit("Category").Create(&e).Error; err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	manual := expense(user.ID, 540, "セブンイレブン", day, nil)
+	expense(user.ID, 540, "セブンイレブン", day.AddDate(0, 0, -5), nil) // 日付が離れている
+	expense(user.ID, 541, "セブンイレブン", day, nil)                   // 金額が違う
+	expense(user.ID, 540, "書店", day, nil)                        // 内容が違う
+	expense(other.ID, 540, "セブンイレブン", day, nil)                  // 他人の支出
+	sameBatch := expense(user.ID, 540, "ｾﾌﾞﾝｲﾚﾌﾞﾝ", day, &batch)
+
+	imported := expense(user.ID, 540, "ｾﾌﾞﾝｲﾚﾌﾞﾝ", day.AddDate(0, 0, 2), &batch)
+	detector := Detector{}
+	flagged, err := detector.Flag(db, imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同じ取り込みの sameBatch は候補にしない
+	if len(flagged) != 1 || flagged[0].ID != manual.ID {
+		t.Fatalf("flagged = %+v, want only the manual expense", flagged)
+	}
+	var candidate models.DuplicateCandidate
+	if err := db.First(&candidate, "expense_id = ?", imported.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if candidate.DuplicateOfID != manual.ID || candidate.Score != 1 || candidate.Status != models.DuplicatePending || candidate.UserID != user.ID {
+		t.Errorf("unexpected candidate: %+v", candidate)
+	}
+
+	// 記録済みの組は (逆向きも含めて) 記録し直さない
+	if flagged, err := detector.Flag(db, imported); err != nil || len(flagged) != 0 {
+		t.Errorf("second flag = %+v, %v", flagged, err)
+	}
+	if flagged, err := detector.Flag(db, manual); err != nil || len(flagged) != 1 || flagged[0].ID != sameBatch.ID {
+		t.Errorf("reverse flag = %+v, %v; want only sameBatch", flagged, err)
+	}
+
+	// 別の支出と判断した組は、判断をやり直せない
+	if err := Ignore(db, candidate); err != nil {
+		t.Fatal(err)
+	}
+	if err := Ignore(db, candidate); !errors.Is(err, ErrNotPending) {
+		t.Errorf("second ignore: err = %v, want ErrNotPending", err)
+	}
+	if err := Merge(db, candidate, manual, imported); !errors.Is(err, ErrNotPending) {
+		t.Errorf("merge after ignore: err = %v, want ErrNotPending", err)
+	}
+	if flagged, err := detector.Flag(db, imported); err != nil || len(flagged) != 0 {
+		t.Errorf("ignored pair was flagged again: %+v, %v", flagged, err)
+	}
+}
+
+func TestMergeMovesWishlistItem(t *testing.T) {
+	db := newTestDB(t)
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	category := models.Category{Name: "家電"}
+	for _, v := range []interface{}{&user, &category} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	item := models.WishlistItem{Name: "イヤホン", URL: "https://example.com/earphone", Status: models.WishlistBought, UserID: user.ID, CategoryID: category.ID}
+	if err := db.Omit("Category", "User").Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	bought := models.Expense{Amount: 9800, Description: "イヤホン", SpentAt: now, UserID: user.ID, CategoryID: category.ID,
+		WishlistItemID: &item.ID, ProductURL: item.URL}
+	imported := models.Expense{Amount: 9800, Description: "イヤホン", SpentAt: now, UserID: user.ID, CategoryID: category.ID}
+	for _, e := range []*models.Expense{&bought, &imported} {
+		if err := db.Omit("Category").Create(e).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Model(&item).Update("expense_id", bought.ID)
+	flagged, err := (&Detector{}).Flag(db, imported)
+	if err != nil || len(flagged) != 1 {
+		t.Fatalf("flagged = %+v, %v", flagged, err)
+	}
+	var candidate models.DuplicateCandidate
+	db.First(&candidate, "expense_id = ?", imported.ID)
+
+	// 取り込んだ方を残し、購入の記録の方を削除する
+	if err := Merge(db, candidate, imported, bought); err != nil {
+		t.Fatal(err)
+	}
+	var kept models.Expense
+	if err := db.First(&kept, "id = ?", imported.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if kept.WishlistItemID == nil || *kept.WishlistItemID != item.ID || kept.ProductURL != item.URL {
+		t.Errorf("wishlist link was not moved: %+v", kept)
+	}
+	db.First(&item, "id = ?", item.ID)
+	if item.ExpenseID == nil || *item.ExpenseID != imported.ID {
+		t.Errorf("wishlist item expense_id = %v, want %s", item.ExpenseID, imported.ID)
+	}
+	if err := db.First(&models.Expense{}, "id = ?", bought.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("removed expense still exists: %v", err)
+	}
+	db.First(&candidate, "id = ?", candidate.ID)
+	if candidate.Status != models.DuplicateMerged || candidate.KeptExpenseID == nil || *candidate.KeptExpenseID != imported.ID || candidate.ResolvedAt == nil {
+		t.Errorf("unexpected candidate: %+v", candidate)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"kakeibo-backend/auth"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AuthHandlers struct {
+	Auth *auth.Service
+}
+
+// LOGIN
+func (h *AuthHandlers) Login(c echo.Context) error {
+	type LoginRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	req := LoginRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	pair, err := h.Auth.Login(req.Email, req.Password, c.Request().UserAgent())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return c.JSON(http.StatusUnauthorized, err.Error())
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, pair)
+}
+
+// REFRESH
+func (h *AuthHandlers) Refresh(c echo.Context) error {
+	type RefreshRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	req := RefreshRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, "refresh_token is required")
+	}
+	pair, err := h.Auth.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrSessionRevoked) {
+			return c.JSON(http.StatusUnauthorized, err.Error())
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, pair)
+}
+
+// LOGOUT
+// 現在のセッションを失効させる。アクセストークン・リフレッシュトークンとも以後使えない
+func (h *AuthHandlers) Logout(c echo.Context) error {
+	session := auth.CurrentSession(c)
+	if session == nil {
+		return c.JSON(http.StatusUnauthorized, "not logged in")
+	}
+	if err := h.Auth.Logout(session.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ME
+func (h *AuthHandlers) Me(c echo.Context) error {
+	user := auth.CurrentUser(c)
+	if user == nil {
+		return c.JSON(http.StatusUnauthorized, "not logged in")
+	}
+	return c.JSON(http.StatusOK, user)
+}
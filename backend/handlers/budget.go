@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/budget"
+	"kakeibo-backend/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// errDuplicateBudget は同じカテゴリ・月の予算が既にあることを表す
+var errDuplicateBudget = errors.New("budget for this category and month already exists")
+
+type BudgetHandlers struct {
+	DB *gorm.DB
+}
+
+type budgetRequest struct {
+	CategoryID uuid.UUID `json:"category_id"`
+	Amount     uint64    `json:"amount"`
+	// Month は YYYY-MM。省略すると毎月の予算
+	Month string `json:"month"`
+	// Rollover は前月までの残りを繰り越すか (毎月の予算のみ)
+	Rollover bool `json:"rollover"`
+	// AlertThresholds は通知する使用率 (%)。省略すると [80, 100]、空の配列なら通知しない
+	AlertThresholds []int `json:"alert_thresholds"`
+
+	month *time.Time
+}
+
+func (r *budgetRequest) validate() error {
+	if r.CategoryID == uuid.Nil {
+		return errors.New("category_id is required")
+	}
+	if r.Amount == 0 {
+		return errors.New("amount must be positive")
+	}
+	if r.Month != "" {
+		t, err := time.ParseInLocation("2006-01", r.Month, time.Local)
+		if err != nil {
+			return errors.New("month must be YYYY-MM")
+		}
+		if r.Rollover {
+			return errors.New("rollover is only available for monthly budgets (without month)")
+		}
+		r.month = &t
+	}
+	if r.AlertThresholds == nil {
+		r.AlertThresholds = models.DefaultAlertThresholds
+	}
+	seen := map[int]bool{}
+	thresholds := []int{}
+	for _, t := range r.AlertThresholds {
+		if t < 1 || t > 1000 {
+			return errors.New("alert_thresholds must be between 1 and 1000")
+		}
+		if !seen[t] {
+			seen[t] = true
+			thresholds = append(thresholds, t)
+		}
+	}
+	sort.Ints(thresholds)
+	r.AlertThresholds = thresholds
+	return nil
+}
+
+func (r *budgetRequest) apply(b *models.Budget) {
+	thresholds, _ := json.Marshal(r.AlertThresholds)
+	b.CategoryID = r.CategoryID
+	b.Amount = r.Amount
+	b.Month = r.month
+	b.Rollover = r.Rollover
+	b.AlertThresholds = datatypes.JSON(thresholds)
+}
+
+// checkDuplicate は b と同じカテゴリ・月の予算が他にあれば errDuplicateBudget を返す
+func (h *BudgetHandlers) checkDuplicate(c echo.Context, b models.Budget) error {
+	query := ownedDB(h.DB, c).Model(&models.Budget{}).Where("category_id = ? AND id <> ?", b.CategoryID, b.ID)
+	if b.Month == nil {
+		query = query.Where("month IS NULL")
+	} else {
+		query = query.Where("month = ?", *b.Month)
+	}
+	var n int64
+	if err := query.Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return errDuplicateBudget
+	}
+	return nil
+}
+
+// save は重複を確認してから b を保存し、カテゴリ付きで読み直す
+func (h *BudgetHandlers) save(c echo.Context, b *models.Budget) error {
+	if err := checkCategory(h.DB, c, b.CategoryID); err != nil {
+		return c.JSON(categoryErrorStatus(err), err.Error())
+	}
+	if err := h.checkDuplicate(c, *b); err != nil {
+		if errors.Is(err, errDuplicateBudget) {
+			return c.JSON(http.StatusConflict, err.Error())
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.DB.Omit("Category", "User").Save(b).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if err := ownedDB(h.DB, c).Preload("Category").First(b, "id = ?", b.ID).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, b)
+}
+
+// CREATE
+// 同じカテゴリ・月 (毎月の予算どうしも) の予算が既にあれば 409
+func (h *BudgetHandlers) CreateBudget(c echo.Context) error {
+	req := budgetRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	b := models.Budget{UserID: auth.CurrentUserID(c)}
+	req.apply(&b)
+	return h.save(c, &b)
+}
+
+// GET
+// 毎月の予算、月ごとの予算 (新しい月から) の順
+func (h *BudgetHandlers) GetBudget(c echo.Context) error {
+	budgets := []models.Budget{}
+	if err := ownedDB(h.DB, c).Preload("Category").
+		Order("month IS NOT NULL, month DESC, created_at ASC").
+		Find(&budgets).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, budgets)
+}
+
+// GET PROGRESS
+// ?month=YYYY-MM (省略時は今月)
+// 対象の月に使う予算ごとに、使った額・残り・使用率を返す
+// (その月だけの予算があるカテゴリは、毎月の予算の代わりにそれを使う)
+func (h *BudgetHandlers) GetBudgetProgress(c echo.Context) error {
+	month := time.Now()
+	if m := c.QueryParam("month"); m != "" {
+		t, err := time.ParseInLocation("2006-01", m, time.Local)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "month must be YYYY-MM")
+		}
+		month = t
+	}
+	calc := budget.Calculator{DB: h.DB}
+	progress, err := calc.Calculate(auth.CurrentUserID(c), month)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, progress)
+}
+
+// UPDATE
+func (h *BudgetHandlers) UpdateBudget(c echo.Context) error {
+	id := c.Param("id")
+	var b models.Budget
+	if err := ownedDB(h.DB, c).First(&b, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "Budget not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	req := budgetRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	req.apply(&b)
+	return h.save(c, &b)
+}
+
+// DELETE
+func (h *BudgetHandlers) DeleteBudget(c echo.Context) error {
+	id := c.Param("id")
+	result := ownedDB(h.DB, c).Delete(&models.Budget{}, "id = ?", id)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "Budget not found")
+	}
+	return c.JSON(http.StatusOK, id)
+}
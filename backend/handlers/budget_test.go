@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"kakeibo-backend/budget"
+	"kakeibo-backend/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCreateBudget(t *testing.T) {
+	h := &BudgetHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	food := models.Category{Name: "食費", UserID: &user.ID}
+	if err := h.DB.Create(&food).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var b models.Budget
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/budgets", fmt.Sprintf(`{"category_id": %q, "amount": 30000, "rollover": true}`, food.ID), nil, h.CreateBudget), &b)
+	if b.Amount != 30000 || !b.Rollover || b.Month != nil || b.Category.Name != "食費" || fmt.Sprint(budget.Thresholds(b)) != "[80 100]" {
+		t.Errorf("unexpected budget: %+v", b)
+	}
+
+	// 毎月の予算は1カテゴリに1件。月ごとの予算は別に作れる
+	if rec := doRequest(t, &user, http.MethodPost, "/api/budgets", fmt.Sprintf(`{"category_id": %q, "amount": 1000}`, food.ID), nil, h.CreateBudget); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate: status = %d, want 409", rec.Code)
+	}
+	var may models.Budget
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/budgets", fmt.Sprintf(`{"category_id": %q, "amount": 50000, "month": "2026-05", "alert_thresholds": [100, 50, 100]}`, food.ID), nil, h.CreateBudget), &may)
+	if may.Month == nil || !may.Month.Equal(time.Date(2026, 5, 1, 0, 0, 0, 0, time.Local)) || fmt.Sprint(budget.Thresholds(may)) != "[50 100]" {
+		t.Errorf("unexpected monthly budget: %+v", may)
+	}
+
+	invalid := []string{
+		fmt.Sprintf(`{"category_id": %q, "amount": 0}`, food.ID),
+		fmt.Sprintf(`{"category_id": %q, "amount": 100, "month": "2026/05"}`, food.ID),
+		fmt.Sprintf(`{"category_id": %q, "amount": 100, "month": "2026-06", "rollover": true}`, food.ID),
+		fmt.Sprintf(`{"category_id": %q, "amount": 100, "month": "2026-06", "alert_thresholds": [0]}`, food.ID),
+		`{"amount": 100}`,
+	}
+	for _, body := range invalid {
+		if rec := doRequest(t, &user, http.MethodPost, "/api/budgets", body, nil, h.CreateBudget); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	// 他人の予算は更新できない
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	if err := h.DB.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{"id": b.ID.String()}
+	body := fmt.Sprintf(`{"category_id": %q, "amount": 35000, "alert_thresholds": []}`, food.ID)
+	if rec := doRequest(t, &other, http.MethodPut, "/", body, params, h.UpdateBudget); rec.Code != http.StatusNotFound {
+		t.Errorf("other user: status = %d, want 404", rec.Code)
+	}
+	decodeBody(t, doRequest(t, &user, http.MethodPut, "/", body, params, h.UpdateBudget), &b)
+	if b.Amount != 35000 || b.Rollover || len(budget.Thresholds(b)) != 0 {
+		t.Errorf("unexpected updated budget: %+v", b)
+	}
+}
+
+func TestGetBudgetProgress(t *testing.T) {
+	h := &BudgetHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	food := models.Category{Name: "食費", UserID: &user.ID}
+	if err := h.DB.Create(&food).Error; err != nil {
+		t.Fatal(err)
+	}
+	eatOut := models.Category{Name: "外食", ParentID: &food.ID, UserID: &user.ID}
+	rows := []interface{}{
+		&eatOut,
+		&models.Budget{Amount: 20000, CategoryID: food.ID, UserID: user.ID},
+	}
+	for _, v := range rows {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	expense := models.Expense{Amount: 5000, Description: "x", SpentAt: time.Date(2026, 4, 10, 12, 0, 0, 0, time.Local), UserID: user.ID, CategoryID: eatOut.ID}
+	if err := h.DB.Create(&expense).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []budget.Progress
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/budgets/progress?month=2026-04", "", nil, h.GetBudgetProgress), &progress)
+	if len(progress) != 1 || progress[0].Spent != 5000 || progress[0].Remaining != 15000 || progress[0].Percent != 25 {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+	if rec := doRequest(t, &user, http.MethodGet, "/api/budgets/progress?month=april", "", nil, h.GetBudgetProgress); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid month: status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"errors"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// errCategoryNotFound は category_id がユーザーの使えないカテゴリを指していることを表す
+var errCategoryNotFound = errors.New("category_id not found")
+
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// アイコン名の最大長
+const maxIconLength = 64
+
+type CategoryHandlers struct {
+	DB *gorm.DB
+}
+
+type categoryRequest struct {
+	Name     string     `json:"name"`
+	Color    string     `json:"color"`
+	Icon     string     `json:"icon"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+func (r *categoryRequest) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if r.Color != "" && !colorPattern.MatchString(r.Color) {
+		return errors.New("color must be #RRGGBB")
+	}
+	r.Icon = strings.TrimSpace(r.Icon)
+	if len(r.Icon) > maxIconLength {
+		return errors.New("icon is too long")
+	}
+	if r.ParentID != nil && *r.ParentID == uuid.Nil {
+		r.ParentID = nil
+	}
+	return nil
+}
+
+func (r categoryRequest) apply(category *models.Category) {
+	category.Name = r.Name
+	category.Color = r.Color
+	category.Icon = r.Icon
+	category.ParentID = r.ParentID
+}
+
+// visibleCategories は認証済みユーザーが使えるカテゴリ (自分のものと既定のもの) のクエリを返す
+func visibleCategories(db *gorm.DB, c echo.Context) *gorm.DB {
+	return db.Scopes(models.VisibleCategories(auth.CurrentUserID(c)))
+}
+
+// checkCategory は id が認証済みユーザーの使えるカテゴリか確認する
+// 使えなければ errCategoryNotFound
+func checkCategory(db *gorm.DB, c echo.Context, id uuid.UUID) error {
+	var count int64
+	if err := visibleCategories(db, c).Model(&models.Category{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errCategoryNotFound
+	}
+	return nil
+}
+
+// categoryErrorStatus は checkCategory のエラーのステータスコードを返す
+func categoryErrorStatus(err error) int {
+	if errors.Is(err, errCategoryNotFound) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// errDefaultCategory は既定のカテゴリを変更しようとしたことを表す
+var errDefaultCategory = errors.New("default categories cannot be changed")
+
+// ownCategory は認証済みユーザーのカテゴリ id と、エラーの場合のステータスコードを返す
+// 見つからなければ 404、既定のカテゴリなら 403
+func (h *CategoryHandlers) ownCategory(c echo.Context, id string) (models.Category, int, error) {
+	var category models.Category
+	if err := visibleCategories(h.DB, c).First(&category, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return category, http.StatusNotFound, errors.New("Category not found")
+		}
+		return category, http.StatusInternalServerError, err
+	}
+	if category.UserID == nil {
+		return category, http.StatusForbidden, errDefaultCategory
+	}
+	return category, http.StatusOK, nil
+}
+
+// categoryReferences は category_id でカテゴリを参照するテーブル
+// 統合では付け替え、削除では参照があれば断る (論理削除した行も含む)
+var categoryReferences = []struct {
+	name  string
+	model interface{}
+}{
+	{"expenses", &models.Expense{}},
+	{"subscriptions", &models.Subscription{}},
+	{"public_fees", &models.PublicFee{}},
+	{"wishlist_items", &models.WishlistItem{}},
+	{"budgets", &models.Budget{}},
+	{"category_rules", &models.CategoryRule{}},
+}
+
+// CategoryReferences はカテゴリを参照している行の数 (テーブル名 → 件数、子カテゴリは "subcategories")
+type CategoryReferences map[string]int64
+
+// countReferences は id を参照している行の数を返す (参照の無いテーブルは含めない)
+func countReferences(db *gorm.DB, id uuid.UUID) (CategoryReferences, error) {
+	refs := CategoryReferences{}
+	for _, r := range categoryReferences {
+		var n int64
+		if err := db.Unscoped().Model(r.model).Where("category_id = ?", id).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			refs[r.name] = n
+		}
+	}
+	var n int64
+	if err := db.Unscoped().Model(&models.Category{}).Where("parent_id = ?", id).Count(&n).Error; err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		refs["subcategories"] = n
+	}
+	return refs, nil
+}
+
+// checkParent のエラー
+var (
+	errParentNotFound = errors.New("parent_id not found")
+	errCategoryCycle  = errors.New("parent_id must not be the category itself or its descendant")
+)
+
+// parentErrorStatus は checkParent のエラーのステータスコードを返す
+func parentErrorStatus(err error) int {
+	if errors.Is(err, errParentNotFound) || errors.Is(err, errCategoryCycle) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// checkParent は parentID を category の親にできるか確認する
+// 親は使えるカテゴリで (errParentNotFound)、自分自身や子孫であってはならない (errCategoryCycle)
+func (h *CategoryHandlers) checkParent(c echo.Context, category models.Category, parentID *uuid.UUID) error {
+	if parentID == nil {
+		return nil
+	}
+	if err := checkCategory(h.DB, c, *parentID); err != nil {
+		if errors.Is(err, errCategoryNotFound) {
+			return errParentNotFound
+		}
+		return err
+	}
+	// 親をたどって category に戻ってきたら循環する
+	seen := map[uuid.UUID]bool{}
+	for id := parentID; id != nil && !seen[*id]; {
+		if *id == category.ID {
+			return errCategoryCycle
+		}
+		seen[*id] = true
+		var parent models.Category
+		if err := h.DB.Select("id", "parent_id").First(&parent, "id = ?", *id).Error; err != nil {
+			return err
+		}
+		id = parent.ParentID
+	}
+	return nil
+}
+
+// CREATE
+// 作成したカテゴリは認証済みユーザーのもの
+func (h *CategoryHandlers) CreateCategory(c echo.Context) error {
+	req := categoryRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	userID := auth.CurrentUserID(c)
+	category := models.Category{UserID: &userID}
+	if err := h.checkParent(c, category, req.ParentID); err != nil {
+		return c.JSON(parentErrorStatus(err), err.Error())
+	}
+	req.apply(&category)
+	if err := h.DB.Create(&category).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, category)
+}
+
+// GET
+// 自分のカテゴリと既定のカテゴリを名前順で返す
+// ?tree=true なら親カテゴリの children に子を入れた階層で返す
+// アーカイブしたカテゴリは ?include_archived=true の場合のみ返す
+func (h *CategoryHandlers) GetCategory(c echo.Context) error {
+	query := visibleCategories(h.DB, c)
+	if c.QueryParam("include_archived") != "true" {
+		query = query.Where("archived_at IS NULL")
+	}
+	categories := []models.Category{}
+	if err := query.Order("name ASC").Find(&categories).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if c.QueryParam("tree") == "true" {
+		return c.JSON(http.StatusOK, categoryTree(categories))
+	}
+	return c.JSON(http.StatusOK, categories)
+}
+
+// categoryTree は categories を階層にして最上位のカテゴリを返す (並び順は保つ)
+// 親が categories に無いカテゴリは最上位とする
+func categoryTree(categories []models.Category) []models.Category {
+	byID := map[uuid.UUID]int{}
+	children := map[uuid.UUID][]int{}
+	for i, cat := range categories {
+		byID[cat.ID] = i
+	}
+	roots := []int{}
+	for i, cat := range categories {
+		if cat.ParentID != nil {
+			if _, ok := byID[*cat.ParentID]; ok {
+				children[*cat.ParentID] = append(children[*cat.ParentID], i)
+				continue
+			}
+		}
+		roots = append(roots, i)
+	}
+	var build func(i int) models.Category
+	build = func(i int) models.Category {
+		cat := categories[i]
+		for _, j := range children[cat.ID] {
+			cat.Children = append(cat.Children, build(j))
+		}
+		return cat
+	}
+	tree := make([]models.Category, 0, len(roots))
+	for _, i := range roots {
+		tree = append(tree, build(i))
+	}
+	return tree
+}
+
+// UPDATE
+// 既定のカテゴリは変更できない (403)
+func (h *CategoryHandlers) UpdateCategory(c echo.Context) error {
+	category, status, err := h.ownCategory(c, c.Param("id"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	req := categoryRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := h.checkParent(c, category, req.ParentID); err != nil {
+		return c.JSON(parentErrorStatus(err), err.Error())
+	}
+	req.apply(&category)
+	if err := h.DB.Save(&category).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, category)
+}
+
+// DELETE
+// 支出などの参照や子カテゴリが残っていれば 409 (参照の件数を返す)。アーカイブか統合を使う
+// 参照が無ければ完全に削除する。既定のカテゴリは削除できない (403)
+func (h *CategoryHandlers) DeleteCategory(c echo.Context) error {
+	id := c.Param("id")
+	category, status, err := h.ownCategory(c, id)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	refs, err := countReferences(h.DB, category.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if len(refs) > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":      "category is still referenced; archive or merge it instead",
+			"references": refs,
+		})
+	}
+	if err := h.DB.Unscoped().Delete(&category).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, id)
+}
+
+// ARCHIVE
+// 選択肢 (GET) に出さないようにする。支出などの分類とレポートには残る
+func (h *CategoryHandlers) ArchiveCategory(c echo.Context) error {
+	return h.setArchived(c, true)
+}
+
+// UNARCHIVE
+func (h *CategoryHandlers) UnarchiveCategory(c echo.Context) error {
+	return h.setArchived(c, false)
+}
+
+func (h *CategoryHandlers) setArchived(c echo.Context, archived bool) error {
+	category, status, err := h.ownCategory(c, c.Param("id"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	category.ArchivedAt = nil
+	if archived {
+		now := time.Now()
+		category.ArchivedAt = &now
+	}
+	if err := h.DB.Model(&category).Update("archived_at", category.ArchivedAt).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, category)
+}
+
+type mergeCategoryRequest struct {
+	Into uuid.UUID `json:"into"`
+}
+
+// CategoryMergeResponse は統合のレスポンス
+type CategoryMergeResponse struct {
+	Into models.Category `json:"into"`
+	// Moved は付け替えた行の数 (テーブル名 → 件数、子カテゴリは "subcategories")
+	Moved CategoryReferences `json:"moved"`
+}
+
+// MERGE
+// :id のカテゴリを into のカテゴリに統合する
+// 支出・サブスクリプション・公共料金・欲しいものリストと子カテゴリを into に付け替え、:id は削除する
+// 予算は into に同じ月の予算があれば金額を足す (:id が into の子孫なら足さずに削除する。mergeBudgets)
+// into は既定のカテゴリでもよいが、:id 自身やその子孫は指定できない
+func (h *CategoryHandlers) MergeCategory(c echo.Context) error {
+	from, status, err := h.ownCategory(c, c.Param("id"))
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	req := mergeCategoryRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.Into == uuid.Nil {
+		return c.JSON(http.StatusBadRequest, "into is required")
+	}
+	var into models.Category
+	if err := visibleCategories(h.DB, c).First(&into, "id = ?", req.Into).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusBadRequest, "into not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	// from の子を into に付け替えるため、into が from の子孫だと循環する
+	if err := h.checkParent(c, from, &into.ID); err != nil {
+		if errors.Is(err, errCategoryCycle) {
+			return c.JSON(http.StatusBadRequest, "into must not be the category itself or its descendant")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	res := CategoryMergeResponse{Moved: CategoryReferences{}}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		merged, err := mergeBudgets(tx, from, into.ID)
+		if err != nil {
+			return err
+		}
+		if merged > 0 {
+			res.Moved["budgets"] = merged
+		}
+		for _, r := range categoryReferences {
+			result := tx.Unscoped().Model(r.model).Where("category_id = ?", from.ID).Update("category_id", into.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				res.Moved[r.name] += result.RowsAffected
+			}
+		}
+		result := tx.Unscoped().Model(&models.Category{}).Where("parent_id = ?", from.ID).Update("parent_id", into.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			res.Moved["subcategories"] = result.RowsAffected
+		}
+		return tx.Unscoped().Delete(&from).Error
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	res.Into = into
+	return c.JSON(http.StatusOK, res)
+}
+
+// mergeBudgets は from の予算のうち、into に同じユーザー・月 (毎月の予算どうしも) の予算があるものを into の予算に足して削除する
+// 付け替えると同じカテゴリ・月の予算が2つになり、使用率や通知で二重に数えるため。繰り越しや通知のしきい値は into の予算のまま
+// from が into の子孫なら、into の予算は既に from の支出を含むため、足さずに from の予算を削除する
+// 戻り値は足した (または削除した) 予算の数
+func mergeBudgets(tx *gorm.DB, from models.Category, intoID uuid.UUID) (int64, error) {
+	nested, err := isDescendant(tx, from, intoID)
+	if err != nil {
+		return 0, err
+	}
+	var budgets []models.Budget
+	if err := tx.Where("category_id = ?", from.ID).Find(&budgets).Error; err != nil {
+		return 0, err
+	}
+	var merged int64
+	for _, b := range budgets {
+		query := tx.Where("category_id = ? AND user_id = ?", intoID, b.UserID)
+		if b.Month == nil {
+			query = query.Where("month IS NULL")
+		} else {
+			query = query.Where("month = ?", *b.Month)
+		}
+		var target models.Budget
+		if err := query.First(&target).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return 0, err
+		}
+		if !nested {
+			if err := tx.Model(&target).Update("amount", gorm.Expr("amount + ?", b.Amount)).Error; err != nil {
+				return 0, err
+			}
+		}
+		if err := tx.Unscoped().Delete(&models.BudgetAlert{}, "budget_id = ?", b.ID).Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Unscoped().Delete(&b).Error; err != nil {
+			return 0, err
+		}
+		merged++
+	}
+	return merged, nil
+}
+
+// isDescendant は category が ancestorID のカテゴリの子孫なら true を返す
+func isDescendant(db *gorm.DB, category models.Category, ancestorID uuid.UUID) (bool, error) {
+	seen := map[uuid.UUID]bool{}
+	for id := category.ParentID; id != nil && !seen[*id]; {
+		if *id == ancestorID {
+			return true, nil
+		}
+		seen[*id] = true
+		var parent models.Category
+		if err := db.Select("id", "parent_id").First(&parent, "id = ?", *id).Error; err != nil {
+			return false, err
+		}
+		id = parent.ParentID
+	}
+	return false, nil
+}
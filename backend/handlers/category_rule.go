@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/categorize"
+	"kakeibo-backend/models"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type CategoryRuleHandlers struct {
+	DB *gorm.DB
+}
+
+type categoryRuleRequest struct {
+	Name       string    `json:"name"`
+	Priority   int       `json:"priority"`
+	IsActive   bool      `json:"is_active"`
+	CategoryID uuid.UUID `json:"category_id"`
+
+	DescriptionContains string `json:"description_contains"`
+	DescriptionPattern  string `json:"description_pattern"`
+	Merchant            string `json:"merchant"`
+	MinAmount           *int   `json:"min_amount"`
+	MaxAmount           *int   `json:"max_amount"`
+	// Weekdays は曜日 (0 = 日曜日 〜 6 = 土曜日)
+	Weekdays []int `json:"weekdays"`
+}
+
+func (r *categoryRuleRequest) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if r.CategoryID == uuid.Nil {
+		return errors.New("category_id is required")
+	}
+	seen := map[int]bool{}
+	weekdays := []int{}
+	for _, d := range r.Weekdays {
+		if !seen[d] {
+			seen[d] = true
+			weekdays = append(weekdays, d)
+		}
+	}
+	sort.Ints(weekdays)
+	r.Weekdays = weekdays
+	return nil
+}
+
+func (r *categoryRuleRequest) apply(rule *models.CategoryRule) {
+	weekdays, _ := json.Marshal(r.Weekdays)
+	rule.Name = r.Name
+	rule.Priority = r.Priority
+	rule.IsActive = r.IsActive
+	rule.CategoryID = r.CategoryID
+	rule.DescriptionContains = r.DescriptionContains
+	rule.DescriptionPattern = r.DescriptionPattern
+	rule.Merchant = r.Merchant
+	rule.MinAmount = r.MinAmount
+	rule.MaxAmount = r.MaxAmount
+	rule.Weekdays = datatypes.JSON(weekdays)
+}
+
+// CategoryRulePreview は規則を過去の支出に当てはめた結果
+type CategoryRulePreview struct {
+	// Expenses はカテゴリが変わる支出 (category は変更前のカテゴリ)
+	Expenses []models.Expense `json:"expenses"`
+	Count    int              `json:"count"`
+}
+
+// CategoryRuleApplyResult は規則を過去の支出に当てはめた結果
+type CategoryRuleApplyResult struct {
+	// ExpenseIDs はカテゴリを変更した支出
+	ExpenseIDs []uuid.UUID `json:"expense_ids"`
+	Count      int         `json:"count"`
+}
+
+// bindRule はリクエストを検証して rule に反映する。失敗した場合はレスポンスのステータスも返す
+func (h *CategoryRuleHandlers) bindRule(c echo.Context, req *categoryRuleRequest, rule *models.CategoryRule) (*categorize.Rule, int, error) {
+	if err := c.Bind(req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	req.apply(rule)
+	compiled, err := categorize.Compile(*rule)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if err := checkCategory(h.DB, c, rule.CategoryID); err != nil {
+		return nil, categoryErrorStatus(err), err
+	}
+	return compiled, http.StatusOK, nil
+}
+
+// save は rule を保存し、カテゴリ付きで読み直す
+func (h *CategoryRuleHandlers) save(c echo.Context, rule *models.CategoryRule) error {
+	if err := h.DB.Omit("Category", "User").Save(rule).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if err := ownedDB(h.DB, c).Preload("Category").First(rule, "id = ?", rule.ID).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+// CREATE
+// 条件 (description_contains / description_pattern / merchant / min_amount / max_amount / weekdays) は1つ以上必要
+// is_active を省略すると有効
+func (h *CategoryRuleHandlers) CreateCategoryRule(c echo.Context) error {
+	req := categoryRuleRequest{IsActive: true}
+	rule := models.CategoryRule{UserID: auth.CurrentUserID(c)}
+	if _, status, err := h.bindRule(c, &req, &rule); err != nil {
+		return c.JSON(status, err.Error())
+	}
+	return h.save(c, &rule)
+}
+
+// GET
+// 評価する順 (priority の小さい順、同じなら作成順)
+func (h *CategoryRuleHandlers) GetCategoryRules(c echo.Context) error {
+	rules := []models.CategoryRule{}
+	if err := ownedDB(h.DB, c).Preload("Category").Order("priority ASC, created_at ASC").Find(&rules).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+// UPDATE
+func (h *CategoryRuleHandlers) UpdateCategoryRule(c echo.Context) error {
+	rule, status, err := h.categoryRule(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	req := categoryRuleRequest{IsActive: rule.IsActive}
+	if _, status, err := h.bindRule(c, &req, &rule); err != nil {
+		return c.JSON(status, err.Error())
+	}
+	return h.save(c, &rule)
+}
+
+// DELETE
+// 規則で分類済みの支出のカテゴリはそのまま
+func (h *CategoryRuleHandlers) DeleteCategoryRule(c echo.Context) error {
+	id := c.Param("id")
+	result := ownedDB(h.DB, c).Delete(&models.CategoryRule{}, "id = ?", id)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "CategoryRule not found")
+	}
+	return c.JSON(http.StatusOK, id)
+}
+
+// DRY RUN
+// 保存前の規則 (リクエストは CREATE と同じ) を過去の支出に当てはめた場合にカテゴリが変わる支出を返す
+// 支出は変更しない
+func (h *CategoryRuleHandlers) DryRunCategoryRule(c echo.Context) error {
+	req := categoryRuleRequest{IsActive: true}
+	rule := models.CategoryRule{UserID: auth.CurrentUserID(c)}
+	compiled, status, err := h.bindRule(c, &req, &rule)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	return h.preview(c, compiled)
+}
+
+// DRY RUN BY ID
+// 保存済みの規則を過去の支出に当てはめた場合にカテゴリが変わる支出を返す (APPLY の確認用)
+func (h *CategoryRuleHandlers) DryRunCategoryRuleByID(c echo.Context) error {
+	rule, status, err := h.categoryRule(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	compiled, err := categorize.Compile(rule)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	return h.preview(c, compiled)
+}
+
+// APPLY
+// 保存済みの規則を過去の支出に当てはめ、一致した支出のカテゴリを変更する
+// (無効な規則も当てはめられる。他の規則の優先順は考えない)
+func (h *CategoryRuleHandlers) ApplyCategoryRule(c echo.Context) error {
+	rule, status, err := h.categoryRule(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	compiled, err := categorize.Compile(rule)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	ids, err := categorize.Apply(h.DB, compiled, nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, CategoryRuleApplyResult{ExpenseIDs: ids, Count: len(ids)})
+}
+
+func (h *CategoryRuleHandlers) preview(c echo.Context, rule *categorize.Rule) error {
+	expenses, err := categorize.Preview(h.DB, rule, nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, CategoryRulePreview{Expenses: expenses, Count: len(expenses)})
+}
+
+// categoryRule はパスの id の規則を読み込む。失敗した場合はレスポンスのステータスも返す
+func (h *CategoryRuleHandlers) categoryRule(c echo.Context) (models.CategoryRule, int, error) {
+	var rule models.CategoryRule
+	if err := ownedDB(h.DB, c).First(&rule, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return rule, http.StatusNotFound, errors.New("CategoryRule not found")
+		}
+		return rule, http.StatusInternalServerError, err
+	}
+	return rule, http.StatusOK, nil
+}
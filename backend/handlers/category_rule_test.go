@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"fmt"
+	"kakeibo-backend/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCategoryRuleDryRunAndApply(t *testing.T) {
+	h := &CategoryRuleHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	misc := models.Category{Name: "その他"}
+	cafe := models.Category{Name: "カフェ"}
+	for _, v := range []interface{}{&user, &other, &misc, &cafe} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := time.Date(2026, 5, 9, 10, 0, 0, 0, time.UTC)
+	for i, e := range []models.Expense{
+		{Amount: 480, Description: "ｽﾀｰﾊﾞｯｸｽ 渋谷", UserID: user.ID, CategoryID: misc.ID},
+		{Amount: 520, Description: "スターバックス 新宿", UserID: user.ID, CategoryID: cafe.ID}, // 既にカフェ
+		{Amount: 1980, Description: "書店", UserID: user.ID, CategoryID: misc.ID},
+		{Amount: 480, Description: "スターバックス", UserID: other.ID, CategoryID: misc.ID}, // 他人の支出
+	} {
+		e.SpentAt = day.AddDate(0, 0, i)
+		if err := h.DB.Create(&e).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body := fmt.Sprintf(`{"name": "スタバ", "description_contains": "スターバックス", "category_id": %q}`, cafe.ID)
+	for name, invalid := range map[string]string{
+		"no condition": fmt.Sprintf(`{"name": "x", "category_id": %q}`, cafe.ID),
+		"bad pattern":  fmt.Sprintf(`{"name": "x", "description_pattern": "(", "category_id": %q}`, cafe.ID),
+		"no name":      fmt.Sprintf(`{"description_contains": "x", "category_id": %q}`, cafe.ID),
+	} {
+		if rec := doRequest(t, &user, http.MethodPost, "/api/category-rules", invalid, nil, h.CreateCategoryRule); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+
+	var preview CategoryRulePreview
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/category-rules/dry-run", body, nil, h.DryRunCategoryRule), &preview)
+	if preview.Count != 1 || preview.Expenses[0].Amount != 480 || preview.Expenses[0].Category.Name != "その他" {
+		t.Errorf("unexpected preview: %+v", preview)
+	}
+	var rules []models.CategoryRule
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/category-rules", "", nil, h.GetCategoryRules), &rules)
+	if len(rules) != 0 {
+		t.Errorf("dry run should not save the rule: %+v", rules)
+	}
+
+	var rule models.CategoryRule
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/category-rules", body, nil, h.CreateCategoryRule), &rule)
+	if !rule.IsActive || rule.Category.Name != "カフェ" || rule.UserID != user.ID {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+	params := map[string]string{"id": rule.ID.String()}
+	if rec := doRequest(t, &other, http.MethodPost, "/", "", params, h.ApplyCategoryRule); rec.Code != http.StatusNotFound {
+		t.Errorf("other user: status = %d, want 404", rec.Code)
+	}
+	var result CategoryRuleApplyResult
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", "", params, h.ApplyCategoryRule), &result)
+	if result.Count != 1 || result.ExpenseIDs[0] != preview.Expenses[0].ID {
+		t.Errorf("unexpected apply result: %+v", result)
+	}
+	var count int64
+	h.DB.Model(&models.Expense{}).Where("category_id = ?", cafe.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("got %d cafe expenses, want 2", count)
+	}
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/", "", params, h.DryRunCategoryRuleByID), &preview)
+	if preview.Count != 0 {
+		t.Errorf("nothing should change after apply: %+v", preview)
+	}
+
+	// 無効にしても更新の他の項目は反映される
+	update := fmt.Sprintf(`{"name": "スタバ", "merchant": "スターバックス", "is_active": false, "priority": 5, "category_id": %q}`, cafe.ID)
+	decodeBody(t, doRequest(t, &user, http.MethodPut, "/", update, params, h.UpdateCategoryRule), &rule)
+	if rule.IsActive || rule.Priority != 5 || rule.Merchant != "スターバックス" || rule.DescriptionContains != "" {
+		t.Errorf("unexpected updated rule: %+v", rule)
+	}
+}
+
+func TestCreateExpenseWithCategoryRule(t *testing.T) {
+	db := newTestDB(t)
+	h := &ExpenseHandlers{DB: db}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	food := models.Category{Name: "食費"}
+	transport := models.Category{Name: "交通費"}
+	for _, v := range []interface{}{&user, &food, &transport} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range []models.CategoryRule{
+		{Name: "平日の電車", DescriptionPattern: `^JR`, Weekdays: []byte(`[1,2,3,4,5]`), Priority: 1, IsActive: true, CategoryID: transport.ID, UserID: user.ID},
+		{Name: "コンビニ", Merchant: "セブンイレブン", Priority: 2, IsActive: true, CategoryID: food.ID, UserID: user.ID},
+		{Name: "無効", DescriptionContains: "JR", IsActive: false, CategoryID: food.ID, UserID: user.ID},
+	} {
+		if err := db.Create(&r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var e models.Expense
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/expenses", `{"amount": 540, "description": "ｾﾌﾞﾝｲﾚﾌﾞﾝ", "spent_at": "2026-05-09T03:00:00Z"}`, nil, h.CreateExpense), &e)
+	if e.CategoryID != food.ID {
+		t.Errorf("category = %s, want food", e.Category.Name)
+	}
+	// 指定したカテゴリは規則より優先する
+	body := fmt.Sprintf(`{"amount": 540, "description": "セブンイレブン", "spent_at": "2026-05-09T03:00:00Z", "category_id": %q}`, transport.ID)
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/expenses", body, nil, h.CreateExpense), &e)
+	if e.CategoryID != transport.ID {
+		t.Errorf("category = %s, want transport", e.Category.Name)
+	}
+	// 2026-05-09 は土曜日なので平日の規則には一致しない (無効な規則も使わない)
+	if rec := doRequest(t, &user, http.MethodPost, "/api/expenses", `{"amount": 210, "description": "JR", "spent_at": "2026-05-09T03:00:00Z"}`, nil, h.CreateExpense); rec.Code != http.StatusBadRequest {
+		t.Errorf("no rule matched: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestImportCommitWithCategoryRule(t *testing.T) {
+	h := &ImportHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	food := models.Category{Name: "食費"}
+	card := models.Category{Name: "カード"}
+	for _, v := range []interface{}{&user, &food, &card} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	rule := models.CategoryRule{Name: "スーパー", DescriptionContains: "スーパー", IsActive: true, CategoryID: food.ID, UserID: user.ID}
+	if err := h.DB.Create(&rule).Error; err != nil {
+		t.Fatal(err)
+	}
+	var batch models.ImportBatch
+	decodeBody(t, uploadCSV(t, h, &user, "enavi202605.csv", rakutenCSV), &batch)
+	params := map[string]string{"id": batch.ID.String()}
+
+	// 規則に一致しない行があるのに category_id が無い
+	if rec := doRequest(t, &user, http.MethodPost, "/", `{}`, params, h.CommitImport); rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", fmt.Sprintf(`{"category_id": %q}`, card.ID), params, h.CommitImport), &batch)
+	var expenses []models.Expense
+	h.DB.Order("spent_at").Find(&expenses, "import_batch_id = ?", batch.ID)
+	if len(expenses) != 3 || expenses[0].CategoryID != food.ID || expenses[1].CategoryID != card.ID || expenses[2].CategoryID != card.ID {
+		t.Errorf("unexpected expenses: %+v", expenses)
+	}
+}
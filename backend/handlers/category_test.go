@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"fmt"
+	"kakeibo-backend/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCategoryVisibility(t *testing.T) {
+	h := &CategoryHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	system := models.Category{Name: "その他"}
+	for _, v := range []interface{}{&user, &other, &system} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	foreign := models.Category{Name: "秘密", UserID: &other.ID}
+	if err := h.DB.Create(&foreign).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var food models.Category
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/category", `{"name": "食費", "color": "#E57373", "icon": "restaurant"}`, nil, h.CreateCategory), &food)
+	if food.UserID == nil || *food.UserID != user.ID || food.Color != "#E57373" {
+		t.Errorf("category should belong to the user: %+v", food)
+	}
+
+	var list []models.Category
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/category", "", nil, h.GetCategory), &list)
+	if len(list) != 2 {
+		t.Errorf("got %+v, want own and default categories", list)
+	}
+
+	params := func(c models.Category) map[string]string { return map[string]string{"id": c.ID.String()} }
+	if rec := doRequest(t, &user, http.MethodPut, "/", `{"name": "x"}`, params(system), h.UpdateCategory); rec.Code != http.StatusForbidden {
+		t.Errorf("PUT default: status = %d, want 403", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodDelete, "/", "", params(system), h.DeleteCategory); rec.Code != http.StatusForbidden {
+		t.Errorf("DELETE default: status = %d, want 403", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodPut, "/", `{"name": "x"}`, params(foreign), h.UpdateCategory); rec.Code != http.StatusNotFound {
+		t.Errorf("PUT foreign: status = %d, want 404", rec.Code)
+	}
+
+	// 他人のカテゴリは支出に使えない
+	e := &ExpenseHandlers{DB: h.DB}
+	body := fmt.Sprintf(`{"amount": 100, "description": "x", "spent_at": %q, "category_id": %q}`, time.Now().Format(time.RFC3339), foreign.ID)
+	if rec := doRequest(t, &user, http.MethodPost, "/api/expenses", body, nil, e.CreateExpense); rec.Code != http.StatusBadRequest {
+		t.Errorf("expense with foreign category: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestCategoryHierarchy(t *testing.T) {
+	h := &CategoryHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	var food, eatingOut, lunch models.Category
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/category", `{"name": "食費"}`, nil, h.CreateCategory), &food)
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/category", fmt.Sprintf(`{"name": "外食", "parent_id": %q}`, food.ID), nil, h.CreateCategory), &eatingOut)
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/category", fmt.Sprintf(`{"name": "ランチ", "parent_id": %q}`, eatingOut.ID), nil, h.CreateCategory), &lunch)
+
+	var tree []models.Category
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/category?tree=true", "", nil, h.GetCategory), &tree)
+	if len(tree) != 1 || len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 || tree[0].Children[0].Children[0].Name != "ランチ" {
+		t.Errorf("unexpected tree: %+v", tree)
+	}
+
+	// 自分の子孫を親にすると循環する
+	body := fmt.Sprintf(`{"name": "食費", "parent_id": %q}`, lunch.ID)
+	if rec := doRequest(t, &user, http.MethodPut, "/", body, map[string]string{"id": food.ID.String()}, h.UpdateCategory); rec.Code != http.StatusBadRequest {
+		t.Errorf("cyclic parent: status = %d, want 400", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodDelete, "/", "", map[string]string{"id": food.ID.String()}, h.DeleteCategory); rec.Code != http.StatusConflict {
+		t.Errorf("DELETE with children: status = %d, want 409", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodPost, "/api/category", `{"name": "x", "color": "red"}`, nil, h.CreateCategory); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid color: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestMergeCategory(t *testing.T) {
+	h := &CategoryHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	from := models.Category{Name: "外食", UserID: &user.ID}
+	into := models.Category{Name: "食費", UserID: &user.ID}
+	for _, v := range []*models.Category{&from, &into} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	child := models.Category{Name: "ランチ", ParentID: &from.ID, UserID: &user.ID}
+	if err := h.DB.Create(&child).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rows := []interface{}{
+		&models.Expense{Amount: 100, Description: "a", SpentAt: now, UserID: user.ID, CategoryID: from.ID},
+		&models.Expense{Amount: 200, Description: "b", SpentAt: now, UserID: user.ID, CategoryID: from.ID},
+		&models.Subscription{Name: "x", MonthlyFee: 100, NextBillingDate: now, IsActive: true, UserID: user.ID, CategoryID: from.ID},
+	}
+	for _, v := range rows {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 論理削除した支出も付け替える
+	if err := h.DB.Delete(rows[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 参照が残っている間は削除できない
+	params := map[string]string{"id": from.ID.String()}
+	if rec := doRequest(t, &user, http.MethodDelete, "/", "", params, h.DeleteCategory); rec.Code != http.StatusConflict {
+		t.Errorf("DELETE referenced: status = %d, want 409", rec.Code)
+	}
+	// 子孫には統合できない
+	if rec := doRequest(t, &user, http.MethodPost, "/", fmt.Sprintf(`{"into": %q}`, child.ID), params, h.MergeCategory); rec.Code != http.StatusBadRequest {
+		t.Errorf("merge into descendant: status = %d, want 400", rec.Code)
+	}
+
+	var res CategoryMergeResponse
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", fmt.Sprintf(`{"into": %q}`, into.ID), params, h.MergeCategory), &res)
+	if res.Moved["expenses"] != 2 || res.Moved["subscriptions"] != 1 || res.Moved["subcategories"] != 1 {
+		t.Errorf("moved = %v", res.Moved)
+	}
+	var n int64
+	h.DB.Unscoped().Model(&models.Expense{}).Where("category_id = ?", into.ID).Count(&n)
+	if n != 2 {
+		t.Errorf("got %d expenses in the merged category, want 2", n)
+	}
+	if err := h.DB.First(&child, "id = ?", child.ID).Error; err != nil || *child.ParentID != into.ID {
+		t.Errorf("subcategory should move under the merged category: %+v, %v", child, err)
+	}
+	if err := h.DB.Unscoped().First(&models.Category{}, "id = ?", from.ID).Error; err == nil {
+		t.Error("merged category should be deleted")
+	}
+}
+
+func TestMergeCategoryBudgets(t *testing.T) {
+	h := &CategoryHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	from := models.Category{Name: "外食", UserID: &user.ID}
+	into := models.Category{Name: "食費", UserID: &user.ID}
+	for _, v := range []*models.Category{&from, &into} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	may := time.Date(2026, 5, 1, 0, 0, 0, 0, time.Local)
+	june := may.AddDate(0, 1, 0)
+	budgets := []*models.Budget{
+		{Amount: 10000, CategoryID: from.ID, UserID: user.ID},
+		{Amount: 30000, CategoryID: into.ID, UserID: user.ID},
+		{Amount: 5000, Month: &may, CategoryID: from.ID, UserID: user.ID},
+		{Amount: 40000, Month: &may, CategoryID: into.ID, UserID: user.ID},
+		{Amount: 8000, Month: &june, CategoryID: from.ID, UserID: user.ID}, // into に6月の予算は無い
+	}
+	for _, b := range budgets {
+		if err := h.DB.Create(b).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	alert := models.BudgetAlert{BudgetID: budgets[0].ID, Month: may, Threshold: 80, Percent: 85, SentAt: may, UserID: user.ID}
+	if err := h.DB.Create(&alert).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var res CategoryMergeResponse
+	params := map[string]string{"id": from.ID.String()}
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", fmt.Sprintf(`{"into": %q}`, into.ID), params, h.MergeCategory), &res)
+	if res.Moved["budgets"] != 3 {
+		t.Errorf("moved = %v", res.Moved)
+	}
+
+	// 同じ月の予算は1つにまとめる
+	var got []models.Budget
+	h.DB.Order("amount").Find(&got, "category_id = ?", into.ID)
+	want := []uint64{8000, 40000, 45000}
+	if len(got) != len(want) {
+		t.Fatalf("got %d budgets, want %d: %+v", len(got), len(want), got)
+	}
+	for i, b := range got {
+		if b.Amount != want[i] {
+			t.Errorf("budget %d amount = %d, want %d", i, b.Amount, want[i])
+		}
+	}
+	if got[0].ID != budgets[4].ID || got[1].ID != budgets[1].ID || got[2].ID != budgets[3].ID {
+		t.Errorf("unexpected budgets: %+v", got)
+	}
+	var n int64
+	h.DB.Unscoped().Model(&models.Budget{}).Where("category_id = ?", from.ID).Count(&n)
+	if n != 0 {
+		t.Errorf("%d budgets still reference the merged category", n)
+	}
+	h.DB.Unscoped().Model(&models.BudgetAlert{}).Where("budget_id = ?", budgets[0].ID).Count(&n)
+	if n != 0 {
+		t.Errorf("alerts of the merged budget should be deleted")
+	}
+}
+
+// TestMergeCategoryBudgetsIntoAncestor は子カテゴリを親に統合しても予算を足さないことのテスト
+// 親の予算は子孫の支出も含めて使うため、子の予算を足すと二重になる
+func TestMergeCategoryBudgetsIntoAncestor(t *testing.T) {
+	h := &CategoryHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 孫のカテゴリ (ランチ → 外食 → 食費) も子孫として扱う
+	food := models.Category{Name: "食費", UserID: &user.ID}
+	eatingOut := models.Category{Name: "外食", UserID: &user.ID}
+	lunch := models.Category{Name: "ランチ", UserID: &user.ID}
+	var parent *models.Category
+	for _, v := range []*models.Category{&food, &eatingOut, &lunch} {
+		if parent != nil {
+			v.ParentID = &parent.ID
+		}
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+		parent = v
+	}
+	budgets := []*models.Budget{
+		{Amount: 30000, CategoryID: food.ID, UserID: user.ID},
+		{Amount: 5000, CategoryID: lunch.ID, UserID: user.ID},
+	}
+	for _, b := range budgets {
+		if err := h.DB.Create(b).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var res CategoryMergeResponse
+	params := map[string]string{"id": lunch.ID.String()}
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", fmt.Sprintf(`{"into": %q}`, food.ID), params, h.MergeCategory), &res)
+	if res.Moved["budgets"] != 1 {
+		t.Errorf("moved = %v", res.Moved)
+	}
+	var got []models.Budget
+	h.DB.Unscoped().Find(&got)
+	if len(got) != 1 || got[0].ID != budgets[0].ID || got[0].Amount != 30000 {
+		t.Errorf("budgets = %+v, want only the parent's 30000", got)
+	}
+}
+
+func TestArchiveCategory(t *testing.T) {
+	h := &CategoryHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	old := models.Category{Name: "旧費目", UserID: &user.ID}
+	if err := h.DB.Create(&old).Error; err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{"id": old.ID.String()}
+
+	var archived models.Category
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", "", params, h.ArchiveCategory), &archived)
+	if archived.ArchivedAt == nil {
+		t.Fatalf("archived_at should be set: %+v", archived)
+	}
+	var list []models.Category
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/category", "", nil, h.GetCategory), &list)
+	if len(list) != 0 {
+		t.Errorf("archived category should be hidden: %+v", list)
+	}
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/category?include_archived=true", "", nil, h.GetCategory), &list)
+	if len(list) != 1 {
+		t.Errorf("include_archived should return it: %+v", list)
+	}
+
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", "", params, h.UnarchiveCategory), &archived)
+	if archived.ArchivedAt != nil {
+		t.Errorf("archived_at should be cleared: %+v", archived)
+	}
+	// 参照が無ければ完全に削除する
+	if rec := doRequest(t, &user, http.MethodDelete, "/", "", params, h.DeleteCategory); rec.Code != http.StatusOK {
+		t.Errorf("DELETE unreferenced: status = %d, want 200", rec.Code)
+	}
+	if err := h.DB.Unscoped().First(&models.Category{}, "id = ?", old.ID).Error; err == nil {
+		t.Error("category should be hard-deleted")
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB はテストごとに独立したインメモリSQLiteを返す
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	// :memory: は接続ごとに別DBになるため1接続に固定する
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Session{},
+		&models.Category{},
+		&models.Subscription{},
+		&models.Expense{},
+		&models.PublicFee{},
+		&models.NotificationSetting{},
+		&models.Notification{},
+		&models.ScrapedItem{},
+		&models.WatchItem{},
+		&models.PriceHistory{},
+		&models.WishlistItem{},
+		&models.Budget{},
+		&models.BudgetAlert{},
+		&models.ImportBatch{},
+		&models.DuplicateCandidate{},
+		&models.CategoryRule{},
+	); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// doRequest は user としてログインした状態でハンドラーを直接呼び出し、レスポンスを返す
+func doRequest(t *testing.T, user *models.User, method, target, body string, params map[string]string, h echo.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if user != nil {
+		auth.SetCurrentUser(c, user, &models.Session{UserID: user.ID})
+	}
+	if len(params) > 0 {
+		var names, values []string
+		for name, value := range params {
+			names = append(names, name)
+			values = append(values, value)
+		}
+		c.SetParamNames(names...)
+		c.SetParamValues(values...)
+	}
+	if err := h(c); err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	return rec
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rec.Body.String())
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"kakeibo-backend/duplicate"
+	"kakeibo-backend/models"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type DuplicateHandlers struct {
+	DB *gorm.DB
+}
+
+type duplicateMergeRequest struct {
+	// Keep は残す支出。duplicate_of (先に登録されていた支出、既定) か expense
+	Keep string `json:"keep"`
+}
+
+func (r duplicateMergeRequest) validate() error {
+	switch r.Keep {
+	case "", "duplicate_of", "expense":
+		return nil
+	}
+	return errors.New("keep must be duplicate_of or expense")
+}
+
+// GET
+// ?status=pending (既定)|merged|ignored で絞り込み。新しい順
+// pending はどちらの支出も削除されていない組のみ返す
+func (h *DuplicateHandlers) GetDuplicates(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status == "" {
+		status = models.DuplicatePending
+	}
+	query := h.duplicateCandidates(c)
+	switch status {
+	case models.DuplicatePending:
+		alive := h.DB.Model(&models.Expense{}).Select("id")
+		query = query.Where("status = ? AND expense_id IN (?) AND duplicate_of_id IN (?)", status, alive, alive)
+	case models.DuplicateMerged, models.DuplicateIgnored:
+		query = query.Where("status = ?", status)
+	default:
+		return c.JSON(http.StatusBadRequest, "status must be pending, merged or ignored")
+	}
+	candidates := []models.DuplicateCandidate{}
+	if err := query.Order("created_at DESC").Find(&candidates).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, candidates)
+}
+
+// MERGE
+// 組の片方の支出を削除して1件にする (既定では後から登録された expense を削除する)
+// pending でなければ 409
+func (h *DuplicateHandlers) MergeDuplicate(c echo.Context) error {
+	candidate, status, err := h.duplicateCandidate(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	req := duplicateMergeRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	// 組のどちらかを既に削除していれば判断できない
+	if candidate.Expense.DeletedAt.Valid || candidate.DuplicateOf.DeletedAt.Valid {
+		return c.JSON(http.StatusConflict, "expense is already deleted")
+	}
+	keep, remove := candidate.DuplicateOf, candidate.Expense
+	if req.Keep == "expense" {
+		keep, remove = remove, keep
+	}
+	if err := duplicate.Merge(h.DB, candidate, keep, remove); err != nil {
+		if errors.Is(err, duplicate.ErrNotPending) {
+			return c.JSON(http.StatusConflict, err.Error())
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	candidate, status, err = h.duplicateCandidate(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	return c.JSON(http.StatusOK, candidate)
+}
+
+// IGNORE
+// 組を別の支出と判断する (同じ組は再び候補にならない)
+// pending でなければ 409
+func (h *DuplicateHandlers) IgnoreDuplicate(c echo.Context) error {
+	candidate, status, err := h.duplicateCandidate(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	if err := duplicate.Ignore(h.DB, candidate); err != nil {
+		if errors.Is(err, duplicate.ErrNotPending) {
+			return c.JSON(http.StatusConflict, err.Error())
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	candidate, status, err = h.duplicateCandidate(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	return c.JSON(http.StatusOK, candidate)
+}
+
+// duplicateCandidates は自分の重複の候補を両方の支出 (削除したものも含む) と一緒に読み込むクエリ
+func (h *DuplicateHandlers) duplicateCandidates(c echo.Context) *gorm.DB {
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+	return ownedDB(h.DB, c).
+		Preload("Expense", unscoped).Preload("Expense.Category").
+		Preload("DuplicateOf", unscoped).Preload("DuplicateOf.Category")
+}
+
+// duplicateCandidate はパスの id の重複の候補を読み込む。失敗した場合はレスポンスのステータスも返す
+func (h *DuplicateHandlers) duplicateCandidate(c echo.Context) (models.DuplicateCandidate, int, error) {
+	var candidate models.DuplicateCandidate
+	if err := h.duplicateCandidates(c).First(&candidate, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return candidate, http.StatusNotFound, errors.New("DuplicateCandidate not found")
+		}
+		return candidate, http.StatusInternalServerError, err
+	}
+	return candidate, http.StatusOK, nil
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"fmt"
+	"kakeibo-backend/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDuplicateReviewQueue(t *testing.T) {
+	db := newTestDB(t)
+	expenses := &ExpenseHandlers{DB: db}
+	h := &DuplicateHandlers{DB: db}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	food := models.Category{Name: "食費"}
+	for _, v := range []interface{}{&user, &other, &food} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	create := func(amount int, description, spentAt string) models.Expense {
+		var e models.Expense
+		body := fmt.Sprintf(`{"amount": %d, "description": %q, "spent_at": %q, "category_id": %q}`, amount, description, spentAt, food.ID)
+		decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/expenses", body, nil, expenses.CreateExpense), &e)
+		return e
+	}
+
+	first := create(1280, "スーパー", "2026-05-03T10:00:00Z")
+	if len(first.PossibleDuplicates) != 0 {
+		t.Errorf("first expense has duplicates: %v", first.PossibleDuplicates)
+	}
+	second := create(1280, "ｽｰﾊﾟｰ", "2026-05-04T00:00:00Z")
+	if len(second.PossibleDuplicates) != 1 || second.PossibleDuplicates[0] != first.ID {
+		t.Fatalf("possible_duplicates = %v, want [%s]", second.PossibleDuplicates, first.ID)
+	}
+	create(480, "カフェ", "2026-05-05T00:00:00Z")
+	third := create(480, "カフェ", "2026-05-05T09:00:00Z")
+
+	var queue []models.DuplicateCandidate
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/duplicates", "", nil, h.GetDuplicates), &queue)
+	if len(queue) != 2 {
+		t.Fatalf("got %d candidates, want 2", len(queue))
+	}
+	var merge, ignore models.DuplicateCandidate
+	for _, d := range queue {
+		if d.ExpenseID == second.ID {
+			merge = d
+		} else if d.ExpenseID == third.ID {
+			ignore = d
+		}
+	}
+	if merge.DuplicateOf.Description != "スーパー" || merge.Expense.Category.Name != "食費" {
+		t.Errorf("expenses not preloaded: %+v", merge)
+	}
+
+	params := map[string]string{"id": merge.ID.String()}
+	if rec := doRequest(t, &other, http.MethodPost, "/", "", params, h.MergeDuplicate); rec.Code != http.StatusNotFound {
+		t.Errorf("other user: status = %d, want 404", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodPost, "/", `{"keep": "both"}`, params, h.MergeDuplicate); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid keep: status = %d, want 400", rec.Code)
+	}
+	var merged models.DuplicateCandidate
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", "", params, h.MergeDuplicate), &merged)
+	if merged.Status != models.DuplicateMerged || merged.KeptExpenseID == nil || *merged.KeptExpenseID != first.ID ||
+		!merged.Expense.DeletedAt.Valid || merged.DuplicateOf.DeletedAt.Valid {
+		t.Errorf("unexpected merged candidate: %+v", merged)
+	}
+	if rec := doRequest(t, &user, http.MethodPost, "/", "", params, h.MergeDuplicate); rec.Code != http.StatusConflict {
+		t.Errorf("second merge: status = %d, want 409", rec.Code)
+	}
+
+	var ignored models.DuplicateCandidate
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", "", map[string]string{"id": ignore.ID.String()}, h.IgnoreDuplicate), &ignored)
+	if ignored.Status != models.DuplicateIgnored || ignored.ResolvedAt == nil {
+		t.Errorf("unexpected ignored candidate: %+v", ignored)
+	}
+	var count int64
+	db.Model(&models.Expense{}).Count(&count)
+	if count != 3 {
+		t.Errorf("got %d expenses, want 3 (only the merged duplicate is deleted)", count)
+	}
+
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/duplicates", "", nil, h.GetDuplicates), &queue)
+	if len(queue) != 0 {
+		t.Errorf("queue should be empty after review: %+v", queue)
+	}
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/duplicates?status=ignored", "", nil, h.GetDuplicates), &queue)
+	if len(queue) != 1 || queue[0].ID != ignore.ID {
+		t.Errorf("unexpected ignored list: %+v", queue)
+	}
+	decodeBody(t, doRequest(t, &other, http.MethodGet, "/api/duplicates?status=merged", "", nil, h.GetDuplicates), &queue)
+	if len(queue) != 0 {
+		t.Errorf("other user sees candidates: %+v", queue)
+	}
+}
+
+func TestImportCommitFlagsDuplicates(t *testing.T) {
+	h := &ImportHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	card := models.Category{Name: "カード"}
+	for _, v := range []interface{}{&user, &card} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var batch models.ImportBatch
+	decodeBody(t, uploadCSV(t, h, &user, "enavi202605.csv", rakutenCSV), &batch)
+	// 手入力済みのカフェ (明細の 2026/05/05 から日付が1日ずれている)
+	manual := models.Expense{Amount: 480, Description: "カフェ", SpentAt: time.Date(2026, 5, 6, 0, 0, 0, 0, time.Local), UserID: user.ID, CategoryID: card.ID}
+	if err := h.DB.Create(&manual).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	params := map[string]string{"id": batch.ID.String()}
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", fmt.Sprintf(`{"category_id": %q}`, card.ID), params, h.CommitImport), &batch)
+	if batch.ExpenseCount != 3 || batch.DuplicateCount != 1 {
+		t.Errorf("expense_count = %d, duplicate_count = %d; want 3, 1", batch.ExpenseCount, batch.DuplicateCount)
+	}
+	var candidates []models.DuplicateCandidate
+	h.DB.Find(&candidates)
+	if len(candidates) != 1 || candidates[0].DuplicateOfID != manual.ID {
+		t.Errorf("unexpected candidates: %+v", candidates)
+	}
+}
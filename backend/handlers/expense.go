@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/categorize"
+	"kakeibo-backend/duplicate"
+	"kakeibo-backend/models"
+	"kakeibo-backend/suggest"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ExpenseHandlers struct {
+	DB *gorm.DB
+	// Suggester はカテゴリの推測に使う (nil ならリクエストのたびに履歴全体から学習する)
+	Suggester *suggest.Suggester
+}
+
+// 推測したカテゴリの件数 (limit) の既定値と上限
+const (
+	defaultSuggestionLimit = 3
+	maxSuggestionLimit     = 10
+)
+
+// CategorySuggestion は推測したカテゴリ
+type CategorySuggestion struct {
+	CategoryID uuid.UUID       `json:"category_id"`
+	Category   models.Category `json:"category"`
+	// Confidence は確信度 (0〜1、使えるカテゴリ全体の合計が1)
+	Confidence float64 `json:"confidence"`
+}
+
+// CategorySuggestionResponse はカテゴリの推測のレスポンス
+type CategorySuggestionResponse struct {
+	Suggestions []CategorySuggestion `json:"suggestions"`
+	// TrainedExpenses は学習に使った支出の数
+	TrainedExpenses int `json:"trained_expenses"`
+}
+
+type expenseRequest struct {
+	Amount      int       `json:"amount"`
+	Description string    `json:"description"`
+	SpentAt     time.Time `json:"spent_at"`
+	CategoryID  uuid.UUID `json:"category_id"`
+}
+
+func (r expenseRequest) validate() error {
+	if r.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if strings.TrimSpace(r.Description) == "" {
+		return errors.New("description is required")
+	}
+	if r.SpentAt.IsZero() {
+		return errors.New("spent_at is required")
+	}
+	if r.CategoryID == uuid.Nil {
+		return errors.New("category_id is required")
+	}
+	return nil
+}
+
+// ExpenseListResponse は一覧取得のレスポンス
+// NextCursor が空なら最終ページ
+type ExpenseListResponse struct {
+	Expenses   []models.Expense `json:"expenses"`
+	NextCursor string           `json:"next_cursor"`
+}
+
+// expenseCursor はキーセットページネーション用のカーソル
+// (spent_at, id) の組で並び順上の位置を表す
+type expenseCursor struct {
+	SpentAt time.Time
+	ID      uuid.UUID
+}
+
+func (c expenseCursor) encode() string {
+	raw := c.SpentAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeExpenseCursor(s string) (expenseCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return expenseCursor{}, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return expenseCursor{}, fmt.Errorf("invalid cursor")
+	}
+	spentAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return expenseCursor{}, fmt.Errorf("invalid cursor")
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return expenseCursor{}, fmt.Errorf("invalid cursor")
+	}
+	return expenseCursor{SpentAt: spentAt, ID: id}, nil
+}
+
+// CREATE
+// category_id を省略すると、カテゴリの規則 (/api/category-rules) で最初に一致したカテゴリにする
+// 重複の候補が見つかった場合は possible_duplicates にその支出の ID を返す (/api/duplicates で確認する)
+func (h *ExpenseHandlers) CreateExpense(c echo.Context) error {
+	req := expenseRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.CategoryID == uuid.Nil {
+		engine, err := categorize.Load(h.DB, auth.CurrentUserID(c))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		rule := engine.Categorize(models.Expense{Amount: req.Amount, Description: req.Description, SpentAt: req.SpentAt})
+		if rule == nil {
+			return c.JSON(http.StatusBadRequest, "category_id is required (no category rule matched)")
+		}
+		req.CategoryID = rule.CategoryID
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := checkCategory(h.DB, c, req.CategoryID); err != nil {
+		return c.JSON(categoryErrorStatus(err), err.Error())
+	}
+	expense := models.Expense{
+		Amount:      req.Amount,
+		Description: req.Description,
+		SpentAt:     req.SpentAt,
+		UserID:      auth.CurrentUserID(c),
+		CategoryID:  req.CategoryID,
+	}
+	var duplicates []models.Expense
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&expense).Error; err != nil {
+			return err
+		}
+		var err error
+		duplicates, err = (&duplicate.Detector{}).Flag(tx, expense)
+		return err
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.DB.Preload("Category").First(&expense, "id = ?", expense.ID).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	for _, d := range duplicates {
+		expense.PossibleDuplicates = append(expense.PossibleDuplicates, d.ID)
+	}
+	return c.JSON(http.StatusOK, expense)
+}
+
+// GET
+// クエリパラメータ:
+//
+//	category_id                  : 絞り込み
+//	from, to                     : SpentAt の範囲 (YYYY-MM-DD は日単位で to を含む)
+//	min_amount, max_amount       : 金額の範囲 (両端を含む)
+//	order                        : desc (既定) / asc  ※SpentAt順
+//	limit, cursor                : ページネーション (cursor は前回の next_cursor)
+func (h *ExpenseHandlers) GetExpense(c echo.Context) error {
+	query := ownedDB(h.DB, c).Model(&models.Expense{}).Preload("Category")
+
+	categoryID, err := parseOptionalUUID(c.QueryParam("category_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if categoryID != uuid.Nil {
+		query = query.Where("category_id = ?", categoryID)
+	}
+
+	if from := c.QueryParam("from"); from != "" {
+		t, _, err := parseDate(from)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		query = query.Where("spent_at >= ?", t)
+	}
+	if to := c.QueryParam("to"); to != "" {
+		t, dateOnly, err := parseDate(to)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		if dateOnly {
+			query = query.Where("spent_at < ?", t.AddDate(0, 0, 1))
+		} else {
+			query = query.Where("spent_at <= ?", t)
+		}
+	}
+
+	minAmount, err := parseOptionalInt("min_amount", c.QueryParam("min_amount"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if minAmount != nil {
+		query = query.Where("amount >= ?", *minAmount)
+	}
+	maxAmount, err := parseOptionalInt("max_amount", c.QueryParam("max_amount"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if maxAmount != nil {
+		query = query.Where("amount <= ?", *maxAmount)
+	}
+
+	desc := true
+	switch c.QueryParam("order") {
+	case "", "desc":
+	case "asc":
+		desc = false
+	default:
+		return c.JSON(http.StatusBadRequest, "order must be asc or desc")
+	}
+
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		cur, err := decodeExpenseCursor(cursor)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		query = query.Where(
+			fmt.Sprintf("(spent_at %s ?) OR (spent_at = ? AND id %s ?)", op, op),
+			cur.SpentAt, cur.SpentAt, cur.ID,
+		)
+	}
+
+	limit, err := parseLimit(c.QueryParam("limit"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if desc {
+		query = query.Order("spent_at DESC").Order("id DESC")
+	} else {
+		query = query.Order("spent_at ASC").Order("id ASC")
+	}
+
+	// 1件多く取得して次ページの有無を判定する
+	expenses := []models.Expense{}
+	if err := query.Limit(limit + 1).Find(&expenses).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	res := ExpenseListResponse{Expenses: expenses}
+	if len(expenses) > limit {
+		res.Expenses = expenses[:limit]
+		last := res.Expenses[limit-1]
+		res.NextCursor = expenseCursor{SpentAt: last.SpentAt, ID: last.ID}.encode()
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// GET BY DATE
+// :date (YYYY-MM-DD) の1日分を SpentAt 昇順で返す
+func (h *ExpenseHandlers) GetExpenseByDate(c echo.Context) error {
+	day, err := time.ParseInLocation("2006-01-02", c.Param("date"), time.Local)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "date must be YYYY-MM-DD")
+	}
+	query := ownedDB(h.DB, c).Preload("Category").
+		Where("spent_at >= ? AND spent_at < ?", day, day.AddDate(0, 0, 1))
+
+	expenses := []models.Expense{}
+	if err := query.Order("spent_at ASC").Order("id ASC").Find(&expenses).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, expenses)
+}
+
+// SUGGEST CATEGORY
+// ?description= の支出のカテゴリを、自分の分類済みの支出の履歴から推測して確信度の高い順に返す
+// ?limit= で件数 (既定 3、最大 10)。アーカイブしたカテゴリは返さない
+func (h *ExpenseHandlers) SuggestCategory(c echo.Context) error {
+	description := c.QueryParam("description")
+	if strings.TrimSpace(description) == "" {
+		return c.JSON(http.StatusBadRequest, "description is required")
+	}
+	limit := defaultSuggestionLimit
+	if l := c.QueryParam("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxSuggestionLimit {
+			return c.JSON(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSuggestionLimit))
+		}
+		limit = n
+	}
+	suggester := h.Suggester
+	if suggester == nil {
+		suggester = &suggest.Suggester{DB: h.DB}
+	}
+	suggestions, trained, err := suggester.Suggest(auth.CurrentUserID(c), description, 0)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	res := CategorySuggestionResponse{Suggestions: []CategorySuggestion{}, TrainedExpenses: trained}
+	if len(suggestions) == 0 {
+		return c.JSON(http.StatusOK, res)
+	}
+	ids := make([]uuid.UUID, 0, len(suggestions))
+	for _, s := range suggestions {
+		ids = append(ids, s.CategoryID)
+	}
+	var categories []models.Category
+	if err := visibleCategories(h.DB, c).Where("id IN ? AND archived_at IS NULL", ids).Find(&categories).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	byID := map[uuid.UUID]models.Category{}
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	// 使えなくなったカテゴリを除いてから確信度を正規化し直す
+	total := 0.0
+	for _, s := range suggestions {
+		if _, ok := byID[s.CategoryID]; ok {
+			total += s.Confidence
+		}
+	}
+	for _, s := range suggestions {
+		category, ok := byID[s.CategoryID]
+		if !ok {
+			continue
+		}
+		res.Suggestions = append(res.Suggestions, CategorySuggestion{
+			CategoryID: s.CategoryID,
+			Category:   category,
+			Confidence: math.Round(s.Confidence/total*1000) / 1000,
+		})
+		if len(res.Suggestions) == limit {
+			break
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// UPDATE
+func (h *ExpenseHandlers) UpdateExpense(c echo.Context) error {
+	id := c.Param("id")
+	var expense models.Expense
+	if err := ownedDB(h.DB, c).First(&expense, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "Expense not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	req := expenseRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := checkCategory(h.DB, c, req.CategoryID); err != nil {
+		return c.JSON(categoryErrorStatus(err), err.Error())
+	}
+	expense.Amount = req.Amount
+	expense.Description = req.Description
+	expense.SpentAt = req.SpentAt
+	expense.CategoryID = req.CategoryID
+	// 関連の Category を Save で上書きしないよう Omit する
+	if err := h.DB.Omit("Category").Save(&expense).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.DB.Preload("Category").First(&expense, "id = ?", expense.ID).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, expense)
+}
+
+// DELETE
+func (h *ExpenseHandlers) DeleteExpense(c echo.Context) error {
+	id := c.Param("id")
+	result := ownedDB(h.DB, c).Delete(&models.Expense{}, "id = ?", id)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "Expense not found")
+	}
+	return c.JSON(http.StatusOK, id)
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"kakeibo-backend/models"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// seedExpenses は user に5件、other に1件の支出を登録する
+func seedExpenses(t *testing.T, h *ExpenseHandlers) (user, other models.User) {
+	t.Helper()
+	user = models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other = models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	food := models.Category{Name: "食費"}
+	for _, v := range []interface{}{&user, &other, &food} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		e := models.Expense{Amount: 100 * (i + 1), Description: "lunch", SpentAt: base.AddDate(0, 0, i), UserID: user.ID, CategoryID: food.ID}
+		if err := h.DB.Create(&e).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := models.Expense{Amount: 9999, Description: "other", SpentAt: base, UserID: other.ID, CategoryID: food.ID}
+	if err := h.DB.Create(&e).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user, other
+}
+
+func TestGetExpensePagination(t *testing.T) {
+	h := &ExpenseHandlers{DB: newTestDB(t)}
+	user, _ := seedExpenses(t, h)
+
+	var amounts []int
+	cursor := ""
+	for page := 0; page < 10; page++ {
+		q := url.Values{"limit": {"2"}, "cursor": {cursor}}
+		var res ExpenseListResponse
+		decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/expenses?"+q.Encode(), "", nil, h.GetExpense), &res)
+		for _, e := range res.Expenses {
+			if e.Category.Name != "食費" {
+				t.Errorf("category not preloaded: %+v", e.Category)
+			}
+			amounts = append(amounts, e.Amount)
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		cursor = res.NextCursor
+	}
+
+	want := []int{500, 400, 300, 200, 100}
+	if len(amounts) != len(want) {
+		t.Fatalf("amounts = %v, want %v", amounts, want)
+	}
+	for i := range want {
+		if amounts[i] != want[i] {
+			t.Fatalf("amounts = %v, want %v", amounts, want)
+		}
+	}
+}
+
+func TestGetExpenseFilters(t *testing.T) {
+	h := &ExpenseHandlers{DB: newTestDB(t)}
+	user, _ := seedExpenses(t, h)
+
+	q := url.Values{
+		"from":       {"2026-04-02"},
+		"to":         {"2026-04-04"},
+		"min_amount": {"250"},
+		"order":      {"asc"},
+	}
+	var res ExpenseListResponse
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/expenses?"+q.Encode(), "", nil, h.GetExpense), &res)
+
+	if len(res.Expenses) != 2 || res.Expenses[0].Amount != 300 || res.Expenses[1].Amount != 400 {
+		t.Fatalf("unexpected expenses: %+v", res.Expenses)
+	}
+	if res.NextCursor != "" {
+		t.Errorf("next_cursor should be empty on last page")
+	}
+}
+
+func TestGetExpenseRejectsBadCursor(t *testing.T) {
+	h := &ExpenseHandlers{DB: newTestDB(t)}
+	user := models.User{}
+	user.ID = uuid.New()
+	rec := doRequest(t, &user, http.MethodGet, "/api/expenses?cursor=broken", "", nil, h.GetExpense)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
+
+// TestExpenseOwnership は他人の支出が見えず、更新・削除もできないことのテスト
+func TestExpenseOwnership(t *testing.T) {
+	h := &ExpenseHandlers{DB: newTestDB(t)}
+	user, other := seedExpenses(t, h)
+
+	var foreign models.Expense
+	if err := h.DB.First(&foreign, "user_id = ?", other.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{"id": foreign.ID.String()}
+
+	var res ExpenseListResponse
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/expenses?limit=100", "", nil, h.GetExpense), &res)
+	for _, e := range res.Expenses {
+		if e.UserID != user.ID {
+			t.Fatalf("GET returned another user's expense: %+v", e)
+		}
+	}
+
+	var byDate []models.Expense
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/expenses/2026-04-01", "", map[string]string{"date": "2026-04-01"}, h.GetExpenseByDate), &byDate)
+	if len(byDate) != 1 || byDate[0].UserID != user.ID {
+		t.Fatalf("GET by date leaked: %+v", byDate)
+	}
+
+	body := `{"amount":1,"description":"hijack","spent_at":"2026-04-01T00:00:00Z","category_id":"` + foreign.CategoryID.String() + `"}`
+	if rec := doRequest(t, &user, http.MethodPut, "/", body, params, h.UpdateExpense); rec.Code != http.StatusNotFound {
+		t.Errorf("PUT foreign expense: status = %d, want 404", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodDelete, "/", "", params, h.DeleteExpense); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE foreign expense: status = %d, want 404", rec.Code)
+	}
+
+	var after models.Expense
+	if err := h.DB.First(&after, "id = ?", foreign.ID).Error; err != nil {
+		t.Fatalf("foreign expense was deleted: %v", err)
+	}
+	if after.Amount != foreign.Amount {
+		t.Errorf("foreign expense was modified: %+v", after)
+	}
+
+	// 作成時は本文ではなく認証済みユーザーが持ち主になる
+	body = `{"amount":500,"description":"coffee","spent_at":"2026-04-10T00:00:00Z","user_id":"` + other.ID.String() + `","category_id":"` + foreign.CategoryID.String() + `"}`
+	var created models.Expense
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", body, nil, h.CreateExpense), &created)
+	if created.UserID != user.ID {
+		t.Errorf("created expense owner = %s, want %s", created.UserID, user.ID)
+	}
+}
+
+func TestSuggestCategory(t *testing.T) {
+	h := &ExpenseHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	food := models.Category{Name: "食費"}
+	transport := models.Category{Name: "交通費"}
+	old := models.Category{Name: "旧カテゴリ"}
+	for _, v := range []interface{}{&user, &food, &transport, &old} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	for _, e := range []models.Expense{
+		{Description: "セブンイレブン", CategoryID: food.ID},
+		{Description: "ローソン", CategoryID: food.ID},
+		{Description: "JR東日本", CategoryID: transport.ID},
+		{Description: "セブンイレブン", CategoryID: old.ID},
+	} {
+		e.Amount, e.SpentAt, e.UserID = 500, now, user.ID
+		if err := h.DB.Create(&e).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.DB.Model(&old).Update("archived_at", now)
+
+	for _, target := range []string{"/api/expenses/suggest-category", "/api/expenses/suggest-category?description=x&limit=11"} {
+		if rec := doRequest(t, &user, http.MethodGet, target, "", nil, h.SuggestCategory); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", target, rec.Code)
+		}
+	}
+
+	var res CategorySuggestionResponse
+	q := url.Values{"description": {"ｾﾌﾞﾝｲﾚﾌﾞﾝ"}}
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/expenses/suggest-category?"+q.Encode(), "", nil, h.SuggestCategory), &res)
+	// アーカイブしたカテゴリは除く
+	if res.TrainedExpenses != 4 || len(res.Suggestions) != 2 || res.Suggestions[0].Category.Name != "食費" {
+		t.Fatalf("unexpected suggestions: %+v", res)
+	}
+	if sum := res.Suggestions[0].Confidence + res.Suggestions[1].Confidence; sum < 0.99 || sum > 1.01 || res.Suggestions[0].Confidence < 0.5 {
+		t.Errorf("unexpected confidences: %+v", res.Suggestions)
+	}
+
+	q.Set("limit", "1")
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/expenses/suggest-category?"+q.Encode(), "", nil, h.SuggestCategory), &res)
+	if len(res.Suggestions) != 1 {
+		t.Errorf("limit=1: %+v", res.Suggestions)
+	}
+
+	// 履歴の無いユーザーには何も返さない
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	if err := h.DB.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	decodeBody(t, doRequest(t, &other, http.MethodGet, "/api/expenses/suggest-category?"+q.Encode(), "", nil, h.SuggestCategory), &res)
+	if len(res.Suggestions) != 0 || res.TrainedExpenses != 0 {
+		t.Errorf("other user: %+v", res)
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/categorize"
+	"kakeibo-backend/csvimport"
+	"kakeibo-backend/duplicate"
+	"kakeibo-backend/models"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// 取り込むCSVの大きさの上限
+const maxImportFileSize = 5 << 20
+
+// errImportStatus は取り込みの状態が操作できる状態でないことを表す
+var errImportStatus = errors.New("import batch is not in the required status")
+
+type ImportHandlers struct {
+	DB *gorm.DB
+}
+
+type importCommitRequest struct {
+	// CategoryID はカテゴリの規則に一致しない行の支出のカテゴリ (すべての行が規則に一致すれば省略できる)
+	CategoryID uuid.UUID `json:"category_id"`
+	// ExcludeLines は取り込まない行の行番号 (csvimport.Row.Line)
+	ExcludeLines []int `json:"exclude_lines"`
+}
+
+// UPLOAD
+// multipart/form-data の file に明細CSVを指定する (format で形式を指定できる。省略時は自動判定)
+// 読み込んだ行を pending の取り込みとして保存して返す。支出は commit するまで作成しない
+func (h *ImportHandlers) UploadImport(c echo.Context) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "file is required")
+	}
+	if file.Size > maxImportFileSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, "file is too large")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, maxImportFileSize))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	result, err := csvimport.Parse(data, c.FormValue("format"), time.Local)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	rows, err := json.Marshal(result.Rows)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	batch := models.ImportBatch{
+		FileName: file.Filename,
+		Format:   result.Format,
+		Encoding: result.Encoding,
+		Status:   models.ImportPending,
+		Rows:     datatypes.JSON(rows),
+		UserID:   auth.CurrentUserID(c),
+	}
+	for _, r := range result.Rows {
+		if r.Skip == "" {
+			batch.RowCount++
+		}
+	}
+	if err := h.DB.Omit("User").Create(&batch).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, batch)
+}
+
+// GET FORMATS
+// 自動判定できる明細の形式
+func (h *ImportHandlers) GetImportFormats(c echo.Context) error {
+	return c.JSON(http.StatusOK, csvimport.Formats)
+}
+
+// GET
+// 新しい順 (読み込んだ行は含まない)
+func (h *ImportHandlers) GetImports(c echo.Context) error {
+	batches := []models.ImportBatch{}
+	if err := ownedDB(h.DB, c).Omit("rows").Order("created_at DESC").Find(&batches).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, batches)
+}
+
+// GET BY ID
+// 読み込んだ行を含む
+func (h *ImportHandlers) GetImportByID(c echo.Context) error {
+	batch, status, err := h.importBatch(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	return c.JSON(http.StatusOK, batch)
+}
+
+// COMMIT
+// pending の取り込みの行から支出を作成する (skip の行と exclude_lines の行は除く)
+// カテゴリは規則 (/api/category-rules) に一致すればそのカテゴリ、一致しなければ category_id
+// 既存の支出と重複しそうなものは重複の候補として記録し、その数を duplicate_count に返す
+// pending でなければ 409
+func (h *ImportHandlers) CommitImport(c echo.Context) error {
+	batch, status, err := h.importBatch(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	req := importCommitRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.CategoryID != uuid.Nil {
+		if err := checkCategory(h.DB, c, req.CategoryID); err != nil {
+			return c.JSON(categoryErrorStatus(err), err.Error())
+		}
+	}
+	engine, err := categorize.Load(h.DB, batch.UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	var rows []csvimport.Row
+	if err := json.Unmarshal(batch.Rows, &rows); err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	exclude := map[int]bool{}
+	for _, line := range req.ExcludeLines {
+		exclude[line] = true
+	}
+	expenses := []models.Expense{}
+	unmatched := 0
+	for _, r := range rows {
+		if r.Skip != "" || exclude[r.Line] {
+			continue
+		}
+		expense := models.Expense{
+			Amount:        r.Amount,
+			Description:   r.Description,
+			SpentAt:       r.SpentAt,
+			UserID:        batch.UserID,
+			CategoryID:    req.CategoryID,
+			ImportBatchID: &batch.ID,
+		}
+		if rule := engine.Categorize(expense); rule != nil {
+			expense.CategoryID = rule.CategoryID
+		} else if req.CategoryID == uuid.Nil {
+			unmatched++
+		}
+		expenses = append(expenses, expense)
+	}
+	if unmatched > 0 {
+		return c.JSON(http.StatusBadRequest, fmt.Sprintf("category_id is required (%d rows match no category rule)", unmatched))
+	}
+
+	now := time.Now()
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// 同時に取り込んだ場合に支出が二重にならないよう、状態が pending の場合のみ更新する
+		result := tx.Model(&models.ImportBatch{}).
+			Where("id = ? AND status = ?", batch.ID, models.ImportPending).
+			Updates(map[string]interface{}{"status": models.ImportCommitted, "committed_at": now, "expense_count": len(expenses)})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errImportStatus
+		}
+		if len(expenses) == 0 {
+			return nil
+		}
+		if err := tx.Omit("Category").CreateInBatches(&expenses, 100).Error; err != nil {
+			return err
+		}
+		detector := duplicate.Detector{}
+		duplicates := 0
+		for _, e := range expenses {
+			flagged, err := detector.Flag(tx, e)
+			if err != nil {
+				return err
+			}
+			if len(flagged) > 0 {
+				duplicates++
+			}
+		}
+		return tx.Model(&models.ImportBatch{}).Where("id = ?", batch.ID).Update("duplicate_count", duplicates).Error
+	})
+	if errors.Is(err, errImportStatus) {
+		return c.JSON(http.StatusConflict, "import batch is already committed or rolled back")
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	batch, status, err = h.importBatch(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	return c.JSON(http.StatusOK, batch)
+}
+
+// ROLLBACK
+// 取り込んだ支出をまとめて削除する (取り込んだ後に編集した支出も含む)
+// committed でなければ 409
+func (h *ImportHandlers) RollbackImport(c echo.Context) error {
+	batch, status, err := h.importBatch(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ImportBatch{}).
+			Where("id = ? AND status = ?", batch.ID, models.ImportCommitted).
+			Updates(map[string]interface{}{"status": models.ImportRolledBack, "rolled_back_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errImportStatus
+		}
+		return tx.Where("user_id = ? AND import_batch_id = ?", batch.UserID, batch.ID).Delete(&models.Expense{}).Error
+	})
+	if errors.Is(err, errImportStatus) {
+		return c.JSON(http.StatusConflict, "only committed import batches can be rolled back")
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	batch, status, err = h.importBatch(c)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+	return c.JSON(http.StatusOK, batch)
+}
+
+// importBatch はパスの id の取り込みを読み込む。失敗した場合はレスポンスのステータスも返す
+func (h *ImportHandlers) importBatch(c echo.Context) (models.ImportBatch, int, error) {
+	var batch models.ImportBatch
+	if err := ownedDB(h.DB, c).First(&batch, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return batch, http.StatusNotFound, errors.New("ImportBatch not found")
+		}
+		return batch, http.StatusInternalServerError, err
+	}
+	return batch, http.StatusOK, nil
+}
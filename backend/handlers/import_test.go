@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+const rakutenCSV = "\"利用日\",\"利用店名・商品名\",\"利用者\",\"支払方法\",\"利用金額\",\"支払手数料\",\"支払総額\"\n" +
+	"\"2026/05/03\",\"スーパー\",\"本人\",\"1回払い\",\"3,280\",\"0\",\"3,280\"\n" +
+	"\"2026/05/04\",\"ドラッグストア\",\"本人\",\"1回払い\",\"1,100\",\"0\",\"1,100\"\n" +
+	"\"2026/05/05\",\"カフェ\",\"本人\",\"1回払い\",\"480\",\"0\",\"480\"\n" +
+	"\"2026/05/06\",\"返品\",\"本人\",\"1回払い\",\"-1,100\",\"0\",\"-1,100\"\n"
+
+// uploadCSV は multipart/form-data で明細CSVを UploadImport に送る
+func uploadCSV(t *testing.T, h *ImportHandlers, user *models.User, name, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/imports", &body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	auth.SetCurrentUser(c, user, &models.Session{UserID: user.ID})
+	if err := h.UploadImport(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestImportCommitAndRollback(t *testing.T) {
+	h := &ImportHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	for _, u := range []*models.User{&user, &other} {
+		if err := h.DB.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	card := models.Category{Name: "カード", UserID: &user.ID}
+	if err := h.DB.Create(&card).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var batch models.ImportBatch
+	decodeBody(t, uploadCSV(t, h, &user, "enavi202605.csv", rakutenCSV), &batch)
+	if batch.Format != "rakuten_card" || batch.Status != models.ImportPending || batch.RowCount != 3 || batch.FileName != "enavi202605.csv" {
+		t.Fatalf("unexpected batch: %+v", batch)
+	}
+	var count int64
+	h.DB.Model(&models.Expense{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("upload should not create expenses, got %d", count)
+	}
+
+	params := map[string]string{"id": batch.ID.String()}
+	if rec := doRequest(t, &other, http.MethodPost, "/", fmt.Sprintf(`{"category_id": %q}`, card.ID), params, h.CommitImport); rec.Code != http.StatusNotFound {
+		t.Errorf("other user: status = %d, want 404", rec.Code)
+	}
+	// 3行目 (ドラッグストア) は除いて取り込む
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", fmt.Sprintf(`{"category_id": %q, "exclude_lines": [3]}`, card.ID), params, h.CommitImport), &batch)
+	if batch.Status != models.ImportCommitted || batch.ExpenseCount != 2 || batch.CommittedAt == nil {
+		t.Errorf("unexpected committed batch: %+v", batch)
+	}
+	var expenses []models.Expense
+	h.DB.Order("spent_at").Find(&expenses, "import_batch_id = ?", batch.ID)
+	if len(expenses) != 2 || expenses[0].Description != "スーパー" || expenses[0].Amount != 3280 || expenses[1].Description != "カフェ" ||
+		expenses[0].CategoryID != card.ID || expenses[0].UserID != user.ID {
+		t.Errorf("unexpected expenses: %+v", expenses)
+	}
+	if rec := doRequest(t, &user, http.MethodPost, "/", fmt.Sprintf(`{"category_id": %q}`, card.ID), params, h.CommitImport); rec.Code != http.StatusConflict {
+		t.Errorf("second commit: status = %d, want 409", rec.Code)
+	}
+
+	// 手入力の支出は取り消しの対象にならない
+	manual := models.Expense{Amount: 500, Description: "手入力", SpentAt: expenses[0].SpentAt, UserID: user.ID, CategoryID: card.ID}
+	if err := h.DB.Create(&manual).Error; err != nil {
+		t.Fatal(err)
+	}
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/", "", params, h.RollbackImport), &batch)
+	if batch.Status != models.ImportRolledBack || batch.RolledBackAt == nil {
+		t.Errorf("unexpected rolled back batch: %+v", batch)
+	}
+	h.DB.Model(&models.Expense{}).Count(&count)
+	if count != 1 {
+		t.Errorf("got %d expenses after rollback, want 1 (the manual one)", count)
+	}
+	if rec := doRequest(t, &user, http.MethodPost, "/", "", params, h.RollbackImport); rec.Code != http.StatusConflict {
+		t.Errorf("second rollback: status = %d, want 409", rec.Code)
+	}
+
+	// 一覧には読み込んだ行を含めない
+	var batches []models.ImportBatch
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/imports", "", nil, h.GetImports), &batches)
+	if len(batches) != 1 || batches[0].ID != batch.ID || len(batches[0].Rows) != 0 {
+		t.Errorf("unexpected list: %+v", batches)
+	}
+}
+
+func TestUploadImportUnknownFormat(t *testing.T) {
+	h := &ImportHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rec := uploadCSV(t, h, &user, "items.csv", "name,price\napple,100\n"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+
+	var batches []models.ImportBatch
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/imports", "", nil, h.GetImports), &batches)
+	if len(batches) != 0 {
+		t.Errorf("failed upload should not be saved: %+v", batches)
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+	"kakeibo-backend/notify"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type NotificationHandlers struct {
+	DB *gorm.DB
+}
+
+type notificationSettingRequest struct {
+	EnableSubscription bool   `json:"enable_subscription"`
+	EnablePublicFee    bool   `json:"enable_public_fee"`
+	RemindDayOfMonth   int    `json:"remind_day_of_month"`
+	Channel            string `json:"channel"`
+	WebhookURL         string `json:"webhook_url"`
+	WebhookFormat      string `json:"webhook_format"`
+	// WebhookToken は省略すると保存済みの値を保つ (レスポンスに含めないため)
+	WebhookToken *string `json:"webhook_token"`
+}
+
+func (r *notificationSettingRequest) validate() error {
+	// 29〜31 は短い月では月末に送る
+	if r.RemindDayOfMonth < 1 || r.RemindDayOfMonth > 31 {
+		return errors.New("remind_day_of_month must be between 1 and 31")
+	}
+	switch r.Channel {
+	case "":
+		r.Channel = models.ChannelInbox
+	case models.ChannelInbox, models.ChannelEmail:
+	case models.ChannelWebhook:
+		if err := notify.CheckWebhookURL(r.WebhookURL); err != nil {
+			return err
+		}
+		switch r.WebhookFormat {
+		case models.WebhookSlack, models.WebhookDiscord, models.WebhookLINE:
+		default:
+			return errors.New("webhook_format must be slack, discord or line")
+		}
+	default:
+		return errors.New("channel must be inbox, email or webhook")
+	}
+	return nil
+}
+
+// GET SETTING
+// 未設定なら既定値 (通知オフ、毎月1日、受信箱) を返す
+func (h *NotificationHandlers) GetNotificationSetting(c echo.Context) error {
+	var setting models.NotificationSetting
+	err := ownedDB(h.DB, c).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		setting = models.NotificationSetting{RemindDayOfMonth: 1, Channel: models.ChannelInbox, UserID: auth.CurrentUserID(c)}
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, setting)
+}
+
+// UPDATE SETTING
+// 未作成なら作成する
+func (h *NotificationHandlers) UpdateNotificationSetting(c echo.Context) error {
+	req := notificationSettingRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	var setting models.NotificationSetting
+	err := ownedDB(h.DB, c).First(&setting).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	setting.UserID = auth.CurrentUserID(c)
+	setting.EnableSubscription = req.EnableSubscription
+	setting.EnablePublicFee = req.EnablePublicFee
+	setting.RemindDayOfMonth = req.RemindDayOfMonth
+	setting.Channel = req.Channel
+	setting.WebhookURL = req.WebhookURL
+	setting.WebhookFormat = req.WebhookFormat
+	if req.WebhookToken != nil {
+		setting.WebhookToken = *req.WebhookToken
+	}
+	if err := h.DB.Omit("User").Save(&setting).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, setting)
+}
+
+// GET LOGS
+// 新しい順
+func (h *NotificationHandlers) GetNotificationLogs(c echo.Context) error {
+	limit, err := parseLimit(c.QueryParam("limit"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	logs := []models.NotificationLog{}
+	if err := ownedDB(h.DB, c).Order("sent_at DESC").Limit(limit).Find(&logs).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, logs)
+}
+
+// GET INBOX
+// アプリ内の通知を新しい順に返す
+// クエリパラメータ:
+//
+//	unread : true なら未読のみ
+//	limit  : 件数
+func (h *NotificationHandlers) GetNotifications(c echo.Context) error {
+	limit, err := parseLimit(c.QueryParam("limit"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	query := ownedDB(h.DB, c)
+	switch c.QueryParam("unread") {
+	case "", "false":
+	case "true":
+		query = query.Where("read_at IS NULL")
+	default:
+		return c.JSON(http.StatusBadRequest, "unread must be true or false")
+	}
+	notifications := []models.Notification{}
+	if err := query.Order("created_at DESC").Order("id DESC").Limit(limit).Find(&notifications).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, notifications)
+}
+
+// MARK AS READ
+// 既読の通知はそのまま (ReadAt を更新しない)
+func (h *NotificationHandlers) MarkNotificationRead(c echo.Context) error {
+	id := c.Param("id")
+	var notification models.Notification
+	if err := ownedDB(h.DB, c).First(&notification, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "Notification not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if notification.ReadAt == nil {
+		now := time.Now()
+		if err := h.DB.Model(&notification).Update("read_at", now).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+	}
+	return c.JSON(http.StatusOK, notification)
+}
+
+// MARK ALL AS READ
+// 既読にした件数を返す
+func (h *NotificationHandlers) MarkAllNotificationsRead(c echo.Context) error {
+	result := ownedDB(h.DB, c).Model(&models.Notification{}).
+		Where("read_at IS NULL").
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error.Error())
+	}
+	return c.JSON(http.StatusOK, result.RowsAffected)
+}
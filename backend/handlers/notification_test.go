@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"kakeibo-backend/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUpdateNotificationSettingChannel(t *testing.T) {
+	h := &NotificationHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []string{
+		`{"remind_day_of_month": 1, "channel": "fax"}`,
+		`{"remind_day_of_month": 1, "channel": "webhook", "webhook_url": "http://hooks.slack.com/x", "webhook_format": "slack"}`,
+		`{"remind_day_of_month": 1, "channel": "webhook", "webhook_url": "https://hooks.slack.com/x", "webhook_format": "teams"}`,
+		// 内部のアドレスには送らない
+		`{"remind_day_of_month": 1, "channel": "webhook", "webhook_url": "https://169.254.169.254/latest/meta-data", "webhook_format": "slack"}`,
+		`{"remind_day_of_month": 1, "channel": "webhook", "webhook_url": "https://localhost:8080/api", "webhook_format": "slack"}`,
+	}
+	for _, body := range invalid {
+		rec := doRequest(t, &user, http.MethodPut, "/api/notification-settings", body, nil, h.UpdateNotificationSetting)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	body := `{"remind_day_of_month": 25, "channel": "webhook", "webhook_url": "https://api.line.me/v2/bot/message/broadcast", "webhook_format": "line", "webhook_token": "secret"}`
+	var setting models.NotificationSetting
+	rec := doRequest(t, &user, http.MethodPut, "/api/notification-settings", body, nil, h.UpdateNotificationSetting)
+	decodeBody(t, rec, &setting)
+	if setting.Channel != models.ChannelWebhook || setting.WebhookFormat != models.WebhookLINE {
+		t.Errorf("setting = %+v", setting)
+	}
+
+	// トークンは返さず、省略した更新では保持する
+	body = `{"remind_day_of_month": 20, "channel": "webhook", "webhook_url": "https://api.line.me/v2/bot/message/broadcast", "webhook_format": "line"}`
+	rec = doRequest(t, &user, http.MethodPut, "/api/notification-settings", body, nil, h.UpdateNotificationSetting)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("response leaks webhook token: %s", rec.Body.String())
+	}
+	var saved models.NotificationSetting
+	if err := h.DB.First(&saved, "user_id = ?", user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.WebhookToken != "secret" || saved.RemindDayOfMonth != 20 {
+		t.Errorf("saved = %+v", saved)
+	}
+}
+
+func TestNotificationInbox(t *testing.T) {
+	h := &NotificationHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	for _, v := range []interface{}{&user, &other} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var mine []models.Notification
+	for _, u := range []models.User{user, user, other} {
+		n := models.Notification{Subject: "s", Body: "b", UserID: u.ID}
+		if err := h.DB.Create(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		if u.ID == user.ID {
+			mine = append(mine, n)
+		}
+	}
+
+	var list []models.Notification
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/notifications?unread=true", "", nil, h.GetNotifications), &list)
+	if len(list) != 2 {
+		t.Fatalf("unread = %d, want 2", len(list))
+	}
+
+	var read models.Notification
+	params := map[string]string{"id": mine[0].ID.String()}
+	decodeBody(t, doRequest(t, &user, http.MethodPut, "/api/notifications/x/read", "", params, h.MarkNotificationRead), &read)
+	if read.ReadAt == nil {
+		t.Errorf("read_at not set: %+v", read)
+	}
+
+	// 他人の通知は既読にできない
+	var foreign models.Notification
+	h.DB.First(&foreign, "user_id = ?", other.ID)
+	rec := doRequest(t, &user, http.MethodPut, "/api/notifications/x/read", "", map[string]string{"id": foreign.ID.String()}, h.MarkNotificationRead)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("foreign status = %d, want 404", rec.Code)
+	}
+
+	var affected int64
+	decodeBody(t, doRequest(t, &user, http.MethodPut, "/api/notifications/read", "", nil, h.MarkAllNotificationsRead), &affected)
+	if affected != 1 {
+		t.Errorf("marked %d, want 1", affected)
+	}
+	list = nil
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/notifications?unread=true", "", nil, h.GetNotifications), &list)
+	if len(list) != 0 {
+		t.Errorf("unread after mark all = %d", len(list))
+	}
+	h.DB.First(&foreign, "id = ?", foreign.ID)
+	if foreign.ReadAt != nil {
+		t.Errorf("other user's notification was marked read")
+	}
+}
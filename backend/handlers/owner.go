@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ownedDB は認証済みユーザーの行だけを対象にするDBを返す
+// user_id を持つテーブルの読み書きは必ずこれを経由すること
+func ownedDB(db *gorm.DB, c echo.Context) *gorm.DB {
+	return db.Scopes(models.OwnedBy(auth.CurrentUserID(c)))
+}
+
+// selfDB は users テーブルへのクエリを認証済みユーザー自身の行に限定する
+func selfDB(db *gorm.DB, c echo.Context) *gorm.DB {
+	userID := auth.CurrentUserID(c)
+	if userID == uuid.Nil {
+		return db.Where("1 = 0")
+	}
+	return db.Where("users.id = ?", userID)
+}
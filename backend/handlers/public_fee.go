@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"errors"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type PublicFeeHandlers struct {
+	DB *gorm.DB
+}
+
+type publicFeeRequest struct {
+	FeeType         string    `json:"fee_type"`
+	Amount          uint64    `json:"amount"`
+	UsageYear       uint      `json:"usage_year"`
+	UsageMonth      uint      `json:"usage_month"`
+	NextBillingDate time.Time `json:"next_billing_date"`
+	Quantity        float64   `json:"quantity"`
+	Unit            string    `json:"unit"`
+	CategoryID      uuid.UUID `json:"category_id"`
+}
+
+// normalizeUnit は表記ゆれのある単位を models の定数にそろえる
+func normalizeUnit(unit string) (string, bool) {
+	switch strings.TrimSpace(unit) {
+	case "kWh", "kwh", "KWH":
+		return models.UnitKWh, true
+	case "m3", "m³", "㎥":
+		return models.UnitCubicMeter, true
+	}
+	return "", false
+}
+
+func (r *publicFeeRequest) validate() error {
+	r.FeeType = strings.TrimSpace(r.FeeType)
+	if r.FeeType == "" {
+		return errors.New("fee_type is required")
+	}
+	if r.Amount == 0 {
+		return errors.New("amount must be positive")
+	}
+	if r.UsageMonth < 1 || r.UsageMonth > 12 {
+		return errors.New("usage_month must be between 1 and 12")
+	}
+	if r.NextBillingDate.IsZero() {
+		return errors.New("next_billing_date is required")
+	}
+	if r.UsageYear == 0 {
+		// 使用月が請求月より後なら前年の使用分
+		r.UsageYear = uint(r.NextBillingDate.Year())
+		if r.UsageMonth > uint(r.NextBillingDate.Month()) {
+			r.UsageYear--
+		}
+	}
+	if r.Quantity < 0 || math.IsNaN(r.Quantity) || math.IsInf(r.Quantity, 0) {
+		return errors.New("quantity must not be negative")
+	}
+	if r.Quantity > 0 || r.Unit != "" {
+		unit, ok := normalizeUnit(r.Unit)
+		if !ok {
+			return errors.New("unit must be kWh or m3")
+		}
+		r.Unit = unit
+	}
+	if r.CategoryID == uuid.Nil {
+		return errors.New("category_id is required")
+	}
+	return nil
+}
+
+func (r publicFeeRequest) apply(fee *models.PublicFee) {
+	fee.FeeType = r.FeeType
+	fee.Amount = r.Amount
+	fee.UsageYear = r.UsageYear
+	fee.UsageMonth = r.UsageMonth
+	fee.NextBillingDate = r.NextBillingDate
+	fee.Quantity = r.Quantity
+	fee.Unit = r.Unit
+	fee.CategoryID = r.CategoryID
+}
+
+// CREATE
+func (h *PublicFeeHandlers) CreatePublicFee(c echo.Context) error {
+	req := publicFeeRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := checkCategory(h.DB, c, req.CategoryID); err != nil {
+		return c.JSON(categoryErrorStatus(err), err.Error())
+	}
+	fee := models.PublicFee{UserID: auth.CurrentUserID(c)}
+	req.apply(&fee)
+	if err := h.DB.Create(&fee).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, fee)
+}
+
+// GET
+// 使用月の新しい順。?fee_type= で絞り込み
+func (h *PublicFeeHandlers) GetPublicFee(c echo.Context) error {
+	query := ownedDB(h.DB, c).Preload("Category")
+	if feeType := c.QueryParam("fee_type"); feeType != "" {
+		query = query.Where("fee_type = ?", feeType)
+	}
+	fees := []models.PublicFee{}
+	if err := query.Order("usage_year DESC").Order("usage_month DESC").Order("fee_type ASC").Find(&fees).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, fees)
+}
+
+// UPDATE
+func (h *PublicFeeHandlers) UpdatePublicFee(c echo.Context) error {
+	id := c.Param("id")
+	var fee models.PublicFee
+	if err := ownedDB(h.DB, c).First(&fee, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "PublicFee not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	req := publicFeeRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := checkCategory(h.DB, c, req.CategoryID); err != nil {
+		return c.JSON(categoryErrorStatus(err), err.Error())
+	}
+	req.apply(&fee)
+	if err := h.DB.Omit("User", "Category").Save(&fee).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, fee)
+}
+
+// DELETE
+func (h *PublicFeeHandlers) DeletePublicFee(c echo.Context) error {
+	id := c.Param("id")
+	result := ownedDB(h.DB, c).Delete(&models.PublicFee{}, "id = ?", id)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "PublicFee not found")
+	}
+	return c.JSON(http.StatusOK, id)
+}
+
+// FeeTrend は1種類の公共料金の月ごとの推移
+type FeeTrend struct {
+	FeeType string     `json:"fee_type"`
+	Unit    string     `json:"unit"`
+	Points  []FeePoint `json:"points"`
+}
+
+// FeeUsage は1か月分の請求額と使用量
+type FeeUsage struct {
+	Amount   uint64  `json:"amount"`
+	Quantity float64 `json:"quantity"`
+	// UnitPrice は1単位あたりの金額。使用量が未入力なら null
+	UnitPrice *float64 `json:"unit_price"`
+}
+
+// FeePoint は使用月1か月分と、その前年同月との比較
+//
+// 前年同月と比べた増減額 AmountChange を使用量と単価の要因に分ける (円、四捨五入):
+//
+//	UsageEffect = (今年の使用量 - 前年の使用量) × 前年の単価
+//	PriceEffect = (今年の単価 - 前年の単価) × 今年の使用量
+//
+// 両年とも使用量がある場合のみ。UsageEffect + PriceEffect は丸めを除き AmountChange に一致する
+type FeePoint struct {
+	Year  uint `json:"year"`
+	Month uint `json:"month"`
+	FeeUsage
+	LastYear     *FeeUsage `json:"last_year"`
+	AmountChange *int64    `json:"amount_change"`
+	// AmountChangeRate は前年比の増減率 (0.1 なら10%増)
+	AmountChangeRate *float64 `json:"amount_change_rate"`
+	UsageEffect      *int64   `json:"usage_effect"`
+	PriceEffect      *int64   `json:"price_effect"`
+}
+
+// TRENDS
+// 種類ごとに直近 months か月 (既定12、最大60) の推移と前年同月比を返す
+// クエリパラメータ:
+//
+//	fee_type : 絞り込み
+//	months   : 期間 (今月まで)
+func (h *PublicFeeHandlers) GetPublicFeeTrends(c echo.Context) error {
+	months := 12
+	if s := c.QueryParam("months"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return c.JSON(http.StatusBadRequest, "months must be a positive integer")
+		}
+		months = min(v, 60)
+	}
+	now := time.Now()
+	to := periodIndex(uint(now.Year()), uint(now.Month()))
+	from := to - months + 1
+
+	// 前年同月の比較のため12か月前から読む
+	query := ownedDB(h.DB, c).Where("usage_year * 12 + usage_month - 1 >= ?", from-12).
+		Where("usage_year * 12 + usage_month - 1 <= ?", to)
+	if feeType := c.QueryParam("fee_type"); feeType != "" {
+		query = query.Where("fee_type = ?", feeType)
+	}
+	var fees []models.PublicFee
+	if err := query.Find(&fees).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, buildFeeTrends(fees, from, to))
+}
+
+// periodIndex は年月を月単位の通し番号にする
+func periodIndex(year, month uint) int {
+	return int(year)*12 + int(month) - 1
+}
+
+// feeMonth は同じ種類・同じ使用月の請求の合計 (メーターが複数ある場合など)
+type feeMonth struct {
+	amount   uint64
+	quantity float64
+	// measured は全件に使用量が入っている場合 true
+	measured bool
+}
+
+func (m feeMonth) usage() FeeUsage {
+	u := FeeUsage{Amount: m.amount, Quantity: m.quantity}
+	if m.measured {
+		price := math.Round(float64(m.amount)/m.quantity*100) / 100
+		u.UnitPrice = &price
+	}
+	return u
+}
+
+// buildFeeTrends は fees を種類ごとにまとめ、from〜to (periodIndex) の各月の推移を返す
+// 請求の無い月は含めない
+func buildFeeTrends(fees []models.PublicFee, from, to int) []FeeTrend {
+	type key struct {
+		feeType string
+		period  int
+	}
+	byMonth := map[key]*feeMonth{}
+	units := map[string]string{}
+	for _, f := range fees {
+		k := key{f.FeeType, periodIndex(f.UsageYear, f.UsageMonth)}
+		m, ok := byMonth[k]
+		if !ok {
+			m = &feeMonth{measured: true}
+			byMonth[k] = m
+		}
+		m.amount += f.Amount
+		m.quantity += f.Quantity
+		m.measured = m.measured && f.Quantity > 0
+		if f.Unit != "" {
+			units[f.FeeType] = f.Unit
+		}
+	}
+
+	trends := map[string]*FeeTrend{}
+	for k, m := range byMonth {
+		if k.period < from || k.period > to {
+			continue
+		}
+		trend, ok := trends[k.feeType]
+		if !ok {
+			trend = &FeeTrend{FeeType: k.feeType, Unit: units[k.feeType], Points: []FeePoint{}}
+			trends[k.feeType] = trend
+		}
+		point := FeePoint{Year: uint(k.period / 12), Month: uint(k.period%12 + 1), FeeUsage: m.usage()}
+		if prev, ok := byMonth[key{k.feeType, k.period - 12}]; ok {
+			compareLastYear(&point, prev.usage())
+		}
+		trend.Points = append(trend.Points, point)
+	}
+
+	result := make([]FeeTrend, 0, len(trends))
+	for _, trend := range trends {
+		sort.Slice(trend.Points, func(i, j int) bool {
+			return periodIndex(trend.Points[i].Year, trend.Points[i].Month) < periodIndex(trend.Points[j].Year, trend.Points[j].Month)
+		})
+		result = append(result, *trend)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].FeeType < result[j].FeeType })
+	return result
+}
+
+func compareLastYear(point *FeePoint, last FeeUsage) {
+	point.LastYear = &last
+	change := int64(point.Amount) - int64(last.Amount)
+	point.AmountChange = &change
+	if last.Amount > 0 {
+		rate := math.Round(float64(change)/float64(last.Amount)*1000) / 1000
+		point.AmountChangeRate = &rate
+	}
+	if point.UnitPrice != nil && last.UnitPrice != nil {
+		lastPrice := float64(last.Amount) / last.Quantity
+		price := float64(point.Amount) / point.Quantity
+		usage := int64(math.Round((point.Quantity - last.Quantity) * lastPrice))
+		priceEffect := int64(math.Round((price - lastPrice) * point.Quantity))
+		point.UsageEffect = &usage
+		point.PriceEffect = &priceEffect
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"kakeibo-backend/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCreatePublicFee(t *testing.T) {
+	h := &PublicFeeHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	category := models.Category{Name: "光熱費"}
+	for _, v := range []interface{}{&user, &category} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 使用年は請求日から推定し、単位の表記ゆれはそろえる
+	body := `{"fee_type": "ガス", "amount": 4800, "usage_month": 12, "next_billing_date": "2026-01-15T00:00:00Z",
+		"quantity": 32.5, "unit": "㎥", "category_id": "` + category.ID.String() + `"}`
+	var fee models.PublicFee
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/public-fees", body, nil, h.CreatePublicFee), &fee)
+	if fee.UsageYear != 2025 || fee.Unit != models.UnitCubicMeter || fee.UserID != user.ID {
+		t.Errorf("fee = %+v", fee)
+	}
+
+	invalid := []string{
+		`{"fee_type": "電気", "amount": 100, "usage_month": 13, "next_billing_date": "2026-01-15T00:00:00Z", "category_id": "` + category.ID.String() + `"}`,
+		`{"fee_type": "電気", "amount": 100, "usage_month": 1, "next_billing_date": "2026-01-15T00:00:00Z", "quantity": 10, "unit": "L", "category_id": "` + category.ID.String() + `"}`,
+		`{"fee_type": "", "amount": 100, "usage_month": 1, "next_billing_date": "2026-01-15T00:00:00Z", "category_id": "` + category.ID.String() + `"}`,
+	}
+	for _, body := range invalid {
+		if rec := doRequest(t, &user, http.MethodPost, "/api/public-fees", body, nil, h.CreatePublicFee); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestBuildFeeTrends(t *testing.T) {
+	fee := func(feeType string, year, month uint, amount uint64, quantity float64) models.PublicFee {
+		return models.PublicFee{FeeType: feeType, UsageYear: year, UsageMonth: month, Amount: amount, Quantity: quantity, Unit: models.UnitKWh}
+	}
+	fees := []models.PublicFee{
+		fee("電気", 2025, 1, 9000, 300),  // 単価30円
+		fee("電気", 2026, 1, 12000, 320), // 単価37.5円
+		fee("電気", 2026, 2, 8000, 0),    // 使用量未入力
+		fee("電気", 2025, 2, 7000, 250),
+		fee("水道", 2026, 1, 3000, 20),
+		fee("水道", 2026, 1, 1000, 5), // 同じ月の2件目は合算
+	}
+	from := periodIndex(2026, 1)
+	trends := buildFeeTrends(fees, from, periodIndex(2026, 12))
+	if len(trends) != 2 || trends[0].FeeType != "水道" || trends[1].FeeType != "電気" {
+		t.Fatalf("trends = %+v", trends)
+	}
+
+	water := trends[0].Points
+	if len(water) != 1 || water[0].Amount != 4000 || water[0].Quantity != 25 || *water[0].UnitPrice != 160 {
+		t.Errorf("water = %+v", water)
+	}
+	if water[0].LastYear != nil {
+		t.Errorf("water has no last year data: %+v", water[0].LastYear)
+	}
+
+	electricity := trends[1].Points
+	if len(electricity) != 2 {
+		t.Fatalf("electricity points = %+v", electricity)
+	}
+	jan := electricity[0]
+	if jan.Year != 2026 || jan.Month != 1 || jan.LastYear == nil || jan.LastYear.Amount != 9000 {
+		t.Fatalf("jan = %+v", jan)
+	}
+	// 3000円増のうち使用量の増加分は 20kWh × 30円 = 600円、単価の上昇分は 7.5円 × 320kWh = 2400円
+	if *jan.AmountChange != 3000 || *jan.UsageEffect != 600 || *jan.PriceEffect != 2400 {
+		t.Errorf("jan change = %d usage = %d price = %d", *jan.AmountChange, *jan.UsageEffect, *jan.PriceEffect)
+	}
+	if *jan.AmountChangeRate != 0.333 {
+		t.Errorf("jan rate = %v", *jan.AmountChangeRate)
+	}
+
+	feb := electricity[1]
+	if feb.UnitPrice != nil || feb.UsageEffect != nil || feb.PriceEffect != nil {
+		t.Errorf("feb without quantity should not be decomposed: %+v", feb)
+	}
+	if feb.AmountChange == nil || *feb.AmountChange != 1000 {
+		t.Errorf("feb change = %v", feb.AmountChange)
+	}
+}
+
+func TestGetPublicFeeTrendsOwnedOnly(t *testing.T) {
+	h := &PublicFeeHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	category := models.Category{Name: "光熱費"}
+	for _, v := range []interface{}{&user, &other, &category} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	for _, u := range []models.User{user, other} {
+		f := models.PublicFee{FeeType: "電気", Amount: 5000, UsageYear: uint(now.Year()), UsageMonth: uint(now.Month()),
+			NextBillingDate: now, UserID: u.ID, CategoryID: category.ID}
+		if err := h.DB.Create(&f).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var trends []FeeTrend
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/public-fees/trends?months=3", "", nil, h.GetPublicFeeTrends), &trends)
+	if len(trends) != 1 || len(trends[0].Points) != 1 || trends[0].Points[0].Amount != 5000 {
+		t.Errorf("trends = %+v", trends)
+	}
+}
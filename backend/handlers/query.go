@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// parseDate は "2006-01-02" または RFC3339 形式の日付を解釈する
+// 日付のみの場合は dateOnly が true になる
+func parseDate(s string) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date %q: use YYYY-MM-DD or RFC3339", s)
+	}
+	return t, false, nil
+}
+
+// parseOptionalUUID は空文字なら uuid.Nil を返す
+func parseOptionalUUID(s string) (uuid.UUID, error) {
+	if s == "" {
+		return uuid.Nil, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid id %q", s)
+	}
+	return id, nil
+}
+
+// parseOptionalInt は空文字なら nil を返す
+func parseOptionalInt(name, s string) (*int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", name, s)
+	}
+	return &v, nil
+}
+
+// parseLimit はページサイズを defaultPageSize〜maxPageSize の範囲で返す
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return defaultPageSize, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", s)
+	}
+	if v > maxPageSize {
+		v = maxPageSize
+	}
+	return v, nil
+}
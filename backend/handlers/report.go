@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"kakeibo-backend/auth"
+	"kakeibo-backend/report"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ReportHandlers struct {
+	DB *gorm.DB
+}
+
+// GET
+// ?month=YYYY-MM (省略時は今月)
+// 集計元の支出・公共料金が変わっていれば再集計して返す
+func (h *ReportHandlers) GetReport(c echo.Context) error {
+	month := time.Now()
+	if m := c.QueryParam("month"); m != "" {
+		t, err := time.ParseInLocation("2006-01", m, time.Local)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "month must be YYYY-MM")
+		}
+		month = t
+	}
+	generator := report.Generator{DB: h.DB}
+	r, err := generator.Get(auth.CurrentUserID(c), month)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+	"kakeibo-backend/netguard"
+	"kakeibo-backend/scraper"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ScraperHandlers struct {
+	DB *gorm.DB
+	// Profiles は URL だけで取得する場合に使うサイトのプロファイル
+	Profiles *scraper.Registry
+	// Config はスクレイパーの設定 (User-Agent・拒否リストなど)。nil なら scraper.DefaultConfig
+	// AllowedDomains はリクエストの値で置き換える
+	Config *scraper.ScraperConfig
+}
+
+type scrapeRequest struct {
+	URL           string `json:"url"`
+	ItemSelector  string `json:"item_selector"`
+	NameSelector  string `json:"name_selector"`
+	PriceSelector string `json:"price_selector"`
+	LinkSelector  string `json:"link_selector"`
+	// NextPageSelector を指定すると次のページへのリンクを辿る
+	NextPageSelector string   `json:"next_page_selector"`
+	AllowedDomains   []string `json:"allowed_domains"`
+	// MaxPages, MaxItems は scraper.DefaultLimits の値を超えられない
+	MaxPages int `json:"max_pages"`
+	MaxItems int `json:"max_items"`
+}
+
+// limits は要求された上限を DefaultLimits の範囲に収める
+func (r scrapeRequest) limits() scraper.Limits {
+	limits := scraper.DefaultLimits()
+	if r.MaxPages > 0 && r.MaxPages < limits.MaxPages {
+		limits.MaxPages = r.MaxPages
+	}
+	if r.MaxItems > 0 && r.MaxItems < limits.MaxItems {
+		limits.MaxItems = r.MaxItems
+	}
+	return limits
+}
+
+// errNoSiteProfile は URL に一致するプロファイルが無く、セレクタも指定されていないことを表す
+var errNoSiteProfile = errors.New("no site profile matches the url")
+
+// site は URL のホストに一致するプロファイルを返す
+// リクエストで指定したセレクタはプロファイルの値より優先する
+func (r scrapeRequest) site(profiles *scraper.Registry) (scraper.SiteProfile, error) {
+	if r.URL == "" {
+		return scraper.SiteProfile{}, errors.New("url is required")
+	}
+	site, found := profiles.Lookup(r.URL)
+	if !found && r.ItemSelector == "" && r.NameSelector == "" && r.PriceSelector == "" {
+		return scraper.SiteProfile{}, errNoSiteProfile
+	}
+	sel := &site.Selectors
+	for _, o := range []struct {
+		dst *string
+		val string
+	}{
+		{&sel.Item, r.ItemSelector},
+		{&sel.Name, r.NameSelector},
+		{&sel.Price, r.PriceSelector},
+		{&sel.Link, r.LinkSelector},
+		{&sel.NextPage, r.NextPageSelector},
+	} {
+		if o.val != "" {
+			*o.dst = o.val
+		}
+	}
+	if sel.Item == "" || sel.Name == "" || sel.Price == "" {
+		if !found {
+			return scraper.SiteProfile{}, errors.New("no site profile matches the url; item_selector, name_selector and price_selector are required")
+		}
+		return scraper.SiteProfile{}, errors.New("item_selector, name_selector and price_selector are required")
+	}
+	if sel.Link == "" {
+		sel.Link = "a"
+	}
+	return site, nil
+}
+
+// SCRAPE
+// URL に一致するサイトのプロファイルがあればセレクタを省略できる
+// プロファイルが無くセレクタも省略した場合は、ページの構造化データ (JSON-LD など) から抽出する
+// 取得した商品は ScrapedItem として保存し (URL が同じなら上書き)、保存後の内容を返す
+// 上限・制限時間に達した場合やクライアントが切断した場合は、それまでに取得した分を保存し
+// "stopped" に理由 (scraper.StopReason) を入れて返す
+// robots.txt で禁止されている URL や拒否リストのドメインは 403
+// 内部のアドレス (localhost・プライベート IP・メタデータのアドレスなど) は 400。名前解決やリダイレクトの先が内部でも取得しない
+func (h *ScraperHandlers) ScrapeProducts(c echo.Context) error {
+	req := scrapeRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	site, err := req.site(h.Profiles)
+	structured := errors.Is(err, errNoSiteProfile)
+	if err != nil && !structured {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	config := *scraper.DefaultConfig()
+	if h.Config != nil {
+		config = *h.Config
+	}
+	config.AllowedDomains = req.AllowedDomains
+	// 最新の価格で上書きするためキャッシュは使わない (同じ URL でも取得し直す)
+	config.CacheDir = ""
+	ps := scraper.NewProductScraper(&config)
+
+	var products []scraper.Product
+	if structured {
+		products, err = ps.ScrapeStructured(c.Request().Context(), req.URL, req.limits())
+	} else {
+		products, err = ps.ScrapeSite(c.Request().Context(), req.URL, site, req.limits())
+	}
+	var stop *scraper.StopError
+	if errors.Is(err, netguard.ErrForbiddenAddress) {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, scraper.ErrDeniedDomain) || errors.Is(err, scraper.ErrDisallowedByRobots) {
+		return c.JSON(http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if err != nil && !errors.As(err, &stop) {
+		return c.JSON(http.StatusBadGateway, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	// クライアントが切断していても、取得できた分は保存する
+	items, err := saveScrapedItems(h.DB.WithContext(context.WithoutCancel(c.Request().Context())), auth.CurrentUserID(c), req.URL, products)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	res := map[string]interface{}{
+		"success": true,
+		"count":   len(items),
+		"items":   items,
+	}
+	if site.Name != "" {
+		res["profile"] = site.Name
+	}
+	if structured {
+		res["structured"] = true
+	}
+	if stop != nil {
+		res["stopped"] = stop.Reason
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// saveScrapedItems は products を userID の ScrapedItem として保存する
+// 同じ URL の商品はまとめて1件にし (後に出たものを優先)、保存済みなら上書きする
+func saveScrapedItems(db *gorm.DB, userID uuid.UUID, sourceURL string, products []scraper.Product) ([]models.ScrapedItem, error) {
+	byURL := map[string]int{}
+	items := []models.ScrapedItem{}
+	for _, p := range products {
+		if p.URL == "" {
+			p.URL = sourceURL
+		}
+		scrapedAt := p.ScrapedAt
+		if scrapedAt.IsZero() {
+			scrapedAt = time.Now()
+		}
+		item := models.ScrapedItem{
+			Name:         p.Name,
+			URL:          p.URL,
+			ImageURL:     p.ImageURL,
+			Description:  p.Description,
+			RawPrice:     p.Price,
+			Currency:     p.Currency,
+			Availability: p.Availability,
+			GTIN:         p.GTIN,
+			SourceURL:    sourceURL,
+			ScrapedAt:    scrapedAt,
+			UserID:       userID,
+		}
+		// 構造化データの通貨に ParsePrice が対応していなければ、金額の桁が分からないため解釈しない
+		if price, err := scraper.ParsePrice(p.Price); err == nil && (p.Currency == "" || p.Currency == price.Currency) {
+			item.Price = &price.Amount
+			item.Currency = price.Currency
+			item.TaxIncluded = price.TaxIncluded
+		}
+		if i, ok := byURL[item.URL]; ok {
+			items[i] = item
+			continue
+		}
+		byURL[item.URL] = len(items)
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return items, nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "url"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"name", "image_url", "description", "raw_price", "price", "currency", "tax_included",
+				"availability", "gtin", "source_url", "scraped_at", "updated_at", "deleted_at",
+			}),
+		}).Omit("User").Create(&items).Error; err != nil {
+			return err
+		}
+		// 競合時は既存行のIDが残るため読み直す
+		urls := make([]string, len(items))
+		for i, item := range items {
+			urls[i] = item.URL
+		}
+		var saved []models.ScrapedItem
+		if err := tx.Where("user_id = ? AND url IN ?", userID, urls).Find(&saved).Error; err != nil {
+			return err
+		}
+		savedByURL := map[string]models.ScrapedItem{}
+		for _, item := range saved {
+			savedByURL[item.URL] = item
+		}
+		for i, item := range items {
+			items[i] = savedByURL[item.URL]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GET ITEMS
+// 保存済みの商品を取得日時の新しい順に返す
+func (h *ScraperHandlers) GetScrapedItems(c echo.Context) error {
+	limit, err := parseLimit(c.QueryParam("limit"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	items := []models.ScrapedItem{}
+	if err := ownedDB(h.DB, c).Order("scraped_at DESC").Order("id DESC").Limit(limit).Find(&items).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+// GET ITEM
+func (h *ScraperHandlers) GetScrapedItemByID(c echo.Context) error {
+	id := c.Param("id")
+	var item models.ScrapedItem
+	if err := ownedDB(h.DB, c).First(&item, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "ScrapedItem not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, item)
+}
+
+// DELETE ITEM
+func (h *ScraperHandlers) DeleteScrapedItem(c echo.Context) error {
+	id := c.Param("id")
+	result := ownedDB(h.DB, c).Delete(&models.ScrapedItem{}, "id = ?", id)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "ScrapedItem not found")
+	}
+	return c.JSON(http.StatusOK, id)
+}
+
+// GET PROFILES
+// URL だけで取得できるサイトのプロファイル
+func (h *ScraperHandlers) GetScrapeProfiles(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.Profiles.Profiles())
+}
+
+// GUIDE
+func (h *ScraperHandlers) GetScrapingGuide(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"description": "Web scraping API for extracting product information",
+		"endpoint":    "POST /api/scrape",
+		"example_request": map[string]interface{}{
+			"url":            "https://example.com/products",
+			"item_selector":  ".product-item",
+			"name_selector":  ".product-name",
+			"price_selector": ".product-price",
+		},
+		"profiles_endpoint": "GET /api/scrape/profiles",
+		"profile_request": map[string]interface{}{
+			"url": "https://example.com/products",
+		},
+	})
+}
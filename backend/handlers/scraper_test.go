@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"kakeibo-backend/models"
+	"kakeibo-backend/scraper"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSaveScrapedItemsDeduplicatesByURL(t *testing.T) {
+	db := newTestDB(t)
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	for _, v := range []interface{}{&user, &other} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	page := "https://shop.example.com/list"
+	at := time.Date(2026, 4, 1, 10, 0, 0, 0, time.UTC)
+
+	first, err := saveScrapedItems(db, user.ID, page, []scraper.Product{
+		{Name: "コーヒー豆", Price: "¥1,280（税込）", URL: "https://shop.example.com/items/1", ScrapedAt: at},
+		{Name: "フィルター", Price: "オープン価格", URL: "https://shop.example.com/items/2", ScrapedAt: at},
+		{Name: "コーヒー豆 (重複)", Price: "¥1,280（税込）", URL: "https://shop.example.com/items/1", ScrapedAt: at},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("saved %d items, want 2", len(first))
+	}
+	beans := first[0]
+	if beans.Price == nil || *beans.Price != 1280 || beans.Currency != "JPY" || beans.TaxIncluded == nil || !*beans.TaxIncluded {
+		t.Errorf("beans = %+v", beans)
+	}
+	if beans.Name != "コーヒー豆 (重複)" || beans.SourceURL != page {
+		t.Errorf("later duplicate should win: %+v", beans)
+	}
+	if first[1].Price != nil || first[1].RawPrice != "オープン価格" {
+		t.Errorf("unparsable price should be kept raw: %+v", first[1])
+	}
+
+	// 削除済みの商品も再取得すれば同じIDで復活する
+	if err := db.Delete(&models.ScrapedItem{}, "id = ?", beans.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	second, err := saveScrapedItems(db, user.ID, page, []scraper.Product{
+		{Name: "コーヒー豆", Price: "1,180円(税抜)", URL: "https://shop.example.com/items/1", ScrapedAt: at.Add(time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 1 || second[0].ID != beans.ID {
+		t.Fatalf("second = %+v, want id %s", second, beans.ID)
+	}
+	if *second[0].Price != 1180 || *second[0].TaxIncluded || !second[0].ScrapedAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("item not updated: %+v", second[0])
+	}
+
+	// 別のユーザーは同じURLでも別の行
+	if _, err := saveScrapedItems(db, other.ID, page, []scraper.Product{
+		{Name: "コーヒー豆", Price: "¥1,280", URL: "https://shop.example.com/items/1"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.ScrapedItem{}).Count(&count)
+	if count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+}
+
+func TestSaveScrapedItemsStructured(t *testing.T) {
+	db := newTestDB(t)
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	items, err := saveScrapedItems(db, user.ID, "https://shop.example.com/items/1", []scraper.Product{
+		{Name: "ケトル", Price: "19.99 USD", Currency: "USD", Availability: "InStock", GTIN: "4901234567894", URL: "https://shop.example.com/items/1"},
+		{Name: "ポット", Price: "12.50 GBP", Currency: "GBP", URL: "https://shop.example.com/items/2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kettle := items[0]
+	if kettle.Price == nil || *kettle.Price != 1999 || kettle.Currency != "USD" || kettle.Availability != "InStock" || kettle.GTIN != "4901234567894" {
+		t.Errorf("kettle = %+v", kettle)
+	}
+	// ParsePrice が知らない通貨は金額を解釈せず、通貨だけ残す
+	if pot := items[1]; pot.Price != nil || pot.Currency != "GBP" || pot.RawPrice != "12.50 GBP" {
+		t.Errorf("pot = %+v", pot)
+	}
+}
+
+func TestScrapeRequestSite(t *testing.T) {
+	profiles, err := scraper.NewRegistry(scraper.SiteProfile{
+		Name:      "shop",
+		Domains:   []string{"shop.example.com"},
+		Selectors: scraper.Selectors{Item: ".item", Name: ".name", Price: ".price", NextPage: "a.next"},
+		Encoding:  "shift_jis",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// URL だけならプロファイルを使う
+	site, err := scrapeRequest{URL: "https://shop.example.com/list"}.site(profiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.Name != "shop" || site.Selectors.Item != ".item" || site.Selectors.Link != "a" || site.Encoding != "shift_jis" {
+		t.Errorf("site = %+v", site)
+	}
+
+	// 指定したセレクタはプロファイルより優先する
+	site, err = scrapeRequest{URL: "https://shop.example.com/list", PriceSelector: ".sale-price"}.site(profiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.Selectors.Price != ".sale-price" || site.Selectors.Name != ".name" || site.Selectors.NextPage != "a.next" {
+		t.Errorf("site = %+v", site)
+	}
+
+	// プロファイルもセレクタも無ければ構造化データから抽出する
+	if _, err := (scrapeRequest{URL: "https://other.example.com/"}).site(profiles); !errors.Is(err, errNoSiteProfile) {
+		t.Errorf("got %v, want errNoSiteProfile", err)
+	}
+	// セレクタの一部だけでは足りない
+	if _, err := (scrapeRequest{URL: "https://other.example.com/", ItemSelector: "li"}).site(profiles); err == nil || errors.Is(err, errNoSiteProfile) {
+		t.Errorf("partial selectors without a profile: got %v", err)
+	}
+	site, err = scrapeRequest{
+		URL:           "https://other.example.com/",
+		ItemSelector:  "li",
+		NameSelector:  "h2",
+		PriceSelector: ".price",
+	}.site(profiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.Name != "" || site.Selectors.Item != "li" {
+		t.Errorf("site = %+v", site)
+	}
+	if _, err := (scrapeRequest{}).site(profiles); err == nil {
+		t.Error("url should be required")
+	}
+}
+
+// TestScrapeProductsDeniedDomain は拒否リストのドメインを 403 で断ることのテスト
+func TestScrapeProductsDeniedDomain(t *testing.T) {
+	db := newTestDB(t)
+	user := models.User{Name: "u", Email: "u@example.com"}
+	db.Create(&user)
+	config := scraper.DefaultConfig()
+	config.DenyDomains = []string{"example.com"}
+	h := ScraperHandlers{DB: db, Config: config}
+
+	rec := doRequest(t, &user, http.MethodPost, "/api/scrape", `{"url": "https://shop.example.com/list", "item_selector": "li", "name_selector": "h2", "price_selector": ".price"}`, nil, h.ScrapeProducts)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403: %s", rec.Code, rec.Body)
+	}
+}
+
+// TestScrapeProductsRefetches は同じ URL をもう一度取得すると最新の価格で上書きすることのテスト
+func TestScrapeProductsRefetches(t *testing.T) {
+	price := "¥1,280"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/list" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<ul><li><h2>コーヒー豆</h2><span class="price">%s</span><a href="/items/1">詳細</a></li></ul>`, price)
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	user := models.User{Name: "u", Email: "u@example.com"}
+	db.Create(&user)
+	config := scraper.DefaultConfig()
+	config.Delay = 0
+	config.CacheDir = t.TempDir() // 設定にキャッシュがあっても使わない
+	config.AllowPrivateAddresses = true
+	h := ScraperHandlers{DB: db, Config: config}
+	body := fmt.Sprintf(`{"url": %q, "item_selector": "li", "name_selector": "h2", "price_selector": ".price"}`, server.URL+"/list")
+
+	for _, want := range []int64{1280, 980} {
+		if want == 980 {
+			price = "¥980"
+		}
+		var res struct {
+			Items []models.ScrapedItem `json:"items"`
+		}
+		decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/scrape", body, nil, h.ScrapeProducts), &res)
+		if len(res.Items) != 1 || res.Items[0].Price == nil || *res.Items[0].Price != want {
+			t.Errorf("items = %+v, want price %d", res.Items, want)
+		}
+	}
+}
+
+// TestScrapeProductsRejectsInternalAddress は内部のアドレスを取得せずに 400 を返すことのテスト
+func TestScrapeProductsRejectsInternalAddress(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	user := models.User{Name: "u", Email: "u@example.com"}
+	db.Create(&user)
+	h := ScraperHandlers{DB: db}
+	for _, u := range []string{server.URL + "/list", "http://localhost/", "http://169.254.169.254/latest/meta-data/", "http://[::1]/"} {
+		body := fmt.Sprintf(`{"url": %q, "item_selector": "li", "name_selector": "h2", "price_selector": ".price"}`, u)
+		if rec := doRequest(t, &user, http.MethodPost, "/api/scrape", body, nil, h.ScrapeProducts); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400: %s", u, rec.Code, rec.Body)
+		}
+	}
+	if hits != 0 {
+		t.Errorf("internal server was contacted %d times", hits)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type SubscriptionHandlers struct {
+	DB *gorm.DB
+}
+
+type subscriptionRequest struct {
+	Name             string    `json:"name"`
+	MonthlyFee       uint64    `json:"monthly_fee"`
+	BillingCycle     string    `json:"billing_cycle"`
+	BillingCycleDays uint      `json:"billing_cycle_days"`
+	BillingDay       uint      `json:"billing_day"`
+	NextBillingDate  time.Time `json:"next_billing_date"`
+	IsActive         bool      `json:"is_active"`
+	CategoryID       uuid.UUID `json:"category_id"`
+}
+
+// billingDay は請求日の基準日を返す。未指定なら NextBillingDate の日
+func (r subscriptionRequest) billingDay() uint {
+	if r.BillingDay != 0 {
+		return r.BillingDay
+	}
+	return uint(r.NextBillingDate.Day())
+}
+
+func (r subscriptionRequest) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if r.NextBillingDate.IsZero() {
+		return errors.New("next_billing_date is required")
+	}
+	switch r.BillingCycle {
+	case models.CycleMonthly, models.CycleYearly:
+		if r.BillingDay > 31 {
+			return errors.New("billing_day must be between 1 and 31")
+		}
+	case models.CycleDays:
+		if r.BillingCycleDays == 0 {
+			return errors.New("billing_cycle_days is required for days cycle")
+		}
+	default:
+		return errors.New("billing_cycle must be monthly, yearly or days")
+	}
+	if r.CategoryID == uuid.Nil {
+		return errors.New("category_id is required")
+	}
+	return nil
+}
+
+// CREATE
+func (h *SubscriptionHandlers) CreateSubscription(c echo.Context) error {
+	req := subscriptionRequest{IsActive: true, BillingCycle: models.CycleMonthly}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := checkCategory(h.DB, c, req.CategoryID); err != nil {
+		return c.JSON(categoryErrorStatus(err), err.Error())
+	}
+	subscription := models.Subscription{
+		Name:             req.Name,
+		MonthlyFee:       req.MonthlyFee,
+		BillingCycle:     req.BillingCycle,
+		BillingCycleDays: req.BillingCycleDays,
+		BillingDay:       req.billingDay(),
+		NextBillingDate:  req.NextBillingDate,
+		IsActive:         req.IsActive,
+		UserID:           auth.CurrentUserID(c),
+		CategoryID:       req.CategoryID,
+	}
+	if err := h.DB.Create(&subscription).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, subscription)
+}
+
+// GET
+func (h *SubscriptionHandlers) GetSubscription(c echo.Context) error {
+	subscriptions := []models.Subscription{}
+	if err := ownedDB(h.DB, c).Preload("Category").Order("next_billing_date ASC").Find(&subscriptions).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, subscriptions)
+}
+
+// UPDATE
+func (h *SubscriptionHandlers) UpdateSubscription(c echo.Context) error {
+	id := c.Param("id")
+	var subscription models.Subscription
+	if err := ownedDB(h.DB, c).First(&subscription, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "Subscription not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	req := subscriptionRequest{BillingCycle: subscription.BillingCycle, IsActive: subscription.IsActive}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := checkCategory(h.DB, c, req.CategoryID); err != nil {
+		return c.JSON(categoryErrorStatus(err), err.Error())
+	}
+	subscription.Name = req.Name
+	subscription.MonthlyFee = req.MonthlyFee
+	subscription.BillingCycle = req.BillingCycle
+	subscription.BillingCycleDays = req.BillingCycleDays
+	subscription.BillingDay = req.billingDay()
+	subscription.NextBillingDate = req.NextBillingDate
+	subscription.IsActive = req.IsActive
+	subscription.CategoryID = req.CategoryID
+	if err := h.DB.Save(&subscription).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, subscription)
+}
+
+// DELETE
+func (h *SubscriptionHandlers) DeleteSubscription(c echo.Context) error {
+	id := c.Param("id")
+	result := ownedDB(h.DB, c).Delete(&models.Subscription{}, "id = ?", id)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "Subscription not found")
+	}
+	return c.JSON(http.StatusOK, id)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"kakeibo-backend/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestUpdateSubscriptionKeepsIsActive は is_active を省略した更新で請求が止まらないことのテスト
+func TestUpdateSubscriptionKeepsIsActive(t *testing.T) {
+	h := &SubscriptionHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	category := models.Category{Name: "サブスク"}
+	for _, v := range []interface{}{&user, &category} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub := models.Subscription{Name: "Netflix", MonthlyFee: 1490, BillingCycle: models.CycleMonthly, BillingDay: 10,
+		NextBillingDate: time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC), IsActive: true, UserID: user.ID, CategoryID: category.ID}
+	if err := h.DB.Create(&sub).Error; err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{"id": sub.ID.String()}
+
+	body := fmt.Sprintf(`{"name": "Netflix", "monthly_fee": 1590, "next_billing_date": "2026-05-10T00:00:00Z", "category_id": %q}`, category.ID)
+	var updated models.Subscription
+	decodeBody(t, doRequest(t, &user, http.MethodPut, "/", body, params, h.UpdateSubscription), &updated)
+	if !updated.IsActive || updated.MonthlyFee != 1590 || updated.BillingCycle != models.CycleMonthly {
+		t.Errorf("unexpected subscription: %+v", updated)
+	}
+
+	// 明示すれば停止できる
+	body = fmt.Sprintf(`{"name": "Netflix", "monthly_fee": 1590, "next_billing_date": "2026-05-10T00:00:00Z", "is_active": false, "category_id": %q}`, category.ID)
+	decodeBody(t, doRequest(t, &user, http.MethodPut, "/", body, params, h.UpdateSubscription), &updated)
+	if updated.IsActive {
+		t.Errorf("subscription should be stopped: %+v", updated)
+	}
+}
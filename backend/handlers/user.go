@@ -1,20 +1,24 @@
 package handlers
 
 import (
+	"errors"
+	"kakeibo-backend/auth"
 	"kakeibo-backend/models"
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
-type UserHandler struct {
-	DB *gorm.DB
+type UserHandlers struct {
+	DB   *gorm.DB
+	Auth *auth.Service
 }
 
 
 // CREATE
-func (h *UserHandler) CreateUser(c echo.Context) error {
+func (h *UserHandlers) CreateUser(c echo.Context) error {
 	type CreateUserRequest struct {
 		Name string `json:"name"`
 		Email string `json:"email"`
@@ -24,12 +28,23 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
 	user := models.User{
 		Name: req.Name,
-		Email: req.Email,
-		Password: req.Password,
+		Email: auth.NormalizeEmail(req.Email),
+		Password: hash,
 	}
-	if err := h.DB.Create(&user).Error; err != nil {
+	// 既定のカテゴリもあわせて作成する
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return models.SeedCategories(tx, user.ID)
+	})
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 	return c.JSON(http.StatusOK, user)
@@ -38,9 +53,9 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 
 
 // GET
-func (h *UserHandler) GetAllUser(c echo.Context) error {
+func (h *UserHandlers) GetAllUser(c echo.Context) error {
 	user := []models.User{}
-	if err := h.DB.Find(&user).Error; err != nil {
+	if err := selfDB(h.DB, c).Find(&user).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 	return c.JSON(http.StatusOK, user)
@@ -48,10 +63,58 @@ func (h *UserHandler) GetAllUser(c echo.Context) error {
 
 
 // GET BY NAME
-func (h *UserHandler) GetUserByName (c echo.Context) error {
+func (h *UserHandlers) GetUserByName (c echo.Context) error {
 	name := c.Param("name")
 	var user []models.User
-	if err := h.DB.Find(&user, "name LIKE ?", "%" + name + "%").Error; err != nil {
+	if err := selfDB(h.DB, c).Find(&user, "name LIKE ?", "%" + name + "%").Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+
+
+// GET WITH PAGINATION
+// ?page=1&limit=50
+func (h *UserHandlers) GetUserWithPagination(c echo.Context) error {
+	limit, err := parseLimit(c.QueryParam("limit"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	var users []models.User
+	if err := selfDB(h.DB, c).Order("created_at ASC").Offset((page - 1) * limit).Limit(limit).Find(&users).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, users)
+}
+
+
+
+// SEARCH
+// ?name= で部分一致検索
+func (h *UserHandlers) SearchUser(c echo.Context) error {
+	name := c.QueryParam("name")
+	var users []models.User
+	if err := selfDB(h.DB, c).Find(&users, "name LIKE ?", "%" + name + "%").Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, users)
+}
+
+
+
+// GET WITH EXPENSE
+func (h *UserHandlers) GetUserWithExpense(c echo.Context) error {
+	id := c.Param("user_id")
+	var user models.User
+	if err := selfDB(h.DB, c).Preload("Expenses.Category").First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "User not found")
+		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 	return c.JSON(http.StatusOK, user)
@@ -60,10 +123,13 @@ func (h *UserHandler) GetUserByName (c echo.Context) error {
 
 
 // GET BY ID
-func (h *UserHandler) GetUserById(c echo.Context) error {
+func (h *UserHandlers) GetUserById(c echo.Context) error {
 	id := c.Param("id")
 	var user models.User
-	if err := h.DB.First(&user, "id = ?", id).Error; err != nil {
+	if err := selfDB(h.DB, c).First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "User not found")
+		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 	return c.JSON(http.StatusOK, user)
@@ -73,11 +139,11 @@ func (h *UserHandler) GetUserById(c echo.Context) error {
 
 
 // UPDATE
-func (h *UserHandler) UpdateUser(c echo.Context) error {
+func (h *UserHandlers) UpdateUser(c echo.Context) error {
     id := c.Param("id")
     var user models.User
-    if err := h.DB.First(&user, "id = ?", id).Error; err != nil {
-        if err == gorm.ErrRecordNotFound {
+    if err := selfDB(h.DB, c).First(&user, "id = ?", id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
             return c.JSON(http.StatusNotFound, "User not found")
         }
         return c.JSON(http.StatusInternalServerError, err.Error())
@@ -85,16 +151,36 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
     type UpdateUserRequest struct {
         Name  string `json:"name"`
         Email string `json:"email"`
+        // 変更する場合のみ指定する
+        Password        string `json:"password"`
+        CurrentPassword string `json:"current_password"`
     }
     req := UpdateUserRequest{}
     if err := c.Bind(&req); err != nil {
         return c.JSON(http.StatusBadRequest, err.Error())
     }
     user.Name = req.Name
-    user.Email = req.Email
+    user.Email = auth.NormalizeEmail(req.Email)
+    passwordChanged := req.Password != ""
+    if passwordChanged {
+        if !auth.CheckPassword(user.Password, req.CurrentPassword) {
+            return c.JSON(http.StatusForbidden, "current_password is incorrect")
+        }
+        hash, err := auth.HashPassword(req.Password)
+        if err != nil {
+            return c.JSON(http.StatusBadRequest, err.Error())
+        }
+        user.Password = hash
+    }
     if err := h.DB.Save(&user).Error; err != nil {
         return c.JSON(http.StatusInternalServerError, err.Error())
     }
+    // パスワード変更時は既存セッションをすべて失効させる
+    if passwordChanged {
+        if err := h.Auth.RevokeAll(user.ID); err != nil {
+            return c.JSON(http.StatusInternalServerError, err.Error())
+        }
+    }
     return c.JSON(http.StatusOK, user)
 }
 
@@ -102,10 +188,14 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 
 
 // DELETE
-func (h *UserHandler) DeleteUserById(c echo.Context) error {
+func (h *UserHandlers) DeleteUser(c echo.Context) error {
 	id := c.Param("id")
-	if err := h.DB.Delete(&models.User{}, "id = ?", id).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+	result := selfDB(h.DB, c).Delete(&models.User{}, "id = ?", id)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "User not found")
 	}
 	return c.JSON(http.StatusOK, id)
 }
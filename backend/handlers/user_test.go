@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+	"net/http"
+	"testing"
+)
+
+// TestUserOwnership は他人のユーザー情報を参照・更新・削除できないことのテスト
+func TestUserOwnership(t *testing.T) {
+	db := newTestDB(t)
+	h := &UserHandlers{DB: db}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	for _, u := range []*models.User{&user, &other} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	self := map[string]string{"id": user.ID.String()}
+	foreign := map[string]string{"id": other.ID.String()}
+
+	if rec := doRequest(t, &user, http.MethodGet, "/", "", self, h.GetUserById); rec.Code != http.StatusOK {
+		t.Errorf("GET self: status = %d, want 200", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodGet, "/", "", foreign, h.GetUserById); rec.Code != http.StatusNotFound {
+		t.Errorf("GET foreign: status = %d, want 404", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodGet, "/", "", map[string]string{"user_id": other.ID.String()}, h.GetUserWithExpense); rec.Code != http.StatusNotFound {
+		t.Errorf("GET foreign expenses: status = %d, want 404", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodPut, "/", `{"name":"x","email":"x@example.com"}`, foreign, h.UpdateUser); rec.Code != http.StatusNotFound {
+		t.Errorf("PUT foreign: status = %d, want 404", rec.Code)
+	}
+	if rec := doRequest(t, &user, http.MethodDelete, "/", "", foreign, h.DeleteUser); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE foreign: status = %d, want 404", rec.Code)
+	}
+
+	var users []models.User
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/?name=a", "", nil, h.SearchUser), &users)
+	if len(users) != 1 || users[0].ID != user.ID {
+		t.Errorf("search leaked other users: %+v", users)
+	}
+}
+
+// TestCreateUserSeedsCategories はユーザー作成時に既定のカテゴリが作成されることのテスト
+func TestCreateUserSeedsCategories(t *testing.T) {
+	db := newTestDB(t)
+	h := &UserHandlers{DB: db}
+	var user models.User
+	decodeBody(t, doRequest(t, nil, http.MethodPost, "/api/users", `{"name":"taro","email":"taro@example.com","password":"password123"}`, nil, h.CreateUser), &user)
+
+	var categories []models.Category
+	if err := db.Scopes(models.VisibleCategories(user.ID)).Find(&categories).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := 0
+	for _, d := range models.DefaultCategories {
+		want += 1 + len(d.Children)
+	}
+	if len(categories) != want {
+		t.Fatalf("got %d categories, want %d", len(categories), want)
+	}
+	byName := map[string]models.Category{}
+	for _, c := range categories {
+		byName[c.Name] = c
+	}
+	food, eatingOut := byName["食費"], byName["外食"]
+	if eatingOut.ParentID == nil || *eatingOut.ParentID != food.ID || food.UserID == nil || *food.UserID != user.ID {
+		t.Errorf("外食 should be a child of the user's 食費: %+v, %+v", food, eatingOut)
+	}
+}
+
+func TestCreateUserNormalizesEmail(t *testing.T) {
+	db := newTestDB(t)
+	h := &UserHandlers{DB: db}
+	var user models.User
+	decodeBody(t, doRequest(t, nil, http.MethodPost, "/api/users", `{"name":"taro","email":" Taro@Example.com ","password":"password123"}`, nil, h.CreateUser), &user)
+	if user.Email != "taro@example.com" {
+		t.Errorf("email = %q, want taro@example.com", user.Email)
+	}
+
+	// 登録した時と同じ表記でも、小文字でもログインできる
+	s := &auth.Service{DB: db, Tokens: auth.NewTokenIssuer([]byte("test-secret"))}
+	for _, email := range []string{" Taro@Example.com ", "taro@example.com"} {
+		if _, err := s.Login(email, "password123", "test"); err != nil {
+			t.Errorf("Login(%q): %v", email, err)
+		}
+	}
+}
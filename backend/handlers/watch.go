@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/models"
+	"kakeibo-backend/netguard"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// 価格監視の取得間隔 (分)
+const (
+	defaultWatchIntervalMinutes = 360
+	minWatchIntervalMinutes     = 15
+)
+
+type WatchHandlers struct {
+	DB *gorm.DB
+}
+
+type watchItemRequest struct {
+	Name            string   `json:"name"`
+	URL             string   `json:"url"`
+	ItemSelector    string   `json:"item_selector"`
+	NameSelector    string   `json:"name_selector"`
+	PriceSelector   string   `json:"price_selector"`
+	TargetPrice     *int64   `json:"target_price"`
+	DropPercent     *float64 `json:"drop_percent"`
+	IntervalMinutes uint     `json:"interval_minutes"`
+	IsActive        bool     `json:"is_active"`
+}
+
+func (r *watchItemRequest) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	// 定期的にサーバーから取得するため、内部のアドレスは登録させない (名前解決の結果は取得時に確認する)
+	if err := netguard.CheckURL(u); err != nil {
+		return errors.New("url must not point to an internal address")
+	}
+	if strings.TrimSpace(r.PriceSelector) == "" {
+		return errors.New("price_selector is required")
+	}
+	// 商品ページ1件を対象とするため、既定ではページ全体を1商品とみなす
+	if r.ItemSelector == "" {
+		r.ItemSelector = "html"
+	}
+	if r.NameSelector == "" {
+		r.NameSelector = "title"
+	}
+	if r.TargetPrice != nil && *r.TargetPrice <= 0 {
+		return errors.New("target_price must be positive")
+	}
+	if r.DropPercent != nil && (*r.DropPercent <= 0 || *r.DropPercent >= 100) {
+		return errors.New("drop_percent must be between 0 and 100")
+	}
+	if r.IntervalMinutes == 0 {
+		r.IntervalMinutes = defaultWatchIntervalMinutes
+	}
+	if r.IntervalMinutes < minWatchIntervalMinutes {
+		return errors.New("interval_minutes must be at least 15")
+	}
+	return nil
+}
+
+func (r watchItemRequest) apply(item *models.WatchItem) {
+	item.Name = r.Name
+	item.URL = r.URL
+	item.ItemSelector = r.ItemSelector
+	item.NameSelector = r.NameSelector
+	item.PriceSelector = r.PriceSelector
+	item.TargetPrice = r.TargetPrice
+	item.DropPercent = r.DropPercent
+	item.IntervalMinutes = r.IntervalMinutes
+	item.IsActive = r.IsActive
+}
+
+// CREATE
+// 次回の監視実行ですぐに価格を取得する
+func (h *WatchHandlers) CreateWatchItem(c echo.Context) error {
+	req := watchItemRequest{IsActive: true}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	item := models.WatchItem{NextCheckAt: time.Now(), UserID: auth.CurrentUserID(c)}
+	req.apply(&item)
+	if err := h.DB.Create(&item).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, item)
+}
+
+// GET
+func (h *WatchHandlers) GetWatchItem(c echo.Context) error {
+	items := []models.WatchItem{}
+	if err := ownedDB(h.DB, c).Order("created_at DESC").Find(&items).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+// UPDATE
+// URL やセレクタの変更をすぐ確認できるよう、次回の監視実行で取得し直す
+func (h *WatchHandlers) UpdateWatchItem(c echo.Context) error {
+	id := c.Param("id")
+	var item models.WatchItem
+	if err := ownedDB(h.DB, c).First(&item, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "WatchItem not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	req := watchItemRequest{IsActive: item.IsActive}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	req.apply(&item)
+	item.NextCheckAt = time.Now()
+	if err := h.DB.Omit("User").Save(&item).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, item)
+}
+
+// DELETE
+// 価格の履歴は残す
+func (h *WatchHandlers) DeleteWatchItem(c echo.Context) error {
+	id := c.Param("id")
+	result := ownedDB(h.DB, c).Delete(&models.WatchItem{}, "id = ?", id)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, "WatchItem not found")
+	}
+	return c.JSON(http.StatusOK, id)
+}
+
+// GET HISTORY
+// 取得日時の新しい順 (limit で件数を指定)
+func (h *WatchHandlers) GetPriceHistory(c echo.Context) error {
+	id := c.Param("id")
+	var item models.WatchItem
+	if err := ownedDB(h.DB, c).First(&item, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "WatchItem not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	limit, err := parseLimit(c.QueryParam("limit"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	history := []models.PriceHistory{}
+	if err := ownedDB(h.DB, c).Where("watch_item_id = ?", item.ID).
+		Order("checked_at DESC").Limit(limit).Find(&history).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"kakeibo-backend/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCreateWatchItem(t *testing.T) {
+	h := &WatchHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"name": "コーヒーミル", "url": "https://shop.example.com/items/1", "price_selector": ".price", "target_price": 5000}`
+	var item models.WatchItem
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/watch-items", body, nil, h.CreateWatchItem), &item)
+	if item.ItemSelector != "html" || item.NameSelector != "title" || item.IntervalMinutes != defaultWatchIntervalMinutes || !item.IsActive {
+		t.Errorf("defaults not applied: %+v", item)
+	}
+	if item.NextCheckAt.After(time.Now()) {
+		t.Errorf("new item should be checked on the next run: %v", item.NextCheckAt)
+	}
+
+	invalid := []string{
+		`{"name": "x", "url": "file:///etc/passwd", "price_selector": ".price"}`,
+		`{"name": "x", "url": "https://shop.example.com", "price_selector": ""}`,
+		`{"name": "x", "url": "https://shop.example.com", "price_selector": ".price", "drop_percent": 100}`,
+		`{"name": "x", "url": "https://shop.example.com", "price_selector": ".price", "interval_minutes": 1}`,
+		`{"name": "x", "url": "http://127.0.0.1:8080/admin", "price_selector": ".price"}`,
+		`{"name": "x", "url": "http://169.254.169.254/latest/meta-data/", "price_selector": ".price"}`,
+		`{"name": "x", "url": "http://localhost/", "price_selector": ".price"}`,
+	}
+	for _, body := range invalid {
+		if rec := doRequest(t, &user, http.MethodPost, "/api/watch-items", body, nil, h.CreateWatchItem); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestGetPriceHistoryOwnedOnly(t *testing.T) {
+	h := &WatchHandlers{DB: newTestDB(t)}
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	for _, v := range []interface{}{&user, &other} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	item := models.WatchItem{Name: "x", URL: "https://example.com", PriceSelector: ".price", IntervalMinutes: 60, NextCheckAt: time.Now(), UserID: user.ID}
+	if err := h.DB.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	for i, price := range []int64{5980, 4980} {
+		row := models.PriceHistory{WatchItemID: item.ID, Price: price, Currency: "JPY", CheckedAt: base.Add(time.Duration(i) * time.Hour), UserID: user.ID}
+		if err := h.DB.Create(&row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	params := map[string]string{"id": item.ID.String()}
+	var rows []models.PriceHistory
+	decodeBody(t, doRequest(t, &user, http.MethodGet, "/api/watch-items/x/history", "", params, h.GetPriceHistory), &rows)
+	if len(rows) != 2 || rows[0].Price != 4980 {
+		t.Errorf("history = %+v", rows)
+	}
+	if rec := doRequest(t, &other, http.MethodGet, "/api/watch-items/x/history", "", params, h.GetPriceHistory); rec.Code != http.StatusNotFound {
+		t.Errorf("other user status = %d, want 404", rec.Code)
+	}
+}
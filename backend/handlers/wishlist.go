@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"errors"
+	"kakeibo-backend/auth"
+	"kakeibo-backend/duplicate"
+	"kakeibo-backend/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// errAlreadyBought は購入済みの商品をもう一度購入しようとしたことを表す
+var errAlreadyBought = errors.New("wishlist item is already bought")
+
+type WishlistHandlers struct {
+	DB *gorm.DB
+}
+
+type wishlistItemRequest struct {
+	// ScrapedItemID を指定すると、省略した商品情報をスクレイピング結果から補う
+	ScrapedItemID *uuid.UUID `json:"scraped_item_id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	ImageURL      string     `json:"image_url"`
+	Description   string     `json:"description"`
+	Price         *int64     `json:"price"`
+	Currency      string     `json:"currency"`
+	Note          string     `json:"note"`
+	CategoryID    uuid.UUID  `json:"category_id"`
+	// Watch を指定すると WatchItem を作成して価格を追跡する (name と url は商品のものを使う)
+	Watch *watchItemRequest `json:"watch"`
+}
+
+// fill は省略された商品情報を item で補う
+func (r *wishlistItemRequest) fill(item models.ScrapedItem) {
+	if r.Name == "" {
+		r.Name = item.Name
+	}
+	if r.URL == "" {
+		r.URL = item.URL
+	}
+	if r.ImageURL == "" {
+		r.ImageURL = item.ImageURL
+	}
+	if r.Description == "" {
+		r.Description = item.Description
+	}
+	if r.Price == nil {
+		r.Price = item.Price
+		r.Currency = item.Currency
+	}
+}
+
+func (r *wishlistItemRequest) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	if r.Price != nil && *r.Price < 0 {
+		return errors.New("price must not be negative")
+	}
+	if r.CategoryID == uuid.Nil {
+		return errors.New("category_id is required")
+	}
+	if r.Watch != nil {
+		r.Watch.Name = r.Name
+		r.Watch.URL = r.URL
+		r.Watch.IsActive = true
+		if err := r.Watch.validate(); err != nil {
+			return errors.New("watch: " + err.Error())
+		}
+	}
+	return nil
+}
+
+type wishlistUpdateRequest struct {
+	Name       string    `json:"name"`
+	Note       string    `json:"note"`
+	CategoryID uuid.UUID `json:"category_id"`
+}
+
+func (r wishlistUpdateRequest) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if r.CategoryID == uuid.Nil {
+		return errors.New("category_id is required")
+	}
+	return nil
+}
+
+// boughtRequest は購入の記録。全て省略できる
+type boughtRequest struct {
+	// Amount は実際に支払った金額 (省略時は追跡中の最新価格、無ければ登録時の価格)
+	Amount      *int       `json:"amount"`
+	SpentAt     *time.Time `json:"spent_at"`
+	CategoryID  *uuid.UUID `json:"category_id"`
+	Description string     `json:"description"`
+}
+
+// BoughtResponse は購入の記録のレスポンス
+type BoughtResponse struct {
+	Item    models.WishlistItem `json:"item"`
+	Expense models.Expense      `json:"expense"`
+}
+
+// CREATE
+func (h *WishlistHandlers) CreateWishlistItem(c echo.Context) error {
+	req := wishlistItemRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.ScrapedItemID != nil {
+		var scraped models.ScrapedItem
+		if err := ownedDB(h.DB, c).First(&scraped, "id = ?", *req.ScrapedItemID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.JSON(http.StatusBadRequest, "scraped_item_id not found")
+			}
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+		req.fill(scraped)
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := checkCategory(h.DB, c, req.CategoryID); err != nil {
+		return c.JSON(categoryErrorStatus(err), err.Error())
+	}
+
+	userID := auth.CurrentUserID(c)
+	item := models.WishlistItem{
+		Name:          req.Name,
+		URL:           req.URL,
+		ImageURL:      req.ImageURL,
+		Description:   req.Description,
+		Price:         req.Price,
+		Currency:      req.Currency,
+		Note:          req.Note,
+		Status:        models.WishlistPlanned,
+		CategoryID:    req.CategoryID,
+		ScrapedItemID: req.ScrapedItemID,
+		UserID:        userID,
+	}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Watch != nil {
+			watch := models.WatchItem{NextCheckAt: time.Now(), UserID: userID}
+			req.Watch.apply(&watch)
+			if err := tx.Create(&watch).Error; err != nil {
+				return err
+			}
+			item.WatchItemID = &watch.ID
+		}
+		return tx.Create(&item).Error
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.wishlistItems(c).First(&item, "id = ?", item.ID).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, item)
+}
+
+// GET
+// ?status=planned|bought で絞り込み
+func (h *WishlistHandlers) GetWishlist(c echo.Context) error {
+	query := h.wishlistItems(c)
+	switch status := c.QueryParam("status"); status {
+	case "":
+	case models.WishlistPlanned, models.WishlistBought:
+		query = query.Where("status = ?", status)
+	default:
+		return c.JSON(http.StatusBadRequest, "status must be planned or bought")
+	}
+	items := []models.WishlistItem{}
+	if err := query.Order("created_at DESC").Find(&items).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+// UPDATE
+func (h *WishlistHandlers) UpdateWishlistItem(c echo.Context) error {
+	id := c.Param("id")
+	var item models.WishlistItem
+	if err := ownedDB(h.DB, c).First(&item, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "WishlistItem not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	req := wishlistUpdateRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := checkCategory(h.DB, c, req.CategoryID); err != nil {
+		return c.JSON(categoryErrorStatus(err), err.Error())
+	}
+	item.Name = req.Name
+	item.Note = req.Note
+	item.CategoryID = req.CategoryID
+	if err := h.DB.Omit("Category", "WatchItem", "User").Save(&item).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.wishlistItems(c).First(&item, "id = ?", item.ID).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, item)
+}
+
+// DELETE
+// 価格の追跡も止める。購入済みの場合、変換した支出は残す
+func (h *WishlistHandlers) DeleteWishlistItem(c echo.Context) error {
+	id := c.Param("id")
+	var item models.WishlistItem
+	if err := ownedDB(h.DB, c).First(&item, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "WishlistItem not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if item.WatchItemID != nil {
+			if err := tx.Delete(&models.WatchItem{}, "id = ?", *item.WatchItemID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&item).Error
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, id)
+}
+
+// BOUGHT
+// 商品を購入済みにし、支払った金額で Expense を作成する
+// Expense の説明は商品名、カテゴリは登録時のもの (どちらもリクエストで変更できる)
+// 価格の追跡は停止する。購入済みなら 409
+// 重複の候補が見つかった場合は expense.possible_duplicates にその支出の ID を返す
+func (h *WishlistHandlers) MarkWishlistItemBought(c echo.Context) error {
+	id := c.Param("id")
+	var item models.WishlistItem
+	if err := ownedDB(h.DB, c).Preload("WatchItem").First(&item, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "WishlistItem not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	req := boughtRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	expense := models.Expense{
+		Description:    item.Name,
+		SpentAt:        time.Now(),
+		UserID:         item.UserID,
+		CategoryID:     item.CategoryID,
+		WishlistItemID: &item.ID,
+		ProductURL:     item.URL,
+	}
+	if req.Amount != nil {
+		expense.Amount = *req.Amount
+	} else if price := wishlistPrice(item); price != nil {
+		expense.Amount = int(*price)
+	} else {
+		return c.JSON(http.StatusBadRequest, "amount is required (the price of the item is unknown)")
+	}
+	if expense.Amount <= 0 {
+		return c.JSON(http.StatusBadRequest, "amount must be positive")
+	}
+	if req.SpentAt != nil {
+		expense.SpentAt = *req.SpentAt
+	}
+	if req.CategoryID != nil && *req.CategoryID != uuid.Nil {
+		if err := checkCategory(h.DB, c, *req.CategoryID); err != nil {
+			return c.JSON(categoryErrorStatus(err), err.Error())
+		}
+		expense.CategoryID = *req.CategoryID
+	}
+	if strings.TrimSpace(req.Description) != "" {
+		expense.Description = req.Description
+	}
+
+	var duplicates []models.Expense
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// 同時に購入した場合に支出が二重にならないよう、状態が planned の場合のみ更新する
+		result := tx.Model(&models.WishlistItem{}).
+			Where("id = ? AND status = ?", item.ID, models.WishlistPlanned).
+			Updates(map[string]interface{}{"status": models.WishlistBought, "bought_at": expense.SpentAt})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyBought
+		}
+		if err := tx.Omit("Category").Create(&expense).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.WishlistItem{}).Where("id = ?", item.ID).Update("expense_id", expense.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		if duplicates, err = (&duplicate.Detector{}).Flag(tx, expense); err != nil {
+			return err
+		}
+		if item.WatchItemID != nil {
+			return tx.Model(&models.WatchItem{}).Where("id = ?", *item.WatchItemID).Update("is_active", false).Error
+		}
+		return nil
+	})
+	if errors.Is(err, errAlreadyBought) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	res := BoughtResponse{}
+	if err := h.wishlistItems(c).First(&res.Item, "id = ?", item.ID).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.DB.Preload("Category").First(&res.Expense, "id = ?", expense.ID).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	for _, d := range duplicates {
+		res.Expense.PossibleDuplicates = append(res.Expense.PossibleDuplicates, d.ID)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// GET HISTORY
+// 追跡中の価格の履歴を取得日時の新しい順で返す (limit で件数を指定)
+// 価格を追跡していない商品は空の配列
+func (h *WishlistHandlers) GetWishlistPriceHistory(c echo.Context) error {
+	id := c.Param("id")
+	var item models.WishlistItem
+	if err := ownedDB(h.DB, c).First(&item, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, "WishlistItem not found")
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	limit, err := parseLimit(c.QueryParam("limit"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	history := []models.PriceHistory{}
+	if item.WatchItemID != nil {
+		if err := ownedDB(h.DB, c).Where("watch_item_id = ?", *item.WatchItemID).
+			Order("checked_at DESC").Limit(limit).Find(&history).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+	}
+	return c.JSON(http.StatusOK, history)
+}
+
+// wishlistPrice は支出の金額に使える item の価格を返す
+// 追跡中の最新の価格、無ければ登録時の価格。円以外の通貨の価格は使わない
+func wishlistPrice(item models.WishlistItem) *int64 {
+	if w := item.WatchItem; w != nil && w.LastPrice != nil && (w.Currency == "" || w.Currency == "JPY") {
+		return w.LastPrice
+	}
+	if item.Price != nil && (item.Currency == "" || item.Currency == "JPY") {
+		return item.Price
+	}
+	return nil
+}
+
+// wishlistItems はカテゴリと価格の追跡を読み込む、認証済みユーザーの WishlistItem のクエリを返す
+func (h *WishlistHandlers) wishlistItems(c echo.Context) *gorm.DB {
+	return ownedDB(h.DB, c).Preload("Category").Preload("WatchItem")
+}
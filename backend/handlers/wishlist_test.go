@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"kakeibo-backend/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// seedWishlist はユーザーとカテゴリ、スクレイピング結果を1件登録する
+func seedWishlist(t *testing.T, h *WishlistHandlers) (models.User, models.Category, models.ScrapedItem) {
+	t.Helper()
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	hobby := models.Category{Name: "趣味"}
+	for _, v := range []interface{}{&user, &hobby} {
+		if err := h.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	price := int64(4980)
+	scraped := models.ScrapedItem{Name: "コーヒーミル", URL: "https://shop.example.com/items/1", RawPrice: "¥4,980", Price: &price, Currency: "JPY",
+		SourceURL: "https://shop.example.com/list", ScrapedAt: time.Now(), UserID: user.ID}
+	if err := h.DB.Create(&scraped).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user, hobby, scraped
+}
+
+func TestCreateWishlistItemFromScrapedItem(t *testing.T) {
+	h := &WishlistHandlers{DB: newTestDB(t)}
+	user, hobby, scraped := seedWishlist(t, h)
+
+	body := fmt.Sprintf(`{"scraped_item_id": %q, "category_id": %q, "watch": {"price_selector": ".price", "target_price": 4000}}`, scraped.ID, hobby.ID)
+	var item models.WishlistItem
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/wishlist", body, nil, h.CreateWishlistItem), &item)
+	if item.Name != "コーヒーミル" || item.URL != scraped.URL || item.Price == nil || *item.Price != 4980 || item.Status != models.WishlistPlanned {
+		t.Errorf("product fields should be copied from the scraped item: %+v", item)
+	}
+	if item.WatchItem == nil || item.WatchItem.URL != scraped.URL || !item.WatchItem.IsActive || item.WatchItem.Name != "コーヒーミル" {
+		t.Errorf("watch item should track the product: %+v", item.WatchItem)
+	}
+
+	invalid := []string{
+		fmt.Sprintf(`{"name": "x", "url": "https://example.com", "category_id": %q, "watch": {"price_selector": ""}}`, hobby.ID),
+		`{"name": "x", "url": "https://example.com"}`,
+		fmt.Sprintf(`{"scraped_item_id": %q, "category_id": %q}`, hobby.ID, hobby.ID),
+	}
+	for _, body := range invalid {
+		if rec := doRequest(t, &user, http.MethodPost, "/api/wishlist", body, nil, h.CreateWishlistItem); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestMarkWishlistItemBought(t *testing.T) {
+	h := &WishlistHandlers{DB: newTestDB(t)}
+	user, hobby, _ := seedWishlist(t, h)
+	price := int64(4980)
+	watch := models.WatchItem{Name: "x", URL: "https://shop.example.com/items/1", PriceSelector: ".price", IntervalMinutes: 60,
+		NextCheckAt: time.Now(), IsActive: true, LastPrice: &price, Currency: "JPY", UserID: user.ID}
+	if err := h.DB.Create(&watch).Error; err != nil {
+		t.Fatal(err)
+	}
+	item := models.WishlistItem{Name: "コーヒーミル", URL: watch.URL, Status: models.WishlistPlanned, CategoryID: hobby.ID, WatchItemID: &watch.ID, UserID: user.ID}
+	if err := h.DB.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{"id": item.ID.String()}
+
+	// 金額を省略すると追跡中の最新価格を使う
+	var res BoughtResponse
+	decodeBody(t, doRequest(t, &user, http.MethodPost, "/api/wishlist/"+item.ID.String()+"/bought", "", params, h.MarkWishlistItemBought), &res)
+	e := res.Expense
+	if e.Amount != 4980 || e.Description != "コーヒーミル" || e.CategoryID != hobby.ID || e.ProductURL != item.URL ||
+		e.WishlistItemID == nil || *e.WishlistItemID != item.ID {
+		t.Errorf("unexpected expense: %+v", e)
+	}
+	if res.Item.Status != models.WishlistBought || res.Item.BoughtAt == nil || res.Item.ExpenseID == nil || *res.Item.ExpenseID != e.ID {
+		t.Errorf("item should be marked bought: %+v", res.Item)
+	}
+	if err := h.DB.First(&watch, "id = ?", watch.ID).Error; err != nil || watch.IsActive {
+		t.Errorf("price tracking should stop: %+v, %v", watch, err)
+	}
+
+	// 二重に購入しない
+	if rec := doRequest(t, &user, http.MethodPost, "/api/wishlist/"+item.ID.String()+"/bought", `{"amount": 4500}`, params, h.MarkWishlistItemBought); rec.Code != http.StatusConflict {
+		t.Errorf("second purchase: status = %d, want 409", rec.Code)
+	}
+	var count int64
+	h.DB.Model(&models.Expense{}).Where("wishlist_item_id = ?", item.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("got %d expenses, want 1", count)
+	}
+}
+
+func TestMarkWishlistItemBoughtRequiresAmount(t *testing.T) {
+	h := &WishlistHandlers{DB: newTestDB(t)}
+	user, hobby, _ := seedWishlist(t, h)
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	if err := h.DB.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	usd := int64(1999)
+	item := models.WishlistItem{Name: "book", URL: "https://shop.example.com/items/2", Price: &usd, Currency: "USD", Status: models.WishlistPlanned, CategoryID: hobby.ID, UserID: user.ID}
+	if err := h.DB.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{"id": item.ID.String()}
+	target := "/api/wishlist/" + item.ID.String() + "/bought"
+
+	// 円以外の価格は金額に使わない
+	if rec := doRequest(t, &user, http.MethodPost, target, "", params, h.MarkWishlistItemBought); rec.Code != http.StatusBadRequest {
+		t.Errorf("without amount: status = %d, want 400", rec.Code)
+	}
+	if rec := doRequest(t, &other, http.MethodPost, target, `{"amount": 3000}`, params, h.MarkWishlistItemBought); rec.Code != http.StatusNotFound {
+		t.Errorf("other user: status = %d, want 404", rec.Code)
+	}
+	// 先に手入力していた同じ購入は重複の候補になる
+	manual := models.Expense{Amount: 3000, Description: "Book", SpentAt: time.Date(2026, 4, 9, 20, 0, 0, 0, time.UTC), UserID: user.ID, CategoryID: hobby.ID}
+	if err := h.DB.Create(&manual).Error; err != nil {
+		t.Fatal(err)
+	}
+	var res BoughtResponse
+	decodeBody(t, doRequest(t, &user, http.MethodPost, target, `{"amount": 3000, "spent_at": "2026-04-10T12:00:00Z"}`, params, h.MarkWishlistItemBought), &res)
+	if res.Expense.Amount != 3000 || !res.Expense.SpentAt.Equal(time.Date(2026, 4, 10, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expense: %+v", res.Expense)
+	}
+	if len(res.Expense.PossibleDuplicates) != 1 || res.Expense.PossibleDuplicates[0] != manual.ID {
+		t.Errorf("possible_duplicates = %v, want [%s]", res.Expense.PossibleDuplicates, manual.ID)
+	}
+}
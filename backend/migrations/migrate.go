@@ -0,0 +1,268 @@
+// Package migrations はバージョン管理されたSQLマイグレーションを適用する
+//
+// マイグレーションは sql/ 配下に次の命名で置き、バイナリに埋め込まれる。
+//
+//	0001_init.up.sql    適用
+//	0001_init.down.sql  取り消し
+//
+// 適用済みのバージョンとup SQLのチェックサムは schema_migrations テーブルに記録される。
+// 適用済みファイルを後から書き換えるとチェックサム不一致でエラーになるため、
+// スキーマ変更は必ず新しいバージョンとして追加すること。
+package migrations
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// 複数インスタンスが同時に起動しても二重適用しないためのアドバイザリロックのキー
+const advisoryLockKey = 7205195
+
+var ErrChecksumMismatch = errors.New("applied migration has been modified")
+
+// Migration は1バージョン分のマイグレーション
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status は status コマンドで表示する1行分の状態
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Modified は適用後にupファイルが変更されていることを表す
+	Modified bool
+}
+
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	Checksum  string    `gorm:"size:64;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// Load は fsys 直下の *.sql からマイグレーションを読み込み、バージョン順に返す
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := fileNamePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+			sum := sha256.Sum256(body)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", mig.Version, mig.Name)
+		}
+		if mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Runner はマイグレーションの適用・取り消しを行う
+type Runner struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+// New は埋め込みのマイグレーションを使うRunnerを返す
+func New(db *gorm.DB) (*Runner, error) {
+	sub, err := fs.Sub(embedded, "sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Load(sub)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{DB: db, Migrations: migrations}, nil
+}
+
+// Up は未適用のマイグレーションを順に適用し、適用したものを返す
+// 適用済みマイグレーションのファイルが変更されていれば何もせず ErrChecksumMismatch を返す
+func (r *Runner) Up() ([]Migration, error) {
+	var ran []Migration
+	err := r.locked(func(db *gorm.DB) error {
+		done, err := applied(db)
+		if err != nil {
+			return err
+		}
+		if err := r.verify(done); err != nil {
+			return err
+		}
+		for _, mig := range r.Migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(mig.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{
+					Version:   mig.Version,
+					Name:      mig.Name,
+					Checksum:  mig.Checksum,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("apply %s: %w", mig.FileName(), err)
+			}
+			ran = append(ran, mig)
+		}
+		return nil
+	})
+	return ran, err
+}
+
+// Down は適用済みのマイグレーションを新しい順に steps 件取り消し、取り消したものを返す
+func (r *Runner) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := r.locked(func(db *gorm.DB) error {
+		done, err := applied(db)
+		if err != nil {
+			return err
+		}
+		if err := r.verify(done); err != nil {
+			return err
+		}
+		for i := len(r.Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := r.Migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(mig.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, "version = ?", mig.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("revert %s: %w", mig.FileName(), err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status は全マイグレーションの適用状況をバージョン順に返す
+func (r *Runner) Status() ([]Status, error) {
+	if err := r.DB.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+	done, err := applied(r.DB)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(r.Migrations))
+	for _, mig := range r.Migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if row, ok := done[mig.Version]; ok {
+			appliedAt := row.AppliedAt
+			st.AppliedAt = &appliedAt
+			st.Modified = row.Checksum != mig.Checksum
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+func applied(db *gorm.DB) (map[int]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+func (r *Runner) verify(done map[int]schemaMigration) error {
+	for _, mig := range r.Migrations {
+		if row, ok := done[mig.Version]; ok && row.Checksum != mig.Checksum {
+			return fmt.Errorf("%w: %s", ErrChecksumMismatch, mig.FileName())
+		}
+	}
+	return nil
+}
+
+// locked は schema_migrations を用意し、PostgreSQLではアドバイザリロックを取って fn を実行する
+func (r *Runner) locked(fn func(db *gorm.DB) error) error {
+	if err := r.DB.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+	if r.DB.Dialector.Name() != "postgres" {
+		return fn(r.DB)
+	}
+	// アドバイザリロックはセッション単位なので、同じ接続で取得・実行・解放する
+	return r.DB.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", advisoryLockKey).Error; err != nil {
+			return err
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", advisoryLockKey)
+		return fn(conn)
+	})
+}
+
+// FileName はマイグレーションの表示用の名前を返す (例: 0001_init)
+func (m Migration) FileName() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
@@ -0,0 +1,161 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_items.up.sql":         {Data: []byte("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT);")},
+		"0001_items.down.sql":       {Data: []byte("DROP TABLE items;")},
+		"0002_items_price.up.sql":   {Data: []byte("ALTER TABLE items ADD COLUMN price INTEGER; CREATE INDEX idx_items_price ON items (price);")},
+		"0002_items_price.down.sql": {Data: []byte("DROP INDEX idx_items_price; ALTER TABLE items DROP COLUMN price;")},
+	}
+}
+
+func newTestRunner(t *testing.T, fsys fstest.MapFS) *Runner {
+	t.Helper()
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Runner{DB: newTestDB(t), Migrations: migrations}
+}
+
+// TestEmbeddedMigrations は埋め込みのマイグレーションが読み込めることのテスト
+func TestEmbeddedMigrations(t *testing.T) {
+	r, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range r.Migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s: version should be %d (no gaps)", m.FileName(), i+1)
+		}
+	}
+}
+
+// TestUpDownStatus は適用・状態確認・取り消しの一連の流れのテスト
+func TestUpDownStatus(t *testing.T) {
+	r := newTestRunner(t, testFS())
+
+	applied, err := r.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Fatalf("applied %d migrations, want 2", len(applied))
+	}
+	if err := r.DB.Exec("INSERT INTO items (name, price) VALUES ('a', 100)").Error; err != nil {
+		t.Fatalf("schema not applied: %v", err)
+	}
+
+	// 2回目は何もしない
+	applied, err = r.Up()
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("second Up: applied %d, err %v", len(applied), err)
+	}
+
+	reverted, err := r.Down(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("reverted %+v, want version 2", reverted)
+	}
+
+	statuses, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Errorf("unexpected status: %+v", statuses)
+	}
+
+	if _, err := r.Down(5); err != nil {
+		t.Fatal(err)
+	}
+	if r.DB.Migrator().HasTable("items") {
+		t.Error("items should be dropped")
+	}
+}
+
+// TestChecksumMismatch は適用済みファイルの書き換えを検出するテスト
+func TestChecksumMismatch(t *testing.T) {
+	fsys := testFS()
+	r := newTestRunner(t, fsys)
+	if _, err := r.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys["0001_items.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE items (id INTEGER PRIMARY KEY);")}
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Migrations = migrations
+
+	if _, err := r.Up(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	statuses, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Modified || statuses[1].Modified {
+		t.Errorf("unexpected status: %+v", statuses)
+	}
+}
+
+// TestFailedMigrationRollsBack は失敗したマイグレーションが記録されないことのテスト
+func TestFailedMigrationRollsBack(t *testing.T) {
+	fsys := testFS()
+	fsys["0003_broken.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE broken (id INTEGER); SELECT * FROM missing_table;")}
+	fsys["0003_broken.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE broken;")}
+	r := newTestRunner(t, fsys)
+
+	applied, err := r.Up()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(applied) != 2 {
+		t.Errorf("applied %d migrations before failure, want 2", len(applied))
+	}
+	statuses, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[2].AppliedAt != nil {
+		t.Error("failed migration should not be recorded")
+	}
+}
+
+// TestLoadRejectsMissingDown は down ファイルのないマイグレーションを拒否するテスト
+func TestLoadRejectsMissingDown(t *testing.T) {
+	fsys := fstest.MapFS{"0001_items.up.sql": {Data: []byte("SELECT 1;")}}
+	if _, err := Load(fsys); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS notification_logs;
+DROP TABLE IF EXISTS notification_settings;
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS public_fees;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS expenses;
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,131 @@
+-- 初期スキーマ
+-- これまで AutoMigrate で作成していたDBにもそのまま適用できるよう、
+-- テーブル・インデックスは IF NOT EXISTS で GORM と同じ名前で作成する
+
+CREATE TABLE IF NOT EXISTS users (
+    id           CHAR(36) PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    name         TEXT NOT NULL,
+    email        TEXT NOT NULL CONSTRAINT uni_users_email UNIQUE,
+    password     TEXT NOT NULL,
+    icon         TEXT,
+    profile_memo TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id         CHAR(36) PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    name       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_at ON categories (deleted_at);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id                CHAR(36) PRIMARY KEY,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ,
+    deleted_at        TIMESTAMPTZ,
+    name              TEXT NOT NULL,
+    monthly_fee       BIGINT NOT NULL,
+    biling_cycle_days BIGINT NOT NULL,
+    next_billing_date TIMESTAMPTZ NOT NULL,
+    is_active         BOOLEAN NOT NULL,
+    user_id           CHAR(36) NOT NULL CONSTRAINT fk_users_subscriptions REFERENCES users (id),
+    category_id       CHAR(36) NOT NULL CONSTRAINT fk_subscriptions_category REFERENCES categories (id)
+);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_deleted_at ON subscriptions (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_id ON subscriptions (user_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_category_id ON subscriptions (category_id);
+
+CREATE TABLE IF NOT EXISTS expenses (
+    id          CHAR(36) PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    amount      BIGINT NOT NULL,
+    description TEXT NOT NULL,
+    spent_at    TIMESTAMPTZ NOT NULL,
+    user_id     CHAR(36) NOT NULL CONSTRAINT fk_users_expenses REFERENCES users (id),
+    category_id CHAR(36) NOT NULL CONSTRAINT fk_expenses_category REFERENCES categories (id)
+);
+CREATE INDEX IF NOT EXISTS idx_expenses_deleted_at ON expenses (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_expenses_spent_at ON expenses (spent_at);
+CREATE INDEX IF NOT EXISTS idx_expenses_user_id ON expenses (user_id);
+CREATE INDEX IF NOT EXISTS idx_expenses_category_id ON expenses (category_id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id                 CHAR(36) PRIMARY KEY,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    deleted_at         TIMESTAMPTZ,
+    refresh_token_hash TEXT NOT NULL,
+    expires_at         TIMESTAMPTZ NOT NULL,
+    revoked_at         TIMESTAMPTZ,
+    user_agent         TEXT,
+    user_id            CHAR(36) NOT NULL CONSTRAINT fk_sessions_user REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_deleted_at ON sessions (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_refresh_token_hash ON sessions (refresh_token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS public_fees (
+    id                CHAR(36) PRIMARY KEY,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ,
+    deleted_at        TIMESTAMPTZ,
+    fee_type          TEXT NOT NULL,
+    amount            BIGINT NOT NULL,
+    usage_month       BIGINT NOT NULL,
+    next_billing_date TIMESTAMPTZ NOT NULL,
+    user_id           CHAR(36) NOT NULL CONSTRAINT fk_public_fees_user REFERENCES users (id),
+    category_id       CHAR(36) NOT NULL CONSTRAINT fk_public_fees_category REFERENCES categories (id)
+);
+CREATE INDEX IF NOT EXISTS idx_public_fees_deleted_at ON public_fees (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_public_fees_user_id ON public_fees (user_id);
+CREATE INDEX IF NOT EXISTS idx_public_fees_category_id ON public_fees (category_id);
+
+CREATE TABLE IF NOT EXISTS reports (
+    id                 CHAR(36) PRIMARY KEY,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    deleted_at         TIMESTAMPTZ,
+    target_month       TIMESTAMPTZ NOT NULL,
+    total_expense      BIGINT NOT NULL,
+    total_public_fee   BIGINT NOT NULL,
+    total_subscription BIGINT NOT NULL,
+    category_breakdown JSON,
+    user_id            CHAR(36) NOT NULL CONSTRAINT fk_reports_user REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_reports_deleted_at ON reports (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_reports_target_month ON reports (target_month);
+CREATE INDEX IF NOT EXISTS idx_reports_user_id ON reports (user_id);
+
+CREATE TABLE IF NOT EXISTS notification_settings (
+    id                  CHAR(36) PRIMARY KEY,
+    created_at          TIMESTAMPTZ,
+    updated_at          TIMESTAMPTZ,
+    deleted_at          TIMESTAMPTZ,
+    enable_subscription BOOLEAN,
+    enable_public_fee   BOOLEAN,
+    remind_day_of_month BIGINT,
+    user_id             CHAR(36) NOT NULL CONSTRAINT fk_notification_settings_user REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_notification_settings_deleted_at ON notification_settings (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_notification_settings_user_id ON notification_settings (user_id);
+
+CREATE TABLE IF NOT EXISTS notification_logs (
+    id                  CHAR(36) PRIMARY KEY,
+    created_at          TIMESTAMPTZ,
+    updated_at          TIMESTAMPTZ,
+    deleted_at          TIMESTAMPTZ,
+    subscription_remind BOOLEAN,
+    public_fee_remind   BOOLEAN,
+    sent_at             TIMESTAMPTZ,
+    user_id             CHAR(36) NOT NULL CONSTRAINT fk_notification_logs_user REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_notification_logs_deleted_at ON notification_logs (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_notification_logs_user_id ON notification_logs (user_id);
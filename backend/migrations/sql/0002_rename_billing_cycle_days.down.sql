@@ -0,0 +1 @@
+ALTER TABLE subscriptions RENAME COLUMN billing_cycle_days TO biling_cycle_days;
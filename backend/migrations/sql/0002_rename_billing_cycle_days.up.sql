@@ -0,0 +1,2 @@
+-- typo修正: biling_cycle_days -> billing_cycle_days
+ALTER TABLE subscriptions RENAME COLUMN biling_cycle_days TO billing_cycle_days;
@@ -0,0 +1,2 @@
+-- GET /api/expenses のキーセットページネーション (user_id で絞り込み, spent_at, id 順) 用
+CREATE INDEX idx_expenses_user_spent_at ON expenses (user_id, spent_at, id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_expenses_subscription_spent_at;
+ALTER TABLE expenses DROP COLUMN subscription_id;
+ALTER TABLE subscriptions DROP COLUMN billing_day;
+ALTER TABLE subscriptions DROP COLUMN billing_cycle;
@@ -0,0 +1,15 @@
+-- サブスクリプション自動計上のための請求サイクルと、計上済み支出の紐付け
+
+ALTER TABLE subscriptions ADD COLUMN billing_cycle TEXT NOT NULL DEFAULT 'monthly';
+ALTER TABLE subscriptions ADD COLUMN billing_day BIGINT NOT NULL DEFAULT 0;
+
+-- これまでは日数のみで管理していたため、代表的な日数を暦の月・年に読み替える
+UPDATE subscriptions SET billing_cycle = 'yearly' WHERE billing_cycle_days IN (365, 366);
+UPDATE subscriptions SET billing_cycle = 'days'
+    WHERE billing_cycle_days > 0 AND billing_cycle_days NOT IN (28, 29, 30, 31, 365, 366);
+UPDATE subscriptions SET billing_day = EXTRACT(DAY FROM next_billing_date)
+    WHERE billing_cycle IN ('monthly', 'yearly');
+
+ALTER TABLE expenses ADD COLUMN subscription_id CHAR(36)
+    CONSTRAINT fk_expenses_subscription REFERENCES subscriptions (id);
+CREATE UNIQUE INDEX idx_expenses_subscription_spent_at ON expenses (subscription_id, spent_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_reports_user_month;
+ALTER TABLE reports DROP COLUMN source_fingerprint;
@@ -0,0 +1,3 @@
+-- 月次レポートの再集計判定用の要約と、ユーザー・月ごとに1件の制約
+ALTER TABLE reports ADD COLUMN source_fingerprint TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX idx_reports_user_month ON reports (user_id, target_month);
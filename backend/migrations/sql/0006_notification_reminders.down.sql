@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_notification_settings_user_id;
+CREATE INDEX idx_notification_settings_user_id ON notification_settings (user_id);
+
+DROP INDEX IF EXISTS idx_notification_logs_user_month;
+ALTER TABLE notification_logs DROP COLUMN remind_month;
@@ -0,0 +1,9 @@
+-- リマインドの月ごとの重複防止と、通知設定をユーザーごとに1件にする
+
+ALTER TABLE notification_logs ADD COLUMN remind_month TIMESTAMPTZ;
+UPDATE notification_logs SET remind_month = date_trunc('month', COALESCE(sent_at, created_at, now())) WHERE remind_month IS NULL;
+ALTER TABLE notification_logs ALTER COLUMN remind_month SET NOT NULL;
+CREATE UNIQUE INDEX idx_notification_logs_user_month ON notification_logs (user_id, remind_month);
+
+DROP INDEX IF EXISTS idx_notification_settings_user_id;
+CREATE UNIQUE INDEX idx_notification_settings_user_id ON notification_settings (user_id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS notifications;
+
+ALTER TABLE notification_settings DROP COLUMN webhook_token;
+ALTER TABLE notification_settings DROP COLUMN webhook_format;
+ALTER TABLE notification_settings DROP COLUMN webhook_url;
+ALTER TABLE notification_settings DROP COLUMN channel;
@@ -0,0 +1,20 @@
+-- 通知の送信先の選択とアプリ内の受信箱
+
+ALTER TABLE notification_settings ADD COLUMN channel TEXT NOT NULL DEFAULT 'inbox';
+ALTER TABLE notification_settings ADD COLUMN webhook_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE notification_settings ADD COLUMN webhook_format TEXT NOT NULL DEFAULT '';
+ALTER TABLE notification_settings ADD COLUMN webhook_token TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE notifications (
+    id         CHAR(36) PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    subject    TEXT NOT NULL,
+    body       TEXT NOT NULL,
+    items      JSON,
+    read_at    TIMESTAMPTZ,
+    user_id    CHAR(36) NOT NULL CONSTRAINT fk_notifications_user REFERENCES users (id)
+);
+CREATE INDEX idx_notifications_deleted_at ON notifications (deleted_at);
+CREATE INDEX idx_notifications_user_id ON notifications (user_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_public_fees_user_usage;
+
+ALTER TABLE public_fees DROP COLUMN unit;
+ALTER TABLE public_fees DROP COLUMN quantity;
+ALTER TABLE public_fees DROP COLUMN usage_year;
@@ -0,0 +1,13 @@
+-- 公共料金の使用年と使用量
+
+ALTER TABLE public_fees ADD COLUMN usage_year BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE public_fees ADD COLUMN quantity DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE public_fees ADD COLUMN unit TEXT NOT NULL DEFAULT '';
+
+-- 既存の行は請求日から使用年を推定する (使用月が請求月より後なら前年の使用分)
+UPDATE public_fees
+SET usage_year = EXTRACT(YEAR FROM next_billing_date)
+    - CASE WHEN usage_month > EXTRACT(MONTH FROM next_billing_date) THEN 1 ELSE 0 END
+WHERE usage_year = 0;
+
+CREATE INDEX idx_public_fees_user_usage ON public_fees (user_id, fee_type, usage_year, usage_month);
@@ -0,0 +1,22 @@
+-- スクレイピング結果の保存
+
+CREATE TABLE scraped_items (
+    id           CHAR(36) PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    name         TEXT NOT NULL,
+    url          TEXT NOT NULL,
+    image_url    TEXT,
+    description  TEXT,
+    raw_price    TEXT,
+    price        BIGINT,
+    currency     TEXT,
+    tax_included BOOLEAN,
+    source_url   TEXT NOT NULL,
+    scraped_at   TIMESTAMPTZ NOT NULL,
+    user_id      CHAR(36) NOT NULL CONSTRAINT fk_scraped_items_user REFERENCES users (id)
+);
+CREATE INDEX idx_scraped_items_deleted_at ON scraped_items (deleted_at);
+CREATE INDEX idx_scraped_items_user_id ON scraped_items (user_id);
+CREATE UNIQUE INDEX idx_scraped_items_user_url ON scraped_items (user_id, url);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS price_histories;
+DROP TABLE IF EXISTS watch_items;
@@ -0,0 +1,44 @@
+-- 商品の価格監視と価格の履歴
+
+CREATE TABLE watch_items (
+    id               CHAR(36) PRIMARY KEY,
+    created_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ,
+    deleted_at       TIMESTAMPTZ,
+    name             TEXT NOT NULL,
+    url              TEXT NOT NULL,
+    item_selector    TEXT NOT NULL,
+    name_selector    TEXT NOT NULL,
+    price_selector   TEXT NOT NULL,
+    target_price     BIGINT,
+    drop_percent     DOUBLE PRECISION,
+    interval_minutes BIGINT NOT NULL,
+    next_check_at    TIMESTAMPTZ NOT NULL,
+    is_active        BOOLEAN NOT NULL DEFAULT TRUE,
+    last_checked_at  TIMESTAMPTZ,
+    last_price       BIGINT,
+    currency         TEXT,
+    last_error       TEXT,
+    user_id          CHAR(36) NOT NULL CONSTRAINT fk_watch_items_user REFERENCES users (id)
+);
+CREATE INDEX idx_watch_items_deleted_at ON watch_items (deleted_at);
+CREATE INDEX idx_watch_items_next_check_at ON watch_items (next_check_at);
+CREATE INDEX idx_watch_items_user_id ON watch_items (user_id);
+
+CREATE TABLE price_histories (
+    id            CHAR(36) PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ,
+    watch_item_id CHAR(36) NOT NULL CONSTRAINT fk_price_histories_watch_item REFERENCES watch_items (id),
+    price         BIGINT NOT NULL,
+    currency      TEXT NOT NULL,
+    tax_included  BOOLEAN,
+    raw_price     TEXT,
+    checked_at    TIMESTAMPTZ NOT NULL,
+    alert_reason  TEXT NOT NULL DEFAULT '',
+    user_id       CHAR(36) NOT NULL CONSTRAINT fk_price_histories_user REFERENCES users (id)
+);
+CREATE INDEX idx_price_histories_deleted_at ON price_histories (deleted_at);
+CREATE INDEX idx_price_histories_item_checked ON price_histories (watch_item_id, checked_at);
+CREATE INDEX idx_price_histories_user_id ON price_histories (user_id);
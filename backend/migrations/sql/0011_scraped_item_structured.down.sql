@@ -0,0 +1,2 @@
+ALTER TABLE scraped_items DROP COLUMN gtin;
+ALTER TABLE scraped_items DROP COLUMN availability;
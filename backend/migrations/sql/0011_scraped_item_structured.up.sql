@@ -0,0 +1,4 @@
+-- 構造化データ (JSON-LD など) から取得した在庫状況と GTIN
+
+ALTER TABLE scraped_items ADD COLUMN availability TEXT;
+ALTER TABLE scraped_items ADD COLUMN gtin TEXT;
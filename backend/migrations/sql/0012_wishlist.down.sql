@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_expenses_wishlist_item_id;
+ALTER TABLE expenses DROP COLUMN product_url;
+ALTER TABLE expenses DROP COLUMN wishlist_item_id;
+DROP TABLE IF EXISTS wishlist_items;
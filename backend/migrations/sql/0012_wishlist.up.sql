@@ -0,0 +1,30 @@
+-- 欲しいものリストと、購入して支出にした場合の紐付け
+
+CREATE TABLE wishlist_items (
+    id              CHAR(36) PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    deleted_at      TIMESTAMPTZ,
+    name            TEXT NOT NULL,
+    url             TEXT NOT NULL,
+    image_url       TEXT,
+    description     TEXT,
+    price           BIGINT,
+    currency        TEXT,
+    note            TEXT,
+    status          TEXT NOT NULL DEFAULT 'planned',
+    category_id     CHAR(36) NOT NULL CONSTRAINT fk_wishlist_items_category REFERENCES categories (id),
+    scraped_item_id CHAR(36) CONSTRAINT fk_wishlist_items_scraped_item REFERENCES scraped_items (id),
+    watch_item_id   CHAR(36) CONSTRAINT fk_wishlist_items_watch_item REFERENCES watch_items (id),
+    bought_at       TIMESTAMPTZ,
+    expense_id      CHAR(36) CONSTRAINT fk_wishlist_items_expense REFERENCES expenses (id),
+    user_id         CHAR(36) NOT NULL CONSTRAINT fk_wishlist_items_user REFERENCES users (id)
+);
+CREATE INDEX idx_wishlist_items_deleted_at ON wishlist_items (deleted_at);
+CREATE INDEX idx_wishlist_items_status ON wishlist_items (status);
+CREATE INDEX idx_wishlist_items_category_id ON wishlist_items (category_id);
+CREATE INDEX idx_wishlist_items_user_id ON wishlist_items (user_id);
+
+ALTER TABLE expenses ADD COLUMN wishlist_item_id CHAR(36) CONSTRAINT fk_expenses_wishlist_item REFERENCES wishlist_items (id);
+ALTER TABLE expenses ADD COLUMN product_url TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_expenses_wishlist_item_id ON expenses (wishlist_item_id);
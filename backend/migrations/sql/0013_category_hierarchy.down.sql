@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_categories_user_id;
+DROP INDEX IF EXISTS idx_categories_parent_id;
+ALTER TABLE categories DROP COLUMN user_id;
+ALTER TABLE categories DROP COLUMN parent_id;
+ALTER TABLE categories DROP COLUMN icon;
+ALTER TABLE categories DROP COLUMN color;
@@ -0,0 +1,9 @@
+-- カテゴリをユーザーごとにし、階層・色・アイコンを追加する
+-- 既存のカテゴリは user_id が NULL の既定カテゴリとして残る
+
+ALTER TABLE categories ADD COLUMN color TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN icon TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN parent_id CHAR(36) CONSTRAINT fk_categories_parent REFERENCES categories (id);
+ALTER TABLE categories ADD COLUMN user_id CHAR(36) CONSTRAINT fk_categories_user REFERENCES users (id);
+CREATE INDEX idx_categories_parent_id ON categories (parent_id);
+CREATE INDEX idx_categories_user_id ON categories (user_id);
@@ -0,0 +1,3 @@
+-- カテゴリのアーカイブ
+
+ALTER TABLE categories ADD COLUMN archived_at TIMESTAMPTZ;
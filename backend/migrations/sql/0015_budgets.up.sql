@@ -0,0 +1,34 @@
+-- カテゴリごとの月の予算と、使用率の通知の記録
+
+CREATE TABLE budgets (
+    id               CHAR(36) PRIMARY KEY,
+    created_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ,
+    deleted_at       TIMESTAMPTZ,
+    amount           BIGINT NOT NULL,
+    month            TIMESTAMPTZ,
+    rollover         BOOLEAN NOT NULL DEFAULT FALSE,
+    alert_thresholds JSON,
+    user_id          CHAR(36) NOT NULL CONSTRAINT fk_budgets_user REFERENCES users (id),
+    category_id      CHAR(36) NOT NULL CONSTRAINT fk_budgets_category REFERENCES categories (id)
+);
+CREATE INDEX idx_budgets_deleted_at ON budgets (deleted_at);
+CREATE INDEX idx_budgets_month ON budgets (month);
+CREATE INDEX idx_budgets_user_id ON budgets (user_id);
+CREATE INDEX idx_budgets_category_id ON budgets (category_id);
+
+CREATE TABLE budget_alerts (
+    id         CHAR(36) PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    budget_id  CHAR(36) NOT NULL CONSTRAINT fk_budget_alerts_budget REFERENCES budgets (id),
+    month      TIMESTAMPTZ NOT NULL,
+    threshold  BIGINT NOT NULL,
+    percent    DOUBLE PRECISION NOT NULL,
+    sent_at    TIMESTAMPTZ NOT NULL,
+    user_id    CHAR(36) NOT NULL CONSTRAINT fk_budget_alerts_user REFERENCES users (id)
+);
+CREATE INDEX idx_budget_alerts_deleted_at ON budget_alerts (deleted_at);
+CREATE INDEX idx_budget_alerts_user_id ON budget_alerts (user_id);
+CREATE UNIQUE INDEX idx_budget_alerts_budget_month_threshold ON budget_alerts (budget_id, month, threshold);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_expenses_import_batch_id;
+ALTER TABLE expenses DROP COLUMN import_batch_id;
+DROP TABLE IF EXISTS import_batches;
@@ -0,0 +1,24 @@
+-- 明細CSVの取り込みと、取り込んだ支出の紐付け
+
+CREATE TABLE import_batches (
+    id             CHAR(36) PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    deleted_at     TIMESTAMPTZ,
+    file_name      TEXT NOT NULL DEFAULT '',
+    format         TEXT NOT NULL,
+    encoding       TEXT NOT NULL,
+    status         TEXT NOT NULL DEFAULT 'pending',
+    rows           JSON,
+    row_count      BIGINT NOT NULL DEFAULT 0,
+    expense_count  BIGINT NOT NULL DEFAULT 0,
+    committed_at   TIMESTAMPTZ,
+    rolled_back_at TIMESTAMPTZ,
+    user_id        CHAR(36) NOT NULL CONSTRAINT fk_import_batches_user REFERENCES users (id)
+);
+CREATE INDEX idx_import_batches_deleted_at ON import_batches (deleted_at);
+CREATE INDEX idx_import_batches_status ON import_batches (status);
+CREATE INDEX idx_import_batches_user_id ON import_batches (user_id);
+
+ALTER TABLE expenses ADD COLUMN import_batch_id CHAR(36) CONSTRAINT fk_expenses_import_batch REFERENCES import_batches (id);
+CREATE INDEX idx_expenses_import_batch_id ON expenses (import_batch_id);
@@ -0,0 +1,2 @@
+ALTER TABLE import_batches DROP COLUMN duplicate_count;
+DROP TABLE IF EXISTS duplicate_candidates;
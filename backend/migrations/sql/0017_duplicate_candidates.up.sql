@@ -0,0 +1,22 @@
+-- 二重に登録された可能性のある支出の組と、その判断
+
+CREATE TABLE duplicate_candidates (
+    id               CHAR(36) PRIMARY KEY,
+    created_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ,
+    deleted_at       TIMESTAMPTZ,
+    expense_id       CHAR(36) NOT NULL CONSTRAINT fk_duplicate_candidates_expense REFERENCES expenses (id),
+    duplicate_of_id  CHAR(36) NOT NULL CONSTRAINT fk_duplicate_candidates_duplicate_of REFERENCES expenses (id),
+    score            DOUBLE PRECISION NOT NULL,
+    status           TEXT NOT NULL DEFAULT 'pending',
+    kept_expense_id  CHAR(36),
+    resolved_at      TIMESTAMPTZ,
+    user_id          CHAR(36) NOT NULL CONSTRAINT fk_duplicate_candidates_user REFERENCES users (id)
+);
+CREATE INDEX idx_duplicate_candidates_deleted_at ON duplicate_candidates (deleted_at);
+CREATE UNIQUE INDEX idx_duplicate_candidates_pair ON duplicate_candidates (expense_id, duplicate_of_id);
+CREATE INDEX idx_duplicate_candidates_duplicate_of_id ON duplicate_candidates (duplicate_of_id);
+CREATE INDEX idx_duplicate_candidates_status ON duplicate_candidates (status);
+CREATE INDEX idx_duplicate_candidates_user_id ON duplicate_candidates (user_id);
+
+ALTER TABLE import_batches ADD COLUMN duplicate_count BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,23 @@
+-- 支出のカテゴリを自動で決める規則
+
+CREATE TABLE category_rules (
+    id                   CHAR(36) PRIMARY KEY,
+    created_at           TIMESTAMPTZ,
+    updated_at           TIMESTAMPTZ,
+    deleted_at           TIMESTAMPTZ,
+    name                 TEXT NOT NULL,
+    priority             BIGINT NOT NULL DEFAULT 0,
+    is_active            BOOLEAN NOT NULL DEFAULT TRUE,
+    description_contains TEXT NOT NULL DEFAULT '',
+    description_pattern  TEXT NOT NULL DEFAULT '',
+    merchant             TEXT NOT NULL DEFAULT '',
+    min_amount           BIGINT,
+    max_amount           BIGINT,
+    weekdays             JSON,
+    user_id              CHAR(36) NOT NULL CONSTRAINT fk_category_rules_user REFERENCES users (id),
+    category_id          CHAR(36) NOT NULL CONSTRAINT fk_category_rules_category REFERENCES categories (id)
+);
+CREATE INDEX idx_category_rules_deleted_at ON category_rules (deleted_at);
+CREATE INDEX idx_category_rules_priority ON category_rules (priority);
+CREATE INDEX idx_category_rules_user_id ON category_rules (user_id);
+CREATE INDEX idx_category_rules_category_id ON category_rules (category_id);
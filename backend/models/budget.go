@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// DefaultAlertThresholds は Budget.AlertThresholds の既定値 (使用率 %)
+var DefaultAlertThresholds = []int{80, 100}
+
+// Budget カテゴリごとの月の予算
+//
+// Month が null なら毎月の予算、指定するとその月だけの予算 (同じ月は毎月の予算より優先する)。
+// 予算は子孫のカテゴリの支出も含めて使う (「食費」の予算は「外食」の支出も含む)。
+type Budget struct {
+	BaseModel
+	Amount uint64 `json:"amount" gorm:"not null"`
+	// Month はその月だけの予算の月の1日。毎月の予算なら null
+	Month *time.Time `json:"month" gorm:"index"`
+	// Rollover が true なら前月までの残り (超過した場合はマイナス) を繰り越す (毎月の予算のみ)
+	Rollover bool `json:"rollover" gorm:"not null;default:false"`
+	// AlertThresholds は通知する使用率 (%) の JSON 配列。空なら通知しない
+	AlertThresholds datatypes.JSON `json:"alert_thresholds" gorm:"type:json"`
+
+	UserID     uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User       User      `json:"user" gorm:"foreignKey:UserID"`
+	CategoryID uuid.UUID `json:"category_id" gorm:"type:char(36);not null;index"`
+	Category   Category  `json:"category" gorm:"foreignKey:CategoryID"`
+}
+
+// BudgetAlert 予算の使用率の通知の記録
+// (budget_id, month, threshold) の一意制約で同じ月に同じしきい値を二度通知しない
+type BudgetAlert struct {
+	BaseModel
+	BudgetID uuid.UUID `json:"budget_id" gorm:"type:char(36);not null;uniqueIndex:idx_budget_alerts_budget_month_threshold,priority:1"`
+	// Month は対象の月の1日
+	Month     time.Time `json:"month" gorm:"not null;uniqueIndex:idx_budget_alerts_budget_month_threshold,priority:2"`
+	Threshold int       `json:"threshold" gorm:"not null;uniqueIndex:idx_budget_alerts_budget_month_threshold,priority:3"`
+	// Percent は通知した時点の使用率
+	Percent float64   `json:"percent" gorm:"not null"`
+	SentAt  time.Time `json:"sent_at" gorm:"not null"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User   User      `json:"user" gorm:"foreignKey:UserID"`
+}
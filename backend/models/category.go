@@ -1,8 +1,26 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
 
+	"github.com/google/uuid"
+)
+
+// Category 支出・サブスクリプション・公共料金の分類
+// UserID が null のものは全ユーザー共通の既定カテゴリ (ユーザーは編集できない)
+// ParentID で階層にできる (食費 > 外食)。レポートでは子の合計を親にも積み上げる
+// アーカイブしたカテゴリは選択肢に出さないが、既存の支出などの分類としては残る
 type Category struct {
 	BaseModel
-	Name string    `json:"name" gorm:"not null"`
-}
\ No newline at end of file
+	Name string `json:"name" gorm:"not null"`
+	// Color は "#RRGGBB"、Icon はフロントエンドのアイコン名 (どちらも任意)
+	Color    string     `json:"color" gorm:"not null;default:''"`
+	Icon     string     `json:"icon" gorm:"not null;default:''"`
+	ParentID *uuid.UUID `json:"parent_id" gorm:"type:char(36);index"`
+	UserID   *uuid.UUID `json:"user_id" gorm:"type:char(36);index"`
+	// ArchivedAt はアーカイブした日時 (アーカイブしていなければ null)
+	ArchivedAt *time.Time `json:"archived_at"`
+
+	// Children は階層で返す場合のみ設定する (保存しない)
+	Children []Category `json:"children,omitempty" gorm:"-"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultCategory は新規ユーザーに作成するカテゴリ (親と子の名前)
+type DefaultCategory struct {
+	Name     string
+	Color    string
+	Icon     string
+	Children []string
+}
+
+// DefaultCategories は一般的な家計簿の費目
+var DefaultCategories = []DefaultCategory{
+	{Name: "食費", Color: "#E57373", Icon: "restaurant", Children: []string{"自炊", "外食", "カフェ・間食"}},
+	{Name: "日用品", Color: "#FFB74D", Icon: "shopping_basket", Children: []string{"消耗品", "家具・家電"}},
+	{Name: "住居", Color: "#A1887F", Icon: "home", Children: []string{"家賃・ローン", "修繕・更新"}},
+	{Name: "水道光熱費", Color: "#4FC3F7", Icon: "bolt", Children: []string{"電気", "ガス", "水道"}},
+	{Name: "通信費", Color: "#7986CB", Icon: "smartphone", Children: []string{"携帯電話", "インターネット", "サブスクリプション"}},
+	{Name: "交通費", Color: "#4DB6AC", Icon: "train", Children: []string{"電車・バス", "タクシー", "ガソリン・駐車場"}},
+	{Name: "医療・保険", Color: "#81C784", Icon: "local_hospital", Children: []string{"医療費", "保険料"}},
+	{Name: "衣服・美容", Color: "#F06292", Icon: "checkroom", Children: []string{"衣服", "美容院・化粧品"}},
+	{Name: "趣味・娯楽", Color: "#BA68C8", Icon: "sports_esports", Children: []string{"書籍", "レジャー"}},
+	{Name: "教育", Color: "#FFD54F", Icon: "school"},
+	{Name: "交際費", Color: "#FF8A65", Icon: "celebration"},
+	{Name: "その他", Color: "#90A4AE", Icon: "more_horiz"},
+}
+
+// SeedCategories は userID のカテゴリとして DefaultCategories を作成する
+// 子カテゴリは親の色とアイコンを引き継ぐ
+func SeedCategories(db *gorm.DB, userID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, d := range DefaultCategories {
+			parent := Category{Name: d.Name, Color: d.Color, Icon: d.Icon, UserID: &userID}
+			if err := tx.Create(&parent).Error; err != nil {
+				return err
+			}
+			for _, name := range d.Children {
+				child := Category{Name: name, Color: d.Color, Icon: d.Icon, ParentID: &parent.ID, UserID: &userID}
+				if err := tx.Create(&child).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// CategoryRule 支出のカテゴリを自動で決める規則
+//
+// 指定した条件をすべて満たす支出を CategoryID のカテゴリにする (条件は1つ以上)。
+// 規則は Priority の小さい順 (同じなら作成順) に評価し、最初に一致したものを使う。IsActive が false の規則は使わない。
+type CategoryRule struct {
+	BaseModel
+	Name     string `json:"name" gorm:"not null"`
+	Priority int    `json:"priority" gorm:"not null;default:0;index"`
+	IsActive bool   `json:"is_active" gorm:"not null"`
+
+	// DescriptionContains は内容に含まれる文字列
+	DescriptionContains string `json:"description_contains" gorm:"not null;default:''"`
+	// DescriptionPattern は内容に一致する正規表現
+	DescriptionPattern string `json:"description_pattern" gorm:"not null;default:''"`
+	// Merchant は店名。内容がこの店名と一致するか、店名から始まる (「ｱﾏｿﾞﾝ」は「アマゾン」と同じ) 場合に一致する
+	Merchant string `json:"merchant" gorm:"not null;default:''"`
+	// MinAmount, MaxAmount は金額の範囲 (両端を含む)
+	MinAmount *int `json:"min_amount"`
+	MaxAmount *int `json:"max_amount"`
+	// Weekdays は SpentAt の曜日 (0 = 日曜日 〜 6 = 土曜日) の JSON 配列。空なら曜日を問わない
+	Weekdays datatypes.JSON `json:"weekdays" gorm:"type:json"`
+
+	UserID     uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User       User      `json:"user" gorm:"foreignKey:UserID"`
+	CategoryID uuid.UUID `json:"category_id" gorm:"type:char(36);not null;index"`
+	Category   Category  `json:"category" gorm:"foreignKey:CategoryID"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 重複の候補の状態 (DuplicateCandidate.Status)
+const (
+	DuplicatePending = "pending" // 確認待ち
+	DuplicateMerged  = "merged"  // 片方の支出を削除して1件にした
+	DuplicateIgnored = "ignored" // 別の支出と判断した (同じ組は二度と候補にしない)
+)
+
+// DuplicateCandidate 同じ買い物が二重に登録された可能性のある支出の組
+// (expense_id, duplicate_of_id) の一意制約で、判断済みの組を再び候補にしない
+type DuplicateCandidate struct {
+	BaseModel
+	// ExpenseID は後から登録された支出、DuplicateOfID は先に登録されていた支出
+	ExpenseID     uuid.UUID `json:"expense_id" gorm:"type:char(36);not null;uniqueIndex:idx_duplicate_candidates_pair,priority:1"`
+	Expense       Expense   `json:"expense" gorm:"foreignKey:ExpenseID"`
+	DuplicateOfID uuid.UUID `json:"duplicate_of_id" gorm:"type:char(36);not null;uniqueIndex:idx_duplicate_candidates_pair,priority:2;index"`
+	DuplicateOf   Expense   `json:"duplicate_of" gorm:"foreignKey:DuplicateOfID"`
+	// Score は内容の類似度 (0〜1)
+	Score  float64 `json:"score" gorm:"not null"`
+	Status string  `json:"status" gorm:"not null;default:pending;index"`
+	// KeptExpenseID は merged の場合に残した支出
+	KeptExpenseID *uuid.UUID `json:"kept_expense_id" gorm:"type:char(36)"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User   User      `json:"user" gorm:"foreignKey:UserID"`
+}
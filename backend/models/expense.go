@@ -9,10 +9,21 @@ type Expense struct {
 	BaseModel
 	Amount      int       `json:"amount" gorm:"not null"`
 	Description string    `json:"description" gorm:"not null"`
-	SpentAt     time.Time `json:"spent_at" gorm:"not null;index"`
+	SpentAt     time.Time `json:"spent_at" gorm:"not null;index;uniqueIndex:idx_expenses_subscription_spent_at,priority:2"`
 
 	UserID     uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
 	CategoryID uuid.UUID `json:"category_id" gorm:"type:char(36);not null;index"`
+	// SubscriptionID はサブスクリプションの自動計上で作られた支出のみ設定される
+	// (subscription_id, spent_at) の一意制約で同じ請求の二重計上を防ぐ
+	SubscriptionID *uuid.UUID `json:"subscription_id" gorm:"type:char(36);uniqueIndex:idx_expenses_subscription_spent_at,priority:1"`
+	// WishlistItemID は欲しいものリストから購入した支出のみ設定される (計画的な支出)
+	// ProductURL はその商品のページ
+	WishlistItemID *uuid.UUID `json:"wishlist_item_id" gorm:"type:char(36);index"`
+	ProductURL     string     `json:"product_url" gorm:"not null;default:''"`
+	// ImportBatchID は明細CSVから取り込んだ支出のみ設定される
+	ImportBatchID *uuid.UUID `json:"import_batch_id" gorm:"type:char(36);index"`
+	// PossibleDuplicates は登録時に重複の候補になった支出 (作成のレスポンスのみ設定する。保存しない)
+	PossibleDuplicates []uuid.UUID `json:"possible_duplicates,omitempty" gorm:"-"`
 
 	Category   Category  `json:"category" gorm:"foreignKey:CategoryID"`
 }
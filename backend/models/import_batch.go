@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// 取り込みの状態 (ImportBatch.Status)
+const (
+	ImportPending    = "pending"     // 読み込んだだけ (Rows を確認して取り込むか決める)
+	ImportCommitted  = "committed"   // 支出を作成した
+	ImportRolledBack = "rolled_back" // 作成した支出をまとめて削除した
+)
+
+// ImportBatch 明細CSVの1回分の取り込み
+// 取り込んだ Expense は ImportBatchID を持ち、取り消すとまとめて削除される
+type ImportBatch struct {
+	BaseModel
+	FileName string `json:"file_name" gorm:"not null;default:''"`
+	// Format は判定した明細の形式 (csvimport.Formats の名前)、Encoding は文字コード
+	Format   string `json:"format" gorm:"not null"`
+	Encoding string `json:"encoding" gorm:"not null"`
+	Status   string `json:"status" gorm:"not null;default:pending;index"`
+	// Rows は読み込んだ行 (csvimport.Row の JSON 配列)。取り込まない行も理由付きで含む
+	Rows datatypes.JSON `json:"rows,omitempty" gorm:"type:json"`
+	// RowCount は取り込める行の数、ExpenseCount は作成した支出の数
+	RowCount     int `json:"row_count" gorm:"not null;default:0"`
+	ExpenseCount int `json:"expense_count" gorm:"not null;default:0"`
+	// DuplicateCount は取り込んだ支出のうち重複の候補になったものの数
+	DuplicateCount int `json:"duplicate_count" gorm:"not null;default:0"`
+
+	CommittedAt  *time.Time `json:"committed_at"`
+	RolledBackAt *time.Time `json:"rolled_back_at"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User   User      `json:"user" gorm:"foreignKey:UserID"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Notification アプリ内の通知 (受信箱)
+type Notification struct {
+	BaseModel
+	Subject string         `json:"subject" gorm:"not null"`
+	Body    string         `json:"body" gorm:"not null"`
+	Items   datatypes.JSON `json:"items" gorm:"type:json"`
+	// ReadAt は既読にした日時。未読なら null
+	ReadAt *time.Time `json:"read_at"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User   User      `json:"user" gorm:"foreignKey:UserID"`
+}
@@ -6,12 +6,16 @@ import (
 	"github.com/google/uuid"
 )
 
+// NotificationLog リマインド送信の記録
+// (user_id, remind_month) の一意制約で同じ月に二度リマインドしない
 type NotificationLog struct {
 	BaseModel
 	SubscriptionRemind bool `json:"subscription_remind"`
 	PublicFeeRemind bool `json:"public_fee_remind"`
 	SentAt time.Time `json:"sent_at"`
+	// RemindMonth はリマインド対象の月の1日
+	RemindMonth time.Time `json:"remind_month" gorm:"not null;uniqueIndex:idx_notification_logs_user_month,priority:2"`
 
-	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index;uniqueIndex:idx_notification_logs_user_month,priority:1"`
 	User   User      `json:"user" gorm:"foreignKey:UserID"`
 }
\ No newline at end of file
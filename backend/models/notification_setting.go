@@ -2,12 +2,35 @@ package models
 
 import "github.com/google/uuid"
 
+// 通知の送信先 (NotificationSetting.Channel)
+const (
+	ChannelInbox   = "inbox"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// Webhook のペイロード形式 (NotificationSetting.WebhookFormat)
+const (
+	WebhookSlack   = "slack"
+	WebhookDiscord = "discord"
+	WebhookLINE    = "line"
+)
+
+// NotificationSetting 通知設定 (ユーザーごとに1件)
+// RemindDayOfMonth 日 (その月に無ければ月末) に翌月分までの請求予定をリマインドする
 type NotificationSetting struct {
 	BaseModel
 	EnableSubscription bool `json:"enable_subscription"` 
 	EnablePublicFee bool `json:"enable_public_fee"` 
 	RemindDayOfMonth int `json:"remind_day_of_month"` 
+	// Channel は送信先 (inbox / email / webhook)
+	Channel string `json:"channel" gorm:"not null;default:'inbox'"`
+	// WebhookURL, WebhookFormat は Channel が webhook のときに使う
+	WebhookURL    string `json:"webhook_url" gorm:"not null;default:''"`
+	WebhookFormat string `json:"webhook_format" gorm:"not null;default:''"`
+	// WebhookToken は Authorization: Bearer で送るトークン (LINE など)。レスポンスには含めない
+	WebhookToken string `json:"-" gorm:"not null;default:''"`
 
-	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;uniqueIndex"`
 	User   User      `json:"user" gorm:"foreignKey:UserID"`
 }
\ No newline at end of file
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 通知した理由 (PriceHistory.AlertReason)
+const (
+	AlertBelowTarget = "below_target"
+	AlertPriceDrop   = "price_drop"
+)
+
+// PriceHistory 監視中の商品の取得ごとの価格
+type PriceHistory struct {
+	BaseModel
+	WatchItemID uuid.UUID `json:"watch_item_id" gorm:"type:char(36);not null;index:idx_price_histories_item_checked,priority:1"`
+	Price       int64     `json:"price" gorm:"not null"`
+	Currency    string    `json:"currency" gorm:"not null"`
+	TaxIncluded *bool     `json:"tax_included"`
+	RawPrice    string    `json:"raw_price"`
+	CheckedAt   time.Time `json:"checked_at" gorm:"not null;index:idx_price_histories_item_checked,priority:2"`
+	// AlertReason はこの価格で通知した場合の理由 (通知していなければ空)
+	AlertReason string `json:"alert_reason" gorm:"not null;default:''"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User   User      `json:"user" gorm:"foreignKey:UserID"`
+}
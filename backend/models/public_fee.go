@@ -6,14 +6,26 @@ import (
 	"github.com/google/uuid"
 )
 
+// 使用量の単位 (PublicFee.Unit)
+const (
+	UnitKWh        = "kWh"
+	UnitCubicMeter = "m3"
+)
+
+// PublicFee 公共料金 (電気・ガス・水道など) の1回分の請求
+// UsageYear / UsageMonth は使用した月、NextBillingDate は請求日
 type PublicFee struct {
 	BaseModel
-	FeeType string `json:"fee_type" gorm:"not null"`
+	FeeType string `json:"fee_type" gorm:"not null;index:idx_public_fees_user_usage,priority:2"`
 	Amount  uint64 `json:"amount" gorm:"not null"`
-	UsageMonth uint `json:"usage_month" gorm:"not null"`
+	UsageMonth uint `json:"usage_month" gorm:"not null;index:idx_public_fees_user_usage,priority:4"`
+	UsageYear uint `json:"usage_year" gorm:"not null;default:0;index:idx_public_fees_user_usage,priority:3"`
 	NextBillingDate time.Time `json:"next_billing_date" gorm:"not null"`
+	// Quantity は使用量 (0 は未入力)。Unit はその単位
+	Quantity float64 `json:"quantity" gorm:"not null;default:0"`
+	Unit     string  `json:"unit" gorm:"not null;default:''"`
 
-	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index;index:idx_public_fees_user_usage,priority:1"`
 	User User `json:"user" gorm:"foreignKey:UserID"`
 	CategoryID uuid.UUID `json:"category_id" gorm:"type:char(36);not null;index"`
 	Category Category `json:"category" gorm:"foreignKey:CategoryID"`
@@ -6,14 +6,18 @@ import (
 	"gorm.io/datatypes"
 )
 
+// Report 月次レポート (report パッケージが集計して保存する)
+// CategoryBreakdown の形式は report.Breakdown を参照
 type Report struct {
 	BaseModel
-	TargetMonth       time.Time      `json:"target_month" gorm:"not null;index"`
+	TargetMonth       time.Time      `json:"target_month" gorm:"not null;index;uniqueIndex:idx_reports_user_month,priority:2"`
 	TotalExpense      uint64         `json:"total_expense" gorm:"not null"`
 	TotalPublicFee    uint64         `json:"total_public_fee" gorm:"not null"`
 	TotalSubscription uint64         `json:"total_subscription" gorm:"not null"`
 	CategoryBreakdown datatypes.JSON `json:"category_breakdown" gorm:"type:json"`
+	// SourceFingerprint は集計元データの要約。変わっていたら再集計する
+	SourceFingerprint string `json:"-" gorm:"not null;default:''"`
 
-	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index;uniqueIndex:idx_reports_user_month,priority:1"`
 	User   User      `json:"user" gorm:"foreignKey:UserID"`
-}
\ No newline at end of file
+}
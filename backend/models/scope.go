@@ -0,0 +1,31 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OwnedBy は user_id カラムを持つテーブルへのクエリを userID の行に限定するスコープ
+//
+//	db.Scopes(models.OwnedBy(userID)).Find(&expenses)
+//
+// userID が uuid.Nil の場合は何も返さない (認証漏れ時に全件が見えないようにする)
+func OwnedBy(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if userID == uuid.Nil {
+			return db.Where("1 = 0")
+		}
+		return db.Where("user_id = ?", userID)
+	}
+}
+
+// VisibleCategories は categories へのクエリを userID が使えるカテゴリ
+// (userID のカテゴリと既定のカテゴリ) に限定するスコープ
+func VisibleCategories(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if userID == uuid.Nil {
+			return db.Where("categories.user_id IS NULL")
+		}
+		return db.Where("(categories.user_id = ? OR categories.user_id IS NULL)", userID)
+	}
+}
@@ -0,0 +1,267 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(
+		&User{}, &Category{}, &Expense{}, &Subscription{}, &PublicFee{},
+		&Report{}, &NotificationSetting{}, &NotificationLog{}, &Notification{}, &ScrapedItem{},
+		&WatchItem{}, &PriceHistory{}, &WishlistItem{}, &Budget{}, &BudgetAlert{},
+		&ImportBatch{},
+		&DuplicateCandidate{},
+		&CategoryRule{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// ownedModel はスコープの検証対象となるモデル
+type ownedModel struct {
+	name string
+	// newRow は userID が持ち主の行を返す
+	newRow func(userID, categoryID uuid.UUID) interface{}
+	// newDest は読み込み先の空の値を返す
+	newDest func() interface{}
+	// newSlice は一覧の読み込み先を返す
+	newSlice func() interface{}
+	// count は一覧の件数を返す
+	count func(slice interface{}) int
+}
+
+func ownedModels() []ownedModel {
+	now := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	return []ownedModel{
+		{
+			name: "Expense",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &Expense{Amount: 100, Description: "x", SpentAt: now, UserID: u, CategoryID: c}
+			},
+			newDest:  func() interface{} { return &Expense{} },
+			newSlice: func() interface{} { return &[]Expense{} },
+			count:    func(s interface{}) int { return len(*s.(*[]Expense)) },
+		},
+		{
+			name: "Subscription",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &Subscription{Name: "x", MonthlyFee: 100, NextBillingDate: now, IsActive: true, UserID: u, CategoryID: c}
+			},
+			newDest:  func() interface{} { return &Subscription{} },
+			newSlice: func() interface{} { return &[]Subscription{} },
+			count:    func(s interface{}) int { return len(*s.(*[]Subscription)) },
+		},
+		{
+			name: "PublicFee",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &PublicFee{FeeType: "electricity", Amount: 100, UsageMonth: 4, NextBillingDate: now, UserID: u, CategoryID: c}
+			},
+			newDest:  func() interface{} { return &PublicFee{} },
+			newSlice: func() interface{} { return &[]PublicFee{} },
+			count:    func(s interface{}) int { return len(*s.(*[]PublicFee)) },
+		},
+		{
+			name: "Report",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &Report{TargetMonth: now, UserID: u}
+			},
+			newDest:  func() interface{} { return &Report{} },
+			newSlice: func() interface{} { return &[]Report{} },
+			count:    func(s interface{}) int { return len(*s.(*[]Report)) },
+		},
+		{
+			name: "NotificationSetting",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &NotificationSetting{RemindDayOfMonth: 1, UserID: u}
+			},
+			newDest:  func() interface{} { return &NotificationSetting{} },
+			newSlice: func() interface{} { return &[]NotificationSetting{} },
+			count:    func(s interface{}) int { return len(*s.(*[]NotificationSetting)) },
+		},
+		{
+			name: "NotificationLog",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &NotificationLog{SentAt: now, UserID: u}
+			},
+			newDest:  func() interface{} { return &NotificationLog{} },
+			newSlice: func() interface{} { return &[]NotificationLog{} },
+			count:    func(s interface{}) int { return len(*s.(*[]NotificationLog)) },
+		},
+		{
+			name: "Notification",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &Notification{Subject: "x", Body: "x", UserID: u}
+			},
+			newDest:  func() interface{} { return &Notification{} },
+			newSlice: func() interface{} { return &[]Notification{} },
+			count:    func(s interface{}) int { return len(*s.(*[]Notification)) },
+		},
+		{
+			name: "ScrapedItem",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &ScrapedItem{Name: "x", URL: "https://example.com/x", SourceURL: "https://example.com", ScrapedAt: now, UserID: u}
+			},
+			newDest:  func() interface{} { return &ScrapedItem{} },
+			newSlice: func() interface{} { return &[]ScrapedItem{} },
+			count:    func(s interface{}) int { return len(*s.(*[]ScrapedItem)) },
+		},
+		{
+			name: "WatchItem",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &WatchItem{Name: "x", URL: "https://example.com/x", PriceSelector: ".price", IntervalMinutes: 60, NextCheckAt: now, UserID: u}
+			},
+			newDest:  func() interface{} { return &WatchItem{} },
+			newSlice: func() interface{} { return &[]WatchItem{} },
+			count:    func(s interface{}) int { return len(*s.(*[]WatchItem)) },
+		},
+		{
+			name: "PriceHistory",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &PriceHistory{WatchItemID: uuid.New(), Price: 100, Currency: "JPY", CheckedAt: now, UserID: u}
+			},
+			newDest:  func() interface{} { return &PriceHistory{} },
+			newSlice: func() interface{} { return &[]PriceHistory{} },
+			count:    func(s interface{}) int { return len(*s.(*[]PriceHistory)) },
+		},
+		{
+			name: "WishlistItem",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &WishlistItem{Name: "x", URL: "https://example.com/x", Status: WishlistPlanned, CategoryID: c, UserID: u}
+			},
+			newDest:  func() interface{} { return &WishlistItem{} },
+			newSlice: func() interface{} { return &[]WishlistItem{} },
+			count:    func(s interface{}) int { return len(*s.(*[]WishlistItem)) },
+		},
+		{
+			name: "Budget",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &Budget{Amount: 30000, CategoryID: c, UserID: u}
+			},
+			newDest:  func() interface{} { return &Budget{} },
+			newSlice: func() interface{} { return &[]Budget{} },
+			count:    func(s interface{}) int { return len(*s.(*[]Budget)) },
+		},
+		{
+			name: "BudgetAlert",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &BudgetAlert{BudgetID: uuid.New(), Month: now, Threshold: 80, Percent: 85, SentAt: now, UserID: u}
+			},
+			newDest:  func() interface{} { return &BudgetAlert{} },
+			newSlice: func() interface{} { return &[]BudgetAlert{} },
+			count:    func(s interface{}) int { return len(*s.(*[]BudgetAlert)) },
+		},
+		{
+			name: "ImportBatch",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &ImportBatch{Format: "generic", Encoding: "utf-8", Status: ImportPending, UserID: u}
+			},
+			newDest:  func() interface{} { return &ImportBatch{} },
+			newSlice: func() interface{} { return &[]ImportBatch{} },
+			count:    func(s interface{}) int { return len(*s.(*[]ImportBatch)) },
+		},
+		{
+			name: "DuplicateCandidate",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &DuplicateCandidate{ExpenseID: uuid.New(), DuplicateOfID: uuid.New(), Score: 1, Status: DuplicatePending, UserID: u}
+			},
+			newDest:  func() interface{} { return &DuplicateCandidate{} },
+			newSlice: func() interface{} { return &[]DuplicateCandidate{} },
+			count:    func(s interface{}) int { return len(*s.(*[]DuplicateCandidate)) },
+		},
+		{
+			name: "CategoryRule",
+			newRow: func(u, c uuid.UUID) interface{} {
+				return &CategoryRule{Name: "x", DescriptionContains: "x", IsActive: true, CategoryID: c, UserID: u}
+			},
+			newDest:  func() interface{} { return &CategoryRule{} },
+			newSlice: func() interface{} { return &[]CategoryRule{} },
+			count:    func(s interface{}) int { return len(*s.(*[]CategoryRule)) },
+		},
+	}
+}
+
+// TestOwnedByIsolation は各モデルで他人の行が読めず、更新・削除もできないことのテスト
+func TestOwnedByIsolation(t *testing.T) {
+	for _, m := range ownedModels() {
+		t.Run(m.name, func(t *testing.T) {
+			db := newTestDB(t)
+			alice := User{Name: "alice", Email: "alice@example.com", Password: "x"}
+			bob := User{Name: "bob", Email: "bob@example.com", Password: "x"}
+			category := Category{Name: "x"}
+			for _, v := range []interface{}{&alice, &bob, &category} {
+				if err := db.Create(v).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			own := m.newRow(alice.ID, category.ID)
+			foreign := m.newRow(bob.ID, category.ID)
+			for _, v := range []interface{}{own, foreign} {
+				if err := db.Create(v).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			ownID := idOf(own)
+			foreignID := idOf(foreign)
+			scoped := func() *gorm.DB { return db.Scopes(OwnedBy(alice.ID)) }
+
+			list := m.newSlice()
+			if err := scoped().Find(list).Error; err != nil {
+				t.Fatal(err)
+			}
+			if n := m.count(list); n != 1 {
+				t.Errorf("Find returned %d rows, want 1", n)
+			}
+
+			if err := scoped().First(m.newDest(), "id = ?", ownID).Error; err != nil {
+				t.Errorf("First own row: %v", err)
+			}
+			if err := scoped().First(m.newDest(), "id = ?", foreignID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("First foreign row: expected ErrRecordNotFound, got %v", err)
+			}
+
+			res := scoped().Model(m.newDest()).Where("id = ?", foreignID).Update("updated_at", time.Now())
+			if res.Error != nil || res.RowsAffected != 0 {
+				t.Errorf("Update foreign row: affected %d, err %v", res.RowsAffected, res.Error)
+			}
+			res = scoped().Delete(m.newDest(), "id = ?", foreignID)
+			if res.Error != nil || res.RowsAffected != 0 {
+				t.Errorf("Delete foreign row: affected %d, err %v", res.RowsAffected, res.Error)
+			}
+			if err := db.First(m.newDest(), "id = ?", foreignID).Error; err != nil {
+				t.Errorf("foreign row should survive: %v", err)
+			}
+
+			// 未認証 (uuid.Nil) では何も見えない
+			list = m.newSlice()
+			if err := db.Scopes(OwnedBy(uuid.Nil)).Find(list).Error; err != nil {
+				t.Fatal(err)
+			}
+			if n := m.count(list); n != 0 {
+				t.Errorf("Find with nil user returned %d rows, want 0", n)
+			}
+		})
+	}
+}
+
+// idOf は BaseModel を埋め込んだ行のIDを返す
+func idOf(row interface{}) uuid.UUID {
+	return reflect.ValueOf(row).Elem().FieldByName("ID").Interface().(uuid.UUID)
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScrapedItem スクレイピングで取得した商品 (ユーザーごとに URL で1件)
+// 同じ URL を再取得した場合は最新の内容で上書きする
+type ScrapedItem struct {
+	BaseModel
+	Name        string `json:"name" gorm:"not null"`
+	URL         string `json:"url" gorm:"not null;uniqueIndex:idx_scraped_items_user_url,priority:2"`
+	ImageURL    string `json:"image_url"`
+	Description string `json:"description"`
+	// RawPrice はページ上の価格表記 ("¥1,280（税込）" など)
+	RawPrice string `json:"raw_price"`
+	// Price は RawPrice を解釈した金額 (通貨の最小単位)。解釈できなければ null
+	Price    *int64 `json:"price"`
+	Currency string `json:"currency"`
+	// TaxIncluded は税込なら true、税抜なら false。表記が無ければ null
+	TaxIncluded *bool `json:"tax_included"`
+	// Availability は schema.org の在庫状況 ("InStock" など)、GTIN は JAN コードなど
+	// どちらもページの構造化データにある場合のみ
+	Availability string `json:"availability"`
+	GTIN         string `json:"gtin"`
+	// SourceURL はスクレイピングしたページの URL
+	SourceURL string    `json:"source_url" gorm:"not null"`
+	ScrapedAt time.Time `json:"scraped_at" gorm:"not null"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index;uniqueIndex:idx_scraped_items_user_url,priority:1"`
+	User   User      `json:"user" gorm:"foreignKey:UserID"`
+}
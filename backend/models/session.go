@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session ログインセッション
+// リフレッシュトークンはハッシュのみ保存し、RevokedAt が入ったら無効
+type Session struct {
+	BaseModel
+	RefreshTokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt        time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	UserAgent        string     `json:"user_agent"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User   User      `json:"-" gorm:"foreignKey:UserID"`
+}
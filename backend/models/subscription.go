@@ -2,14 +2,27 @@ package models
 
 import (
 	"time"
+
 	"github.com/google/uuid"
 )
 
+// 請求サイクル
+const (
+	CycleMonthly = "monthly" // 毎月 BillingDay 日 (月末を超える場合は月末)
+	CycleYearly  = "yearly"  // 毎年 NextBillingDate の月の BillingDay 日
+	CycleDays    = "days"    // BillingCycleDays 日ごと
+)
+
 type Subscription struct {
 	BaseModel
-	Name            string    `json:"name" gorm:"not null"`
-	MonthlyFee      uint64    `json:"monthly_fee" gorm:"not null"`
-	BilingCycleDays uint      `json:"biling_cycle_days" gorm:"not null"`
+	Name string `json:"name" gorm:"not null"`
+	// MonthlyFee は1回の請求額 (yearly なら年額、days なら1サイクル分)
+	MonthlyFee       uint64 `json:"monthly_fee" gorm:"not null"`
+	BillingCycle     string `json:"billing_cycle" gorm:"not null;default:monthly"`
+	BillingCycleDays uint   `json:"billing_cycle_days" gorm:"not null"`
+	// BillingDay は monthly / yearly の請求日 (1〜31)
+	// 短い月に丸めた後も元の日付に戻せるよう、NextBillingDate とは別に保持する
+	BillingDay      uint      `json:"billing_day" gorm:"not null;default:0"`
 	NextBillingDate time.Time `json:"next_billing_date" gorm:"not null"`
 	IsActive        bool      `json:"is_active" gorm:"not null"`
 
@@ -17,4 +30,4 @@ type Subscription struct {
 	User       User      `json:"user" gorm:"foreignKey:UserID"`
 	CategoryID uuid.UUID `json:"category_id" gorm:"type:char(36);not null;index"`
 	Category   Category  `json:"category" gorm:"foreignKey:CategoryID"`
-}
\ No newline at end of file
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WatchItem 価格を監視する商品
+// NextCheckAt を過ぎると pricewatch が再取得し、PriceHistory に記録する
+type WatchItem struct {
+	BaseModel
+	Name string `json:"name" gorm:"not null"`
+	URL  string `json:"url" gorm:"not null"`
+	// ItemSelector, NameSelector, PriceSelector は商品ページから価格を取り出すセレクタ
+	ItemSelector  string `json:"item_selector" gorm:"not null"`
+	NameSelector  string `json:"name_selector" gorm:"not null"`
+	PriceSelector string `json:"price_selector" gorm:"not null"`
+	// TargetPrice 以下になったら通知する (null なら通知しない)
+	TargetPrice *int64 `json:"target_price"`
+	// DropPercent 前回の価格から何%を超えて下がったら通知するか (null なら通知しない)
+	DropPercent *float64 `json:"drop_percent"`
+	// IntervalMinutes は再取得の間隔
+	IntervalMinutes uint      `json:"interval_minutes" gorm:"not null"`
+	NextCheckAt     time.Time `json:"next_check_at" gorm:"not null;index"`
+	IsActive        bool      `json:"is_active" gorm:"not null;default:true"`
+
+	// 直近の取得結果
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	LastPrice     *int64     `json:"last_price"`
+	Currency      string     `json:"currency"`
+	// LastError は直近の取得が失敗した場合のエラー (成功すれば空)
+	LastError string `json:"last_error"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User   User      `json:"user" gorm:"foreignKey:UserID"`
+}
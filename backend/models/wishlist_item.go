@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 欲しいものリストの状態 (WishlistItem.Status)
+const (
+	WishlistPlanned = "planned"
+	WishlistBought  = "bought"
+)
+
+// WishlistItem 購入予定の商品 (欲しいものリスト)
+// 価格は WatchItem で追跡し、購入したら Expense に変換する
+// (変換した Expense は WishlistItemID を持ち、レポートで計画的な支出として集計される)
+type WishlistItem struct {
+	BaseModel
+	Name        string `json:"name" gorm:"not null"`
+	URL         string `json:"url" gorm:"not null"`
+	ImageURL    string `json:"image_url"`
+	Description string `json:"description"`
+	// Price は登録時の価格 (通貨の最小単位)。不明なら null
+	Price    *int64 `json:"price"`
+	Currency string `json:"currency"`
+	Note     string `json:"note"`
+	Status   string `json:"status" gorm:"not null;default:planned;index"`
+
+	// CategoryID は購入時の Expense のカテゴリ
+	CategoryID uuid.UUID `json:"category_id" gorm:"type:char(36);not null;index"`
+	Category   Category  `json:"category" gorm:"foreignKey:CategoryID"`
+	// ScrapedItemID は登録元のスクレイピング結果 (あれば)
+	ScrapedItemID *uuid.UUID `json:"scraped_item_id" gorm:"type:char(36)"`
+	// WatchItemID は価格を追跡する WatchItem (追跡しなければ null)
+	WatchItemID *uuid.UUID `json:"watch_item_id" gorm:"type:char(36)"`
+	WatchItem   *WatchItem `json:"watch_item,omitempty" gorm:"foreignKey:WatchItemID"`
+
+	// 購入済みの場合のみ
+	BoughtAt  *time.Time `json:"bought_at"`
+	ExpenseID *uuid.UUID `json:"expense_id" gorm:"type:char(36)"`
+
+	UserID uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	User   User      `json:"user" gorm:"foreignKey:UserID"`
+}
@@ -0,0 +1,62 @@
+// Package netguard はユーザーが指定した URL (Webhook・スクレイピング・価格監視) に
+// サーバーからリクエストする際、内部のアドレスへ接続させないようにする
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress は接続先が内部のアドレス (ループバック・プライベート・リンクローカルなど) であることを表す
+var ErrForbiddenAddress = errors.New("address is not allowed")
+
+// CheckURL は u のホストが明らかに内部のアドレス (localhost や内部の IP アドレス) でないことを確認する
+// スキームは呼び出し側で確認する。ホスト名の名前解決の結果は接続時 (Transport) に確認する
+func CheckURL(u *url.URL) error {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && !PublicIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// Transport は接続先の IP アドレスが内部のアドレスなら接続しない http.Transport を返す
+// 名前解決した後のアドレスを接続時に確認するため、DNS の応答を差し替えられても内部には接続しない (リダイレクト先も同じ)。
+// 確認できなくなるため環境変数のプロキシは使わない
+func Transport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !PublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// sharedAddressSpace はキャリアグレード NAT のアドレス (100.64.0.0/10)
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// PublicIP は ip がインターネット上のアドレスなら true を返す
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
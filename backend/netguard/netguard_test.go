@@ -0,0 +1,53 @@
+package netguard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	for raw, want := range map[string]error{
+		"https://hooks.example.com/x":          nil,
+		"http://93.184.216.34/":                nil,
+		"http://localhost:8080/":               ErrForbiddenAddress,
+		"http://api.localhost./":               ErrForbiddenAddress,
+		"http://127.0.0.1/":                    ErrForbiddenAddress,
+		"http://10.1.2.3/":                     ErrForbiddenAddress,
+		"http://169.254.169.254/latest/":       ErrForbiddenAddress,
+		"http://100.64.0.1/":                   ErrForbiddenAddress,
+		"http://[::1]/":                        ErrForbiddenAddress,
+		"http://[fd00::1]/":                    ErrForbiddenAddress,
+		"http://[::ffff:127.0.0.1]/":           ErrForbiddenAddress,
+		"http://0.0.0.0/":                      ErrForbiddenAddress,
+		"https://shop.example.com/items?id=10": nil,
+	} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckURL(u); !errors.Is(err, want) || (want == nil && err != nil) {
+			t.Errorf("CheckURL(%q) = %v, want %v", raw, err, want)
+		}
+	}
+}
+
+// TestTransportRefusesInternalAddress は接続時に内部のアドレスを断ることのテスト
+// (ホスト名の名前解決の結果やリダイレクト先も同じ経路で確認される)
+func TestTransportRefusesInternalAddress(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: Transport()}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("err = %v, want ErrForbiddenAddress", err)
+	}
+	if hits != 0 {
+		t.Errorf("server was contacted %d times", hits)
+	}
+}
@@ -0,0 +1,319 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kakeibo-backend/models"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMessage = Message{
+	Subject: "【家計簿】5月の請求予定",
+	Body:    "Netflix 1,490円 (5/3)\n電気 5,510円 (5/6)",
+	Items:   []Item{{Kind: KindSubscription, Name: "Netflix", Amount: 1490}},
+}
+
+// fakeSMTP は1通だけ受け取るSMTPサーバー
+type fakeSMTP struct {
+	addr string
+	done chan struct{}
+	// 受信内容 (done が閉じた後に読む)
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{addr: ln.Addr().String(), done: make(chan struct{})}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		defer close(s.done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(conn)
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost fake smtp")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = line
+			reply("235 ok")
+		case "MAIL":
+			s.from = line
+			reply("250 ok")
+		case "RCPT":
+			s.to = append(s.to, line)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			s.data = b.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	server := startFakeSMTP(t)
+	n := SMTPNotifier{
+		Addr:     server.addr,
+		From:     "kakeibo <noreply@example.com>",
+		Username: "user",
+		Password: "secret",
+	}
+	user := models.User{Name: "太郎", Email: "taro@example.com"}
+	if err := n.Notify(context.Background(), user, testMessage); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-server.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("smtp server did not finish")
+	}
+
+	if !strings.HasPrefix(server.auth, "AUTH PLAIN") {
+		t.Errorf("auth = %q, want AUTH PLAIN", server.auth)
+	}
+	if server.from != "MAIL FROM:<noreply@example.com>" {
+		t.Errorf("from = %q", server.from)
+	}
+	if len(server.to) != 1 || server.to[0] != "RCPT TO:<taro@example.com>" {
+		t.Errorf("to = %v", server.to)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(server.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != testMessage.Subject {
+		t.Errorf("subject = %q (%v), want %q", subject, err, testMessage.Subject)
+	}
+	raw, _ := io.ReadAll(parsed.Body)
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+	if err != nil || string(body) != testMessage.Body {
+		t.Errorf("body = %q (%v), want %q", body, err, testMessage.Body)
+	}
+}
+
+func TestWebhookNotifierPayloads(t *testing.T) {
+	cases := []struct {
+		format string
+		check  func(t *testing.T, payload map[string]interface{})
+	}{
+		{models.WebhookSlack, func(t *testing.T, p map[string]interface{}) {
+			if !strings.HasPrefix(p["text"].(string), testMessage.Subject) {
+				t.Errorf("slack payload = %v", p)
+			}
+		}},
+		{models.WebhookDiscord, func(t *testing.T, p map[string]interface{}) {
+			if !strings.HasPrefix(p["content"].(string), testMessage.Subject) {
+				t.Errorf("discord payload = %v", p)
+			}
+		}},
+		{models.WebhookLINE, func(t *testing.T, p map[string]interface{}) {
+			messages, _ := p["messages"].([]interface{})
+			if len(messages) != 1 || messages[0].(map[string]interface{})["type"] != "text" {
+				t.Errorf("line payload = %v", p)
+			}
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.format, func(t *testing.T) {
+			var got map[string]interface{}
+			var authorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				if r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("content-type = %q", r.Header.Get("Content-Type"))
+				}
+				json.NewDecoder(r.Body).Decode(&got)
+			}))
+			defer server.Close()
+
+			n := WebhookNotifier{URL: server.URL, Format: tc.format, Token: "tok", Client: server.Client()}
+			if err := n.Notify(context.Background(), models.User{}, testMessage); err != nil {
+				t.Fatal(err)
+			}
+			if authorization != "Bearer tok" {
+				t.Errorf("authorization = %q", authorization)
+			}
+			tc.check(t, got)
+		})
+	}
+}
+
+func TestWebhookNotifierErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	n := WebhookNotifier{URL: server.URL, Format: models.WebhookSlack, Client: server.Client()}
+	err := n.Notify(context.Background(), models.User{}, testMessage)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("err = %v, want status 403", err)
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	for _, u := range []string{"https://hooks.slack.com/services/x", "https://discord.com/api/webhooks/1/x", "https://8.8.8.8/x"} {
+		if err := CheckWebhookURL(u); err != nil {
+			t.Errorf("CheckWebhookURL(%q) = %v", u, err)
+		}
+	}
+	forbidden := []string{
+		"https://localhost/x", "https://api.localhost/x", "https://127.0.0.1/x", "https://10.0.0.5/x", "https://192.168.1.1/x",
+		"https://169.254.169.254/latest", "https://[::1]/x", "https://[fe80::1]/x", "https://0.0.0.0/x", "https://100.64.0.1/x",
+	}
+	for _, u := range forbidden {
+		if err := CheckWebhookURL(u); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("CheckWebhookURL(%q) = %v, want ErrForbiddenAddress", u, err)
+		}
+	}
+	if err := CheckWebhookURL("http://hooks.slack.com/x"); err == nil {
+		t.Error("http URL should be rejected")
+	}
+}
+
+// TestWebhookNotifierRejectsInternalAddress は既定のクライアントが内部のアドレスへ接続しないことのテスト
+// (ホスト名で指定して名前解決の結果が内部のアドレスになる場合も、接続時に断る)
+func TestWebhookNotifierRejectsInternalAddress(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	for _, u := range []string{server.URL, fmt.Sprintf("http://localhost:%d/hook", port)} {
+		n := WebhookNotifier{URL: u, Format: models.WebhookSlack}
+		if err := n.Notify(context.Background(), models.User{}, testMessage); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("%s: err = %v, want ErrForbiddenAddress", u, err)
+		}
+	}
+	if called {
+		t.Error("request reached the internal server")
+	}
+}
+
+// TestRouter は通知設定の Channel で送信先が変わることのテスト
+func TestRouter(t *testing.T) {
+	db := newTestDB(t)
+	var hooked int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hooked++
+	}))
+	defer server.Close()
+
+	email := &recordingNotifier{}
+	router := Router{DB: db, Email: email, Client: server.Client()}
+
+	users := map[string]models.User{}
+	for _, channel := range []string{models.ChannelInbox, models.ChannelEmail, models.ChannelWebhook, ""} {
+		user := models.User{Name: channel, Email: channel + "@example.com", Password: "x"}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		users[channel] = user
+		if channel == "" {
+			continue // 通知設定なし
+		}
+		setting := models.NotificationSetting{
+			RemindDayOfMonth: 1, Channel: channel, UserID: user.ID,
+			WebhookURL: server.URL, WebhookFormat: models.WebhookDiscord,
+		}
+		if err := db.Create(&setting).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, user := range users {
+		if err := router.Notify(context.Background(), user, testMessage); err != nil {
+			t.Fatalf("notify %s: %v", user.Name, err)
+		}
+	}
+	if len(email.to) != 1 || email.to[0] != users[models.ChannelEmail].ID {
+		t.Errorf("email sent to %v", email.to)
+	}
+	if hooked != 1 {
+		t.Errorf("webhook called %d times, want 1", hooked)
+	}
+	var inbox []models.Notification
+	if err := db.Order("user_id").Find(&inbox).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox) != 2 {
+		t.Fatalf("inbox has %d notifications, want 2 (inbox channel and no setting)", len(inbox))
+	}
+	for _, n := range inbox {
+		if n.UserID != users[models.ChannelInbox].ID && n.UserID != users[""].ID {
+			t.Errorf("unexpected inbox notification for %s", n.UserID)
+		}
+		if n.Subject != testMessage.Subject || n.ReadAt != nil {
+			t.Errorf("inbox notification = %+v", n)
+		}
+	}
+
+	// SMTP 未構成ならメール希望者も受信箱へ
+	router.Email = nil
+	if err := router.Notify(context.Background(), users[models.ChannelEmail], testMessage); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.Notification{}).Where("user_id = ?", users[models.ChannelEmail].ID).Count(&count)
+	if count != 1 {
+		t.Errorf("email user inbox count = %d, want 1", count)
+	}
+}
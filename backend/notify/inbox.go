@@ -0,0 +1,29 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"kakeibo-backend/models"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// InboxNotifier は通知をアプリ内の受信箱 (models.Notification) に保存する
+type InboxNotifier struct {
+	DB *gorm.DB
+}
+
+func (n InboxNotifier) Notify(ctx context.Context, user models.User, msg Message) error {
+	items, err := json.Marshal(msg.Items)
+	if err != nil {
+		return err
+	}
+	notification := models.Notification{
+		Subject: msg.Subject,
+		Body:    msg.Body,
+		Items:   datatypes.JSON(items),
+		UserID:  user.ID,
+	}
+	return n.DB.WithContext(ctx).Omit("User").Create(&notification).Error
+}
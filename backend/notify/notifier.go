@@ -0,0 +1,43 @@
+// Package notify はリマインドの組み立て・送信を行う
+package notify
+
+import (
+	"context"
+	"kakeibo-backend/models"
+	"log"
+	"time"
+)
+
+// 明細の種類
+const (
+	KindSubscription = "subscription"
+	KindPublicFee    = "public_fee"
+)
+
+// Item はリマインドに載せる1件の請求予定
+type Item struct {
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name"`
+	Amount  uint64    `json:"amount"`
+	DueDate time.Time `json:"due_date"`
+}
+
+// Message は送信する通知
+type Message struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Items   []Item `json:"items"`
+}
+
+// Notifier は通知の送信手段
+type Notifier interface {
+	Notify(ctx context.Context, user models.User, msg Message) error
+}
+
+// LogNotifier は通知をログに出力するだけの Notifier (開発用)
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, user models.User, msg Message) error {
+	log.Printf("notify %s <%s>: %s\n%s", user.Name, user.Email, msg.Subject, msg.Body)
+	return nil
+}
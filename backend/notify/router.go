@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"kakeibo-backend/models"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Router はユーザーの NotificationSetting.Channel に応じて送信先を選ぶ Notifier
+//
+// 通知設定が無い、または Channel が email で Email が未設定 (SMTP 未構成) の場合は受信箱に送る。
+type Router struct {
+	DB *gorm.DB
+	// Email は email チャネルの送信手段。nil なら受信箱に送る
+	Email Notifier
+	// Client は Webhook の送信に使う。nil なら既定のクライアント
+	Client *http.Client
+}
+
+func (r Router) Notify(ctx context.Context, user models.User, msg Message) error {
+	var setting models.NotificationSetting
+	err := r.DB.WithContext(ctx).First(&setting, "user_id = ?", user.ID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	notifier, err := r.notifierFor(setting)
+	if err != nil {
+		return err
+	}
+	return notifier.Notify(ctx, user, msg)
+}
+
+func (r Router) notifierFor(setting models.NotificationSetting) (Notifier, error) {
+	switch setting.Channel {
+	case models.ChannelEmail:
+		if r.Email != nil {
+			return r.Email, nil
+		}
+	case models.ChannelWebhook:
+		if setting.WebhookURL == "" {
+			return nil, errors.New("webhook url is not set")
+		}
+		return WebhookNotifier{
+			URL:    setting.WebhookURL,
+			Format: setting.WebhookFormat,
+			Token:  setting.WebhookToken,
+			Client: r.Client,
+		}, nil
+	}
+	return InboxNotifier{DB: r.DB}, nil
+}
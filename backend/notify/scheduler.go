@@ -0,0 +1,230 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kakeibo-backend/models"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Scheduler は NotificationSetting.RemindDayOfMonth の日に請求予定をリマインドする
+// その日に実行できなかった場合は、同じ月のうちに次に実行した時に送る
+//
+// 送信前に NotificationLog を (user_id, remind_month) の一意制約付きで作成して送信権を確保するため、
+// 1日に何度実行しても、複数プロセスで実行しても、同じ月に二度送らない。
+// 送信に失敗した場合は記録を消し、次回の実行で再送する。
+type Scheduler struct {
+	DB       *gorm.DB
+	Notifier Notifier
+	Now      func() time.Time
+}
+
+// RunResult は1回の実行結果
+type RunResult struct {
+	Sent   int
+	Failed int
+}
+
+// RemindDay は day 日のリマインドが year 年 month 月の何日になるかを返す
+// その月に存在しない日 (2月30日など) は月末に丸める
+func RemindDay(year int, month time.Month, day int) int {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > last {
+		return last
+	}
+	if day < 1 {
+		return 1
+	}
+	return day
+}
+
+// Run は今月のリマインド日を過ぎていて、今月まだ送っていないユーザーへ通知を送る
+// (リマインド日にプロセスが止まっていても、次の実行で送る)
+func (s *Scheduler) Run(ctx context.Context) (RunResult, error) {
+	now := s.now()
+	today := now.Day()
+	lastDay := RemindDay(now.Year(), now.Month(), 31)
+	month := startOfMonth(now)
+
+	query := s.DB.Preload("User").Where("enable_subscription = ? OR enable_public_fee = ?", true, true)
+	// 月末は、その月に存在しない日を指定しているユーザーも含めて全員のリマインド日を過ぎている
+	if today < lastDay {
+		query = query.Where("remind_day_of_month <= ?", today)
+	}
+	sent := s.DB.Unscoped().Model(&models.NotificationLog{}).Select("user_id").Where("remind_month = ?", month)
+	query = query.Where("user_id NOT IN (?)", sent)
+	var settings []models.NotificationSetting
+	if err := query.Find(&settings).Error; err != nil {
+		return RunResult{}, err
+	}
+
+	var result RunResult
+	for _, setting := range settings {
+		sent, err := s.remind(ctx, setting, now)
+		if err != nil {
+			log.Printf("notify: remind user %s: %v", setting.UserID, err)
+			result.Failed++
+			continue
+		}
+		if sent {
+			result.Sent++
+		}
+	}
+	return result, nil
+}
+
+// Start は interval ごとに Run を実行する。ctx がキャンセルされるまで戻らない
+// 同じ月には一度しか送らないため、interval は1日より短くてよい (停止明けの取りこぼし防止)
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if res, err := s.Run(ctx); err != nil {
+			log.Printf("notify: %v", err)
+		} else if res.Sent > 0 || res.Failed > 0 {
+			log.Printf("notify: sent %d reminders (%d failed)", res.Sent, res.Failed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// remind は1ユーザー分のリマインドを送る。送る必要がなければ false を返す
+func (s *Scheduler) remind(ctx context.Context, setting models.NotificationSetting, now time.Time) (bool, error) {
+	msg, err := s.BuildMessage(setting, now)
+	if err != nil {
+		return false, err
+	}
+	if len(msg.Items) == 0 {
+		return false, nil
+	}
+
+	entry := models.NotificationLog{
+		SubscriptionRemind: setting.EnableSubscription && hasKind(msg.Items, KindSubscription),
+		PublicFeeRemind:    setting.EnablePublicFee && hasKind(msg.Items, KindPublicFee),
+		SentAt:             now,
+		RemindMonth:        startOfMonth(now),
+		UserID:             setting.UserID,
+	}
+	res := s.DB.Omit("User").Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		// 今月は送信済み (または他のプロセスが送信中)
+		return false, nil
+	}
+
+	if err := s.Notifier.Notify(ctx, setting.User, msg); err != nil {
+		// 次回の実行で再送できるよう記録を消す
+		if delErr := s.DB.Unscoped().Delete(&entry).Error; delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// BuildMessage は now の日から1か月以内の請求予定をまとめたリマインドを作る
+// 期間の多くは翌月にかかるため、件名には月ではなく期間の日付を入れる
+func (s *Scheduler) BuildMessage(setting models.NotificationSetting, now time.Time) (Message, error) {
+	from := startOfDay(now)
+	until := from.AddDate(0, 1, 0)
+	var items []Item
+
+	if setting.EnableSubscription {
+		var subs []models.Subscription
+		if err := s.DB.
+			Where("user_id = ? AND is_active = ? AND next_billing_date >= ? AND next_billing_date < ?",
+				setting.UserID, true, from, until).
+			Order("next_billing_date ASC").
+			Find(&subs).Error; err != nil {
+			return Message{}, err
+		}
+		for _, sub := range subs {
+			items = append(items, Item{Kind: KindSubscription, Name: sub.Name, Amount: sub.MonthlyFee, DueDate: sub.NextBillingDate})
+		}
+	}
+
+	if setting.EnablePublicFee {
+		var fees []models.PublicFee
+		if err := s.DB.
+			Where("user_id = ? AND next_billing_date >= ? AND next_billing_date < ?",
+				setting.UserID, from, until).
+			Order("next_billing_date ASC").
+			Find(&fees).Error; err != nil {
+			return Message{}, err
+		}
+		for _, fee := range fees {
+			items = append(items, Item{Kind: KindPublicFee, Name: fee.FeeType, Amount: fee.Amount, DueDate: fee.NextBillingDate})
+		}
+	}
+
+	return Message{
+		Subject: fmt.Sprintf("【家計簿】%s〜%sの請求予定 (%d件)", from.Format("1/2"), until.AddDate(0, 0, -1).Format("1/2"), len(items)),
+		Body:    formatBody(items),
+		Items:   items,
+	}, nil
+}
+
+func formatBody(items []Item) string {
+	var b strings.Builder
+	var total uint64
+	b.WriteString("今後1か月の請求予定です。\n\n")
+	for _, item := range items {
+		label := "サブスク"
+		if item.Kind == KindPublicFee {
+			label = "公共料金"
+		}
+		fmt.Fprintf(&b, "%s  [%s] %s  %s円\n", item.DueDate.Format("01/02"), label, item.Name, FormatYen(item.Amount))
+		total += item.Amount
+	}
+	fmt.Fprintf(&b, "\n合計 %s円\n", FormatYen(total))
+	return b.String()
+}
+
+// FormatYen は3桁区切りの金額文字列を返す ("1,280" など)
+func FormatYen(n uint64) string {
+	s := fmt.Sprintf("%d", n)
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func hasKind(items []Item, kind string) bool {
+	for _, item := range items {
+		if item.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"kakeibo-backend/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type recordingNotifier struct {
+	sent []Message
+	to   []uuid.UUID
+	err  error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, user models.User, msg Message) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, msg)
+	n.to = append(n.to, user.ID)
+	return nil
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(
+		&models.User{}, &models.Category{}, &models.Subscription{}, &models.PublicFee{},
+		&models.NotificationSetting{}, &models.NotificationLog{}, &models.Notification{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newUser は remindDay 日にリマインドするユーザーと、請求予定を1件ずつ作る
+func newUser(t *testing.T, db *gorm.DB, email string, remindDay int, due time.Time) models.User {
+	t.Helper()
+	user := models.User{Name: email, Email: email, Password: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	rows := []interface{}{
+		&models.NotificationSetting{EnableSubscription: true, EnablePublicFee: true, RemindDayOfMonth: remindDay, UserID: user.ID},
+		&models.Subscription{Name: "Netflix", MonthlyFee: 1490, BillingCycle: models.CycleMonthly, NextBillingDate: due, IsActive: true, UserID: user.ID, CategoryID: uuid.New()},
+		&models.PublicFee{FeeType: "電気", Amount: 5510, UsageMonth: 1, NextBillingDate: due.AddDate(0, 0, 3), UserID: user.ID, CategoryID: uuid.New()},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return user
+}
+
+func TestRemindDay(t *testing.T) {
+	if d := RemindDay(2026, time.February, 31); d != 28 {
+		t.Errorf("Feb 31 -> %d, want 28", d)
+	}
+	if d := RemindDay(2028, time.February, 30); d != 29 {
+		t.Errorf("leap Feb 30 -> %d, want 29", d)
+	}
+	if d := RemindDay(2026, time.April, 15); d != 15 {
+		t.Errorf("Apr 15 -> %d, want 15", d)
+	}
+}
+
+// TestRunClampsToMonthEnd は短い月の月末に29〜31日指定のユーザーへ送ることのテスト
+func TestRunClampsToMonthEnd(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Date(2026, 2, 28, 9, 0, 0, 0, time.Local)
+	onEnd := newUser(t, db, "end@example.com", 31, now.AddDate(0, 0, 5))
+	mid := newUser(t, db, "mid@example.com", 15, now.AddDate(0, 0, 5))
+	// 15日指定のユーザーには今月の15日に送信済み
+	sentOn15 := models.NotificationLog{SubscriptionRemind: true, SentAt: time.Date(2026, 2, 15, 9, 0, 0, 0, time.Local),
+		RemindMonth: time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local), UserID: mid.ID}
+	if err := db.Omit("User").Create(&sentOn15).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	n := &recordingNotifier{}
+	s := &Scheduler{DB: db, Notifier: n, Now: func() time.Time { return now }}
+	res, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Sent != 1 || len(n.to) != 1 || n.to[0] != onEnd.ID {
+		t.Fatalf("sent to %v, want only %s", n.to, onEnd.ID)
+	}
+	if len(n.sent[0].Items) != 2 {
+		t.Errorf("items = %+v, want subscription and public fee", n.sent[0].Items)
+	}
+
+	var entry models.NotificationLog
+	if err := db.First(&entry, "user_id = ?", onEnd.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !entry.SubscriptionRemind || !entry.PublicFeeRemind {
+		t.Errorf("log should record both reminders: %+v", entry)
+	}
+}
+
+// TestRunOncePerMonth は同じ日に何度実行しても1回しか送らないことのテスト
+func TestRunOncePerMonth(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Date(2026, 4, 10, 9, 0, 0, 0, time.Local)
+	newUser(t, db, "taro@example.com", 10, now.AddDate(0, 0, 1))
+
+	n := &recordingNotifier{}
+	s := &Scheduler{DB: db, Notifier: n, Now: func() time.Time { return now }}
+	for i := 0; i < 3; i++ {
+		if _, err := s.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Hour)
+	}
+	if len(n.sent) != 1 {
+		t.Errorf("sent %d reminders, want 1", len(n.sent))
+	}
+}
+
+// TestRunCatchesUpMissedDay はリマインド日に実行できなかった月も、その月のうちに送ることのテスト
+func TestRunCatchesUpMissedDay(t *testing.T) {
+	db := newTestDB(t)
+	// 10日指定だが、プロセスが止まっていて12日に初めて実行された
+	now := time.Date(2026, 4, 12, 9, 0, 0, 0, time.Local)
+	late := newUser(t, db, "late@example.com", 10, now.AddDate(0, 0, 1))
+	newUser(t, db, "future@example.com", 20, now.AddDate(0, 0, 1))
+
+	n := &recordingNotifier{}
+	s := &Scheduler{DB: db, Notifier: n, Now: func() time.Time { return now }}
+	if _, err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.to) != 1 || n.to[0] != late.ID {
+		t.Fatalf("sent to %v, want only %s", n.to, late.ID)
+	}
+
+	// 同じ月にはもう送らず、翌月はリマインド日まで送らない
+	for _, day := range []time.Time{now.AddDate(0, 0, 1), time.Date(2026, 5, 9, 9, 0, 0, 0, time.Local)} {
+		now = day
+		if _, err := s.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(n.to) != 1 {
+		t.Errorf("sent %d reminders, want 1", len(n.to))
+	}
+	now = time.Date(2026, 5, 10, 9, 0, 0, 0, time.Local)
+	db.Model(&models.Subscription{}).Where("user_id = ?", late.ID).Update("next_billing_date", now.AddDate(0, 0, 1))
+	if _, err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.to) != 2 || n.to[1] != late.ID {
+		t.Errorf("May reminder: sent to %v", n.to)
+	}
+}
+
+// TestRunRetriesAfterFailure は送信失敗時に記録を残さず、次回再送することのテスト
+func TestRunRetriesAfterFailure(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Date(2026, 4, 10, 9, 0, 0, 0, time.Local)
+	newUser(t, db, "taro@example.com", 10, now.AddDate(0, 0, 1))
+
+	n := &recordingNotifier{err: errors.New("smtp down")}
+	s := &Scheduler{DB: db, Notifier: n, Now: func() time.Time { return now }}
+	res, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Failed != 1 {
+		t.Errorf("failed = %d, want 1", res.Failed)
+	}
+	var count int64
+	db.Unscoped().Model(&models.NotificationLog{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("failed reminder should not be logged")
+	}
+
+	n.err = nil
+	if _, err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.sent) != 1 {
+		t.Errorf("retry sent %d reminders, want 1", len(n.sent))
+	}
+}
+
+// TestBuildMessageHonorsSettings は無効にした種類の請求予定を含めないことのテスト
+func TestBuildMessageHonorsSettings(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Date(2026, 4, 10, 9, 0, 0, 0, time.Local)
+	user := newUser(t, db, "taro@example.com", 10, now.AddDate(0, 0, 1))
+
+	s := &Scheduler{DB: db}
+	msg, err := s.BuildMessage(models.NotificationSetting{EnablePublicFee: true, UserID: user.ID}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Items) != 1 || msg.Items[0].Kind != KindPublicFee {
+		t.Errorf("items = %+v, want only the public fee", msg.Items)
+	}
+	// 件名は月ではなく期間 (4/10〜5/9) を表す
+	if want := "【家計簿】4/10〜5/9の請求予定 (1件)"; msg.Subject != want {
+		t.Errorf("subject = %q, want %q", msg.Subject, want)
+	}
+	if FormatYen(1234567) != "1,234,567" {
+		t.Errorf("FormatYen = %s", FormatYen(1234567))
+	}
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"kakeibo-backend/models"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPNotifier は通知をメールで User.Email に送る
+type SMTPNotifier struct {
+	// Addr は SMTP サーバーの host:port
+	Addr string
+	// From は差出人アドレス
+	From string
+	// Username が空でなければ PLAIN 認証する (平文の接続では localhost のみ)
+	Username string
+	Password string
+	Now      func() time.Time
+}
+
+func (n SMTPNotifier) Notify(ctx context.Context, user models.User, msg Message) error {
+	if user.Email == "" {
+		return errors.New("user has no email address")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, err := net.SplitHostPort(n.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+	from, err := mail.ParseAddress(n.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	raw := n.buildMail(*from, user, msg)
+	// エンベロープには表示名を除いたアドレスを使う
+	if err := smtp.SendMail(n.Addr, auth, from.Address, []string{user.Email}, raw); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// buildMail は件名を MIME エンコード、本文を base64 にした UTF-8 のメールを組み立てる
+func (n SMTPNotifier) buildMail(from mail.Address, user models.User, msg Message) []byte {
+	to := mail.Address{Name: user.Name, Address: user.Email}
+	now := time.Now
+	if n.Now != nil {
+		now = n.Now
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", to.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		b.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	b.WriteString(body + "\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kakeibo-backend/models"
+	"kakeibo-backend/netguard"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WebhookNotifier は通知を HTTP の Webhook に JSON で POST する
+//
+// Format ごとのペイロード:
+//   - slack:   {"text": "..."}                                  (Incoming Webhook)
+//   - discord: {"content": "..."}                               (Webhook)
+//   - line:    {"messages": [{"type": "text", "text": "..."}]}  (Messaging API の broadcast など。Token が必要)
+type WebhookNotifier struct {
+	URL    string
+	Format string
+	// Token が空でなければ Authorization: Bearer で送る
+	Token string
+	// Client が nil なら WebhookClient を使う (内部のアドレスには送らない)
+	Client *http.Client
+}
+
+// ErrForbiddenAddress は Webhook の送信先が内部のアドレス (ループバック・プライベート・リンクローカルなど) であることを表す
+// URL はユーザーが指定するため、サーバーから内部のホストへリクエストを送らせないようにする
+var ErrForbiddenAddress = netguard.ErrForbiddenAddress
+
+// CheckWebhookURL は Webhook の URL が https で、ホストが明らかに内部のアドレスでないことを確認する
+// ホスト名の名前解決の結果は送信時 (WebhookClient) に確認する
+func CheckWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return errors.New("webhook_url must be an https URL")
+	}
+	return netguard.CheckURL(u)
+}
+
+// WebhookClient は接続先の IP アドレスが内部のアドレスなら接続しない http.Client を返す (netguard.Transport)
+func WebhookClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: netguard.Transport()}
+}
+
+// discord の content は2000文字まで
+const discordContentLimit = 2000
+
+// Payload は Format に合わせたリクエストボディを返す
+func (n WebhookNotifier) Payload(msg Message) ([]byte, error) {
+	text := msg.Subject + "\n" + msg.Body
+	var payload interface{}
+	switch n.Format {
+	case models.WebhookSlack:
+		payload = map[string]string{"text": text}
+	case models.WebhookDiscord:
+		if r := []rune(text); len(r) > discordContentLimit {
+			text = string(r[:discordContentLimit])
+		}
+		payload = map[string]string{"content": text}
+	case models.WebhookLINE:
+		payload = map[string]interface{}{
+			"messages": []map[string]string{{"type": "text", "text": text}},
+		}
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q", n.Format)
+	}
+	return json.Marshal(payload)
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, user models.User, msg Message) error {
+	body, err := n.Payload(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+
+	client := n.Client
+	if client == nil {
+		client = WebhookClient(10 * time.Second)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("webhook: status %d: %s", res.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
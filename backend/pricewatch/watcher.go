@@ -0,0 +1,270 @@
+// Package pricewatch は監視中の商品 (models.WatchItem) の価格を定期的に取得し、値下がりを通知する
+package pricewatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kakeibo-backend/models"
+	"kakeibo-backend/notify"
+	"kakeibo-backend/scraper"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 1回の実行で取得する商品数の上限 (残りは次回の実行で取得する)
+const maxChecksPerRun = 50
+
+// 商品ページ1件の取得の制限時間
+const fetchTimeout = 30 * time.Second
+
+// ErrProductNotFound はページから商品が見つからなかったことを表す
+var ErrProductNotFound = errors.New("product not found on page")
+
+// Fetcher は商品ページを取得して商品情報を返す
+type Fetcher interface {
+	Fetch(ctx context.Context, item models.WatchItem) (scraper.Product, error)
+}
+
+// ScraperFetcher は scraper.ProductScraper で商品ページを取得する Fetcher
+type ScraperFetcher struct {
+	// Config が nil なら scraper.DefaultConfig を使う
+	Config *scraper.ScraperConfig
+}
+
+func (f ScraperFetcher) Fetch(ctx context.Context, item models.WatchItem) (scraper.Product, error) {
+	config := *scraper.DefaultConfig()
+	if f.Config != nil {
+		config = *f.Config
+	}
+	// 価格の変化を見るためキャッシュは使わない
+	config.CacheDir = ""
+	ps := scraper.NewProductScraper(&config)
+	sel := scraper.Selectors{Item: item.ItemSelector, Name: item.NameSelector, Price: item.PriceSelector}
+	products, err := ps.Scrape(ctx, item.URL, sel, scraper.Limits{MaxPages: 1, MaxItems: 1, Timeout: fetchTimeout})
+	var stop *scraper.StopError
+	// 商品ページに複数の商品が見つかった場合は最初の1件を使う
+	if err != nil && !(errors.As(err, &stop) && stop.Reason == scraper.StopMaxItems) {
+		return scraper.Product{}, err
+	}
+	if len(products) == 0 {
+		return scraper.Product{}, ErrProductNotFound
+	}
+	return products[0], nil
+}
+
+// RunResult は1回の実行結果
+type RunResult struct {
+	Checked int // 価格を取得できた商品数
+	Alerts  int // 通知した数
+	Failed  int // 取得または通知に失敗した数
+}
+
+// Watcher は NextCheckAt を過ぎた商品の価格を取得して PriceHistory に記録し、
+// 目標価格を下回った・前回から DropPercent を超えて下がった場合に通知する
+//
+// 取得前に NextCheckAt を読み込み時の値を条件に進めるため、
+// 複数プロセスで実行しても同じ商品を同時に取得しない。
+type Watcher struct {
+	DB       *gorm.DB
+	Fetcher  Fetcher
+	Notifier notify.Notifier
+	Now      func() time.Time
+}
+
+// Run は取得時刻を過ぎた有効な商品を取得する
+func (w *Watcher) Run(ctx context.Context) (RunResult, error) {
+	now := w.now()
+	var due []models.WatchItem
+	if err := w.DB.Preload("User").
+		Where("is_active = ? AND next_check_at <= ?", true, now).
+		Order("next_check_at ASC").
+		Limit(maxChecksPerRun).
+		Find(&due).Error; err != nil {
+		return RunResult{}, err
+	}
+
+	var result RunResult
+	for _, item := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		claimed, err := w.claim(item, now)
+		if err != nil {
+			return result, err
+		}
+		if !claimed {
+			continue
+		}
+		alerted, err := w.check(ctx, item, now)
+		if err != nil {
+			log.Printf("pricewatch: check %s: %v", item.ID, err)
+			result.Failed++
+			continue
+		}
+		result.Checked++
+		if alerted {
+			result.Alerts++
+		}
+	}
+	return result, nil
+}
+
+// Start は interval ごとに Run を実行する。ctx がキャンセルされるまで戻らない
+// 各商品の取得間隔は WatchItem.IntervalMinutes で決まるため、interval はそれより短くてよい
+func (w *Watcher) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if res, err := w.Run(ctx); err != nil {
+			log.Printf("pricewatch: %v", err)
+		} else if res.Checked > 0 || res.Failed > 0 {
+			log.Printf("pricewatch: checked %d items, %d alerts (%d failed)", res.Checked, res.Alerts, res.Failed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim は次回の取得時刻を進める。他の実行が先に進めていれば false を返す
+func (w *Watcher) claim(item models.WatchItem, now time.Time) (bool, error) {
+	next := now.Add(time.Duration(item.IntervalMinutes) * time.Minute)
+	res := w.DB.Model(&models.WatchItem{}).
+		Where("id = ? AND next_check_at = ?", item.ID, item.NextCheckAt).
+		Update("next_check_at", next)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// check は1件の商品の価格を取得して記録し、通知した場合は true を返す
+//
+// 通知に失敗した場合は LastPrice を更新しないため、次回の取得で改めて判定・通知する。
+func (w *Watcher) check(ctx context.Context, item models.WatchItem, now time.Time) (bool, error) {
+	product, err := w.Fetcher.Fetch(ctx, item)
+	if err != nil {
+		return false, w.fail(item, now, err)
+	}
+	price, err := scraper.ParsePrice(product.Price)
+	if err != nil {
+		return false, w.fail(item, now, fmt.Errorf("parse price %q: %w", product.Price, err))
+	}
+
+	history := models.PriceHistory{
+		WatchItemID: item.ID,
+		Price:       price.Amount,
+		Currency:    price.Currency,
+		TaxIncluded: price.TaxIncluded,
+		RawPrice:    product.Price,
+		CheckedAt:   now,
+		UserID:      item.UserID,
+	}
+	updates := map[string]interface{}{
+		"last_checked_at": now,
+		"last_price":      price.Amount,
+		"currency":        price.Currency,
+		"last_error":      "",
+	}
+
+	var notifyErr error
+	if reason := Evaluate(item, price); reason != "" {
+		notifyErr = w.Notifier.Notify(ctx, item.User, BuildMessage(item, price, reason))
+		if notifyErr == nil {
+			history.AlertReason = reason
+		} else {
+			delete(updates, "last_price")
+			delete(updates, "currency")
+			updates["last_error"] = "notify: " + notifyErr.Error()
+		}
+	}
+
+	err = w.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User").Create(&history).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WatchItem{}).Where("id = ?", item.ID).Updates(updates).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	if notifyErr != nil {
+		return false, notifyErr
+	}
+	return history.AlertReason != "", nil
+}
+
+// fail は取得の失敗を記録して cause を返す
+func (w *Watcher) fail(item models.WatchItem, now time.Time, cause error) error {
+	err := w.DB.Model(&models.WatchItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"last_checked_at": now,
+		"last_error":      cause.Error(),
+	}).Error
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+	return cause
+}
+
+// Evaluate は取得した価格で通知すべきかを判定し、通知の理由を返す (通知しない場合は空)
+//
+//   - AlertBelowTarget: TargetPrice 以下になった (前回は目標より高かった、または初回)
+//   - AlertPriceDrop:   前回の価格から DropPercent を超えて下がった
+//
+// 目標価格以下のまま推移している間は AlertBelowTarget を繰り返さない。
+// 通貨が前回と異なる場合は前回の価格と比べない。
+func Evaluate(item models.WatchItem, price scraper.Price) string {
+	last := item.LastPrice
+	if last != nil && item.Currency != "" && item.Currency != price.Currency {
+		last = nil
+	}
+	if item.TargetPrice != nil && price.Amount <= *item.TargetPrice && (last == nil || *last > *item.TargetPrice) {
+		return models.AlertBelowTarget
+	}
+	if item.DropPercent != nil && last != nil && *last > 0 {
+		drop := float64(*last-price.Amount) / float64(*last) * 100
+		if drop > *item.DropPercent {
+			return models.AlertPriceDrop
+		}
+	}
+	return ""
+}
+
+// BuildMessage は値下がりの通知を作る
+func BuildMessage(item models.WatchItem, price scraper.Price, reason string) notify.Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s が %s になりました。\n", item.Name, formatPrice(price.Amount, price.Currency))
+	switch reason {
+	case models.AlertBelowTarget:
+		fmt.Fprintf(&b, "目標価格 %s 以下です。\n", formatPrice(*item.TargetPrice, price.Currency))
+	case models.AlertPriceDrop:
+		drop := float64(*item.LastPrice-price.Amount) / float64(*item.LastPrice) * 100
+		fmt.Fprintf(&b, "前回の %s から %.1f%% 値下がりしました。\n", formatPrice(*item.LastPrice, price.Currency), drop)
+	}
+	fmt.Fprintf(&b, "\n%s\n", item.URL)
+	return notify.Message{
+		Subject: fmt.Sprintf("【家計簿】値下がり: %s", item.Name),
+		Body:    b.String(),
+	}
+}
+
+// formatPrice は通貨の最小単位の金額を表示用にする
+func formatPrice(amount int64, currency string) string {
+	if currency == "" || currency == "JPY" {
+		return notify.FormatYen(uint64(amount)) + "円"
+	}
+	return fmt.Sprintf("%d.%02d %s", amount/100, amount%100, currency)
+}
+
+func (w *Watcher) now() time.Time {
+	if w.Now != nil {
+		return w.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,249 @@
+package pricewatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kakeibo-backend/models"
+	"kakeibo-backend/netguard"
+	"kakeibo-backend/notify"
+	"kakeibo-backend/scraper"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.WatchItem{}, &models.PriceHistory{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// fakeFetcher は呼ばれるたびに prices を先頭から返す
+type fakeFetcher struct {
+	prices []string
+	calls  int
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, item models.WatchItem) (scraper.Product, error) {
+	if f.calls >= len(f.prices) {
+		return scraper.Product{}, errors.New("no more prices")
+	}
+	price := f.prices[f.calls]
+	f.calls++
+	if price == "" {
+		return scraper.Product{}, ErrProductNotFound
+	}
+	return scraper.Product{Name: item.Name, Price: price}, nil
+}
+
+type recordingNotifier struct {
+	sent []notify.Message
+	err  error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, user models.User, msg notify.Message) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func int64p(v int64) *int64       { return &v }
+func float64p(v float64) *float64 { return &v }
+
+// runChecks は1時間ごとに n 回実行する
+func runChecks(t *testing.T, w *Watcher, start time.Time, n int) {
+	t.Helper()
+	now := start
+	w.Now = func() time.Time { return now }
+	for i := 0; i < n; i++ {
+		if _, err := w.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Hour)
+	}
+}
+
+func newItem(t *testing.T, db *gorm.DB, start time.Time, target *int64, drop *float64) models.WatchItem {
+	t.Helper()
+	user := models.User{Name: "taro", Email: fmt.Sprintf("taro%d@example.com", time.Now().UnixNano()), Password: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	item := models.WatchItem{
+		Name: "コーヒーミル", URL: "https://shop.example.com/items/1",
+		ItemSelector: "html", NameSelector: "title", PriceSelector: ".price",
+		TargetPrice: target, DropPercent: drop,
+		IntervalMinutes: 60, NextCheckAt: start, IsActive: true, UserID: user.ID,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func history(t *testing.T, db *gorm.DB, item models.WatchItem) []models.PriceHistory {
+	t.Helper()
+	var rows []models.PriceHistory
+	if err := db.Order("checked_at ASC").Find(&rows, "watch_item_id = ?", item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// TestTargetAlertFiresOnce は目標価格を下回ったときに1回だけ通知することのテスト
+func TestTargetAlertFiresOnce(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC)
+	item := newItem(t, db, start, int64p(5000), nil)
+
+	n := &recordingNotifier{}
+	fetcher := &fakeFetcher{prices: []string{"¥5,980（税込）", "¥4,980（税込）", "¥4,780（税込）", "¥5,480", "¥4,980"}}
+	runChecks(t, &Watcher{DB: db, Fetcher: fetcher, Notifier: n}, start, 5)
+
+	rows := history(t, db, item)
+	if len(rows) != 5 {
+		t.Fatalf("history has %d rows, want 5", len(rows))
+	}
+	var reasons []string
+	for _, r := range rows {
+		reasons = append(reasons, r.AlertReason)
+	}
+	want := []string{"", models.AlertBelowTarget, "", "", models.AlertBelowTarget}
+	if fmt.Sprint(reasons) != fmt.Sprint(want) {
+		t.Errorf("alert reasons = %q, want %q", reasons, want)
+	}
+	if len(n.sent) != 2 {
+		t.Errorf("sent %d alerts, want 2", len(n.sent))
+	}
+
+	var saved models.WatchItem
+	db.First(&saved, "id = ?", item.ID)
+	if saved.LastPrice == nil || *saved.LastPrice != 4980 || saved.LastCheckedAt == nil {
+		t.Errorf("item = %+v", saved)
+	}
+	if !saved.NextCheckAt.Equal(start.Add(5 * time.Hour)) {
+		t.Errorf("next_check_at = %v", saved.NextCheckAt)
+	}
+}
+
+// TestPercentDropAlert は前回から N% を超えて下がったときに通知することのテスト
+func TestPercentDropAlert(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC)
+	item := newItem(t, db, start, nil, float64p(10))
+
+	n := &recordingNotifier{}
+	// 10000 → 9000 (ちょうど10%: 通知しない) → 8000 (11.1%: 通知)
+	fetcher := &fakeFetcher{prices: []string{"10,000円", "9,000円", "8,000円"}}
+	runChecks(t, &Watcher{DB: db, Fetcher: fetcher, Notifier: n}, start, 3)
+
+	rows := history(t, db, item)
+	if len(rows) != 3 || rows[1].AlertReason != "" || rows[2].AlertReason != models.AlertPriceDrop {
+		t.Errorf("history = %+v", rows)
+	}
+	if len(n.sent) != 1 {
+		t.Fatalf("sent %d alerts, want 1", len(n.sent))
+	}
+	if want := "【家計簿】値下がり: コーヒーミル"; n.sent[0].Subject != want {
+		t.Errorf("subject = %q", n.sent[0].Subject)
+	}
+}
+
+// TestNotDueAndFailures は取得時刻前の商品を取得せず、失敗を記録することのテスト
+func TestNotDueAndFailures(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC)
+	item := newItem(t, db, start.Add(30*time.Minute), int64p(5000), nil)
+
+	fetcher := &fakeFetcher{prices: []string{"", "オープン価格"}}
+	w := &Watcher{DB: db, Fetcher: fetcher, Notifier: &recordingNotifier{}, Now: func() time.Time { return start }}
+	if _, err := w.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fetcher.calls != 0 {
+		t.Fatalf("item fetched before next_check_at")
+	}
+
+	runChecks(t, w, start.Add(time.Hour), 2)
+	var saved models.WatchItem
+	db.First(&saved, "id = ?", item.ID)
+	if saved.LastError == "" || saved.LastPrice != nil {
+		t.Errorf("failure not recorded: %+v", saved)
+	}
+	if rows := history(t, db, item); len(rows) != 0 {
+		t.Errorf("failed checks should not add history: %+v", rows)
+	}
+}
+
+// TestNotifyFailureRetries は通知に失敗した場合、次回の取得で改めて通知することのテスト
+func TestNotifyFailureRetries(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC)
+	item := newItem(t, db, start, int64p(5000), nil)
+
+	n := &recordingNotifier{err: errors.New("webhook down")}
+	fetcher := &fakeFetcher{prices: []string{"¥4,980", "¥4,980"}}
+	w := &Watcher{DB: db, Fetcher: fetcher, Notifier: n}
+	runChecks(t, w, start, 1)
+	n.err = nil
+	runChecks(t, w, start.Add(time.Hour), 1)
+
+	if len(n.sent) != 1 {
+		t.Errorf("sent %d alerts after retry, want 1", len(n.sent))
+	}
+	rows := history(t, db, item)
+	if len(rows) != 2 || rows[0].AlertReason != "" || rows[1].AlertReason != models.AlertBelowTarget {
+		t.Errorf("history = %+v", rows)
+	}
+}
+
+func TestScraperFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><title>コーヒーミル</title></head>
+<body><h1>コーヒーミル</h1><span class="price">¥4,980（税込）</span></body></html>`)
+	}))
+	defer server.Close()
+
+	config := scraper.DefaultConfig()
+	config.Delay = 0
+	config.AllowPrivateAddresses = true
+	f := ScraperFetcher{Config: config}
+	item := models.WatchItem{URL: server.URL, ItemSelector: "html", NameSelector: "title", PriceSelector: ".price"}
+	product, err := f.Fetch(context.Background(), item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Name != "コーヒーミル" || product.Price != "¥4,980（税込）" {
+		t.Errorf("product = %+v", product)
+	}
+
+	item.NameSelector = ".missing"
+	if _, err := f.Fetch(context.Background(), item); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("err = %v, want ErrProductNotFound", err)
+	}
+
+	// 既定の設定では内部のアドレスから取得しない
+	item.NameSelector = "title"
+	if _, err := (ScraperFetcher{}).Fetch(context.Background(), item); !errors.Is(err, netguard.ErrForbiddenAddress) {
+		t.Errorf("default config: err = %v, want ErrForbiddenAddress", err)
+	}
+}
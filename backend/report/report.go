@@ -0,0 +1,312 @@
+// Package report はユーザーの月次レポート (models.Report) を集計・保存する
+package report
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kakeibo-backend/models"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BreakdownVersion は CategoryBreakdown の形式のバージョン
+// フィールドの意味を変える場合は上げること
+const BreakdownVersion = 3
+
+// Breakdown は models.Report.CategoryBreakdown に保存するJSONの形式
+//
+//	{
+//	  "version": 3,
+//	  "total": 52340,
+//	  "planned": 4980,
+//	  "categories": [
+//	    {"category_id": "…", "name": "食費", "parent_id": null, "total": 0, "rollup": 31200, "count": 0, "share": 0,
+//	     "expense": 0, "subscription": 0, "public_fee": 0, "planned": 0},
+//	    {"category_id": "…", "name": "外食", "parent_id": "…", "total": 31200, "rollup": 31200, "count": 42, "share": 0.596,
+//	     "expense": 31200, "subscription": 0, "public_fee": 0, "planned": 0},
+//	    …
+//	  ]
+//	}
+type Breakdown struct {
+	Version int `json:"version"`
+	// Total は全カテゴリの合計 (TotalExpense + TotalSubscription + TotalPublicFee)
+	Total uint64 `json:"total"`
+	// Planned は支出 (TotalExpense) のうち欲しいものリストから購入した分
+	// TotalExpense - Planned が計画外の支出
+	Planned uint64 `json:"planned"`
+	// Categories は Rollup の降順 (同額なら名前順)
+	// 集計対象の行があるカテゴリと、その祖先のカテゴリを含む
+	Categories []CategoryTotal `json:"categories"`
+}
+
+// CategoryTotal は1カテゴリ分の集計
+type CategoryTotal struct {
+	CategoryID uuid.UUID `json:"category_id"`
+	// Name は集計時点のカテゴリ名
+	Name string `json:"name"`
+	// ParentID は集計時点の親カテゴリ (最上位なら null)
+	ParentID *uuid.UUID `json:"parent_id"`
+	// Total はこのカテゴリ自身の Expense + Subscription + PublicFee
+	Total uint64 `json:"total"`
+	// Rollup は Total と全ての子孫カテゴリの Total の合計
+	Rollup uint64 `json:"rollup"`
+	// Count は集計対象の件数 (支出・サブスクリプション請求・公共料金の合計)
+	Count int64 `json:"count"`
+	// Share は Breakdown.Total に占める割合 (0〜1)。Total が0なら0
+	Share        float64 `json:"share"`
+	Expense      uint64  `json:"expense"`
+	Subscription uint64  `json:"subscription"`
+	PublicFee    uint64  `json:"public_fee"`
+	// Planned は Expense のうち欲しいものリストから購入した分
+	Planned uint64 `json:"planned"`
+}
+
+// MonthStart は t を含む月の1日0時 (t のタイムゾーン) を返す
+func MonthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// Generator は月次レポートを集計する
+//
+// 集計対象 (TargetMonth の1日0時〜翌月1日0時):
+//   - TotalExpense:      手入力などの支出 (SubscriptionID なし) の SpentAt
+//   - TotalSubscription: サブスクリプションの請求として計上された支出の SpentAt
+//   - TotalPublicFee:    公共料金の NextBillingDate
+type Generator struct {
+	DB *gorm.DB
+}
+
+// Get は保存済みのレポートを返す
+// 未作成、または集計元データが変わっている場合は再集計して保存する
+func (g *Generator) Get(userID uuid.UUID, month time.Time) (*models.Report, error) {
+	month = MonthStart(month)
+	fingerprint, err := g.fingerprint(userID, month)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing models.Report
+	err = g.DB.First(&existing, "user_id = ? AND target_month = ?", userID, month).Error
+	if err == nil && existing.SourceFingerprint == fingerprint {
+		return &existing, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return g.generate(userID, month, fingerprint)
+}
+
+// Generate は保存済みかどうかに関わらず再集計して保存する
+func (g *Generator) Generate(userID uuid.UUID, month time.Time) (*models.Report, error) {
+	month = MonthStart(month)
+	fingerprint, err := g.fingerprint(userID, month)
+	if err != nil {
+		return nil, err
+	}
+	return g.generate(userID, month, fingerprint)
+}
+
+type sourceRow struct {
+	CategoryID     uuid.UUID
+	IsSubscription bool
+	IsPlanned      bool
+	Total          int64
+	Count          int64
+}
+
+func (g *Generator) generate(userID uuid.UUID, month time.Time, fingerprint string) (*models.Report, error) {
+	next := month.AddDate(0, 1, 0)
+
+	var expenseRows []sourceRow
+	if err := g.DB.Model(&models.Expense{}).
+		Select("category_id, subscription_id IS NOT NULL AS is_subscription, wishlist_item_id IS NOT NULL AS is_planned, SUM(amount) AS total, COUNT(*) AS count").
+		Where("user_id = ? AND spent_at >= ? AND spent_at < ?", userID, month, next).
+		Group("category_id, subscription_id IS NOT NULL, wishlist_item_id IS NOT NULL").
+		Scan(&expenseRows).Error; err != nil {
+		return nil, fmt.Errorf("aggregate expenses: %w", err)
+	}
+
+	var feeRows []sourceRow
+	if err := g.DB.Model(&models.PublicFee{}).
+		Select("category_id, SUM(amount) AS total, COUNT(*) AS count").
+		Where("user_id = ? AND next_billing_date >= ? AND next_billing_date < ?", userID, month, next).
+		Group("category_id").
+		Scan(&feeRows).Error; err != nil {
+		return nil, fmt.Errorf("aggregate public fees: %w", err)
+	}
+
+	report := models.Report{TargetMonth: month, UserID: userID, SourceFingerprint: fingerprint}
+	var planned uint64
+	byCategory := map[uuid.UUID]*CategoryTotal{}
+	category := func(id uuid.UUID) *CategoryTotal {
+		if ct, ok := byCategory[id]; ok {
+			return ct
+		}
+		ct := &CategoryTotal{CategoryID: id}
+		byCategory[id] = ct
+		return ct
+	}
+	for _, r := range expenseRows {
+		ct := category(r.CategoryID)
+		ct.Count += r.Count
+		if r.IsSubscription {
+			ct.Subscription += uint64(r.Total)
+			report.TotalSubscription += uint64(r.Total)
+		} else {
+			ct.Expense += uint64(r.Total)
+			report.TotalExpense += uint64(r.Total)
+			if r.IsPlanned {
+				ct.Planned += uint64(r.Total)
+				planned += uint64(r.Total)
+			}
+		}
+	}
+	for _, r := range feeRows {
+		ct := category(r.CategoryID)
+		ct.Count += r.Count
+		ct.PublicFee += uint64(r.Total)
+		report.TotalPublicFee += uint64(r.Total)
+	}
+
+	breakdown, err := g.breakdown(byCategory, report.TotalExpense+report.TotalSubscription+report.TotalPublicFee)
+	if err != nil {
+		return nil, err
+	}
+	breakdown.Planned = planned
+	raw, err := json.Marshal(breakdown)
+	if err != nil {
+		return nil, err
+	}
+	report.CategoryBreakdown = datatypes.JSON(raw)
+
+	// (user_id, target_month) で1件。既存の行は ID を保ったまま上書きする
+	if err := g.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "target_month"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"total_expense", "total_public_fee", "total_subscription",
+			"category_breakdown", "source_fingerprint", "updated_at", "deleted_at",
+		}),
+	}).Omit("User").Create(&report).Error; err != nil {
+		return nil, fmt.Errorf("save report: %w", err)
+	}
+	// 競合時は既存行のIDが残るため読み直す (report.ID は採番したばかりの値)
+	var saved models.Report
+	if err := g.DB.First(&saved, "user_id = ? AND target_month = ?", userID, month).Error; err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (g *Generator) breakdown(byCategory map[uuid.UUID]*CategoryTotal, total uint64) (Breakdown, error) {
+	for _, ct := range byCategory {
+		ct.Total = ct.Expense + ct.Subscription + ct.PublicFee
+		if total > 0 {
+			ct.Share = float64(ct.Total) / float64(total)
+		}
+	}
+
+	// 祖先のカテゴリを読み込む (削除済みのカテゴリも過去の集計には名前を出す)
+	categories := map[uuid.UUID]models.Category{}
+	ids := make([]uuid.UUID, 0, len(byCategory))
+	for id := range byCategory {
+		ids = append(ids, id)
+	}
+	for len(ids) > 0 {
+		var rows []models.Category
+		if err := g.DB.Unscoped().Find(&rows, "id IN ?", ids).Error; err != nil {
+			return Breakdown{}, err
+		}
+		ids = ids[:0]
+		for _, c := range rows {
+			categories[c.ID] = c
+			if c.ParentID != nil {
+				if _, ok := categories[*c.ParentID]; !ok {
+					ids = append(ids, *c.ParentID)
+				}
+			}
+		}
+	}
+
+	// 各カテゴリの Total を自分と祖先の Rollup に積み上げる
+	for id := range categories {
+		if _, ok := byCategory[id]; !ok {
+			byCategory[id] = &CategoryTotal{CategoryID: id}
+		}
+	}
+	for id, c := range categories {
+		byCategory[id].Name = c.Name
+		byCategory[id].ParentID = c.ParentID
+	}
+	for id, ct := range byCategory {
+		seen := map[uuid.UUID]bool{}
+		for cur := &id; cur != nil && !seen[*cur]; {
+			seen[*cur] = true
+			ancestor, ok := byCategory[*cur]
+			if !ok {
+				break
+			}
+			ancestor.Rollup += ct.Total
+			cur = ancestor.ParentID
+		}
+	}
+
+	b := Breakdown{Version: BreakdownVersion, Total: total, Categories: []CategoryTotal{}}
+	for _, ct := range byCategory {
+		b.Categories = append(b.Categories, *ct)
+	}
+	sort.Slice(b.Categories, func(i, j int) bool {
+		if b.Categories[i].Rollup != b.Categories[j].Rollup {
+			return b.Categories[i].Rollup > b.Categories[j].Rollup
+		}
+		return b.Categories[i].Name < b.Categories[j].Name
+	})
+	return b, nil
+}
+
+// fingerprint は対象月の集計元データの件数・合計・最終更新日時の要約を返す
+// 行の追加・削除・金額やカテゴリの変更・月をまたぐ移動のいずれでも値が変わる
+func (g *Generator) fingerprint(userID uuid.UUID, month time.Time) (string, error) {
+	next := month.AddDate(0, 1, 0)
+	type summary struct {
+		Count     int64
+		Total     int64
+		UpdatedAt sql.NullString
+	}
+	var expenses, fees summary
+	if err := g.DB.Model(&models.Expense{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(amount), 0) AS total, MAX(updated_at) AS updated_at").
+		Where("user_id = ? AND spent_at >= ? AND spent_at < ?", userID, month, next).
+		Scan(&expenses).Error; err != nil {
+		return "", err
+	}
+	if err := g.DB.Model(&models.PublicFee{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(amount), 0) AS total, MAX(updated_at) AS updated_at").
+		Where("user_id = ? AND next_billing_date >= ? AND next_billing_date < ?", userID, month, next).
+		Scan(&fees).Error; err != nil {
+		return "", err
+	}
+	// カテゴリ名・階層の変更も反映する (祖先のカテゴリも集計に含まれるため、使えるカテゴリ全体を見る)
+	var categoryUpdatedAt sql.NullString
+	if err := g.DB.Model(&models.Category{}).Unscoped().
+		Scopes(models.VisibleCategories(userID)).
+		Select("MAX(updated_at)").
+		Scan(&categoryUpdatedAt).Error; err != nil {
+		return "", err
+	}
+
+	raw := fmt.Sprintf("v%d|e:%d:%d:%s|f:%d:%d:%s|c:%s", BreakdownVersion,
+		expenses.Count, expenses.Total, expenses.UpdatedAt.String,
+		fees.Count, fees.Total, fees.UpdatedAt.String,
+		categoryUpdatedAt.String)
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,245 @@
+package report
+
+import (
+	"encoding/json"
+	"kakeibo-backend/models"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type fixture struct {
+	g         *Generator
+	user      models.User
+	food      models.Category
+	utilities models.Category
+	video     models.Category
+}
+
+func newFixture(t *testing.T) fixture {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(
+		&models.User{}, &models.Category{}, &models.Subscription{},
+		&models.Expense{}, &models.PublicFee{}, &models.Report{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	f := fixture{
+		g:         &Generator{DB: db},
+		user:      models.User{Name: "taro", Email: "taro@example.com", Password: "x"},
+		food:      models.Category{Name: "食費"},
+		utilities: models.Category{Name: "水道光熱費"},
+		video:     models.Category{Name: "動画配信"},
+	}
+	for _, v := range []interface{}{&f.user, &f.food, &f.utilities, &f.video} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func (f fixture) create(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := f.g.DB.Create(v).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decodeBreakdown(t *testing.T, r *models.Report) Breakdown {
+	t.Helper()
+	var b Breakdown
+	if err := json.Unmarshal(r.CategoryBreakdown, &b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestGenerate は月次の合計とカテゴリ別内訳のテスト
+func TestGenerate(t *testing.T) {
+	f := newFixture(t)
+	april := time.Date(2026, 4, 1, 0, 0, 0, 0, time.Local)
+	subID := uuid.New()
+
+	f.create(t, &models.Expense{Amount: 1000, Description: "lunch", SpentAt: april.AddDate(0, 0, 2), UserID: f.user.ID, CategoryID: f.food.ID})
+	f.create(t, &models.Expense{Amount: 2000, Description: "dinner", SpentAt: april.AddDate(0, 0, 29), UserID: f.user.ID, CategoryID: f.food.ID})
+	f.create(t, &models.Expense{Amount: 1490, Description: "Netflix", SpentAt: april.AddDate(0, 0, 9), UserID: f.user.ID, CategoryID: f.video.ID, SubscriptionID: &subID})
+	f.create(t, &models.PublicFee{FeeType: "electricity", Amount: 5510, UsageMonth: 3, NextBillingDate: april.AddDate(0, 0, 20), UserID: f.user.ID, CategoryID: f.utilities.ID})
+	// 対象外: 翌月・他ユーザー
+	f.create(t, &models.Expense{Amount: 9999, Description: "may", SpentAt: april.AddDate(0, 1, 0), UserID: f.user.ID, CategoryID: f.food.ID})
+	f.create(t, &models.Expense{Amount: 9999, Description: "other", SpentAt: april, UserID: uuid.New(), CategoryID: f.food.ID})
+
+	r, err := f.g.Get(f.user.ID, april.AddDate(0, 0, 15))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.TargetMonth.Equal(april) {
+		t.Errorf("target_month = %s, want %s", r.TargetMonth, april)
+	}
+	if r.TotalExpense != 3000 || r.TotalSubscription != 1490 || r.TotalPublicFee != 5510 {
+		t.Fatalf("totals = %d/%d/%d, want 3000/1490/5510", r.TotalExpense, r.TotalSubscription, r.TotalPublicFee)
+	}
+
+	b := decodeBreakdown(t, r)
+	if b.Version != BreakdownVersion || b.Total != 10000 || len(b.Categories) != 3 {
+		t.Fatalf("unexpected breakdown: %+v", b)
+	}
+	top := b.Categories[0]
+	if top.Name != "水道光熱費" || top.Total != 5510 || top.PublicFee != 5510 || top.Count != 1 {
+		t.Errorf("unexpected top category: %+v", top)
+	}
+	food := b.Categories[1]
+	if food.Name != "食費" || food.Total != 3000 || food.Count != 2 || math.Abs(food.Share-0.3) > 1e-9 {
+		t.Errorf("unexpected food category: %+v", food)
+	}
+	if video := b.Categories[2]; video.Subscription != 1490 || video.Expense != 0 {
+		t.Errorf("unexpected video category: %+v", video)
+	}
+}
+
+// TestGeneratePlanned は欲しいものリストから購入した支出を計画的な支出として分けて集計するテスト
+func TestGeneratePlanned(t *testing.T) {
+	f := newFixture(t)
+	april := time.Date(2026, 4, 1, 0, 0, 0, 0, time.Local)
+	wishID := uuid.New()
+
+	f.create(t, &models.Expense{Amount: 1000, Description: "lunch", SpentAt: april, UserID: f.user.ID, CategoryID: f.food.ID})
+	f.create(t, &models.Expense{Amount: 4980, Description: "コーヒーミル", SpentAt: april, UserID: f.user.ID, CategoryID: f.food.ID, WishlistItemID: &wishID})
+
+	r, err := f.g.Get(f.user.ID, april)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := decodeBreakdown(t, r)
+	if r.TotalExpense != 5980 || b.Planned != 4980 {
+		t.Errorf("total_expense = %d, planned = %d; want 5980, 4980", r.TotalExpense, b.Planned)
+	}
+	if len(b.Categories) != 1 || b.Categories[0].Expense != 5980 || b.Categories[0].Planned != 4980 || b.Categories[0].Count != 2 {
+		t.Errorf("unexpected categories: %+v", b.Categories)
+	}
+}
+
+// TestGenerateRollup は子カテゴリの合計が祖先のカテゴリに積み上がることのテスト
+func TestGenerateRollup(t *testing.T) {
+	f := newFixture(t)
+	april := time.Date(2026, 4, 1, 0, 0, 0, 0, time.Local)
+	eatingOut := models.Category{Name: "外食", ParentID: &f.food.ID, UserID: &f.user.ID}
+	lunch := models.Category{Name: "ランチ", ParentID: &eatingOut.ID, UserID: &f.user.ID}
+	f.create(t, &eatingOut)
+	f.create(t, &lunch)
+
+	f.create(t, &models.Expense{Amount: 1000, Description: "groceries", SpentAt: april, UserID: f.user.ID, CategoryID: f.food.ID})
+	f.create(t, &models.Expense{Amount: 3000, Description: "dinner", SpentAt: april, UserID: f.user.ID, CategoryID: eatingOut.ID})
+	f.create(t, &models.Expense{Amount: 800, Description: "lunch", SpentAt: april, UserID: f.user.ID, CategoryID: lunch.ID})
+
+	r, err := f.g.Get(f.user.ID, april)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := decodeBreakdown(t, r)
+	if b.Total != 4800 || len(b.Categories) != 3 {
+		t.Fatalf("unexpected breakdown: %+v", b)
+	}
+	want := []struct {
+		name          string
+		total, rollup uint64
+	}{
+		{"食費", 1000, 4800},
+		{"外食", 3000, 3800},
+		{"ランチ", 800, 800},
+	}
+	for i, w := range want {
+		ct := b.Categories[i]
+		if ct.Name != w.name || ct.Total != w.total || ct.Rollup != w.rollup {
+			t.Errorf("categories[%d] = %+v, want %s total %d rollup %d", i, ct, w.name, w.total, w.rollup)
+		}
+	}
+	if b.Categories[2].ParentID == nil || *b.Categories[2].ParentID != eatingOut.ID {
+		t.Errorf("parent_id of ランチ = %v", b.Categories[2].ParentID)
+	}
+
+	// 親のカテゴリに行が無くても内訳に含める
+	hobby := models.Category{Name: "趣味", UserID: &f.user.ID}
+	f.create(t, &hobby)
+	books := models.Category{Name: "書籍", ParentID: &hobby.ID, UserID: &f.user.ID}
+	f.create(t, &books)
+	f.create(t, &models.Expense{Amount: 1500, Description: "novel", SpentAt: april, UserID: f.user.ID, CategoryID: books.ID})
+	r, err = f.g.Get(f.user.ID, april)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = decodeBreakdown(t, r)
+	for _, ct := range b.Categories {
+		if ct.Name == "趣味" && (ct.Total != 0 || ct.Rollup != 1500 || ct.Count != 0) {
+			t.Errorf("unexpected parent without rows: %+v", ct)
+		}
+	}
+	if len(b.Categories) != 5 {
+		t.Errorf("got %d categories, want 5", len(b.Categories))
+	}
+}
+
+// TestGetRegeneratesOnChange は集計元が変わったときだけ再集計されることのテスト
+func TestGetRegeneratesOnChange(t *testing.T) {
+	f := newFixture(t)
+	april := time.Date(2026, 4, 1, 0, 0, 0, 0, time.Local)
+	lunch := models.Expense{Amount: 1000, Description: "lunch", SpentAt: april.AddDate(0, 0, 2), UserID: f.user.ID, CategoryID: f.food.ID}
+	f.create(t, &lunch)
+
+	first, err := f.g.Get(f.user.ID, april)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := f.g.Get(f.user.ID, april)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID || !again.UpdatedAt.Equal(first.UpdatedAt) {
+		t.Error("unchanged data should not regenerate the report")
+	}
+
+	steps := []struct {
+		name   string
+		change func()
+		want   uint64
+	}{
+		{"amount changed", func() { f.g.DB.Model(&lunch).Update("amount", 1200) }, 1200},
+		{"expense added", func() {
+			f.create(t, &models.Expense{Amount: 300, Description: "coffee", SpentAt: april.AddDate(0, 0, 3), UserID: f.user.ID, CategoryID: f.food.ID})
+		}, 1500},
+		{"moved to next month", func() { f.g.DB.Model(&lunch).Update("spent_at", april.AddDate(0, 1, 1)) }, 300},
+		{"deleted", func() { f.g.DB.Where("description = ?", "coffee").Delete(&models.Expense{}) }, 0},
+	}
+	for _, step := range steps {
+		step.change()
+		r, err := f.g.Get(f.user.ID, april)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.TotalExpense != step.want {
+			t.Errorf("%s: total_expense = %d, want %d", step.name, r.TotalExpense, step.want)
+		}
+		if r.ID != first.ID {
+			t.Errorf("%s: report should be updated in place", step.name)
+		}
+	}
+
+	var count int64
+	f.g.DB.Model(&models.Report{}).Count(&count)
+	if count != 1 {
+		t.Errorf("report rows = %d, want 1", count)
+	}
+}
@@ -62,6 +62,8 @@ func example2_CustomSelector() {
 }
 
 // Example3: 実践的な使用例 - 価格監視
+// アプリでは pricewatch パッケージが /api/watch-items に登録した商品を定期的に取得し、
+// 価格の履歴を保存して値下がりを通知する。ここでは1商品だけを手動で確認する
 func example3_PriceMonitoring() {
 	fmt.Println("\n=== Example 3: Price Monitoring ===")
 
@@ -89,9 +91,10 @@ func example3_PriceMonitoring() {
 			)
 
 			// 価格が閾値以下なら通知(実装例)
-			// if isPriceLow(product.Price) {
-			//     sendNotification(product)
-			// }
+			price, err := scraper.ParsePrice(product.Price)
+			if err == nil && price.Amount <= 3000 {
+				fmt.Printf("目標価格以下です: %d %s\n", price.Amount, price.Currency)
+			}
 		}
 	}
 
@@ -126,7 +129,6 @@ func example4_MultiplePages() {
 		}
 
 		allProducts = append(allProducts, products...)
-		ps.ClearProducts() // 次のページ用にクリア
 
 		// サーバーに負荷をかけないよう待機
 		time.Sleep(2 * time.Second)
@@ -137,7 +139,8 @@ func example4_MultiplePages() {
 
 func main() {
 	fmt.Println("Scraping Examples")
-	fmt.Println("=================\n")
+	fmt.Println("=================")
+	fmt.Println()
 
 	// 注意: これらの例は実際には動作しません
 	// 実際のサイトに合わせてURLとセレクタを変更してください
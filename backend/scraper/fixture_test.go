@@ -0,0 +1,303 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// フィクスチャ (testdata/fixtures/<名前>/) を使ったテスト
+// 書き方と記録の手順は testdata/fixtures/README.md を参照
+var (
+	updateGolden   = flag.Bool("update", false, "update golden.json of fixtures with the current results")
+	recordFixtures = flag.Bool("record", false, "re-fetch fixture pages from their origin and update golden.json")
+)
+
+// fixtureCase は case.yaml
+type fixtureCase struct {
+	Description string `yaml:"description"`
+	// Origin は記録元のサイト ("https://shop.example.com")
+	// ページ内の Origin の URL はテストサーバーの URL に置き換えて配信し、結果の URL は Origin に戻して比べる
+	Origin string `yaml:"origin"`
+	// Start は最初のページのパス (クエリを含む)
+	Start string `yaml:"start"`
+	// Profile が無ければ ScrapeStructured で抽出する
+	Profile  *SiteProfile `yaml:"profile"`
+	MaxPages int          `yaml:"max_pages"`
+	MaxItems int          `yaml:"max_items"`
+}
+
+// fixturePage は pages.json の1ページ (キーはリクエストの URI)
+type fixturePage struct {
+	File        string `json:"file"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type"`
+}
+
+// fixtureResult は golden.json
+type fixtureResult struct {
+	Stopped  StopReason      `json:"stopped,omitempty"`
+	Products []goldenProduct `json:"products"`
+}
+
+type goldenProduct struct {
+	Name         string `json:"name"`
+	Price        string `json:"price"`
+	Parsed       *Price `json:"parsed"` // ParsePrice(Price) の結果 (解釈できなければ null)
+	URL          string `json:"url"`
+	ImageURL     string `json:"image_url,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+	Availability string `json:"availability,omitempty"`
+	GTIN         string `json:"gtin,omitempty"`
+}
+
+func TestFixtures(t *testing.T) {
+	cases, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*", "case.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("no fixtures in testdata/fixtures")
+	}
+	for _, path := range cases {
+		dir := filepath.Dir(path)
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			runFixture(t, dir)
+		})
+	}
+}
+
+func runFixture(t *testing.T, dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, "case.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fc fixtureCase
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil {
+		t.Fatalf("case.yaml: %v", err)
+	}
+	if *recordFixtures && fc.Origin == "" {
+		t.Skip("no origin to record from")
+	}
+
+	server := newFixtureServer(t, dir, fc.Origin, *recordFixtures)
+	limits := Limits{MaxPages: fc.MaxPages, MaxItems: fc.MaxItems}
+	var products []Product
+	if fc.Profile != nil {
+		products, err = newTestScraper().ScrapeSite(context.Background(), server.URL+fc.Start, *fc.Profile, limits)
+	} else {
+		products, err = newTestScraper().ScrapeStructured(context.Background(), server.URL+fc.Start, limits)
+	}
+	var result fixtureResult
+	var stop *StopError
+	switch {
+	case errors.As(err, &stop):
+		result.Stopped = stop.Reason
+	case err != nil:
+		t.Fatal(err)
+	}
+	if *recordFixtures {
+		server.save(t)
+	}
+
+	origin := fc.Origin
+	if origin == "" {
+		origin = "http://fixture.test"
+	}
+	unserve := func(s string) string { return strings.ReplaceAll(s, server.URL, origin) }
+	result.Products = make([]goldenProduct, 0, len(products))
+	for _, p := range products {
+		g := goldenProduct{
+			Name:         p.Name,
+			Price:        p.Price,
+			URL:          unserve(p.URL),
+			ImageURL:     unserve(p.ImageURL),
+			Description:  p.Description,
+			Currency:     p.Currency,
+			Availability: p.Availability,
+			GTIN:         p.GTIN,
+		}
+		if price, err := ParsePrice(p.Price); err == nil {
+			g.Parsed = &price
+		}
+		result.Products = append(result.Products, g)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.Bytes()
+	goldenPath := filepath.Join(dir, "golden.json")
+	if *updateGolden || *recordFixtures {
+		if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("%v (run go test ./scraper -run TestFixtures -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("result differs from %s (run with -update if the change is intended)\n--- got\n%s--- want\n%s", goldenPath, got, want)
+	}
+}
+
+// fixtureServer は記録済みのページを配信するテストサーバー
+// 記録モードでは、未記録のページを origin から取得して保存してから配信する
+type fixtureServer struct {
+	*httptest.Server
+	dir    string
+	origin string
+	record bool
+
+	mu    sync.Mutex
+	pages map[string]fixturePage
+	files map[string][]byte // 記録モードで取得した本文 (ファイル名 → 本文)
+}
+
+func newFixtureServer(t *testing.T, dir, origin string, record bool) *fixtureServer {
+	t.Helper()
+	s := &fixtureServer{dir: dir, origin: origin, record: record, pages: map[string]fixturePage{}, files: map[string][]byte{}}
+	if !record {
+		data, err := os.ReadFile(filepath.Join(dir, "pages.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &s.pages); err != nil {
+			t.Fatalf("pages.json: %v", err)
+		}
+	}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fixtureServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	uri := r.URL.RequestURI()
+	page, body, err := s.page(uri)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if s.origin != "" {
+		body = bytes.ReplaceAll(body, []byte(s.origin), []byte(s.URL))
+	}
+	if page.ContentType == "" {
+		// 記録元が Content-Type を返さなかった場合は、推測して付けない
+		w.Header()["Content-Type"] = nil
+	} else {
+		w.Header().Set("Content-Type", page.ContentType)
+	}
+	if page.Status != 0 {
+		w.WriteHeader(page.Status)
+	}
+	w.Write(body)
+}
+
+// page は uri のページと本文を返す。記録も無く記録モードでもなければ os.ErrNotExist
+func (s *fixtureServer) page(uri string) (fixturePage, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if page, ok := s.pages[uri]; ok {
+		if body, ok := s.files[page.File]; ok {
+			return page, body, nil
+		}
+		body, err := os.ReadFile(filepath.Join(s.dir, "pages", page.File))
+		return page, body, err
+	}
+	if !s.record {
+		return fixturePage{}, nil, os.ErrNotExist
+	}
+
+	res, err := http.Get(s.origin + uri)
+	if err != nil {
+		return fixturePage{}, nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fixturePage{}, nil, err
+	}
+	page := fixturePage{File: s.fileName(uri), ContentType: res.Header.Get("Content-Type")}
+	if res.StatusCode != http.StatusOK {
+		page.Status = res.StatusCode
+	}
+	s.pages[uri] = page
+	s.files[page.File] = body
+	return page, body, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fileName は uri から記録するファイル名を作る ("/list?page=2" → "list_page_2.html")
+func (s *fixtureServer) fileName(uri string) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(uri, ".html"), ".htm")
+	base = strings.Trim(unsafeFileChars.ReplaceAllString(base, "_"), "_.")
+	if base == "" {
+		base = "index"
+	}
+	name := base + ".html"
+	for i := 2; s.files[name] != nil; i++ {
+		name = fmt.Sprintf("%s_%d.html", base, i)
+	}
+	return name
+}
+
+// save は記録したページで pages/ と pages.json を置き換える
+func (s *fixtureServer) save(t *testing.T) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pagesDir := filepath.Join(s.dir, "pages")
+	if err := os.RemoveAll(pagesDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(pagesDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(pagesDir, name), s.files[name], 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := json.MarshalIndent(s.pages, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, "pages.json"), append(data, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("recorded %d pages from %s", len(names), s.origin)
+}
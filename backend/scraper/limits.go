@@ -0,0 +1,71 @@
+package scraper
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limits は1回のスクレイピングの上限
+// 0 の項目は DefaultLimits の値を使う
+type Limits struct {
+	MaxPages int           // 取得するページ数の上限 (ページネーションを含む)
+	MaxItems int           // 取得する商品数の上限
+	Timeout  time.Duration // 全体の制限時間
+}
+
+// DefaultLimits はデフォルトの上限を返す
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPages: 10,
+		MaxItems: 200,
+		Timeout:  30 * time.Second,
+	}
+}
+
+func (l Limits) withDefaults() Limits {
+	d := DefaultLimits()
+	if l.MaxPages <= 0 {
+		l.MaxPages = d.MaxPages
+	}
+	if l.MaxItems <= 0 {
+		l.MaxItems = d.MaxItems
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = d.Timeout
+	}
+	return l
+}
+
+// StopReason はスクレイピングが途中で止まった理由
+type StopReason string
+
+const (
+	StopCanceled StopReason = "canceled"  // 呼び出し元の context がキャンセルされた
+	StopDeadline StopReason = "deadline"  // 制限時間 (Limits.Timeout または context の期限) を過ぎた
+	StopMaxPages StopReason = "max_pages" // 未取得のページを残して Limits.MaxPages に達した
+	StopMaxItems StopReason = "max_items" // 未取得の商品を残して Limits.MaxItems に達した
+)
+
+// StopError はスクレイピングが最後まで終わらなかったことを表す
+// 一緒に返される商品は止まるまでに取得できた分
+//
+// canceled / deadline の場合は context のエラーを Unwrap で返すため、
+// errors.Is(err, context.DeadlineExceeded) のように判定できる。
+type StopError struct {
+	Reason StopReason
+	Pages  int // 取得したページ数
+	Items  int // 取得した商品数
+	Err    error
+}
+
+func (e *StopError) Error() string {
+	msg := fmt.Sprintf("scraping stopped (%s) after %d pages and %d items", e.Reason, e.Pages, e.Items)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *StopError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,109 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newPagedServer は /page/N に商品3件と次のページへのリンクを返すサーバー (lastPage まで。0 なら無限)
+func newPagedServer(t *testing.T, lastPage int, delay time.Duration) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Path[len("/page/"):])
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><body>")
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, `<div class="product-item"><span class="product-name">p%d-%d</span><span class="product-price">¥100</span></div>`, page, i)
+		}
+		if lastPage == 0 || page < lastPage {
+			fmt.Fprintf(w, `<a class="next-page" href="/page/%d">next</a>`, page+1)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestScrapeStopsAtMaxPages(t *testing.T) {
+	server := newPagedServer(t, 0, 0)
+	products, err := newTestScraper().Scrape(context.Background(), server.URL+"/page/1", ExampleSelectors(), Limits{MaxPages: 2})
+
+	var stop *StopError
+	if !errors.As(err, &stop) || stop.Reason != StopMaxPages {
+		t.Fatalf("err = %v, want StopMaxPages", err)
+	}
+	if len(products) != 6 || stop.Pages != 2 || stop.Items != 6 {
+		t.Errorf("got %d products, stop = %+v", len(products), stop)
+	}
+}
+
+func TestScrapeStopsAtMaxItems(t *testing.T) {
+	server := newPagedServer(t, 0, 0)
+	products, err := newTestScraper().Scrape(context.Background(), server.URL+"/page/1", ExampleSelectors(), Limits{MaxItems: 4})
+
+	var stop *StopError
+	if !errors.As(err, &stop) || stop.Reason != StopMaxItems {
+		t.Fatalf("err = %v, want StopMaxItems", err)
+	}
+	if len(products) != 4 {
+		t.Errorf("got %d products, want 4", len(products))
+	}
+}
+
+// TestScrapeWithinLimits はちょうど上限で最後まで取得できた場合はエラーにならないことのテスト
+func TestScrapeWithinLimits(t *testing.T) {
+	server := newPagedServer(t, 2, 0)
+	products, err := newTestScraper().Scrape(context.Background(), server.URL+"/page/1", ExampleSelectors(), Limits{MaxPages: 2, MaxItems: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 6 {
+		t.Errorf("got %d products, want 6", len(products))
+	}
+}
+
+func TestScrapeDeadline(t *testing.T) {
+	server := newPagedServer(t, 0, 200*time.Millisecond)
+	start := time.Now()
+	products, err := newTestScraper().Scrape(context.Background(), server.URL+"/page/1", ExampleSelectors(), Limits{Timeout: 500 * time.Millisecond})
+
+	var stop *StopError
+	if !errors.As(err, &stop) || stop.Reason != StopDeadline {
+		t.Fatalf("err = %v, want StopDeadline", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err should wrap context.DeadlineExceeded: %v", err)
+	}
+	if len(products) == 0 {
+		t.Errorf("partial results should be returned")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("scrape took %v after the deadline", elapsed)
+	}
+}
+
+func TestScrapeCanceled(t *testing.T) {
+	server := newPagedServer(t, 0, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	products, err := newTestScraper().Scrape(ctx, server.URL+"/page/1", ExampleSelectors(), Limits{})
+
+	var stop *StopError
+	if !errors.As(err, &stop) || stop.Reason != StopCanceled || !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want StopCanceled", err)
+	}
+	if len(products) != 0 {
+		t.Errorf("got %d products from a canceled scrape", len(products))
+	}
+}
@@ -0,0 +1,239 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kakeibo-backend/netguard"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// ErrDeniedDomain は ScraperConfig.DenyDomains のドメインを取得しようとしたことを表す
+var ErrDeniedDomain = errors.New("domain is on the deny list")
+
+// ErrDisallowedByRobots は robots.txt で取得が禁止されていることを表す
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// DefaultUserAgent は既定の User-Agent
+// ブラウザを装わず、robots.txt でこの名前 ("KakeiboBot") を指定して制限できるようにする
+const DefaultUserAgent = "KakeiboBot/1.0 (household budget price checker)"
+
+// DomainRule はドメインごとのリクエストの間隔と並行数
+// Domain はサブドメインにも一致する ("example.com" は "www.example.com" にも使う)
+type DomainRule struct {
+	Domain      string
+	Delay       time.Duration // 同じホストへのリクエストの最短間隔
+	Parallelism int           // 1回のスクレイピングでの並行リクエスト数 (0 なら ScraperConfig.Parallelism)
+}
+
+// ParseDomainRules は "example.com=5s, shop.example.jp=10s/2" のような表記を読む
+// 各要素は ドメイン=間隔[/並行数]。環境変数での設定に使う
+func ParseDomainRules(s string) ([]DomainRule, error) {
+	var rules []DomainRule
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		domain, spec, ok := strings.Cut(part, "=")
+		domain = normalizeDomain(domain)
+		if !ok || domain == "" {
+			return nil, fmt.Errorf("invalid domain rule %q (want domain=delay[/parallelism])", part)
+		}
+		delaySpec, parallelSpec, hasParallel := strings.Cut(spec, "/")
+		delay, err := time.ParseDuration(strings.TrimSpace(delaySpec))
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid delay in domain rule %q", part)
+		}
+		rule := DomainRule{Domain: domain, Delay: delay}
+		if hasParallel {
+			rule.Parallelism, err = strconv.Atoi(strings.TrimSpace(parallelSpec))
+			if err != nil || rule.Parallelism <= 0 {
+				return nil, fmt.Errorf("invalid parallelism in domain rule %q", part)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// domainMatches は host が domain またはそのサブドメインなら true を返す
+func domainMatches(host, domain string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domain = normalizeDomain(domain)
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+// robotsTTL は robots.txt をキャッシュする期間
+const robotsTTL = 24 * time.Hour
+
+// robots.txt の取得の制限時間
+const robotsTimeout = 10 * time.Second
+
+// Politeness はホストごとの robots.txt のキャッシュと、最後にリクエストした時刻を持つ
+//
+// ProductScraper はスクレイピングのたびにコレクターを作るため、間隔の管理をコレクターに任せると
+// 続けて実行したスクレイピング (価格監視の商品ごとの取得など) の間で間隔が空かない。
+// 1つの Politeness を ScraperConfig で共有すると、同じホストへの間隔をプロセス全体で守れる。
+type Politeness struct {
+	// Client は robots.txt の取得に使う。nil なら ProductScraper と同じ接続先の制限 (ScraperConfig.AllowPrivateAddresses) で取得する
+	Client *http.Client
+
+	mu     sync.Mutex
+	robots map[string]robotsEntry // "scheme://host" → robots.txt
+	next   map[string]time.Time   // ホスト → 次にリクエストしてよい時刻
+}
+
+type robotsEntry struct {
+	data      *robotstxt.RobotsData
+	fetchedAt time.Time
+}
+
+// NewPoliteness は空の Politeness を作成する
+func NewPoliteness() *Politeness {
+	return &Politeness{robots: map[string]robotsEntry{}, next: map[string]time.Time{}}
+}
+
+// Robots は u のホストの robots.txt を返す (robotsTTL の間はキャッシュを使う)
+//
+// robots.txt が 4xx なら全て許可、5xx なら全て禁止とみなす。書式が壊れている場合も全て許可とみなす。
+func (p *Politeness) Robots(ctx context.Context, u *url.URL, userAgent string) (*robotstxt.RobotsData, error) {
+	return p.robotsVia(ctx, u, userAgent, nil)
+}
+
+// robotsVia は Robots と同じだが、Client が nil なら transport で取得する (transport も nil なら http.DefaultClient)
+func (p *Politeness) robotsVia(ctx context.Context, u *url.URL, userAgent string, transport http.RoundTripper) (*robotstxt.RobotsData, error) {
+	key := u.Scheme + "://" + u.Host
+	p.mu.Lock()
+	entry, ok := p.robots[key]
+	p.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < robotsTTL {
+		return entry.data, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, robotsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, key+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	client := p.Client
+	if client == nil && transport != nil {
+		client = &http.Client{Transport: transport}
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch robots.txt: %w", err)
+	}
+	defer res.Body.Close()
+	data, err := robotstxt.FromResponse(res)
+	var parseErr *robotstxt.ParseError
+	if errors.As(err, &parseErr) {
+		log.Printf("robots.txt of %s is malformed; treating as allow-all: %v", u.Host, err)
+		data, err = robotstxt.FromStatusAndBytes(http.StatusNotFound, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("robots.txt: %w", err)
+	}
+
+	p.mu.Lock()
+	p.robots[key] = robotsEntry{data: data, fetchedAt: time.Now()}
+	p.mu.Unlock()
+	return data, nil
+}
+
+// Wait は host への前回のリクエストから delay が経つまで待ち、次のリクエストの時刻を予約する
+// 並行して呼んでも delay ずつずれた時刻に順番に戻る。ctx が終わればそのエラーを返す
+func (p *Politeness) Wait(ctx context.Context, host string, delay time.Duration) error {
+	p.mu.Lock()
+	now := time.Now()
+	at := now
+	if next, ok := p.next[host]; ok && next.After(now) {
+		at = next
+	}
+	p.next[host] = at.Add(delay)
+	p.mu.Unlock()
+
+	if wait := at.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// rule は host に適用する規則を返す (一致する DomainRule のうち最も長いドメイン、無ければ既定)
+func (c *ScraperConfig) rule(host string) DomainRule {
+	rule := DomainRule{Delay: c.Delay, Parallelism: c.Parallelism}
+	matched := ""
+	for _, r := range c.DomainRules {
+		if domainMatches(host, r.Domain) && len(r.Domain) > len(matched) {
+			matched = r.Domain
+			rule.Domain = r.Domain
+			rule.Delay = r.Delay
+			if r.Parallelism > 0 {
+				rule.Parallelism = r.Parallelism
+			}
+		}
+	}
+	return rule
+}
+
+// denied は host が DenyDomains にあれば true を返す
+func (c *ScraperConfig) denied(host string) bool {
+	for _, d := range c.DenyDomains {
+		if domainMatches(host, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed は u を取得してよいかを内部のアドレス・拒否リスト・robots.txt で確認し、空けるべき間隔を返す
+// 間隔はドメインの規則と robots.txt の Crawl-delay の長い方
+func (ps *ProductScraper) allowed(ctx context.Context, u *url.URL) (time.Duration, error) {
+	host := u.Hostname()
+	if !ps.config.AllowPrivateAddresses {
+		if err := netguard.CheckURL(u); err != nil {
+			return 0, fmt.Errorf("%s: %w", host, err)
+		}
+	}
+	if ps.config.denied(host) {
+		return 0, fmt.Errorf("%s: %w", host, ErrDeniedDomain)
+	}
+	delay := ps.config.rule(host).Delay
+	if ps.config.IgnoreRobotsTxt {
+		return delay, nil
+	}
+	robots, err := ps.config.Politeness.robotsVia(ctx, u, ps.config.UserAgent, ps.transport)
+	if err != nil {
+		return 0, err
+	}
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if !robots.TestAgent(path, ps.config.UserAgent) {
+		return 0, fmt.Errorf("%s: %w", u, ErrDisallowedByRobots)
+	}
+	if d := robots.FindGroup(ps.config.UserAgent).CrawlDelay; d > delay {
+		delay = d
+	}
+	return delay, nil
+}
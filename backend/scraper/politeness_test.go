@@ -0,0 +1,283 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// robotsServer は /robots.txt に robotsTxt を返し、受けたリクエストを記録するサーバー
+type robotsServer struct {
+	*httptest.Server
+	mu           sync.Mutex
+	robotsHits   int
+	visited      []string
+	userAgents   []string
+	robotsTxt    string
+	robotsStatus int
+}
+
+func newRobotsServer(t *testing.T, robotsTxt string) *robotsServer {
+	t.Helper()
+	s := &robotsServer{robotsTxt: robotsTxt}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.userAgents = append(s.userAgents, r.UserAgent())
+		if r.URL.Path == "/robots.txt" {
+			s.robotsHits++
+			if s.robotsStatus != 0 {
+				w.WriteHeader(s.robotsStatus)
+			}
+			fmt.Fprint(w, s.robotsTxt)
+			return
+		}
+		s.visited = append(s.visited, r.URL.RequestURI())
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><body><div class="product-item"><span class="product-name">茶</span><span class="product-price">¥100</span></div>
+<a class="next-page" href="/private/list">次へ</a></body></html>`)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestScrapeRespectsRobotsTxt(t *testing.T) {
+	server := newRobotsServer(t, "User-agent: *\nDisallow: /private/\n")
+	ps := newTestScraper()
+
+	products, err := ps.Scrape(context.Background(), server.URL+"/list", ExampleSelectors(), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 {
+		t.Errorf("got %d products, want 1", len(products))
+	}
+	// 禁止されたページへのリンクはたどらない
+	if len(server.visited) != 1 || server.visited[0] != "/list" {
+		t.Errorf("visited %v, want only /list", server.visited)
+	}
+	for _, ua := range server.userAgents {
+		if ua != DefaultUserAgent {
+			t.Errorf("User-Agent = %q, want %q", ua, DefaultUserAgent)
+		}
+	}
+
+	// 最初のページが禁止されていればエラー
+	_, err = ps.Scrape(context.Background(), server.URL+"/private/list", ExampleSelectors(), Limits{})
+	if !errors.Is(err, ErrDisallowedByRobots) {
+		t.Errorf("err = %v, want ErrDisallowedByRobots", err)
+	}
+	if server.robotsHits != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1 (cached)", server.robotsHits)
+	}
+}
+
+// TestScrapeRobotsTxtForAgent は自分の名前のグループが * より優先されることのテスト
+func TestScrapeRobotsTxtForAgent(t *testing.T) {
+	server := newRobotsServer(t, "User-agent: *\nAllow: /\n\nUser-agent: KakeiboBot\nDisallow: /\n")
+	_, err := newTestScraper().Scrape(context.Background(), server.URL+"/list", ExampleSelectors(), Limits{})
+	if !errors.Is(err, ErrDisallowedByRobots) {
+		t.Errorf("err = %v, want ErrDisallowedByRobots", err)
+	}
+
+	config := DefaultConfig()
+	config.CacheDir = ""
+	config.IgnoreRobotsTxt = true
+	config.AllowPrivateAddresses = true
+	if _, err := NewProductScraper(config).Scrape(context.Background(), server.URL+"/list", ExampleSelectors(), Limits{MaxPages: 1}); err != nil && !isStop(err) {
+		t.Errorf("IgnoreRobotsTxt: err = %v", err)
+	}
+}
+
+func TestScrapeRobotsTxtUnavailable(t *testing.T) {
+	// 5xx は一時的に全て禁止とみなす
+	server := newRobotsServer(t, "")
+	server.robotsStatus = http.StatusServiceUnavailable
+	_, err := newTestScraper().Scrape(context.Background(), server.URL+"/list", ExampleSelectors(), Limits{})
+	if !errors.Is(err, ErrDisallowedByRobots) {
+		t.Errorf("5xx: err = %v, want ErrDisallowedByRobots", err)
+	}
+
+	// 4xx は robots.txt が無いものとして全て許可する
+	server = newRobotsServer(t, "")
+	server.robotsStatus = http.StatusNotFound
+	if _, err := newTestScraper().Scrape(context.Background(), server.URL+"/list", ExampleSelectors(), Limits{MaxPages: 1}); err != nil && !isStop(err) {
+		t.Errorf("404: err = %v", err)
+	}
+}
+
+// TestScrapeCrawlDelay は Crawl-delay が同じ Politeness を使うスクレイピングの間でも守られることのテスト
+func TestScrapeCrawlDelay(t *testing.T) {
+	server := newRobotsServer(t, "User-agent: *\nCrawl-delay: 0.2\n")
+	config := DefaultConfig()
+	config.Delay = 0
+	config.CacheDir = ""
+	config.Politeness = NewPoliteness()
+	config.AllowPrivateAddresses = true
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := NewProductScraper(config).Scrape(context.Background(), server.URL+"/list", ExampleSelectors(), Limits{MaxPages: 1}); err != nil && !isStop(err) {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("3 requests took %v, want at least 2 crawl delays", elapsed)
+	}
+	if server.robotsHits != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1", server.robotsHits)
+	}
+}
+
+func TestScrapeDenyDomains(t *testing.T) {
+	server := newRobotsServer(t, "")
+	u, _ := url.Parse(server.URL)
+	config := DefaultConfig()
+	config.CacheDir = ""
+	config.DenyDomains = []string{u.Hostname()}
+	config.AllowPrivateAddresses = true
+
+	_, err := NewProductScraper(config).Scrape(context.Background(), server.URL+"/list", ExampleSelectors(), Limits{})
+	if !errors.Is(err, ErrDeniedDomain) {
+		t.Errorf("err = %v, want ErrDeniedDomain", err)
+	}
+	if server.robotsHits != 0 || len(server.visited) != 0 {
+		t.Errorf("denied domain was contacted: robots %d, pages %v", server.robotsHits, server.visited)
+	}
+}
+
+// TestScrapeRedirectChecks はリダイレクト先も拒否リストと robots.txt で確認することのテスト
+func TestScrapeRedirectChecks(t *testing.T) {
+	redirectTo := func(target string) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/list" {
+				http.Redirect(w, r, target, http.StatusFound)
+				return
+			}
+			http.NotFound(w, r)
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+	config := DefaultConfig()
+	config.Delay = 0
+	config.CacheDir = ""
+	config.AllowPrivateAddresses = true
+
+	// 拒否リストのドメイン (localhost) へのリダイレクト
+	denied := newRobotsServer(t, "")
+	u, _ := url.Parse(denied.URL)
+	origin := redirectTo("http://localhost:" + u.Port() + "/list")
+	config.DenyDomains = []string{"localhost"}
+	products, err := NewProductScraper(config).Scrape(context.Background(), origin.URL+"/list", ExampleSelectors(), Limits{})
+	if len(products) != 0 || (err != nil && !errors.Is(err, ErrDeniedDomain)) {
+		t.Errorf("deny list: products = %+v, err = %v", products, err)
+	}
+	if denied.robotsHits != 0 || len(denied.visited) != 0 {
+		t.Errorf("denied domain was contacted: robots %d, pages %v", denied.robotsHits, denied.visited)
+	}
+
+	// robots.txt で禁止されたページへのリダイレクト
+	disallowed := newRobotsServer(t, "User-agent: *\nDisallow: /\n")
+	origin = redirectTo(disallowed.URL + "/list")
+	config.DenyDomains = nil
+	products, err = NewProductScraper(config).Scrape(context.Background(), origin.URL+"/list", ExampleSelectors(), Limits{})
+	if len(products) != 0 || (err != nil && !errors.Is(err, ErrDisallowedByRobots)) {
+		t.Errorf("robots.txt: products = %+v, err = %v", products, err)
+	}
+	if disallowed.robotsHits != 1 || len(disallowed.visited) != 0 {
+		t.Errorf("disallowed page was fetched: robots %d, pages %v", disallowed.robotsHits, disallowed.visited)
+	}
+}
+
+func TestParseDomainRules(t *testing.T) {
+	rules, err := ParseDomainRules(" Example.com=5s, shop.example.jp=1m30s/2 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DomainRule{
+		{Domain: "example.com", Delay: 5 * time.Second},
+		{Domain: "shop.example.jp", Delay: 90 * time.Second, Parallelism: 2},
+	}
+	if fmt.Sprint(rules) != fmt.Sprint(want) {
+		t.Errorf("got %+v, want %+v", rules, want)
+	}
+
+	for _, s := range []string{"example.com", "=5s", "example.com=fast", "example.com=-1s", "example.com=1s/0", "example.com/a=1s"} {
+		if _, err := ParseDomainRules(s); err == nil {
+			t.Errorf("ParseDomainRules(%q) should fail", s)
+		}
+	}
+}
+
+func TestConfigRule(t *testing.T) {
+	config := ScraperConfig{
+		Delay:       2 * time.Second,
+		Parallelism: 1,
+		DomainRules: []DomainRule{
+			{Domain: "example.com", Delay: 5 * time.Second},
+			{Domain: "shop.example.com", Delay: 10 * time.Second, Parallelism: 3},
+		},
+		DenyDomains: []string{"blocked.example"},
+	}
+	cases := []struct {
+		host  string
+		delay time.Duration
+		par   int
+	}{
+		{"example.com", 5 * time.Second, 1},
+		{"www.example.com", 5 * time.Second, 1},
+		{"sale.shop.example.com", 10 * time.Second, 3},
+		{"notexample.com", 2 * time.Second, 1},
+	}
+	for _, c := range cases {
+		if r := config.rule(c.host); r.Delay != c.delay || r.Parallelism != c.par {
+			t.Errorf("rule(%q) = %+v", c.host, r)
+		}
+	}
+	if !config.denied("cdn.blocked.example") || config.denied("blocked.example.com") {
+		t.Error("DenyDomains should match the domain and its subdomains only")
+	}
+}
+
+func TestPolitenessWait(t *testing.T) {
+	p := NewPoliteness()
+	delay := 50 * time.Millisecond
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Wait(context.Background(), "a.example", delay); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// 別のホストは待たない
+	if err := p.Wait(context.Background(), "b.example", delay); err != nil || time.Since(start) > delay {
+		t.Errorf("other host waited: %v, %v", err, time.Since(start))
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 2*delay {
+		t.Errorf("3 concurrent waits took %v, want at least %v", elapsed, 2*delay)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Wait(ctx, "c.example", time.Hour)
+	if err := p.Wait(ctx, "c.example", time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func isStop(err error) bool {
+	var stop *StopError
+	return errors.As(err, &stop)
+}
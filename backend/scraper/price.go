@@ -0,0 +1,158 @@
+package scraper
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// ErrNoPrice は文字列に金額が含まれない場合のエラー (「オープン価格」など)
+var ErrNoPrice = errors.New("no price found")
+
+// Price は商品の価格表記を解釈した結果
+type Price struct {
+	// Amount は通貨の最小単位での金額 (円なら円、USD ならセント)
+	Amount int64 `json:"amount"`
+	// Currency は ISO 4217 の通貨コード。記号が無ければ JPY とみなす
+	Currency string `json:"currency"`
+	// TaxIncluded は税込なら true、税抜なら false。表記が無ければ nil
+	TaxIncluded *bool `json:"tax_included"`
+}
+
+// 通貨の記号・表記と通貨コード。長い表記から照合する
+var currencySymbols = []struct {
+	symbol   string
+	currency string
+}{
+	{"JPY", "JPY"},
+	{"USD", "USD"},
+	{"EUR", "EUR"},
+	{"US$", "USD"},
+	{"円", "JPY"},
+	{"¥", "JPY"},
+	{"$", "USD"},
+	{"€", "EUR"},
+}
+
+// 小数点以下の桁数 (最小単位に換算する)
+var currencyDecimals = map[string]int{"JPY": 0, "USD": 2, "EUR": 2}
+
+// 税込・税抜の表記
+var taxMarkers = []struct {
+	marker   string
+	included bool
+}{
+	{"税抜", false},
+	{"税別", false},
+	{"本体価格", false},
+	{"tax excluded", false},
+	{"excl. tax", false},
+	{"税込", true},
+	{"内税", true},
+	{"tax included", true},
+	{"incl. tax", true},
+}
+
+// ParsePrice は "¥1,280（税込）" や "1,280円 (税抜)" のような価格表記を解釈する
+//
+// 全角の数字・記号は半角として扱う。金額が複数ある場合 ("¥1,280〜¥2,000" など) は最初の金額を使い、
+// 税込・税抜はその金額の直後の表記、無ければ直前の最も近い表記で判定する。
+func ParsePrice(raw string) (Price, error) {
+	s := width.Fold.String(raw)
+	start, end := findNumber(s)
+	if start < 0 {
+		return Price{}, ErrNoPrice
+	}
+
+	currency := detectCurrency(s)
+	amount, err := parseAmount(s[start:end], currencyDecimals[currency])
+	if err != nil {
+		return Price{}, err
+	}
+
+	price := Price{Amount: amount, Currency: currency}
+	// 次の金額までを、この金額の表記とみなす
+	rest := s[end:]
+	if next, _ := findNumber(rest); next >= 0 {
+		rest = rest[:next]
+	}
+	if included, ok := nearestTax(rest, false); ok {
+		price.TaxIncluded = &included
+	} else if included, ok := nearestTax(s[:start], true); ok {
+		price.TaxIncluded = &included
+	}
+	return price, nil
+}
+
+// findNumber は最初の数字列 (桁区切りのカンマと小数点を含む) の範囲を返す。無ければ -1
+func findNumber(s string) (start, end int) {
+	start = strings.IndexFunc(s, func(r rune) bool { return r >= '0' && r <= '9' })
+	if start < 0 {
+		return -1, -1
+	}
+	end = start
+	for end < len(s) {
+		c := s[end]
+		if c >= '0' && c <= '9' {
+			end++
+			continue
+		}
+		// 数字に挟まれたカンマ・小数点だけを含める
+		if (c == ',' || c == '.') && end+1 < len(s) && s[end+1] >= '0' && s[end+1] <= '9' {
+			end++
+			continue
+		}
+		break
+	}
+	return start, end
+}
+
+func parseAmount(number string, decimals int) (int64, error) {
+	number = strings.ReplaceAll(number, ",", "")
+	whole, frac, _ := strings.Cut(number, ".")
+	amount, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < decimals; i++ {
+		amount *= 10
+		if i < len(frac) {
+			amount += int64(frac[i] - '0')
+		}
+	}
+	return amount, nil
+}
+
+func detectCurrency(s string) string {
+	upper := strings.ToUpper(s)
+	for _, c := range currencySymbols {
+		if strings.Contains(upper, c.symbol) {
+			return c.currency
+		}
+	}
+	return "JPY"
+}
+
+// nearestTax は s の中の税込・税抜の表記を探す
+// fromEnd なら末尾に最も近い表記、そうでなければ先頭に最も近い表記を使う
+func nearestTax(s string, fromEnd bool) (included bool, ok bool) {
+	lower := strings.ToLower(s)
+	best := -1
+	for _, m := range taxMarkers {
+		var i int
+		if fromEnd {
+			i = strings.LastIndex(lower, m.marker)
+		} else {
+			i = strings.Index(lower, m.marker)
+		}
+		if i < 0 {
+			continue
+		}
+		if best < 0 || (fromEnd && i > best) || (!fromEnd && i < best) {
+			best, included, ok = i, m.included, true
+		}
+	}
+	return included, ok
+}
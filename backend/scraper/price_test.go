@@ -0,0 +1,52 @@
+package scraper
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	yes, no := true, false
+	cases := []struct {
+		raw      string
+		amount   int64
+		currency string
+		tax      *bool
+	}{
+		{"¥1,280（税込）", 1280, "JPY", &yes},
+		{"￥１，２８０（税込）", 1280, "JPY", &yes},
+		{"1,280円 (税抜)", 1280, "JPY", &no},
+		{"1,280円", 1280, "JPY", nil},
+		{"本体価格 980円", 980, "JPY", &no},
+		{"税抜価格 (税込 1,408円)", 1408, "JPY", &yes},
+		{"1,408円(税込) / 1,280円(税抜)", 1408, "JPY", &yes},
+		{"¥1,280 〜 ¥2,000", 1280, "JPY", nil},
+		{"価格: 3,300円 税込", 3300, "JPY", &yes},
+		{"$12.99", 1299, "USD", nil},
+		{"US$ 5.5", 550, "USD", nil},
+	}
+	for _, tc := range cases {
+		got, err := ParsePrice(tc.raw)
+		if err != nil {
+			t.Errorf("%q: %v", tc.raw, err)
+			continue
+		}
+		if got.Amount != tc.amount || got.Currency != tc.currency {
+			t.Errorf("%q: got %d %s, want %d %s", tc.raw, got.Amount, got.Currency, tc.amount, tc.currency)
+		}
+		switch {
+		case tc.tax == nil && got.TaxIncluded != nil:
+			t.Errorf("%q: tax_included = %v, want nil", tc.raw, *got.TaxIncluded)
+		case tc.tax != nil && (got.TaxIncluded == nil || *got.TaxIncluded != *tc.tax):
+			t.Errorf("%q: tax_included = %v, want %v", tc.raw, got.TaxIncluded, *tc.tax)
+		}
+	}
+}
+
+func TestParsePriceNoPrice(t *testing.T) {
+	for _, raw := range []string{"", "オープン価格", "売り切れ"} {
+		if _, err := ParsePrice(raw); !errors.Is(err, ErrNoPrice) {
+			t.Errorf("%q: err = %v, want ErrNoPrice", raw, err)
+		}
+	}
+}
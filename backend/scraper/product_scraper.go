@@ -1,12 +1,22 @@
 package scraper
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"kakeibo-backend/netguard"
 	"log"
+	"mime"
+	"net/http"
+	neturl "net/url"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/html/charset"
 )
 
 // Product はスクレイピングで取得する商品情報
@@ -17,22 +27,38 @@ type Product struct {
 	ImageURL    string    `json:"image_url"`
 	Description string    `json:"description"`
 	ScrapedAt   time.Time `json:"scraped_at"`
+	// 以下は構造化データ (ExtractStructured) から取得した場合のみ
+	Currency     string `json:"currency,omitempty"`     // ISO 4217 の通貨コード
+	Availability string `json:"availability,omitempty"` // schema.org の在庫状況 ("InStock" など)
+	GTIN         string `json:"gtin,omitempty"`         // GTIN (JAN コードなど)
 }
 
 // ScraperConfig はスクレイパーの設定
 type ScraperConfig struct {
 	AllowedDomains []string      // 許可するドメイン
-	UserAgent      string        // User-Agent
-	Delay          time.Duration // リクエスト間隔
+	UserAgent      string        // User-Agent (robots.txt の照合にも使う)
+	Delay          time.Duration // 同じホストへのリクエスト間隔
 	Parallelism    int           // 並行リクエスト数
 	CacheDir       string        // キャッシュディレクトリ
+	// DomainRules はドメインごとに Delay / Parallelism を変える規則
+	DomainRules []DomainRule
+	// DenyDomains は取得しないドメイン (サブドメインを含む)
+	DenyDomains []string
+	// IgnoreRobotsTxt が true なら robots.txt を確認しない (テスト用)
+	IgnoreRobotsTxt bool
+	// AllowPrivateAddresses が true なら内部のアドレス (ループバック・プライベートなど) にも接続する (テスト用)
+	// false なら URL はユーザーが指定するため、netguard で内部のホストへの接続を断る (リダイレクト先・名前解決の結果も)
+	AllowPrivateAddresses bool
+	// Politeness は robots.txt のキャッシュと間隔の管理。複数の ProductScraper で共有できる
+	// nil なら NewProductScraper が作成する
+	Politeness *Politeness
 }
 
 // DefaultConfig はデフォルト設定を返す
 func DefaultConfig() *ScraperConfig {
 	return &ScraperConfig{
 		AllowedDomains: []string{},
-		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		UserAgent:      DefaultUserAgent,
 		Delay:          2 * time.Second,
 		Parallelism:    1,
 		CacheDir:       "./cache",
@@ -40,148 +66,394 @@ func DefaultConfig() *ScraperConfig {
 }
 
 // ProductScraper は商品情報をスクレイピングする
+//
+// 設定だけを持ち、スクレイピングのたびに専用のコレクターと結果を用意するため、
+// 1つの ProductScraper を複数のゴルーチン (API サーバーのリクエストなど) で共有して同時に使える。
 type ProductScraper struct {
-	collector *colly.Collector
-	config    *ScraperConfig
-	products  []Product
+	config ScraperConfig
+	// transport はページと robots.txt の取得に使う。nil なら http.DefaultTransport
+	transport http.RoundTripper
 }
 
 // NewProductScraper は新しいProductScraperを作成
+// config は複製して保持するため、作成後に変更しても影響しない
 func NewProductScraper(config *ScraperConfig) *ProductScraper {
 	if config == nil {
 		config = DefaultConfig()
 	}
+	c := config.clone()
+	if c.Politeness == nil {
+		c.Politeness = NewPoliteness()
+	}
+	ps := &ProductScraper{config: c}
+	if !c.AllowPrivateAddresses {
+		ps.transport = netguard.Transport()
+	}
+	return ps
+}
+
+// Config は設定の複製を返す (Politeness は共有する)
+func (ps *ProductScraper) Config() ScraperConfig {
+	return ps.config.clone()
+}
+
+func (c *ScraperConfig) clone() ScraperConfig {
+	clone := *c
+	clone.AllowedDomains = append([]string(nil), c.AllowedDomains...)
+	clone.DomainRules = append([]DomainRule(nil), c.DomainRules...)
+	clone.DenyDomains = append([]string(nil), c.DenyDomains...)
+	return clone
+}
+
+// Selectors は商品の抽出に使うセレクタ
+type Selectors struct {
+	Item        string `json:"item" yaml:"item"`               // 商品1件を囲む要素 (必須)
+	Name        string `json:"name" yaml:"name"`               // 商品名 (必須。空の商品は除く)
+	Price       string `json:"price" yaml:"price"`             // 価格
+	Link        string `json:"link" yaml:"link"`               // 商品ページへのリンク (href)
+	Image       string `json:"image" yaml:"image"`             // 画像 (src)
+	Description string `json:"description" yaml:"description"` // 説明
+	// NextPage は次のページへのリンク (href)。空ならページネーションを辿らない
+	NextPage string `json:"next_page" yaml:"next_page"`
+}
+
+// ExampleSelectors は ScrapeExample が使うセレクタ
+func ExampleSelectors() Selectors {
+	return Selectors{
+		Item:        ".product-item",
+		Name:        ".product-name",
+		Price:       ".product-price",
+		Link:        "a",
+		Image:       "img",
+		Description: ".product-description",
+		NextPage:    "a.next-page",
+	}
+}
+
+// maxRedirects は1回のリクエストで辿るリダイレクトの上限 (net/http の既定と同じ)
+const maxRedirects = 10
 
+// newCollector は1回のスクレイピング専用のコレクターを作成する
+// ctx がキャンセルされると実行中のリクエストも中断する
+func (ps *ProductScraper) newCollector(ctx context.Context) *colly.Collector {
 	c := colly.NewCollector(
-		colly.UserAgent(config.UserAgent),
-		colly.CacheDir(config.CacheDir),
+		colly.UserAgent(ps.config.UserAgent),
+		colly.CacheDir(ps.config.CacheDir),
 		colly.Async(true),
+		colly.StdlibContext(ctx),
 	)
+	if ps.transport != nil {
+		c.WithTransport(ps.transport)
+	}
+	// colly はリダイレクト先には OnRequest を呼ばないため、リダイレクトのたびに
+	// OnRequest と同じく拒否リスト・robots.txt を確認し、同じホストへの間隔を空ける
+	c.SetRedirectHandler(func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		delay, err := ps.allowed(ctx, req.URL)
+		if err == nil {
+			err = ps.config.Politeness.Wait(ctx, req.URL.Host, delay)
+		}
+		if err != nil {
+			log.Printf("Not following redirect to %s: %v", req.URL, err)
+			return err
+		}
+		return nil
+	})
 
-	// レート制限設定
+	// 並行数の制限 (先に追加した規則が優先される)
+	// 間隔はスクレイピングをまたいで守るため、コレクターではなく Politeness で空ける
+	for _, r := range ps.config.DomainRules {
+		if r.Parallelism <= 0 {
+			continue
+		}
+		domain := normalizeDomain(r.Domain)
+		for _, glob := range []string{domain, "*." + domain} {
+			c.Limit(&colly.LimitRule{DomainGlob: glob, Parallelism: r.Parallelism})
+		}
+	}
 	c.Limit(&colly.LimitRule{
 		DomainGlob:  "*",
-		Parallelism: config.Parallelism,
-		Delay:       config.Delay,
+		Parallelism: ps.config.Parallelism,
 	})
 
-	if len(config.AllowedDomains) > 0 {
-		c.AllowedDomains = config.AllowedDomains
+	if len(ps.config.AllowedDomains) > 0 {
+		c.AllowedDomains = append([]string(nil), ps.config.AllowedDomains...)
+	}
+	return c
+}
+
+// crawl は1回のスクレイピングの状態
+// コレクターのコールバックは並行して呼ばれるため、ロックして更新する
+type crawl struct {
+	limits Limits
+
+	mu       sync.Mutex
+	products []Product
+	pages    int
+	// reason は上限に達して止めた理由 (上限に達していなければ空)
+	reason StopReason
+}
+
+// startPage はページを取得してよければ true を返す
+func (c *crawl) startPage() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reason != "" {
+		return false
+	}
+	if c.pages >= c.limits.MaxPages {
+		c.reason = StopMaxPages
+		return false
 	}
+	c.pages++
+	return true
+}
 
-	return &ProductScraper{
-		collector: c,
-		config:    config,
-		products:  []Product{},
+// add は商品を追加する。上限に達していれば追加せずに止める
+func (c *crawl) add(p Product) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reason == StopMaxItems {
+		return
+	}
+	if len(c.products) >= c.limits.MaxItems {
+		c.reason = StopMaxItems
+		return
 	}
+	c.products = append(c.products, p)
 }
 
-// ScrapeExample は例としてシンプルなスクレイピングを実行
-// 実際のサイトに合わせてセレクタを変更してください
-func (ps *ProductScraper) ScrapeExample(url string) ([]Product, error) {
-	ps.products = []Product{}
+// stopped は上限に達していれば true を返す
+func (c *crawl) stopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason != ""
+}
 
-	// リクエスト前のログ
-	ps.collector.OnRequest(func(r *colly.Request) {
-		log.Printf("Visiting: %s", r.URL.String())
-	})
+// result は取得した商品と、途中で止まった場合は *StopError を返す
+func (c *crawl) result(ctx context.Context) ([]Product, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	products := append([]Product{}, c.products...)
+	stop := &StopError{Reason: c.reason}
+	// 上限に達したことより、キャンセル・期限切れを優先して報告する
+	if err := ctx.Err(); err != nil {
+		stop = contextStop(err)
+	}
+	if stop.Reason == "" {
+		return products, nil
+	}
+	stop.Pages = c.pages
+	stop.Items = len(products)
+	return products, stop
+}
 
-	// エラーハンドリング
-	ps.collector.OnError(func(r *colly.Response, err error) {
-		log.Printf("Error visiting %s: %v", r.Request.URL, err)
-	})
+// contextStop は context のエラーを StopError にする
+func contextStop(err error) *StopError {
+	reason := StopCanceled
+	if errors.Is(err, context.DeadlineExceeded) {
+		reason = StopDeadline
+	}
+	return &StopError{Reason: reason, Err: err}
+}
 
-	// HTMLから商品情報を抽出
-	// 注意: これは例です。実際のサイトに合わせてセレクタを変更してください
-	ps.collector.OnHTML(".product-item", func(e *colly.HTMLElement) {
-		product := Product{
-			Name:        strings.TrimSpace(e.ChildText(".product-name")),
-			Price:       strings.TrimSpace(e.ChildText(".product-price")),
-			URL:         e.Request.AbsoluteURL(e.ChildAttr("a", "href")),
-			ImageURL:    e.ChildAttr("img", "src"),
-			Description: strings.TrimSpace(e.ChildText(".product-description")),
-			ScrapedAt:   time.Now(),
-		}
+// Scrape は url から sel で商品を抽出する
+//
+// limits の上限に達した場合、ctx がキャンセルされた場合、制限時間を過ぎた場合は、
+// それまでに取得した商品と *StopError を返す。最初のページを取得できない場合はエラーのみを返す。
+func (ps *ProductScraper) Scrape(ctx context.Context, url string, sel Selectors, limits Limits) ([]Product, error) {
+	return ps.ScrapeSite(ctx, url, SiteProfile{Selectors: sel}, limits)
+}
 
-		// 空のデータは追加しない
-		if product.Name != "" {
-			ps.products = append(ps.products, product)
-			log.Printf("Found product: %s - %s", product.Name, product.Price)
-		}
-	})
+// ScrapeSite は url から profile のセレクタで商品を抽出する
+// Scrape と異なり、profile の PricePattern で価格を切り出し、Encoding で本文を読む
+// (Domains は見ないため、Registry.Lookup で選んだ profile を渡す)
+func (ps *ProductScraper) ScrapeSite(ctx context.Context, url string, profile SiteProfile, limits Limits) ([]Product, error) {
+	pricePattern, err := profile.compilePricePattern()
+	if err != nil {
+		return nil, err
+	}
+	sel := profile.Selectors
+	return ps.run(ctx, url, profile.Encoding, limits, func(collector *colly.Collector, run *crawl) {
+		// HTMLから商品情報を抽出
+		collector.OnHTML(sel.Item, func(e *colly.HTMLElement) {
+			if run.stopped() {
+				return
+			}
+			child := func(selector string) *goquery.Selection {
+				return itemChild(e.DOM, selector, sel.Item)
+			}
+			product := Product{
+				Name:      cleanText(child(sel.Name).Text()),
+				ScrapedAt: time.Now(),
+			}
+			if sel.Price != "" {
+				product.Price = extractPrice(cleanText(child(sel.Price).Text()), pricePattern)
+			}
+			if sel.Link != "" {
+				product.URL = e.Request.AbsoluteURL(child(sel.Link).AttrOr("href", ""))
+			}
+			if sel.Image != "" {
+				product.ImageURL = child(sel.Image).AttrOr("src", "")
+			}
+			if sel.Description != "" {
+				product.Description = cleanText(child(sel.Description).Text())
+			}
+
+			// 空のデータは追加しない
+			if product.Name != "" {
+				run.add(product)
+			}
+		})
 
-	// 次のページへのリンクを辿る(ページネーション)
-	ps.collector.OnHTML("a.next-page", func(e *colly.HTMLElement) {
-		nextPage := e.Attr("href")
-		if nextPage != "" {
-			e.Request.Visit(nextPage)
+		// 次のページへのリンクを辿る(ページネーション)
+		if sel.NextPage != "" {
+			collector.OnHTML(sel.NextPage, func(e *colly.HTMLElement) {
+				nextPage := e.Attr("href")
+				if nextPage != "" && !run.stopped() && ctx.Err() == nil {
+					e.Request.Visit(nextPage)
+				}
+			})
 		}
 	})
+}
+
+// itemChild は商品要素 item の中で selector に一致する最初の要素を返す
+// 閉じタグの欠落などで商品要素が入れ子になっている場合、内側の商品の要素は含めない
+func itemChild(item *goquery.Selection, selector, itemSelector string) *goquery.Selection {
+	return item.Find(selector).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.ParentsUntilSelection(item).Filter(itemSelector).Length() == 0
+	}).First()
+}
 
-	// スクレイピング完了時
-	ps.collector.OnScraped(func(r *colly.Response) {
-		log.Printf("Finished scraping: %s", r.Request.URL)
+// cleanText は前後の空白を除き、改行・タブを含む空白の連続を1つの空白にする (全角の空白はそのまま)
+func cleanText(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f'
+	}), " ")
+}
+
+// ScrapeStructured は url のページに埋め込まれた構造化データ (JSON-LD, microdata, OpenGraph) から商品を抽出する
+// セレクタが分からないサイトに使う。ページネーションは辿らない (詳しくは ExtractStructured)
+func (ps *ProductScraper) ScrapeStructured(ctx context.Context, url string, limits Limits) ([]Product, error) {
+	return ps.run(ctx, url, "", limits, func(collector *colly.Collector, run *crawl) {
+		collector.OnHTML("html", func(e *colly.HTMLElement) {
+			for _, product := range ExtractStructured(e.DOM, e.Request.URL) {
+				if run.stopped() {
+					return
+				}
+				run.add(product)
+			}
+		})
 	})
+}
 
-	// スクレイピング開始
-	err := ps.collector.Visit(url)
+// run は url から取得を始め、setup で登録したコールバックで商品を集める
+// encoding が空なら Content-Type の charset に従う (無ければ UTF-8 とみなす)
+func (ps *ProductScraper) run(ctx context.Context, url string, encoding string, limits Limits, setup func(*colly.Collector, *crawl)) ([]Product, error) {
+	limits = limits.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return nil, contextStop(err)
+	}
+
+	// 最初のページが取得できない場合はエラーを返す
+	start, err := neturl.Parse(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to visit URL: %w", err)
 	}
+	if _, err := ps.allowed(ctx, start); err != nil {
+		if ctx.Err() != nil {
+			return nil, contextStop(ctx.Err())
+		}
+		return nil, err
+	}
 
-	// 非同期処理の完了を待つ
-	ps.collector.Wait()
-
-	return ps.products, nil
-}
-
-// ScrapeWithCustomSelector はカスタムセレクタでスクレイピング
-func (ps *ProductScraper) ScrapeWithCustomSelector(
-	url string,
-	itemSelector string,
-	nameSelector string,
-	priceSelector string,
-	linkSelector string,
-) ([]Product, error) {
-	ps.products = []Product{}
+	collector := ps.newCollector(ctx)
+	run := &crawl{limits: limits}
 
-	ps.collector.OnRequest(func(r *colly.Request) {
+	// 拒否リスト・robots.txt の確認と、同じホストへの間隔を空けてからリクエストする
+	collector.OnRequest(func(r *colly.Request) {
+		if ctx.Err() != nil || !run.startPage() {
+			r.Abort()
+			return
+		}
+		delay, err := ps.allowed(ctx, r.URL)
+		if err == nil {
+			err = ps.config.Politeness.Wait(ctx, r.URL.Host, delay)
+		}
+		if err != nil {
+			log.Printf("Skipping %s: %v", r.URL, err)
+			r.Abort()
+			return
+		}
+		r.ResponseCharacterEncoding = encoding
 		log.Printf("Visiting: %s", r.URL.String())
 	})
 
-	ps.collector.OnError(func(r *colly.Response, err error) {
-		log.Printf("Error: %v", err)
+	// エラーハンドリング
+	collector.OnError(func(r *colly.Response, err error) {
+		log.Printf("Error visiting %s: %v", r.Request.URL, err)
 	})
 
-	// カスタムセレクタで抽出
-	ps.collector.OnHTML(itemSelector, func(e *colly.HTMLElement) {
-		product := Product{
-			Name:      strings.TrimSpace(e.ChildText(nameSelector)),
-			Price:     strings.TrimSpace(e.ChildText(priceSelector)),
-			URL:       e.Request.AbsoluteURL(e.ChildAttr(linkSelector, "href")),
-			ScrapedAt: time.Now(),
-		}
+	// OnHTML より先に呼ばれる
+	if encoding == "" {
+		collector.OnResponse(func(r *colly.Response) {
+			r.Body = decodeByMeta(r.Body, r.Headers.Get("Content-Type"))
+		})
+	}
 
-		if product.Name != "" {
-			ps.products = append(ps.products, product)
+	setup(collector, run)
+
+	// スクレイピング開始
+	if err := collector.Visit(url); err != nil {
+		if ctx.Err() != nil {
+			return run.result(ctx)
 		}
-	})
+		return nil, fmt.Errorf("failed to visit URL: %w", err)
+	}
+
+	// 非同期処理の完了を待つ
+	collector.Wait()
+	return run.result(ctx)
+}
 
-	err := ps.collector.Visit(url)
+// decodeByMeta は Content-Type に charset が無く UTF-8 でもない本文を、
+// <meta charset> (無ければ windows-1252) に従って UTF-8 に変換する
+// colly は Content-Type の charset しか見ないため、<meta> だけで Shift_JIS を宣言するページのために使う
+func decodeByMeta(body []byte, contentType string) []byte {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		return body
+	}
+	if utf8.Valid(body) {
+		return body
+	}
+	enc, _, _ := charset.DetermineEncoding(body, contentType)
+	decoded, err := enc.NewDecoder().Bytes(body)
 	if err != nil {
-		return nil, err
+		return body
 	}
-
-	ps.collector.Wait()
-	return ps.products, nil
+	return decoded
 }
 
-// GetProducts は取得した商品リストを返す
-func (ps *ProductScraper) GetProducts() []Product {
-	return ps.products
+// ScrapeExample は例としてシンプルなスクレイピングを実行
+// ExampleSelectors で抽出し、DefaultLimits の範囲で次のページを辿る
+// 実際のサイトに合わせてセレクタを変更してください
+func (ps *ProductScraper) ScrapeExample(url string) ([]Product, error) {
+	return ps.Scrape(context.Background(), url, ExampleSelectors(), DefaultLimits())
 }
 
-// ClearProducts は商品リストをクリア
-func (ps *ProductScraper) ClearProducts() {
-	ps.products = []Product{}
+// ScrapeWithCustomSelector はカスタムセレクタでスクレイピング (1ページのみ、DefaultLimits の範囲)
+func (ps *ProductScraper) ScrapeWithCustomSelector(
+	url string,
+	itemSelector string,
+	nameSelector string,
+	priceSelector string,
+	linkSelector string,
+) ([]Product, error) {
+	sel := Selectors{Item: itemSelector, Name: nameSelector, Price: priceSelector, Link: linkSelector}
+	return ps.Scrape(context.Background(), url, sel, DefaultLimits())
 }
@@ -1,6 +1,11 @@
 package scraper
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -27,37 +32,112 @@ func TestNewProductScraper(t *testing.T) {
 	scraper := NewProductScraper(nil)
 
 	if scraper == nil {
-		t.Error("Scraper should not be nil")
+		t.Fatal("Scraper should not be nil")
 	}
 
-	if scraper.collector == nil {
-		t.Error("Collector should not be nil")
+	if scraper.Config().UserAgent != DefaultConfig().UserAgent {
+		t.Error("nil config should fall back to DefaultConfig")
 	}
+}
+
+// TestNewProductScraperCopiesConfig は作成後に設定を変更しても影響しないことのテスト
+func TestNewProductScraperCopiesConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.AllowedDomains = []string{"example.com"}
+	scraper := NewProductScraper(config)
+
+	config.UserAgent = "changed"
+	config.AllowedDomains[0] = "evil.example"
 
-	if scraper.config == nil {
-		t.Error("Config should not be nil")
+	got := scraper.Config()
+	if got.UserAgent == "changed" || got.AllowedDomains[0] != "example.com" {
+		t.Errorf("config was shared with caller: %+v", got)
 	}
 }
 
-// TestClearProducts は商品リストのクリアテスト
-func TestClearProducts(t *testing.T) {
-	scraper := NewProductScraper(nil)
+// newTestScraper はテスト用に待機・キャッシュなしのスクレイパーを返す
+func newTestScraper() *ProductScraper {
+	config := DefaultConfig()
+	config.Delay = 0
+	config.CacheDir = ""
+	config.Parallelism = 4
+	config.AllowPrivateAddresses = true
+	return NewProductScraper(config)
+}
 
-	// テストデータを追加
-	scraper.products = []Product{
-		{Name: "Test Product", Price: "1000円"},
-	}
+// newCatalogServer は /list?shop=N で shop N の商品を3件返すサーバー
+func newCatalogServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shop := r.URL.Query().Get("shop")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><body>")
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, `<div class="product-item"><a href="/items/%s-%d"><span class="product-name">shop%s item%d</span></a><span class="product-price">¥%d00</span></div>`,
+				shop, i, shop, i, i)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestRepeatedScrapeDoesNotDuplicate は同じスクレイパーで繰り返し実行しても結果が重複しないことのテスト
+func TestRepeatedScrapeDoesNotDuplicate(t *testing.T) {
+	server := newCatalogServer(t)
+	ps := newTestScraper()
 
-	if len(scraper.GetProducts()) != 1 {
-		t.Error("Should have 1 product")
+	for i := 0; i < 3; i++ {
+		products, err := ps.ScrapeWithCustomSelector(server.URL+"/list?shop=1", ".product-item", ".product-name", ".product-price", "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(products) != 3 {
+			t.Fatalf("run %d: got %d products, want 3", i, len(products))
+		}
+	}
+	products, err := ps.ScrapeExample(server.URL + "/list?shop=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 3 {
+		t.Errorf("ScrapeExample got %d products, want 3", len(products))
 	}
+}
 
-	scraper.ClearProducts()
+// TestConcurrentScrapeIsolated は1つのスクレイパーを並行して使っても結果が混ざらないことのテスト
+// go test -race で実行すること
+func TestConcurrentScrapeIsolated(t *testing.T) {
+	server := newCatalogServer(t)
+	ps := newTestScraper()
 
-	if len(scraper.GetProducts()) != 0 {
-		t.Error("Products should be empty after clear")
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for shop := 1; shop <= 8; shop++ {
+		wg.Add(1)
+		go func(shop int) {
+			defer wg.Done()
+			products, err := ps.ScrapeWithCustomSelector(fmt.Sprintf("%s/list?shop=%d", server.URL, shop), ".product-item", ".product-name", ".product-price", "a")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(products) != 3 {
+				errs <- fmt.Errorf("shop %d: got %d products, want 3", shop, len(products))
+				return
+			}
+			prefix := fmt.Sprintf("shop%d ", shop)
+			for _, p := range products {
+				if !strings.HasPrefix(p.Name, prefix) {
+					errs <- fmt.Errorf("shop %d: got foreign product %q", shop, p.Name)
+					return
+				}
+			}
+		}(shop)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
 	}
 }
-
-// 実際のスクレイピングテストは、テスト用のHTMLサーバーを立てて行うのが望ましい
-// ここでは構造のテストのみ実施
@@ -0,0 +1,260 @@
+package scraper
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"gopkg.in/yaml.v3"
+)
+
+// SiteProfile はサイトごとの抽出方法
+//
+// YAML または JSON で書き、ディレクトリから LoadProfiles で読み込む:
+//
+//	name: example-shop
+//	domains: [shop.example.com]
+//	selectors:
+//	  item: .product-item
+//	  name: .product-name
+//	  price: .product-price
+//	  link: a
+//	  next_page: a.next-page
+//	price_pattern: '販売価格\s*([0-9,]+円)'
+//	encoding: shift_jis
+type SiteProfile struct {
+	Name string `json:"name" yaml:"name"`
+	// Domains はこのプロファイルを使うホスト。サブドメインにも一致する ("example.com" は "www.example.com" にも使う)
+	Domains   []string  `json:"domains" yaml:"domains"`
+	Selectors Selectors `json:"selectors" yaml:"selectors"`
+	// PricePattern は価格の要素のテキストから価格の部分を切り出す正規表現
+	// グループがあれば最初のグループ、無ければ一致した全体を使う。一致しなければ価格は空
+	PricePattern string `json:"price_pattern,omitempty" yaml:"price_pattern"`
+	// Encoding はページの文字コード ("shift_jis", "euc-jp" など)
+	// Content-Type に charset が無い、または誤っているサイトのために指定する。空なら Content-Type に従う
+	Encoding string `json:"encoding,omitempty" yaml:"encoding"`
+}
+
+// Validate はプロファイルの必須項目と正規表現・文字コードを確認する
+func (p SiteProfile) Validate() error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(p.Domains) == 0 {
+		return errors.New("domains is required")
+	}
+	for _, d := range p.Domains {
+		if normalizeDomain(d) == "" {
+			return fmt.Errorf("invalid domain %q", d)
+		}
+	}
+	if p.Selectors.Item == "" || p.Selectors.Name == "" {
+		return errors.New("selectors.item and selectors.name are required")
+	}
+	if _, err := p.compilePricePattern(); err != nil {
+		return err
+	}
+	if p.Encoding != "" {
+		if _, err := htmlindex.Get(p.Encoding); err != nil {
+			return fmt.Errorf("unknown encoding %q", p.Encoding)
+		}
+	}
+	return nil
+}
+
+func (p SiteProfile) compilePricePattern() (*regexp.Regexp, error) {
+	if p.PricePattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(p.PricePattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price_pattern: %w", err)
+	}
+	return re, nil
+}
+
+// extractPrice は pattern で text から価格の部分を切り出す
+func extractPrice(text string, pattern *regexp.Regexp) string {
+	if pattern == nil {
+		return text
+	}
+	m := pattern.FindStringSubmatch(text)
+	switch {
+	case m == nil:
+		return ""
+	case len(m) > 1:
+		return strings.TrimSpace(m[1])
+	default:
+		return strings.TrimSpace(m[0])
+	}
+}
+
+// normalizeDomain は Domains の表記 ("*.example.com", "Example.com." など) をホスト名にそろえる
+func normalizeDomain(d string) string {
+	d = strings.ToLower(strings.TrimSpace(d))
+	d = strings.TrimPrefix(d, "*.")
+	d = strings.TrimSuffix(d, ".")
+	if strings.ContainsAny(d, "/:* ") {
+		return ""
+	}
+	return d
+}
+
+// LoadProfiles は fsys の直下にある *.yaml, *.yml, *.json を読み込む
+// 1ファイルに1プロファイル。name を省略した場合はファイル名 (拡張子を除く) を使う
+func LoadProfiles(fsys fs.FS) ([]SiteProfile, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	profiles := []SiteProfile{}
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := path.Ext(name)
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var p SiteProfile
+		if ext == ".json" {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			err = dec.Decode(&p)
+		} else {
+			dec := yaml.NewDecoder(bytes.NewReader(data))
+			dec.KnownFields(true)
+			err = dec.Decode(&p)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if p.Name == "" {
+			p.Name = strings.TrimSuffix(name, ext)
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+//go:embed profiles
+var builtinProfiles embed.FS
+
+// BuiltinProfiles は scraper/profiles に同梱しているプロファイルを返す
+func BuiltinProfiles() []SiteProfile {
+	sub, err := fs.Sub(builtinProfiles, "profiles")
+	if err != nil {
+		panic(err)
+	}
+	profiles, err := LoadProfiles(sub)
+	if err != nil {
+		panic(fmt.Sprintf("builtin profile: %v", err))
+	}
+	return profiles
+}
+
+// Registry は URL のホストからプロファイルを選ぶ
+// 作成後は変更しないため、複数のゴルーチンから同時に使える
+type Registry struct {
+	profiles []SiteProfile
+	byDomain map[string]int // 正規化したドメイン → profiles の添字
+}
+
+// NewRegistry は profiles の Registry を作成する
+// プロファイルの名前またはドメインが重複している場合はエラー
+func NewRegistry(profiles ...SiteProfile) (*Registry, error) {
+	r := &Registry{byDomain: map[string]int{}}
+	names := map[string]bool{}
+	for _, p := range profiles {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicate profile name %q", p.Name)
+		}
+		names[p.Name] = true
+		for _, d := range p.Domains {
+			d = normalizeDomain(d)
+			if i, ok := r.byDomain[d]; ok {
+				return nil, fmt.Errorf("domain %q is in both %q and %q", d, r.profiles[i].Name, p.Name)
+			}
+			r.byDomain[d] = len(r.profiles)
+		}
+		r.profiles = append(r.profiles, p)
+	}
+	return r, nil
+}
+
+// LoadRegistry は同梱のプロファイルと dir のプロファイルから Registry を作成する
+// dir に同梱のものと同じ名前のプロファイルがあれば置き換える。dir が空なら同梱分のみ
+func LoadRegistry(dir string) (*Registry, error) {
+	profiles := BuiltinProfiles()
+	if dir != "" {
+		custom, err := LoadProfiles(os.DirFS(dir))
+		if err != nil {
+			return nil, err
+		}
+		byName := map[string]int{}
+		for i, p := range profiles {
+			byName[p.Name] = i
+		}
+		for _, p := range custom {
+			if i, ok := byName[p.Name]; ok {
+				profiles[i] = p
+				continue
+			}
+			byName[p.Name] = len(profiles)
+			profiles = append(profiles, p)
+		}
+	}
+	return NewRegistry(profiles...)
+}
+
+// Lookup は rawURL のホストに一致するプロファイルを返す
+// 複数に一致する場合は最も長いドメイン ("shop.example.com" と "example.com" なら前者) を優先する
+func (r *Registry) Lookup(rawURL string) (SiteProfile, bool) {
+	if r == nil {
+		return SiteProfile{}, false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return SiteProfile{}, false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for host != "" {
+		if i, ok := r.byDomain[host]; ok {
+			return r.profiles[i], true
+		}
+		_, rest, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = rest
+	}
+	return SiteProfile{}, false
+}
+
+// Profiles は登録されているプロファイルを名前順に返す
+func (r *Registry) Profiles() []SiteProfile {
+	if r == nil {
+		return []SiteProfile{}
+	}
+	profiles := append([]SiteProfile{}, r.profiles...)
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
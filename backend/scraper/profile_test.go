@@ -0,0 +1,192 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"shop.yaml": {Data: []byte(`
+domains: [shop.example.com]
+selectors:
+  item: .item
+  name: .name
+  price: .price
+price_pattern: '販売価格\s*([0-9,]+円)'
+encoding: shift_jis
+`)},
+		"market.json": {Data: []byte(`{"name": "market", "domains": ["market.example.jp"], "selectors": {"item": "li", "name": "h2", "next_page": "a[rel=next]"}}`)},
+		"README.txt":  {Data: []byte("not a profile")},
+	}
+	profiles, err := LoadProfiles(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("got %d profiles, want 2", len(profiles))
+	}
+	byName := map[string]SiteProfile{}
+	for _, p := range profiles {
+		byName[p.Name] = p
+	}
+	shop, ok := byName["shop"]
+	if !ok {
+		t.Fatalf("name should default to the file name: %+v", profiles)
+	}
+	if shop.Encoding != "shift_jis" || shop.Selectors.Price != ".price" || shop.PricePattern == "" {
+		t.Errorf("shop = %+v", shop)
+	}
+	if byName["market"].Selectors.NextPage != "a[rel=next]" {
+		t.Errorf("market = %+v", byName["market"])
+	}
+}
+
+func TestLoadProfilesInvalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown field":    "domains: [a.example.com]\nselectors: {item: li, name: h2}\nselecter: typo\n",
+		"missing domains":  "selectors: {item: li, name: h2}\n",
+		"missing item":     "domains: [a.example.com]\nselectors: {name: h2}\n",
+		"bad pattern":      "domains: [a.example.com]\nselectors: {item: li, name: h2}\nprice_pattern: '([0-9'\n",
+		"unknown encoding": "domains: [a.example.com]\nselectors: {item: li, name: h2}\nencoding: klingon\n",
+		"domain with path": "domains: [a.example.com/shop]\nselectors: {item: li, name: h2}\n",
+	}
+	for name, data := range cases {
+		if _, err := LoadProfiles(fstest.MapFS{"p.yaml": {Data: []byte(data)}}); err == nil || !strings.Contains(err.Error(), "p.yaml") {
+			t.Errorf("%s: got %v, want an error naming the file", name, err)
+		}
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	sel := Selectors{Item: "li", Name: "h2"}
+	r, err := NewRegistry(
+		SiteProfile{Name: "example", Domains: []string{"example.com"}, Selectors: sel},
+		SiteProfile{Name: "shop", Domains: []string{"*.Shop.Example.com"}, Selectors: sel},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/products", "example"},
+		{"https://www.example.com/products", "example"},
+		{"https://shop.example.com:8443/list", "shop"},
+		{"https://sale.shop.example.com/list", "shop"},
+		{"https://notexample.com/", ""},
+		{"https://example.org/", ""},
+		{"::bad", ""},
+	}
+	for _, c := range cases {
+		p, ok := r.Lookup(c.url)
+		if p.Name != c.want || ok != (c.want != "") {
+			t.Errorf("Lookup(%q) = %q, %v; want %q", c.url, p.Name, ok, c.want)
+		}
+	}
+
+	var empty *Registry
+	if _, ok := empty.Lookup("https://example.com/"); ok {
+		t.Error("nil registry should match nothing")
+	}
+}
+
+func TestNewRegistryRejectsDuplicates(t *testing.T) {
+	sel := Selectors{Item: "li", Name: "h2"}
+	if _, err := NewRegistry(
+		SiteProfile{Name: "a", Domains: []string{"example.com"}, Selectors: sel},
+		SiteProfile{Name: "b", Domains: []string{"EXAMPLE.com."}, Selectors: sel},
+	); err == nil {
+		t.Error("duplicate domain should be an error")
+	}
+	if _, err := NewRegistry(
+		SiteProfile{Name: "a", Domains: []string{"a.example.com"}, Selectors: sel},
+		SiteProfile{Name: "a", Domains: []string{"b.example.com"}, Selectors: sel},
+	); err == nil {
+		t.Error("duplicate name should be an error")
+	}
+}
+
+func TestBuiltinProfiles(t *testing.T) {
+	r, err := LoadRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := r.Lookup("https://example.com/products")
+	if !ok || p.Selectors != ExampleSelectors() {
+		t.Errorf("example profile = %+v, want ExampleSelectors", p)
+	}
+}
+
+func TestLoadRegistryOverridesBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	data := "name: example\ndomains: [example.com]\nselectors: {item: li, name: h2}\n"
+	if err := os.WriteFile(filepath.Join(dir, "example.yml"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := LoadRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := r.Lookup("https://example.com/"); p.Selectors.Item != "li" {
+		t.Errorf("profile in dir should replace the builtin one: %+v", p)
+	}
+	if len(r.Profiles()) != len(BuiltinProfiles()) {
+		t.Errorf("got %d profiles", len(r.Profiles()))
+	}
+}
+
+// TestScrapeSiteEncodingAndPattern は Content-Type に charset が無い Shift_JIS のページを
+// プロファイルの encoding で読み、price_pattern で価格を切り出すテスト
+func TestScrapeSiteEncodingAndPattern(t *testing.T) {
+	page := `<html><body><div class="item"><h2>緑茶</h2><p class="price">通常価格 1,500円 販売価格 1,280円（税込）</p></div></body></html>`
+	body, err := japanese.ShiftJIS.NewEncoder().String(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	profile := SiteProfile{
+		Name:         "tea",
+		Selectors:    Selectors{Item: ".item", Name: "h2", Price: ".price"},
+		PricePattern: `販売価格\s*([0-9,]+円)`,
+		Encoding:     "shift_jis",
+	}
+	products, err := newTestScraper().ScrapeSite(context.Background(), server.URL, profile, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 {
+		t.Fatalf("got %d products, want 1", len(products))
+	}
+	if products[0].Name != "緑茶" || products[0].Price != "1,280円" {
+		t.Errorf("got %+v", products[0])
+	}
+}
+
+func TestExtractPrice(t *testing.T) {
+	if got := extractPrice("¥1,280", nil); got != "¥1,280" {
+		t.Errorf("no pattern: got %q", got)
+	}
+	profile := SiteProfile{PricePattern: `[0-9,]+円`}
+	re, _ := profile.compilePricePattern()
+	if got := extractPrice("セール 980円", re); got != "980円" {
+		t.Errorf("whole match: got %q", got)
+	}
+	if got := extractPrice("オープン価格", re); got != "" {
+		t.Errorf("no match: got %q", got)
+	}
+}
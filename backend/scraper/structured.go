@@ -0,0 +1,400 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ExtractStructured はページに埋め込まれた構造化データから商品を抽出する
+//
+// 次の順に探し、最初に商品が見つかったものだけを使う:
+//
+//  1. JSON-LD (<script type="application/ld+json">) の schema.org Product
+//  2. microdata (itemscope itemtype="https://schema.org/Product")
+//  3. OpenGraph の og:* / product:* の meta タグ (価格がある場合のみ)
+//
+// 価格は Offer (複数あれば最初の価格付きのもの、AggregateOffer なら lowPrice) から取り、
+// 通貨があれば "1280 JPY" のように通貨コードを付けて Price に入れる (ParsePrice で解釈できる)。
+// 相対 URL は pageURL を基準に解決する。
+func ExtractStructured(doc *goquery.Selection, pageURL *url.URL) []Product {
+	for _, extract := range []func(*goquery.Selection) []structuredProduct{jsonLDProducts, microdataProducts, openGraphProducts} {
+		found := extract(doc)
+		if len(found) == 0 {
+			continue
+		}
+		now := time.Now()
+		products := make([]Product, 0, len(found))
+		for _, sp := range found {
+			if p, ok := sp.product(pageURL, now); ok {
+				products = append(products, p)
+			}
+		}
+		if len(products) > 0 {
+			return products
+		}
+	}
+	return nil
+}
+
+// structuredProduct は構造化データから読んだままの値
+type structuredProduct struct {
+	name, description, url, image string
+	price, currency, availability string
+	gtins                         []string // 優先順 (gtin13 を先に)
+}
+
+func (sp structuredProduct) product(pageURL *url.URL, now time.Time) (Product, bool) {
+	p := Product{
+		Name:         strings.TrimSpace(sp.name),
+		Description:  strings.TrimSpace(sp.description),
+		URL:          resolveURL(pageURL, sp.url),
+		ImageURL:     resolveURL(pageURL, sp.image),
+		Currency:     strings.ToUpper(strings.TrimSpace(sp.currency)),
+		Availability: normalizeAvailability(sp.availability),
+		ScrapedAt:    now,
+	}
+	if p.Name == "" {
+		return Product{}, false
+	}
+	if p.URL == "" && pageURL != nil {
+		p.URL = pageURL.String()
+	}
+	if price := strings.TrimSpace(sp.price); price != "" {
+		p.Price = price
+		if p.Currency != "" {
+			p.Price += " " + p.Currency
+		}
+	}
+	for _, g := range sp.gtins {
+		if g = normalizeGTIN(g); g != "" {
+			p.GTIN = g
+			break
+		}
+	}
+	return p, true
+}
+
+// 商品・Offer の GTIN のプロパティ (JAN は gtin13)
+var gtinProps = []string{"gtin13", "gtin", "gtin12", "gtin14", "gtin8"}
+
+// jsonLDProducts は JSON-LD の Product を探す
+// @graph・配列・ItemList の要素・mainEntity の中も探す (Product の中の関連商品は除く)
+func jsonLDProducts(doc *goquery.Selection) []structuredProduct {
+	var products []structuredProduct
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]interface{}:
+			if hasType(v["@type"], "Product") {
+				products = append(products, jsonLDProduct(v))
+				return
+			}
+			for _, key := range []string{"@graph", "itemListElement", "item", "mainEntity"} {
+				walk(v[key])
+			}
+		}
+	}
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var v interface{}
+		// 壊れた JSON-LD は無視する
+		if json.Unmarshal([]byte(s.Text()), &v) == nil {
+			walk(v)
+		}
+	})
+	return products
+}
+
+func jsonLDProduct(v map[string]interface{}) structuredProduct {
+	sp := structuredProduct{
+		name:        ldString(v["name"]),
+		description: ldString(v["description"]),
+		url:         ldString(v["url"]),
+		image:       ldString(v["image"]),
+	}
+	offer := firstOffer(v["offers"])
+	for _, key := range gtinProps {
+		sp.gtins = append(sp.gtins, ldString(v[key]), ldString(offer[key]))
+	}
+	if offer == nil {
+		return sp
+	}
+	sp.price = ldString(offer["price"])
+	if sp.price == "" {
+		sp.price = ldString(offer["lowPrice"])
+	}
+	sp.currency = ldString(offer["priceCurrency"])
+	if spec, ok := offer["priceSpecification"].(map[string]interface{}); ok {
+		if sp.price == "" {
+			sp.price = ldString(spec["price"])
+		}
+		if sp.currency == "" {
+			sp.currency = ldString(spec["priceCurrency"])
+		}
+	}
+	sp.availability = ldString(offer["availability"])
+	if sp.url == "" {
+		sp.url = ldString(offer["url"])
+	}
+	return sp
+}
+
+// firstOffer は offers (Offer, AggregateOffer またはその配列) から価格のある最初の Offer を返す
+func firstOffer(v interface{}) map[string]interface{} {
+	var first map[string]interface{}
+	offers, ok := v.([]interface{})
+	if !ok {
+		offers = []interface{}{v}
+	}
+	for _, o := range offers {
+		offer, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if first == nil {
+			first = offer
+		}
+		if ldString(offer["price"]) != "" || ldString(offer["lowPrice"]) != "" {
+			return offer
+		}
+		if spec, ok := offer["priceSpecification"].(map[string]interface{}); ok && ldString(spec["price"]) != "" {
+			return offer
+		}
+	}
+	return first
+}
+
+// hasType は @type ("Product" または ["Product", ...]) に typ が含まれるか
+// "schema:Product" や "https://schema.org/Product" の表記も受け付ける
+func hasType(v interface{}, typ string) bool {
+	types, ok := v.([]interface{})
+	if !ok {
+		types = []interface{}{v}
+	}
+	for _, t := range types {
+		s, _ := t.(string)
+		if s == typ || strings.HasSuffix(s, "/"+typ) || strings.HasSuffix(s, ":"+typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// ldString は JSON-LD の値を文字列にする
+// 数値はそのまま、配列は最初の値、オブジェクトは @value / url / contentUrl / name を使う
+func ldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		for _, e := range v {
+			if s := ldString(e); s != "" {
+				return s
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"@value", "url", "contentUrl", "name"} {
+			if s := ldString(v[key]); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// microdataProducts は itemtype が schema.org/Product の要素を探す
+// 他の Product の中にある Product (関連商品など) は除く
+func microdataProducts(doc *goquery.Selection) []structuredProduct {
+	var products []structuredProduct
+	isProduct := func(_ int, s *goquery.Selection) bool {
+		return hasItemType(s, "Product")
+	}
+	doc.Find("[itemscope][itemtype]").FilterFunction(isProduct).Each(func(_ int, item *goquery.Selection) {
+		if item.ParentsFiltered("[itemscope][itemtype]").FilterFunction(isProduct).Length() > 0 {
+			return
+		}
+		sp := structuredProduct{
+			name:        propValue(itemProp(item, "name")),
+			description: propValue(itemProp(item, "description")),
+			url:         propValue(itemProp(item, "url")),
+			image:       propValue(itemProp(item, "image")),
+		}
+		offer := itemProp(item, "offers")
+		for _, name := range gtinProps {
+			sp.gtins = append(sp.gtins, propValue(itemProp(item, name)), propValue(itemProp(offer, name)))
+		}
+		sp.price = propValue(itemProp(offer, "price"))
+		if sp.price == "" {
+			sp.price = propValue(itemProp(offer, "lowPrice"))
+		}
+		sp.currency = propValue(itemProp(offer, "priceCurrency"))
+		sp.availability = propValue(itemProp(offer, "availability"))
+		products = append(products, sp)
+	})
+	return products
+}
+
+func hasItemType(s *goquery.Selection, typ string) bool {
+	for _, t := range strings.Fields(s.AttrOr("itemtype", "")) {
+		if strings.HasSuffix(t, "schema.org/"+typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// itemProp は item の直接のプロパティ name の最初の要素を返す
+// (item の中の別の itemscope のプロパティは含めない)
+func itemProp(item *goquery.Selection, name string) *goquery.Selection {
+	if item.Length() == 0 {
+		return item
+	}
+	return item.Find("[itemprop]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		for _, p := range strings.Fields(s.AttrOr("itemprop", "")) {
+			if p == name {
+				return s.Parent().Closest("[itemscope]").IsSelection(item)
+			}
+		}
+		return false
+	}).First()
+}
+
+// propValue は microdata のプロパティの値を要素の種類に応じて読む
+func propValue(s *goquery.Selection) string {
+	if s.Length() == 0 {
+		return ""
+	}
+	if v, ok := s.Attr("content"); ok {
+		return strings.TrimSpace(v)
+	}
+	var attr string
+	switch goquery.NodeName(s) {
+	case "a", "area", "link":
+		attr = "href"
+	case "img", "audio", "video", "source", "iframe", "embed":
+		attr = "src"
+	case "time":
+		attr = "datetime"
+	case "data", "meter":
+		attr = "value"
+	}
+	if v, ok := s.Attr(attr); attr != "" && ok {
+		return strings.TrimSpace(v)
+	}
+	return strings.TrimSpace(s.Text())
+}
+
+// openGraphProducts は og:* / product:* の meta タグからページの商品を1件作る
+// 商品以外のページの og:title を拾わないよう、価格が無ければ商品としない
+func openGraphProducts(doc *goquery.Selection) []structuredProduct {
+	meta := func(names ...string) string {
+		for _, name := range names {
+			sel := doc.Find(`meta[property="` + name + `"], meta[name="` + name + `"]`)
+			if v := strings.TrimSpace(sel.AttrOr("content", "")); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	price := meta("product:price:amount", "og:price:amount", "product:sale_price:amount")
+	if price == "" {
+		return nil
+	}
+	return []structuredProduct{{
+		name:         meta("og:title"),
+		description:  meta("og:description"),
+		url:          meta("og:url"),
+		image:        meta("og:image", "og:image:url", "og:image:secure_url"),
+		price:        price,
+		currency:     meta("product:price:currency", "og:price:currency", "product:sale_price:currency"),
+		availability: meta("product:availability", "og:availability"),
+		gtins:        []string{meta("product:ean"), meta("product:gtin"), meta("product:upc")},
+	}}
+}
+
+// schema.org の在庫状況 (ItemAvailability)。OpenGraph の表記 ("in stock", "oos" など) も対応する
+var availabilities = map[string]string{
+	"instock":             "InStock",
+	"outofstock":          "OutOfStock",
+	"oos":                 "OutOfStock",
+	"soldout":             "SoldOut",
+	"preorder":            "PreOrder",
+	"presale":             "PreSale",
+	"backorder":           "BackOrder",
+	"discontinued":        "Discontinued",
+	"limitedavailability": "LimitedAvailability",
+	"onlineonly":          "OnlineOnly",
+	"instoreonly":         "InStoreOnly",
+	"madetoorder":         "MadeToOrder",
+}
+
+// normalizeAvailability は "https://schema.org/InStock" や "in stock" を "InStock" にそろえる
+// 知らない値はそのまま返す
+func normalizeAvailability(v string) string {
+	v = strings.TrimSpace(v)
+	if i := strings.LastIndexAny(v, "/:"); i >= 0 {
+		v = v[i+1:]
+	}
+	key := strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(v))
+	if a, ok := availabilities[key]; ok {
+		return a
+	}
+	return v
+}
+
+// normalizeGTIN は数字以外 (空白・ハイフン) を除き、桁数とチェックディジットが正しければ返す
+func normalizeGTIN(v string) string {
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return r
+		case r == ' ' || r == '-':
+			return -1
+		}
+		return 'x'
+	}, v)
+	if strings.Contains(digits, "x") {
+		return ""
+	}
+	switch len(digits) {
+	case 8, 12, 13, 14:
+	default:
+		return ""
+	}
+	// 末尾から数えて奇数桁目 (チェックディジットを除く) に3を掛ける
+	sum := 0
+	for i := len(digits) - 2; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-2-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	if (10-sum%10)%10 != int(digits[len(digits)-1]-'0') {
+		return ""
+	}
+	return digits
+}
+
+// resolveURL は ref を base からの URL に解決する
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
@@ -0,0 +1,201 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func extract(t *testing.T, html string) []Product {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := url.Parse("https://shop.example.com/items/1")
+	return ExtractStructured(doc.Selection, page)
+}
+
+func TestExtractJSONLD(t *testing.T) {
+	products := extract(t, `<html><head>
+<script type="application/ld+json">{"@context": "https://schema.org", "@type": "BreadcrumbList"}</script>
+<script type="application/ld+json">{broken</script>
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@graph": [
+  {"@type": "WebPage", "name": "ページ"},
+  {"@type": ["Product", "Thing"], "name": "コーヒーミル", "image": ["/img/mill.jpg"], "gtin13": "4901234567894",
+   "description": "手挽き", "brand": {"@type": "Brand", "name": "Kakeibo"},
+   "offers": {"@type": "Offer", "price": 4980, "priceCurrency": "JPY", "availability": "https://schema.org/InStock"},
+   "isRelatedTo": {"@type": "Product", "name": "フィルター"}}
+]}
+</script></head><body></body></html>`)
+	if len(products) != 1 {
+		t.Fatalf("got %d products, want 1: %+v", len(products), products)
+	}
+	p := products[0]
+	want := Product{
+		Name:         "コーヒーミル",
+		Price:        "4980 JPY",
+		URL:          "https://shop.example.com/items/1",
+		ImageURL:     "https://shop.example.com/img/mill.jpg",
+		Description:  "手挽き",
+		Currency:     "JPY",
+		Availability: "InStock",
+		GTIN:         "4901234567894",
+		ScrapedAt:    p.ScrapedAt,
+	}
+	if p != want {
+		t.Errorf("got  %+v\nwant %+v", p, want)
+	}
+	if price, err := ParsePrice(p.Price); err != nil || price.Amount != 4980 || price.Currency != "JPY" {
+		t.Errorf("ParsePrice(%q) = %+v, %v", p.Price, price, err)
+	}
+}
+
+func TestExtractJSONLDOffers(t *testing.T) {
+	products := extract(t, `<script type="application/ld+json">[
+  {"@type": "Product", "name": "セット", "url": "/items/set",
+   "offers": {"@type": "AggregateOffer", "lowPrice": "12.50", "highPrice": "20", "priceCurrency": "usd"}},
+  {"@type": "Product", "name": "単品",
+   "offers": [{"@type": "Offer", "availability": "SoldOut"},
+              {"@type": "Offer", "priceSpecification": {"price": "980", "priceCurrency": "JPY"}, "gtin": "invalid"}]},
+  {"@type": "Product", "name": "価格なし"}
+]</script>`)
+	if len(products) != 3 {
+		t.Fatalf("got %d products, want 3: %+v", len(products), products)
+	}
+	if p := products[0]; p.Price != "12.50 USD" || p.URL != "https://shop.example.com/items/set" {
+		t.Errorf("aggregate offer: %+v", p)
+	}
+	if p := products[1]; p.Price != "980 JPY" || p.GTIN != "" {
+		t.Errorf("offer with price should be used: %+v", p)
+	}
+	if p := products[2]; p.Price != "" || p.URL != "https://shop.example.com/items/1" {
+		t.Errorf("product without offers: %+v", p)
+	}
+}
+
+func TestExtractMicrodata(t *testing.T) {
+	products := extract(t, `<html><body>
+<div itemscope itemtype="https://schema.org/Product">
+  <h1 itemprop="name">緑茶 100g</h1>
+  <img itemprop="image" src="/img/tea.jpg">
+  <a itemprop="url" href="/items/tea">詳細</a>
+  <meta itemprop="gtin13" content="4500000000018">
+  <div itemprop="brand" itemscope itemtype="https://schema.org/Brand"><span itemprop="name">茶園</span></div>
+  <div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+    <span itemprop="price" content="1280">¥1,280</span>
+    <meta itemprop="priceCurrency" content="JPY">
+    <link itemprop="availability" href="https://schema.org/OutOfStock">
+  </div>
+  <div itemscope itemtype="https://schema.org/Product"><span itemprop="name">関連商品</span></div>
+</div>
+</body></html>`)
+	if len(products) != 1 {
+		t.Fatalf("got %d products, want 1: %+v", len(products), products)
+	}
+	p := products[0]
+	if p.Name != "緑茶 100g" || p.Price != "1280 JPY" || p.URL != "https://shop.example.com/items/tea" ||
+		p.ImageURL != "https://shop.example.com/img/tea.jpg" || p.Availability != "OutOfStock" || p.GTIN != "4500000000018" {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestExtractOpenGraph(t *testing.T) {
+	products := extract(t, `<html><head>
+<meta property="og:title" content="電気ケトル">
+<meta property="og:image" content="https://cdn.example.com/kettle.jpg">
+<meta property="product:price:amount" content="3,980">
+<meta property="product:price:currency" content="JPY">
+<meta property="product:availability" content="in stock">
+<meta property="product:ean" content="4901234567894">
+</head></html>`)
+	if len(products) != 1 {
+		t.Fatalf("got %d products, want 1", len(products))
+	}
+	p := products[0]
+	if p.Name != "電気ケトル" || p.Price != "3,980 JPY" || p.Availability != "InStock" || p.GTIN != "4901234567894" ||
+		p.ImageURL != "https://cdn.example.com/kettle.jpg" || p.URL != "https://shop.example.com/items/1" {
+		t.Errorf("got %+v", p)
+	}
+
+	// 価格の無い OpenGraph は商品としない (記事ページなど)
+	if products := extract(t, `<meta property="og:title" content="お知らせ">`); len(products) != 0 {
+		t.Errorf("got %+v, want none", products)
+	}
+}
+
+// TestExtractStructuredPriority は JSON-LD があれば microdata・OpenGraph を使わないことのテスト
+func TestExtractStructuredPriority(t *testing.T) {
+	products := extract(t, `<html><head>
+<meta property="og:title" content="OG">
+<meta property="product:price:amount" content="100">
+<script type="application/ld+json">{"@type": "Product", "name": "JSON-LD", "offers": {"price": "200"}}</script>
+</head><body><div itemscope itemtype="http://schema.org/Product"><span itemprop="name">microdata</span></div></body></html>`)
+	if len(products) != 1 || products[0].Name != "JSON-LD" || products[0].Price != "200" {
+		t.Errorf("got %+v", products)
+	}
+}
+
+func TestNormalizeGTIN(t *testing.T) {
+	cases := map[string]string{
+		"4901234567894":    "4901234567894",
+		"4901-2345-67894":  "4901234567894",
+		"96385074":         "96385074",
+		"4901234567895":    "", // チェックディジットが誤り
+		"490123456789":     "", // 桁数が誤り (12桁としてチェックディジットが合わない)
+		"49012345678A":     "",
+		"":                 "",
+		"04901234567894":   "04901234567894",
+		" 4500000000018 ":  "4500000000018",
+		"4500000000018/ab": "",
+	}
+	for in, want := range cases {
+		if got := normalizeGTIN(in); got != want {
+			t.Errorf("normalizeGTIN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeAvailability(t *testing.T) {
+	cases := map[string]string{
+		"https://schema.org/InStock": "InStock",
+		"http://schema.org/PreOrder": "PreOrder",
+		"schema:BackOrder":           "BackOrder",
+		"in stock":                   "InStock",
+		"out of stock":               "OutOfStock",
+		"oos":                        "OutOfStock",
+		"in_stock":                   "InStock",
+		"Reserved":                   "Reserved",
+		"":                           "",
+	}
+	for in, want := range cases {
+		if got := normalizeAvailability(in); got != want {
+			t.Errorf("normalizeAvailability(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestScrapeStructured(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><script type="application/ld+json">
+{"@type": "Product", "name": "ドリッパー", "offers": {"price": "1650", "priceCurrency": "JPY"}}
+</script></head><body><a class="next-page" href="/page2">次へ</a></body></html>`)
+	}))
+	defer server.Close()
+
+	products, err := newTestScraper().ScrapeStructured(context.Background(), server.URL+"/items/dripper", Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 || products[0].Name != "ドリッパー" || products[0].URL != server.URL+"/items/dripper" {
+		t.Errorf("got %+v", products)
+	}
+}
@@ -0,0 +1,154 @@
+// Package suggest は支出の内容からカテゴリを推測する
+//
+// ユーザーごとに、分類済みの支出の内容の文字 n-gram を特徴量とするナイーブベイズ分類器を学習する。
+// 店名は単語に区切れない日本語や略称 (「ｾﾌﾞﾝ」「ｾﾌﾞﾝｲﾚﾌﾞﾝ」) が多いため、単語ではなく文字の並びで比べる。
+package suggest
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ngramSizes は特徴量にする n-gram の長さ
+var ngramSizes = []int{2, 3}
+
+// Model は多項ナイーブベイズ分類器 (ラプラス平滑化)
+// Train と Untrain で1件ずつ学習・取り消しができる。並行に使う場合は呼び出し側で排他する
+type Model struct {
+	docs   map[uuid.UUID]int            // カテゴリごとの学習した支出の数
+	counts map[uuid.UUID]map[string]int // カテゴリごとの n-gram の出現数
+	totals map[uuid.UUID]int            // カテゴリごとの n-gram の出現数の合計
+	vocab  map[string]int               // n-gram ごとの出現数 (全カテゴリ)
+	n      int                          // 学習した支出の数
+}
+
+// NewModel は何も学習していない Model を返す
+func NewModel() *Model {
+	return &Model{
+		docs:   map[uuid.UUID]int{},
+		counts: map[uuid.UUID]map[string]int{},
+		totals: map[uuid.UUID]int{},
+		vocab:  map[string]int{},
+	}
+}
+
+// Len は学習した支出の数を返す
+func (m *Model) Len() int { return m.n }
+
+// Train は内容 description の支出が categoryID に分類されていることを学習する
+func (m *Model) Train(description string, categoryID uuid.UUID) {
+	grams := Ngrams(description)
+	if len(grams) == 0 {
+		return
+	}
+	m.n++
+	m.docs[categoryID]++
+	if m.counts[categoryID] == nil {
+		m.counts[categoryID] = map[string]int{}
+	}
+	for _, g := range grams {
+		m.counts[categoryID][g]++
+		m.totals[categoryID]++
+		m.vocab[g]++
+	}
+}
+
+// Untrain は Train した支出を取り消す (支出の変更・削除)
+func (m *Model) Untrain(description string, categoryID uuid.UUID) {
+	grams := Ngrams(description)
+	if len(grams) == 0 || m.docs[categoryID] == 0 {
+		return
+	}
+	m.n--
+	if m.docs[categoryID]--; m.docs[categoryID] == 0 {
+		delete(m.docs, categoryID)
+	}
+	counts := m.counts[categoryID]
+	for _, g := range grams {
+		if counts[g] > 0 {
+			if counts[g]--; counts[g] == 0 {
+				delete(counts, g)
+			}
+			m.totals[categoryID]--
+			if m.vocab[g]--; m.vocab[g] == 0 {
+				delete(m.vocab, g)
+			}
+		}
+	}
+	if len(counts) == 0 {
+		delete(m.counts, categoryID)
+		delete(m.totals, categoryID)
+	}
+}
+
+// Suggestion は推測したカテゴリと確信度 (0〜1、全カテゴリの合計が1)
+type Suggestion struct {
+	CategoryID uuid.UUID `json:"category_id"`
+	Confidence float64   `json:"confidence"`
+}
+
+// Predict は description のカテゴリを確信度の高い順に返す (学習していなければ空)
+func (m *Model) Predict(description string) []Suggestion {
+	grams := Ngrams(description)
+	if m.n == 0 || len(grams) == 0 {
+		return []Suggestion{}
+	}
+	vocab := float64(len(m.vocab))
+	scores := make(map[uuid.UUID]float64, len(m.docs))
+	max := math.Inf(-1)
+	for categoryID, docs := range m.docs {
+		score := math.Log(float64(docs) / float64(m.n))
+		denominator := float64(m.totals[categoryID]) + vocab
+		for _, g := range grams {
+			score += math.Log((float64(m.counts[categoryID][g]) + 1) / denominator)
+		}
+		scores[categoryID] = score
+		if score > max {
+			max = score
+		}
+	}
+	// 対数のまま指数にすると桁あふれするため、最大値を引いてから正規化する
+	sum := 0.0
+	for categoryID, score := range scores {
+		scores[categoryID] = math.Exp(score - max)
+		sum += scores[categoryID]
+	}
+	suggestions := make([]Suggestion, 0, len(scores))
+	for categoryID, score := range scores {
+		suggestions = append(suggestions, Suggestion{CategoryID: categoryID, Confidence: score / sum})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Confidence != suggestions[j].Confidence {
+			return suggestions[i].Confidence > suggestions[j].Confidence
+		}
+		return suggestions[i].CategoryID.String() < suggestions[j].CategoryID.String()
+	})
+	return suggestions
+}
+
+// Ngrams は description の文字 n-gram を返す
+// 全角・半角 (NFKC)、大文字・小文字をそろえ、空白と記号を除く。先頭と末尾には境界の印を付ける
+func Ngrams(description string) []string {
+	s := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return -1
+		}
+		return r
+	}, strings.ToLower(norm.NFKC.String(description)))
+	if s == "" {
+		return nil
+	}
+	runes := []rune("^" + s + "$")
+	var grams []string
+	for _, n := range ngramSizes {
+		for i := 0; i+n <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+n]))
+		}
+	}
+	return grams
+}
@@ -0,0 +1,188 @@
+package suggest
+
+import (
+	"kakeibo-backend/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.Category{}, &models.Expense{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestNgrams(t *testing.T) {
+	got := Ngrams("ｾﾌﾞﾝ-A")
+	want := []string{"^セ", "セブ", "ブン", "ンa", "a$", "^セブ", "セブン", "ブンa", "ンa$"}
+	if len(got) != len(want) {
+		t.Fatalf("Ngrams = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Ngrams[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if got := Ngrams(" ・ "); got != nil {
+		t.Errorf("Ngrams of symbols = %q, want nil", got)
+	}
+}
+
+func TestModelPredict(t *testing.T) {
+	food, transport, books := uuid.New(), uuid.New(), uuid.New()
+	m := NewModel()
+	if got := m.Predict("セブンイレブン"); len(got) != 0 {
+		t.Errorf("untrained model predicted %+v", got)
+	}
+	for _, s := range []struct {
+		description string
+		category    uuid.UUID
+	}{
+		{"セブンイレブン 渋谷店", food},
+		{"ｾﾌﾞﾝｲﾚﾌﾞﾝ", food},
+		{"ファミリーマート", food},
+		{"ローソン", food},
+		{"JR東日本 モバイルSuica", transport},
+		{"東京メトロ", transport},
+		{"JR東日本", transport},
+		{"紀伊國屋書店", books},
+	} {
+		m.Train(s.description, s.category)
+	}
+	if m.Len() != 8 {
+		t.Errorf("Len = %d, want 8", m.Len())
+	}
+
+	cases := map[string]uuid.UUID{
+		"セブンイレブン 新宿店": food,
+		"ＪＲ東日本":       transport,
+		"ファミマ":        food,
+		"書店":          books,
+	}
+	for description, want := range cases {
+		got := m.Predict(description)
+		if len(got) != 3 || got[0].CategoryID != want {
+			t.Errorf("Predict(%q) = %+v, want %s first", description, got, want)
+			continue
+		}
+		sum := 0.0
+		for _, s := range got {
+			sum += s.Confidence
+		}
+		if sum < 0.999 || sum > 1.001 || got[0].Confidence < got[1].Confidence {
+			t.Errorf("Predict(%q) confidences = %+v", description, got)
+		}
+	}
+
+	// 取り消すと学習する前と同じになる
+	m.Untrain("紀伊國屋書店", books)
+	if got := m.Predict("書店"); len(got) != 2 {
+		t.Errorf("after untrain: %+v, want 2 categories", got)
+	}
+	for _, c := range m.counts {
+		for g, n := range c {
+			if n <= 0 {
+				t.Errorf("count of %q is %d", g, n)
+			}
+		}
+	}
+}
+
+func TestSuggesterSync(t *testing.T) {
+	db := newTestDB(t)
+	user := models.User{Name: "taro", Email: "taro@example.com", Password: "x"}
+	other := models.User{Name: "hanako", Email: "hanako@example.com", Password: "x"}
+	food := models.Category{Name: "食費"}
+	books := models.Category{Name: "書籍"}
+	for _, v := range []interface{}{&user, &other, &food, &books} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	create := func(userID uuid.UUID, description string, categoryID uuid.UUID) models.Expense {
+		e := models.Expense{Amount: 100, Description: description, SpentAt: time.Now(), UserID: userID, CategoryID: categoryID}
+		if err := db.Create(&e).Error; err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	create(user.ID, "セブンイレブン", food.ID)
+	bookstore := create(user.ID, "紀伊國屋書店", food.ID) // 間違えて食費にした
+	create(other.ID, "丸善書店", books.ID)              // 他人の履歴は使わない
+
+	s := &Suggester{DB: db}
+	got, trained, err := s.Suggest(user.ID, "書店", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trained != 2 || len(got) != 1 || got[0].CategoryID != food.ID {
+		t.Errorf("before fix: %+v (trained %d)", got, trained)
+	}
+
+	// カテゴリを直すと、次の推測から反映される
+	if err := db.Model(&models.Expense{}).Where("id = ?", bookstore.ID).Update("category_id", books.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	create(user.ID, "ジュンク堂書店", books.ID)
+	got, trained, err = s.Suggest(user.ID, "書店", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trained != 3 || len(got) != 1 || got[0].CategoryID != books.ID {
+		t.Errorf("after fix: %+v (trained %d)", got, trained)
+	}
+
+	// 長いトランザクションで、前回の推測より前の updated_at の支出が後からコミットされても学習する
+	late := models.Expense{Amount: 100, Description: "三省堂書店", SpentAt: time.Now(), UserID: user.ID, CategoryID: books.ID}
+	late.CreatedAt = time.Now().Add(-time.Hour)
+	late.UpdatedAt = late.CreatedAt
+	if err := db.Create(&late).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, trained, err = s.Suggest(user.ID, "書店", 0); err != nil {
+		t.Fatal(err)
+	}
+	if trained != 4 {
+		t.Errorf("late commit: trained %d, want 4", trained)
+	}
+
+	// 削除した支出は学習から除く (物理削除も)
+	db.Where("category_id = ? AND user_id = ? AND id <> ?", books.ID, user.ID, late.ID).Delete(&models.Expense{})
+	db.Unscoped().Delete(&late)
+	got, trained, err = s.Suggest(user.ID, "書店", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trained != 1 || len(got) != 1 || got[0].CategoryID != food.ID {
+		t.Errorf("after delete: %+v (trained %d)", got, trained)
+	}
+}
+
+func TestSuggesterEvictsLeastRecentlyUsed(t *testing.T) {
+	db := newTestDB(t)
+	s := &Suggester{DB: db, MaxUsers: 2}
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{a, b, a, c} {
+		if _, _, err := s.Suggest(id, "書店", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.users) != 2 || s.users[a] == nil || s.users[c] == nil {
+		t.Errorf("cached users = %v, want a and c", s.users)
+	}
+}
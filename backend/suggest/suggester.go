@@ -0,0 +1,155 @@
+package suggest
+
+import (
+	"kakeibo-backend/models"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultMaxUsers は Suggester.MaxUsers の既定値
+const DefaultMaxUsers = 1000
+
+// maxChangedIDs は変わった支出を ID で指定して読み直す数の上限 (プレースホルダの数の制限のため)
+const maxChangedIDs = 500
+
+// Suggester はユーザーごとの Model をメモリに持ち、支出の保存に合わせて少しずつ学習し直す
+//
+// 推測のたびにユーザーの支出の ID・カテゴリ・updated_at だけを読み、学習した時と比べて
+// 追加・変更された支出は読み直して学習し直し、無くなった (削除された) 支出は学習を取り消す。
+// updated_at の範囲で絞り込まないため、長いトランザクション (明細の取り込みなど) が後からコミットされても取りこぼさない。
+// 支出を保存する経路 (登録・取り込み・規則の適用・カテゴリの統合など) ごとに学習を呼び出す必要は無い。
+type Suggester struct {
+	DB *gorm.DB
+	// MaxUsers はメモリに持つ Model の数の上限。超えたら最も長く使っていないユーザーの Model を捨てる。0 なら DefaultMaxUsers
+	MaxUsers int
+
+	mu    sync.Mutex
+	users map[uuid.UUID]*userModel
+	clock uint64 // 使った順を表す通し番号
+}
+
+// sample は支出を学習した時の内容とカテゴリ (取り消しに使う)
+type sample struct {
+	description string
+	categoryID  uuid.UUID
+	updatedAt   time.Time
+}
+
+type userModel struct {
+	mu      sync.Mutex
+	model   *Model
+	trained map[uuid.UUID]sample
+	usedAt  uint64 // Suggester.mu で保護する
+}
+
+// Suggest は userID の支出の履歴から description のカテゴリを確信度の高い順に最大 limit 件返す
+// 2つ目の戻り値は学習した支出の数
+func (s *Suggester) Suggest(userID uuid.UUID, description string, limit int) ([]Suggestion, int, error) {
+	u := s.user(userID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := s.sync(userID, u); err != nil {
+		return nil, 0, err
+	}
+	suggestions := u.model.Predict(description)
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, u.model.Len(), nil
+}
+
+func (s *Suggester) user(userID uuid.UUID) *userModel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.users == nil {
+		s.users = map[uuid.UUID]*userModel{}
+	}
+	s.clock++
+	u, ok := s.users[userID]
+	if !ok {
+		s.evict()
+		u = &userModel{model: NewModel(), trained: map[uuid.UUID]sample{}}
+		s.users[userID] = u
+	}
+	u.usedAt = s.clock
+	return u
+}
+
+// evict は Model の数が上限に達していれば、最も長く使っていないものを捨てる (s.mu を持って呼ぶ)
+// 捨てた Model を使っている最中の推測はそのまま終わり、次の推測で学習し直す
+func (s *Suggester) evict() {
+	max := s.MaxUsers
+	if max <= 0 {
+		max = DefaultMaxUsers
+	}
+	for len(s.users) >= max {
+		var oldest uuid.UUID
+		var usedAt uint64
+		for id, u := range s.users {
+			if usedAt == 0 || u.usedAt < usedAt {
+				oldest, usedAt = id, u.usedAt
+			}
+		}
+		delete(s.users, oldest)
+	}
+}
+
+// sync はユーザーの今の支出と学習した支出の差分を u に反映する
+func (s *Suggester) sync(userID uuid.UUID, u *userModel) error {
+	var current []models.Expense
+	if err := s.DB.Model(&models.Expense{}).
+		Select("id", "category_id", "updated_at").
+		Where("user_id = ?", userID).
+		Find(&current).Error; err != nil {
+		return err
+	}
+
+	seen := make(map[uuid.UUID]bool, len(current))
+	changed := map[uuid.UUID]bool{}
+	for _, e := range current {
+		seen[e.ID] = true
+		prev, ok := u.trained[e.ID]
+		if !ok || prev.categoryID != e.CategoryID || !prev.updatedAt.Equal(e.UpdatedAt) {
+			changed[e.ID] = true
+		}
+	}
+	for id, prev := range u.trained {
+		if !seen[id] {
+			u.model.Untrain(prev.description, prev.categoryID)
+			delete(u.trained, id)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	// 最初の同期など変わった支出が多ければ、ID を並べずにユーザーの支出をすべて読む
+	query := s.DB.Model(&models.Expense{}).
+		Select("id", "description", "category_id", "updated_at").
+		Where("user_id = ?", userID)
+	if len(changed) <= maxChangedIDs {
+		ids := make([]uuid.UUID, 0, len(changed))
+		for id := range changed {
+			ids = append(ids, id)
+		}
+		query = query.Where("id IN ?", ids)
+	}
+	var expenses []models.Expense
+	if err := query.Find(&expenses).Error; err != nil {
+		return err
+	}
+	for _, e := range expenses {
+		if !changed[e.ID] {
+			continue
+		}
+		if prev, ok := u.trained[e.ID]; ok {
+			u.model.Untrain(prev.description, prev.categoryID)
+		}
+		u.model.Train(e.Description, e.CategoryID)
+		u.trained[e.ID] = sample{description: e.Description, categoryID: e.CategoryID, updatedAt: e.UpdatedAt}
+	}
+	return nil
+}